@@ -0,0 +1,275 @@
+package bootstrap
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"seanmcapp/repository"
+	"seanmcapp/service"
+	"seanmcapp/util"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const cliUsage = `usage: seanmcapp [command]
+
+Without a command the server starts. Commands:
+  migrate up | down [steps] | status
+  job run news|stock|instagram|digest
+  wallet export [csv|json]
+  stock refresh
+  config check`
+
+// Exit codes of RunCLI.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// usageError is a command line that could not be understood, as opposed to a
+// command that ran and failed.
+type usageError string
+
+func (e usageError) Error() string { return "usage: " + string(e) }
+
+// cliEnv hands commands what they need on demand, so a command only loads
+// and connects to what it uses.
+type cliEnv struct {
+	settings func() util.AppsSettings
+	openDB   func(util.DatabaseSettings) *sql.DB
+	services func(util.AppsSettings) (MainServices, *sql.DB)
+}
+
+var defaultCLIEnv = cliEnv{
+	settings: util.GetAppSettings,
+	openDB:   OpenDB,
+	services: GetMainServices,
+}
+
+// RunCLI runs the management command in args (os.Args[1:]) with the same
+// wiring as the server and returns the process exit code. Ctrl-C cancels a
+// command that talks to the database or the network.
+func RunCLI(args []string, out io.Writer) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return exitCode(runCLI(ctx, defaultCLIEnv, args, out), os.Stderr)
+}
+
+func exitCode(err error, errOut io.Writer) int {
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		fmt.Fprintf(errOut, "%v\n\n%s\n", err, cliUsage)
+		return exitUsage
+	default:
+		fmt.Fprintf(errOut, "error: %v\n", err)
+		return exitError
+	}
+}
+
+func runCLI(ctx context.Context, env cliEnv, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageError("no command given")
+	}
+	command, args := args[0], args[1:]
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+
+	switch {
+	case command == "migrate":
+		settings := env.settings()
+		if settings.DBSettings.Backend == util.BackendMemory {
+			return errors.New("migrations only apply to the postgres backend")
+		}
+		db := env.openDB(settings.DBSettings)
+		defer db.Close()
+		return runMigrate(db, args, out)
+	case command == "job" && sub == "run" && len(args) == 2:
+		services, db := env.services(env.settings())
+		defer closeDB(db)
+		return runJob(ctx, services, args[1])
+	case command == "wallet" && sub == "export" && len(args) <= 2:
+		format := "csv"
+		if len(args) == 2 {
+			format = args[1]
+		}
+		if format != "csv" && format != "json" {
+			return usageError(fmt.Sprintf("unknown export format %q", format))
+		}
+		services, db := env.services(env.settings())
+		defer closeDB(db)
+		return exportWallets(ctx, services.WalletService, format, out)
+	case command == "stock" && sub == "refresh" && len(args) == 1:
+		services, db := env.services(env.settings())
+		defer closeDB(db)
+		return refreshStocks(ctx, services.StockService, out)
+	case command == "config" && sub == "check" && len(args) == 1:
+		// Loading the settings exits listing every invalid one.
+		settings := env.settings()
+		if settings.DBSettings.Backend == util.BackendMemory {
+			return checkConfig(settings, nil, out)
+		}
+		db := env.openDB(settings.DBSettings)
+		defer db.Close()
+		migrator, err := repository.NewMigrator(db)
+		if err != nil {
+			return err
+		}
+		return checkConfig(settings, migrator, out)
+	case command == "help" || command == "-h" || command == "--help":
+		fmt.Fprintln(out, cliUsage)
+		return nil
+	default:
+		return usageError(fmt.Sprintf("unknown command %q", strings.Join(append([]string{command}, args...), " ")))
+	}
+}
+
+// closeDB closes the database of GetMainServices, which is nil with the memory
+// backend.
+func closeDB(db *sql.DB) {
+	if db != nil {
+		db.Close()
+	}
+}
+
+// jobs are the scheduled tasks that can be run by name.
+func jobs(services MainServices) map[string]ScheduledTask {
+	return map[string]ScheduledTask{
+		"news":      services.NewsService,
+		"stock":     services.StockService,
+		"instagram": services.InstagramService,
+		"digest":    services.DigestService,
+	}
+}
+
+// runJob runs one scheduled task once, as the scheduler would, and returns
+// its failure or panic as an error.
+func runJob(ctx context.Context, services MainServices, name string) error {
+	task, ok := jobs(services)[name]
+	if !ok {
+		return usageError(fmt.Sprintf("unknown job %q", name))
+	}
+	if task == nil {
+		return turnedOff(name)
+	}
+	return services.Jobs.Run(ctx, name, repository.TriggerManual, task)
+}
+
+// turnedOff is the error of a command whose feature this configuration does
+// not wire.
+func turnedOff(job string) error {
+	return fmt.Errorf("job %s is turned off in this configuration", job)
+}
+
+func exportWallets(ctx context.Context, wallets service.WalletService, format string, out io.Writer) error {
+	entries, err := wallets.Export(ctx)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"id", "date", "name", "category", "currency", "amount", "done", "account"})
+	for _, e := range entries {
+		id := ""
+		if e.ID != nil {
+			id = strconv.Itoa(*e.ID)
+		}
+		_ = w.Write([]string{id, strconv.Itoa(e.Date), e.Name, e.Category, e.Currency, strconv.Itoa(e.Amount), strconv.FormatBool(e.Done), e.Account})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func refreshStocks(ctx context.Context, stocks service.StockService, out io.Writer) error {
+	if stocks == nil {
+		return turnedOff("stock")
+	}
+	refreshed, err := stocks.RefreshPrices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range refreshed {
+		price := "-"
+		if s.CurrentPrice != nil {
+			price = strconv.FormatInt(*s.CurrentPrice, 10)
+		}
+		fmt.Fprintf(out, "%-6s %8s\n", s.Name, price)
+	}
+	return nil
+}
+
+// checkConfig reports what the loaded settings turn on and checks the
+// database schema matches this build, unless migrator is nil as it is with the
+// memory backend. Secrets are never printed.
+func checkConfig(settings util.AppsSettings, migrator *repository.Migrator, out io.Writer) error {
+	features := settings.Features
+	if migrator == nil {
+		file := settings.DBSettings.File
+		if file == "" {
+			file = "nothing kept across restarts"
+		}
+		fmt.Fprintf(out, "database:  in memory (%s)\n", file)
+	} else {
+		fmt.Fprintf(out, "database:  %s/%s (auto-migrate %t)\n", settings.DBSettings.Host, settings.DBSettings.Name, settings.DBSettings.AutoMigrate)
+	}
+	if features.Telegram {
+		mode := "webhook"
+		if settings.TelegramSettings.PollUpdates {
+			mode = "long polling"
+		}
+		fmt.Fprintf(out, "telegram:  @%s via %s\n", settings.TelegramSettings.Botname, mode)
+	} else {
+		fmt.Fprintln(out, "telegram:  off")
+	}
+	fmt.Fprintf(out, "features:  news %s, stock %s, instagram %s\n", onOff(features.News), onOff(features.Stock), onOff(features.Instagram))
+
+	sources := make([]string, 0, len(settings.NotifySettings.Routes))
+	for source := range settings.NotifySettings.Routes {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		fmt.Fprintf(out, "notify:    %s -> %s\n", source, strings.Join(settings.NotifySettings.Routes[source], ", "))
+	}
+
+	if migrator == nil {
+		fmt.Fprintln(out, "config OK")
+		return nil
+	}
+	version, err := migrator.Check()
+	if err != nil {
+		return err
+	}
+	if version < migrator.Latest() {
+		return fmt.Errorf("database schema is at version %d, this build expects %d; run `migrate up`", version, migrator.Latest())
+	}
+	fmt.Fprintf(out, "schema:    version %d, up to date\n", version)
+	fmt.Fprintln(out, "config OK")
+	return nil
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,179 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"seanmcapp/service"
+	"seanmcapp/util"
+)
+
+type fakeWallets struct {
+	service.WalletService
+	entries []service.DashboardWallet
+	err     error
+}
+
+func (f *fakeWallets) Export(context.Context) ([]service.DashboardWallet, error) {
+	return f.entries, f.err
+}
+
+type fakeStocks struct {
+	service.StockService
+	refreshed []service.DashboardStock
+	err       error
+}
+
+func (f *fakeStocks) RefreshPrices(context.Context) ([]service.DashboardStock, error) {
+	return f.refreshed, f.err
+}
+
+type panickingTask struct{}
+
+func (panickingTask) Run(context.Context) (int, error) { panic("boom") }
+
+func testCLIEnv(t *testing.T, services MainServices) cliEnv {
+	t.Helper()
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	return cliEnv{
+		settings: func() util.AppsSettings { return util.AppsSettings{} },
+		openDB:   func(util.DatabaseSettings) *sql.DB { return db },
+		services: func(util.AppsSettings) (MainServices, *sql.DB) { return services, db },
+	}
+}
+
+func TestRunCLIJobRun(t *testing.T) {
+	news := &fakeTask{}
+	env := testCLIEnv(t, MainServices{NewsService: news})
+
+	require.NoError(t, runCLI(t.Context(), env, []string{"job", "run", "news"}, &bytes.Buffer{}))
+	assert.Equal(t, 1, news.runs)
+
+	var usage usageError
+	assert.ErrorAs(t, runCLI(t.Context(), env, []string{"job", "run", "weather"}, &bytes.Buffer{}), &usage)
+}
+
+func TestRunJobTurnedOff(t *testing.T) {
+	err := runJob(t.Context(), MainServices{}, "instagram")
+	assert.EqualError(t, err, "job instagram is turned off in this configuration")
+}
+
+func TestRunJobReportsPanic(t *testing.T) {
+	err := runJob(t.Context(), MainServices{InstagramService: panickingTask{}}, "instagram")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+}
+
+func TestRunJobReportsFailure(t *testing.T) {
+	err := runJob(t.Context(), MainServices{NewsService: &fakeTask{err: errors.New("no news")}}, "news")
+	assert.EqualError(t, err, "no news")
+}
+
+func TestRunCLIWalletExport(t *testing.T) {
+	id := 7
+	wallets := &fakeWallets{entries: []service.DashboardWallet{
+		{ID: &id, Date: 202406, Name: "Rent, June", Category: "Rent", Currency: "SGD", Amount: -1500, Done: true, Account: "DBS"},
+	}}
+	env := testCLIEnv(t, MainServices{WalletService: wallets})
+
+	var out bytes.Buffer
+	require.NoError(t, runCLI(t.Context(), env, []string{"wallet", "export"}, &out))
+	assert.Equal(t, "id,date,name,category,currency,amount,done,account\n7,202406,\"Rent, June\",Rent,SGD,-1500,true,DBS\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runCLI(t.Context(), env, []string{"wallet", "export", "json"}, &out))
+	assert.Contains(t, out.String(), `"name": "Rent, June"`)
+
+	var usage usageError
+	assert.ErrorAs(t, runCLI(t.Context(), env, []string{"wallet", "export", "xml"}, &out), &usage)
+
+	wallets.err = errors.New("db down")
+	assert.EqualError(t, runCLI(t.Context(), env, []string{"wallet", "export"}, &out), "db down")
+}
+
+func TestRunCLIStockRefresh(t *testing.T) {
+	price := int64(9150)
+	stocks := &fakeStocks{refreshed: []service.DashboardStock{{Name: "BBCA", CurrentPrice: &price}, {Name: "TLKM"}}}
+	env := testCLIEnv(t, MainServices{StockService: stocks})
+
+	var out bytes.Buffer
+	require.NoError(t, runCLI(t.Context(), env, []string{"stock", "refresh"}, &out))
+	assert.Equal(t, "BBCA       9150\nTLKM          -\n", out.String())
+}
+
+func TestRunCLIStockRefreshTurnedOff(t *testing.T) {
+	env := testCLIEnv(t, MainServices{})
+
+	err := runCLI(t.Context(), env, []string{"stock", "refresh"}, &bytes.Buffer{})
+	assert.EqualError(t, err, "job stock is turned off in this configuration")
+}
+
+func TestCheckConfig(t *testing.T) {
+	settings := util.AppsSettings{
+		DBSettings:       util.DatabaseSettings{Host: "db.example.com", Name: "seanmc", Pass: "hunter2"},
+		TelegramSettings: util.TelegramSettings{Botname: "seanmcbot"},
+		NotifySettings:   util.NotifySettings{Routes: map[string][]string{"stock": {"email", "telegram:personal"}}},
+		Features:         util.FeatureSettings{Telegram: true, Stock: true},
+	}
+
+	t.Run("up to date", func(t *testing.T) {
+		migrator, _ := newTestMigrator(t, 1)
+		var out bytes.Buffer
+		require.NoError(t, checkConfig(settings, migrator, &out))
+		assert.Contains(t, out.String(), "telegram:  @seanmcbot via webhook")
+		assert.Contains(t, out.String(), "features:  news off, stock on, instagram off")
+		assert.Contains(t, out.String(), "notify:    stock -> email, telegram:personal")
+		assert.Contains(t, out.String(), "config OK")
+		assert.NotContains(t, out.String(), "hunter2")
+	})
+
+	t.Run("pending migrations", func(t *testing.T) {
+		migrator, _ := newTestMigrator(t, 0)
+		assert.ErrorContains(t, checkConfig(settings, migrator, &bytes.Buffer{}), "migrate up")
+	})
+}
+
+func TestCheckConfigMemoryBackend(t *testing.T) {
+	settings := util.AppsSettings{DBSettings: util.DatabaseSettings{Backend: util.BackendMemory, File: "seanmcapp.json"}}
+	env := cliEnv{settings: func() util.AppsSettings { return settings }}
+
+	var out bytes.Buffer
+	require.NoError(t, runCLI(t.Context(), env, []string{"config", "check"}, &out))
+	assert.Contains(t, out.String(), "database:  in memory (seanmcapp.json)")
+	assert.Contains(t, out.String(), "config OK")
+
+	assert.EqualError(t, runCLI(t.Context(), env, []string{"migrate", "status"}, &out), "migrations only apply to the postgres backend")
+}
+
+func TestRunCLIMigrateStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0)")).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	env := cliEnv{
+		settings: func() util.AppsSettings { return util.AppsSettings{} },
+		openDB:   func(util.DatabaseSettings) *sql.DB { return db },
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, runCLI(t.Context(), env, []string{"migrate", "status"}, &out))
+	assert.Contains(t, out.String(), "database schema is at version 1")
+}
+
+func TestExitCode(t *testing.T) {
+	var errOut bytes.Buffer
+	assert.Equal(t, exitOK, exitCode(nil, &errOut))
+	assert.Equal(t, exitError, exitCode(errors.New("db down"), &errOut))
+	assert.Equal(t, exitUsage, exitCode(usageError("unknown command"), &errOut))
+	assert.Equal(t, exitUsage, exitCode(runCLI(t.Context(), cliEnv{}, []string{"frobnicate"}, &bytes.Buffer{}), &errOut))
+	assert.Contains(t, errOut.String(), "job run news|stock|instagram|digest")
+}
@@ -0,0 +1,127 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Commit is the commit the binary was built from, set at build time with
+// -ldflags "-X seanmcapp/bootstrap.Commit=$SOURCE_VERSION".
+var Commit = "unknown"
+
+// startedAt is when the process started, reported by /version.
+var startedAt = time.Now()
+
+// readyTimeout bounds each readiness check, so a hung dependency makes
+// /readyz fail rather than hang the uptime check.
+var readyTimeout = 2 * time.Second
+
+// Health answers /readyz by checking the dependencies the app needs to serve.
+type Health struct {
+	checks           map[string]func(ctx context.Context) error
+	schedulerStarted atomic.Bool
+}
+
+func NewHealth() *Health {
+	return &Health{checks: make(map[string]func(ctx context.Context) error)}
+}
+
+// AddCheck makes readiness depend on check, e.g. a database ping.
+func (h *Health) AddCheck(name string, check func(ctx context.Context) error) {
+	h.checks[name] = check
+}
+
+// SchedulerStarted records that the cron jobs are scheduled and running.
+func (h *Health) SchedulerStarted() {
+	h.schedulerStarted.Store(true)
+}
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type readiness struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]dependencyStatus `json:"dependencies"`
+}
+
+// ready runs every check at once, each bounded by readyTimeout.
+func (h *Health) ready(ctx context.Context) readiness {
+	result := readiness{Status: "ok", Dependencies: make(map[string]dependencyStatus, len(h.checks)+1)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := runCheck(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			result.Dependencies[name] = status
+		}()
+	}
+	wg.Wait()
+
+	result.Dependencies["scheduler"] = dependencyStatus{Status: "ok"}
+	if !h.schedulerStarted.Load() {
+		result.Dependencies["scheduler"] = dependencyStatus{Status: "down", Error: "not started"}
+	}
+
+	for _, status := range result.Dependencies {
+		if status.Status != "ok" {
+			result.Status = "unavailable"
+		}
+	}
+	return result
+}
+
+func runCheck(ctx context.Context, check func(ctx context.Context) error) dependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	status := dependencyStatus{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+	if errors.Is(err, context.DeadlineExceeded) {
+		status.Status, status.Error = "down", "timed out after "+readyTimeout.String()
+	} else if err != nil {
+		status.Status, status.Error = "down", err.Error()
+	}
+	return status
+}
+
+// registerHealthRoutes adds the routes uptime checks use. None of them need
+// a token; /readyz is only added when there is a Health to ask.
+func registerHealthRoutes(r *gin.Engine, health *Health) {
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	r.GET("/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"commit":         Commit,
+			"started_at":     startedAt.UTC().Format(time.RFC3339),
+			"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		})
+	})
+
+	if health == nil {
+		return
+	}
+	r.GET("/readyz", func(c *gin.Context) {
+		result := health.ready(c.Request.Context())
+		code := http.StatusOK
+		if result.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, result)
+	})
+}
@@ -0,0 +1,95 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getHealthRoute(t *testing.T, health *Health, path string) (int, map[string]any) {
+	t.Helper()
+	r := gin.New()
+	registerHealthRoutes(r, health)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func TestHealthz(t *testing.T) {
+	code, body := getHealthRoute(t, nil, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body["status"])
+}
+
+func TestVersion(t *testing.T) {
+	defer func(commit string) { Commit = commit }(Commit)
+	Commit = "abc1234"
+
+	code, body := getHealthRoute(t, nil, "/version")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "abc1234", body["commit"])
+	assert.Equal(t, startedAt.UTC().Format(time.RFC3339), body["started_at"])
+}
+
+func TestReadyz(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	health := NewHealth()
+	health.AddCheck("database", db.PingContext)
+
+	t.Run("scheduler not started", func(t *testing.T) {
+		mock.ExpectPing()
+		code, body := getHealthRoute(t, health, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		deps := body["dependencies"].(map[string]any)
+		assert.Equal(t, "ok", deps["database"].(map[string]any)["status"])
+		assert.Equal(t, map[string]any{"status": "down", "latency_ms": float64(0), "error": "not started"}, deps["scheduler"])
+	})
+
+	health.SchedulerStarted()
+
+	t.Run("ready", func(t *testing.T) {
+		mock.ExpectPing()
+		code, body := getHealthRoute(t, health, "/readyz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ok", body["status"])
+		assert.Contains(t, body["dependencies"].(map[string]any)["database"], "latency_ms")
+	})
+
+	t.Run("database down", func(t *testing.T) {
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		code, body := getHealthRoute(t, health, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "unavailable", body["status"])
+		assert.Equal(t, "connection refused", body["dependencies"].(map[string]any)["database"].(map[string]any)["error"])
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadyCheckTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { readyTimeout = timeout }(readyTimeout)
+	readyTimeout = 10 * time.Millisecond
+
+	status := runCheck(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Equal(t, "down", status.Status)
+	assert.Equal(t, "timed out after 10ms", status.Error)
+	assert.GreaterOrEqual(t, status.LatencyMS, int64(10))
+}
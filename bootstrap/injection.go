@@ -1,10 +1,9 @@
 package bootstrap
 
 import (
+	"context"
 	"database/sql"
-	"log"
-	"net"
-	"net/url"
+	"log/slog"
 	"seanmcapp/external"
 	"seanmcapp/repository"
 	"seanmcapp/service"
@@ -14,55 +13,166 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// MainServices are the wired services. Those of features turned off in
+// util.FeatureSettings are left nil, and are neither scheduled nor routed.
 type MainServices struct {
 	WalletService    service.WalletService
 	NewsService      service.NewsService
 	StockService     service.StockService
 	InstagramService service.InstagramService
+	BotService       service.BotService
+	OutboxService    service.OutboxService
+	DigestService    service.DigestService
+	UpdatePoller     *UpdatePoller // only started when TelegramSettings.PollUpdates is set
+	OutboxWorker     *OutboxWorker
+	Health           *Health
+	Metrics          *Metrics
+	Jobs             *JobRunner
 }
 
+// GetMainServices wires the services. The returned database is nil with the
+// memory backend.
 func GetMainServices(settings util.AppsSettings) (MainServices, *sql.DB) {
+	repos, db := openRepos(settings.DBSettings)
 
-	dsn := url.URL{
-		Scheme:   "postgres",
-		User:     url.UserPassword(settings.DBSettings.User, settings.DBSettings.Pass),
-		Host:     net.JoinHostPort(settings.DBSettings.Host, "5432"),
-		Path:     settings.DBSettings.Name,
-		RawQuery: "sslmode=require",
+	features := settings.Features
+	digestRepo := &repository.DigestRepoImpl{DB: db}
+
+	walletService := &service.WalletServiceImpl{WalletRepo: repos.wallet}
+	services := MainServices{WalletService: walletService, Health: NewHealth(), Metrics: NewMetrics(), Jobs: &JobRunner{Timeouts: settings.JobTimeouts}}
+	if db != nil {
+		services.Health.AddCheck("database", db.PingContext)
+		services.Jobs.Runs = &repository.JobRunRepoImpl{DB: db}
+		services.Jobs.Schedules = &repository.JobScheduleRepoImpl{DB: db}
+		services.Jobs.Claims = &repository.JobClaimRepoImpl{DB: db}
 	}
 
-	db, err := sql.Open("postgres", dsn.String())
-	if err != nil {
-		log.Fatal(err)
+	// Everything Telegram is left unwired, and nil, when the feature is off.
+	var telegramClient external.TelegramClient
+	var outboxService service.OutboxService
+	var outbox *service.OutboxServiceImpl
+	if features.Telegram {
+		botAPI := external.NewTelegramClient(settings.TelegramSettings.Endpoint, settings.TelegramSettings.Botname)
+		telegramClient = external.NewReliableTelegramClient(botAPI)
+		if settings.TelegramSettings.ReadyCheck {
+			services.Health.AddCheck("telegram", func(ctx context.Context) error {
+				_, err := botAPI.GetMe(ctx)
+				return err
+			})
+		}
+		outbox = &service.OutboxServiceImpl{OutboxRepo: &repository.OutboxRepoImpl{DB: db}, TelegramClient: telegramClient}
+		outboxService = outbox
+		services.OutboxService = outbox
+		services.OutboxWorker = &OutboxWorker{Outbox: outbox}
+		services.DigestService = &service.DigestServiceImpl{DigestRepo: digestRepo, TelegramClient: telegramClient, Outbox: outbox}
 	}
+	notifier := newNotificationRouter(settings.NotifySettings, settings.TelegramSettings, telegramClient, outboxService, digestRepo)
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("cannot reach database: %v", err)
+	if features.News {
+		newsService := service.NewNewsService(telegramClient, settings.TelegramSettings.GroupChatID)
+		newsService.Notifier = notifier
+		services.NewsService = newsService
 	}
 
-	// Keep the pool within Heroku Postgres connection limits.
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	var stockService *service.StockServiceImpl
+	if features.Stock {
+		stockService = &service.StockServiceImpl{StockRepo: repos.stock, StockClient: external.NewStockClient(), TelegramClient: telegramClient, Notifier: notifier, PersonalChatID: settings.TelegramSettings.PersonalChatID}
+		services.StockService = stockService
+		services.Metrics.AddGauge("seanmcapp_tracked_stocks", "Stocks on the dashboard.", func() (int, error) {
+			stocks, err := repos.stock.GetAll(context.Background())
+			return len(stocks), err
+		})
+	}
 
-	walletRepo := &repository.WalletRepoImpl{DB: db}
-	stockRepo := &repository.StockRepoImpl{DB: db}
-	instagramAccountRepo := &repository.InstagramAccountRepoImpl{DB: db}
+	if features.Instagram {
+		instagramClient := external.NewInstagramClient(settings.IGSettings.SessionID, settings.IGSettings.CSRFToken)
+		instagramService := &service.InstagramServiceImpl{InstagramAccountRepo: repos.instagram, InstagramClient: instagramClient, TelegramClient: telegramClient, Notifier: notifier, Outbox: outboxService, PersonalChatID: settings.TelegramSettings.PersonalChatID,
+			QuietHours: quietHoursFor(settings.NotifySettings.QuietHours, "personal", service.SourceInstagram)}
+		if outbox != nil {
+			outbox.Handle(service.OutboxKindInstagram, instagramService.Deliver)
+		}
+		services.InstagramService = instagramService
+		services.Metrics.AddGauge("seanmcapp_instagram_accounts", "Instagram accounts being followed.", func() (int, error) {
+			accounts, err := repos.instagram.GetAll(context.Background())
+			return len(accounts), err
+		})
+	}
+
+	if features.Telegram {
+		// Bot commands are registered here so every handler can reuse the services above.
+		botService := service.NewBotService(telegramClient, settings.TelegramSettings.Botname)
+		if stockService != nil {
+			service.RegisterStockCommands(botService, stockService)
+		}
+		service.RegisterWalletCommands(botService, walletService)
+		registerJobCommands(botService, services.Jobs, enabledJobs(services))
+		services.BotService = botService
+		services.UpdatePoller = &UpdatePoller{
+			TelegramClient: telegramClient,
+			OffsetRepo:     &repository.TelegramOffsetRepoImpl{DB: db},
+			Bot:            botService,
+			Botname:        settings.TelegramSettings.Botname,
+			Allowed:        newChatAllowlist(settings.TelegramSettings.AllowedChatIDs),
+		}
+	}
 
-	telegramClient := external.NewTelegramClient(settings.TelegramSettings.Endpoint, settings.TelegramSettings.Botname)
-	instagramClient := external.NewInstagramClient(settings.IGSettings.SessionID, settings.IGSettings.CSRFToken)
-	stockClient := external.NewStockClient()
+	return services, db
+}
 
-	walletService := &service.WalletServiceImpl{WalletRepo: walletRepo}
-	newsService := service.NewNewsService(telegramClient, settings.TelegramSettings.GroupChatID)
-	stockService := &service.StockServiceImpl{StockRepo: stockRepo, StockClient: stockClient, TelegramClient: telegramClient, PersonalChatID: settings.TelegramSettings.PersonalChatID}
-	instagramService := &service.InstagramServiceImpl{InstagramAccountRepo: instagramAccountRepo, InstagramClient: instagramClient, TelegramClient: telegramClient, PersonalChatID: settings.TelegramSettings.PersonalChatID}
+// dataRepos are the repositories either backend provides.
+type dataRepos struct {
+	wallet    repository.WalletRepo
+	stock     repository.StockRepo
+	instagram repository.InstagramAccountRepo
+}
+
+// openRepos opens the configured backend, migrating a Postgres database as
+// configured, and exits when it cannot.
+func openRepos(settings util.DatabaseSettings) (dataRepos, *sql.DB) {
+	if settings.Backend == util.BackendMemory {
+		store, err := repository.NewMemoryStore(settings.File)
+		if err != nil {
+			fatal("opening memory store", "error", err)
+		}
+		if settings.File == "" {
+			slog.Warn("using the in-memory backend; nothing is kept across restarts")
+		}
+		return dataRepos{
+			wallet:    &repository.WalletRepoMemory{Store: store},
+			stock:     &repository.StockRepoMemory{Store: store},
+			instagram: &repository.InstagramAccountRepoMemory{Store: store},
+		}, nil
+	}
 
-	return MainServices{
-		WalletService:    walletService,
-		NewsService:      newsService,
-		StockService:     stockService,
-		InstagramService: instagramService,
+	db := OpenDB(settings)
+	migrator, err := repository.NewMigrator(db)
+	if err != nil {
+		fatal("loading migrations", "error", err)
+	}
+	if err := prepareSchema(migrator, settings.AutoMigrate); err != nil {
+		fatal("preparing database schema", "error", err)
+	}
+	return dataRepos{
+		wallet:    &repository.WalletRepoImpl{DB: db},
+		stock:     &repository.StockRepoImpl{DB: db},
+		instagram: &repository.InstagramAccountRepoImpl{DB: db},
 	}, db
+}
+
+// OpenDB connects to Postgres and exits when the database cannot be reached.
+func OpenDB(settings util.DatabaseSettings) *sql.DB {
+	db, err := sql.Open("postgres", settings.DSN())
+	if err != nil {
+		fatal("opening database", "error", err)
+	}
 
+	if err := db.Ping(); err != nil {
+		fatal("cannot reach database", "error", err)
+	}
+
+	// Keep the pool within Heroku Postgres connection limits.
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	return db
 }
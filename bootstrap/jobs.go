@@ -0,0 +1,422 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"seanmcapp/service"
+	"seanmcapp/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+// JobRunner runs the scheduled jobs, logging and measuring every run and, with
+// a JobRunRepo, keeping its history. It also schedules them on the cron that
+// InitScheduler hands it, and reschedules them when their schedule changes,
+// here or on another instance, which it learns of by re-reading
+// job_schedules every minute.
+// With Claims, a scheduled run happens on one instance only. Every run is
+// cancelled after its timeout. A nil JobRunner still runs jobs.
+type JobRunner struct {
+	Runs      repository.JobRunRepo      // nil keeps no history, as with the memory backend
+	Schedules repository.JobScheduleRepo // nil keeps the default schedules
+	Claims    repository.JobClaimRepo    // nil runs cron jobs on every instance
+	Timeouts  util.JobTimeouts           // zero lets jobs run as long as they take
+
+	mu      sync.Mutex
+	ctx     context.Context // scheduled and triggered runs stop when it is done
+	cron    *cron.Cron
+	entries map[string]jobEntry
+	running sync.WaitGroup // triggered runs
+
+	reloaded map[string]time.Time // when each stored schedule reloadSchedules last saw was saved
+}
+
+// jobEntry is a job's schedule and, when it is enabled, its cron entry.
+type jobEntry struct {
+	schedule repository.JobSchedule
+	id       cron.EntryID
+}
+
+// jobRun is a run that has been started.
+type jobRun struct {
+	id        string
+	historyID int
+	name      string
+	trigger   string
+	start     time.Time
+	ctx       context.Context
+	quiet     bool // see quietJobs
+}
+
+// quietJobs run every minute, and most of their runs find nothing to do.
+// Their scheduled runs are only recorded, and logged at info, when they
+// processed something or failed, so idle runs neither flood job_runs and the
+// logs nor push the runs that delivered out of the history.
+var quietJobs = map[string]bool{"digest": true}
+
+// Run runs one job under ctx and its timeout. Each run gets a run id, its
+// history id when history is kept, logged as run_id with its start and end.
+// A panic is reported as an error, and failures are logged, so callers may
+// ignore err.
+func (r *JobRunner) Run(ctx context.Context, name, trigger string, task ScheduledTask) error {
+	run, err := r.begin(ctx, name, trigger)
+	if err != nil {
+		// The run goes ahead: its history is lost, not the job.
+		slog.Warn("recording job run", "job", name, "error", err)
+	}
+	return r.execute(run, task)
+}
+
+// runContext is what scheduled and triggered runs are started under: the one
+// InitScheduler was given, or the background until then.
+func (r *JobRunner) runContext() context.Context {
+	if r == nil {
+		return context.Background()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// Wait blocks until the runs Trigger started have finished.
+func (r *JobRunner) Wait() {
+	if r != nil {
+		r.running.Wait()
+	}
+}
+
+// guardedTask is a job that runs once at a time, as the services do through
+// their runGuard. TryStart takes its guard for a run started under the
+// returned context, or reports false while a run is in progress.
+type guardedTask interface {
+	TryStart(ctx context.Context) (context.Context, func(), bool)
+}
+
+// Trigger starts a job in the background and returns its run id straight
+// away. The job's guard is taken before Trigger returns, so of two triggers
+// at once only one starts the job; the other, and any trigger while the
+// previous run has not finished, gets ErrAlreadyRunning. When history is kept
+// but the run cannot be recorded, the job is not started and that error is
+// returned, since its run id could not be looked up.
+func (r *JobRunner) Trigger(name, trigger string, task ScheduledTask) (string, error) {
+	ctx, release := r.runContext(), func() {}
+	if t, ok := task.(guardedTask); ok {
+		var started bool
+		if ctx, release, started = t.TryStart(ctx); !started {
+			return "", fmt.Errorf("%s: %w", name, service.ErrAlreadyRunning)
+		}
+	}
+	run, err := r.begin(ctx, name, trigger)
+	if err != nil {
+		release()
+		return "", fmt.Errorf("recording job run: %w", err)
+	}
+	if r != nil {
+		r.running.Add(1)
+	}
+	go func() {
+		defer release()
+		if r != nil {
+			defer r.running.Done()
+		}
+		r.execute(run, task)
+	}()
+	return run.id, nil
+}
+
+// begin gives a run its id, recording its start when history is kept. A run
+// whose start could not be recorded still gets an id, for its logs only.
+func (r *JobRunner) begin(ctx context.Context, name, trigger string) (*jobRun, error) {
+	run := &jobRun{id: util.NewID(), name: name, trigger: trigger, start: time.Now()}
+	run.quiet = quietJobs[name] && trigger == repository.TriggerCron
+	var err error
+	if r != nil && r.Runs != nil && !run.quiet {
+		var id int
+		if id, err = r.Runs.Start(ctx, name, trigger, run.start); err == nil {
+			run.id, run.historyID = strconv.Itoa(id), id
+		}
+	}
+	run.ctx = util.WithRunID(ctx, run.id)
+	return run, err
+}
+
+func (r *JobRunner) execute(run *jobRun, task ScheduledTask) (err error) {
+	ctx, name, trigger := run.ctx, run.name, run.trigger
+	level := slog.LevelInfo
+	if run.quiet {
+		level = slog.LevelDebug
+	}
+	slog.Log(ctx, level, "job started", "job", name, "trigger", trigger)
+
+	timeout := time.Duration(0)
+	if r != nil {
+		timeout = r.Timeouts.For(name)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	items := 0
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job %s panicked: %v", name, p)
+		}
+		if timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("job %s timed out after %s: %w", name, timeout, err)
+		}
+
+		outcome := repository.JobSuccess
+		switch {
+		case errors.Is(err, service.ErrAlreadyRunning):
+			outcome = repository.JobSkipped
+		case err != nil:
+			outcome = repository.JobFailure
+		}
+		observeJob(name, run.start, outcome)
+
+		attrs := []any{"job", name, "trigger", trigger, "items", items, "duration_ms", time.Since(run.start).Milliseconds()}
+		switch outcome {
+		case repository.JobSkipped:
+			slog.InfoContext(ctx, "job skipped, previous run still going", attrs...)
+		case repository.JobFailure:
+			slog.ErrorContext(ctx, "job failed", append(attrs, "error", err)...)
+		default:
+			if items > 0 {
+				level = slog.LevelInfo
+			}
+			slog.Log(ctx, level, "job finished", attrs...)
+		}
+
+		// The run is recorded even when it was cancelled or timed out.
+		recordCtx := context.WithoutCancel(run.ctx)
+		if run.quiet && (outcome != repository.JobSuccess || items > 0) && r != nil && r.Runs != nil {
+			// An idle run would have been dropped; this one is kept after all.
+			id, err := r.Runs.Start(recordCtx, name, trigger, run.start)
+			if err != nil {
+				slog.WarnContext(ctx, "recording job run", "job", name, "error", err)
+			}
+			run.historyID = id
+		}
+		if run.historyID != 0 {
+			finished := time.Now()
+			record := repository.JobRun{ID: run.historyID, FinishedAt: &finished, Outcome: outcome, Items: items}
+			if err != nil {
+				record.Error = errorSummary(err)
+			}
+			if err := r.Runs.Finish(recordCtx, record); err != nil {
+				slog.WarnContext(ctx, "recording job run", "job", name, "error", err)
+			}
+		}
+	}()
+	items, err = task.Run(ctx)
+	return err
+}
+
+// errorSummary is the first line of err, cut to fit a history listing.
+func errorSummary(err error) string {
+	summary, _, _ := strings.Cut(err.Error(), "\n")
+	if len(summary) > 500 {
+		summary = summary[:500] + "…"
+	}
+	return summary
+}
+
+type jobStatus struct {
+	Name     string             `json:"name"`
+	Schedule string             `json:"schedule,omitempty"`
+	Timezone string             `json:"timezone,omitempty"`
+	Enabled  bool               `json:"enabled"`
+	NextRun  *time.Time         `json:"next_run,omitempty"`
+	LastRun  *repository.JobRun `json:"last_run,omitempty"`
+}
+
+const (
+	defaultJobRunsLimit = 20
+	maxJobRunsLimit     = 100
+)
+
+// registerJobRoutes lists the jobs that are turned on with their schedule and
+// last run and the recent runs of each, starts them on demand and changes
+// their schedule.
+func registerJobRoutes(api *gin.RouterGroup, services MainServices) {
+	tasks := enabledJobs(services)
+	runner := services.Jobs
+
+	api.GET("", func(c *gin.Context) {
+		statuses, err := jobStatuses(c.Request.Context(), runner, tasks)
+		resolve(c, statuses, err)
+	})
+
+	api.GET("/:name/runs", func(c *gin.Context) {
+		name := c.Param("name")
+		if _, ok := tasks[name]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no job %q in this configuration", name)})
+			return
+		}
+		if runner.Runs == nil {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "job history is only kept with the postgres backend"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultJobRunsLimit)))
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		runs, err := runner.Runs.List(c.Request.Context(), name, min(limit, maxJobRunsLimit))
+		resolve(c, runs, err)
+	})
+
+	api.POST("/:name/trigger", func(c *gin.Context) {
+		name := c.Param("name")
+		task, ok := tasks[name]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no job %q in this configuration", name)})
+			return
+		}
+		runID, err := runner.Trigger(name, repository.TriggerManual, task)
+		if errors.Is(err, service.ErrAlreadyRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("job %s is already running", name)})
+			return
+		}
+		if err != nil {
+			resolve(c, "", err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"data": gin.H{"job": name, "run_id": runID}})
+	})
+
+	api.PUT("/:name/schedule", func(c *gin.Context) {
+		name := c.Param("name")
+		task, ok := tasks[name]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no job %q in this configuration", name)})
+			return
+		}
+		if runner.Schedules == nil {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "job schedules are only kept with the postgres backend"})
+			return
+		}
+		// Fields left out keep their current value, e.g. {"enabled": false}.
+		var body struct {
+			CronExpr *string `json:"cron"`
+			Timezone *string `json:"timezone"`
+			Enabled  *bool   `json:"enabled"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		schedule, err := runner.UpdateSchedule(c.Request.Context(), name, task, func(s *repository.JobSchedule) {
+			if body.CronExpr != nil {
+				s.CronExpr = *body.CronExpr
+			}
+			if body.Timezone != nil {
+				s.Timezone = *body.Timezone
+			}
+			if body.Enabled != nil {
+				s.Enabled = *body.Enabled
+			}
+		})
+		resolve(c, schedule, err)
+	})
+
+	api.GET("/runs/:id", func(c *gin.Context) {
+		if runner.Runs == nil {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "job history is only kept with the postgres backend"})
+			return
+		}
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "run id must be a number"})
+			return
+		}
+		run, err := runner.Runs.Get(c.Request.Context(), id)
+		resolve(c, run, err)
+	})
+}
+
+// jobStatuses describes each job: when it runs next and how it last ran.
+func jobStatuses(ctx context.Context, runner *JobRunner, tasks map[string]ScheduledTask) ([]jobStatus, error) {
+	statuses := []jobStatus{}
+	for _, name := range sortedJobNames(tasks) {
+		status := jobStatus{Name: name}
+		if schedule, ok := runner.Schedule(name); ok {
+			status.Schedule, status.Timezone, status.Enabled = schedule.CronExpr, schedule.Timezone, schedule.Enabled
+		}
+		if next, ok := runner.Next(name); ok {
+			status.NextRun = &next
+		}
+		if runner.Runs != nil {
+			runs, err := runner.Runs.List(ctx, name, 1)
+			if err != nil {
+				return nil, err
+			}
+			if len(runs) > 0 {
+				status.LastRun = &runs[0]
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// registerJobCommands adds /run, which starts a job in the background and
+// replies straight away with its run id.
+func registerJobCommands(bot service.BotService, runner *JobRunner, tasks map[string]ScheduledTask) {
+	names := strings.Join(sortedJobNames(tasks), "|")
+	bot.Register("run", "run a job now: /run "+names, func(_ context.Context, cmd service.BotCommand) (service.BotReply, error) {
+		if len(cmd.Args) != 1 {
+			return service.BotReply{}, service.ValidationError{Message: "usage: /run " + names}
+		}
+		name := strings.ToLower(cmd.Args[0])
+		task, ok := tasks[name]
+		if !ok {
+			return service.BotReply{}, service.ValidationError{Message: fmt.Sprintf("no job %q, try /run %s", name, names)}
+		}
+		runID, err := runner.Trigger(name, repository.TriggerBot, task)
+		if errors.Is(err, service.ErrAlreadyRunning) {
+			return service.BotReply{}, service.ValidationError{Message: fmt.Sprintf("%s is already running", name)}
+		}
+		if err != nil {
+			return service.BotReply{}, err
+		}
+		return service.BotReply{Text: external.NewMessage().Text("▶️ ").Bold(name).Textf(" started, run %s", runID).String()}, nil
+	})
+}
+
+// enabledJobs are the jobs of the features that are turned on.
+func enabledJobs(services MainServices) map[string]ScheduledTask {
+	enabled := make(map[string]ScheduledTask)
+	for name, task := range jobs(services) {
+		if task != nil {
+			enabled[name] = task
+		}
+	}
+	return enabled
+}
+
+func sortedJobNames(tasks map[string]ScheduledTask) []string {
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,425 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"seanmcapp/repository"
+	"seanmcapp/service"
+	"seanmcapp/util"
+)
+
+// fakeJobRuns keeps the job history in memory, newest last.
+type fakeJobRuns struct {
+	mu       sync.Mutex
+	runs     []repository.JobRun
+	startErr error
+	listErr  error
+}
+
+func (f *fakeJobRuns) Start(_ context.Context, job, trigger string, startedAt time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.startErr != nil {
+		return 0, f.startErr
+	}
+	f.runs = append(f.runs, repository.JobRun{ID: len(f.runs) + 1, Job: job, Trigger: trigger, StartedAt: startedAt, Outcome: repository.JobRunning})
+	return len(f.runs), nil
+}
+
+func (f *fakeJobRuns) Finish(_ context.Context, run repository.JobRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := &f.runs[run.ID-1]
+	stored.FinishedAt, stored.Outcome, stored.Error, stored.Items = run.FinishedAt, run.Outcome, run.Error, run.Items
+	return nil
+}
+
+func (f *fakeJobRuns) Get(_ context.Context, id int) (repository.JobRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id < 1 || id > len(f.runs) {
+		return repository.JobRun{}, repository.ErrNotFound
+	}
+	return f.runs[id-1], nil
+}
+
+func (f *fakeJobRuns) List(_ context.Context, job string, limit int) ([]repository.JobRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	runs := []repository.JobRun{}
+	for i := len(f.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		if f.runs[i].Job == job {
+			runs = append(runs, f.runs[i])
+		}
+	}
+	return runs, f.listErr
+}
+
+func TestJobRunnerKeepsHistory(t *testing.T) {
+	history := &fakeJobRuns{}
+	runner := &JobRunner{Runs: history}
+
+	require.NoError(t, runner.Run(t.Context(), "stock", repository.TriggerCron, &fakeTask{items: 12}))
+	require.Error(t, runner.Run(t.Context(), "news", repository.TriggerManual, &fakeTask{err: errors.New("no news source could be fetched\nat all")}))
+	require.Error(t, runner.Run(t.Context(), "news", repository.TriggerBot, &fakeTask{err: fmt.Errorf("news run: %w", service.ErrAlreadyRunning)}))
+	require.Error(t, runner.Run(t.Context(), "instagram", repository.TriggerCron, panickingTask{}))
+
+	require.Len(t, history.runs, 4)
+	for _, run := range history.runs {
+		assert.NotNil(t, run.FinishedAt, run.Job)
+	}
+	assert.Equal(t, repository.JobRun{ID: 1, Job: "stock", Trigger: repository.TriggerCron, Outcome: repository.JobSuccess, Items: 12},
+		withoutTimes(history.runs[0]))
+	assert.Equal(t, repository.JobRun{ID: 2, Job: "news", Trigger: repository.TriggerManual, Outcome: repository.JobFailure, Error: "no news source could be fetched"},
+		withoutTimes(history.runs[1]))
+	assert.Equal(t, repository.JobSkipped, history.runs[2].Outcome)
+	assert.Equal(t, repository.TriggerBot, history.runs[2].Trigger)
+	assert.Equal(t, repository.JobFailure, history.runs[3].Outcome)
+	assert.Equal(t, "job instagram panicked: boom", history.runs[3].Error)
+}
+
+func TestJobRunnerKeepsOnlyBusyDigestRuns(t *testing.T) {
+	logs := captureLogs(t)
+	history := &fakeJobRuns{}
+	runner := &JobRunner{Runs: history}
+
+	require.NoError(t, runner.Run(t.Context(), "digest", repository.TriggerCron, &fakeTask{}))
+	assert.Empty(t, history.runs, "an idle scheduled digest is not recorded")
+	assert.Empty(t, logs.String(), "nor logged at info")
+
+	require.NoError(t, runner.Run(t.Context(), "digest", repository.TriggerCron, &fakeTask{items: 3}))
+	require.Error(t, runner.Run(t.Context(), "digest", repository.TriggerCron, &fakeTask{err: errors.New("db down")}))
+	require.NoError(t, runner.Run(t.Context(), "digest", repository.TriggerManual, &fakeTask{}))
+
+	require.Len(t, history.runs, 3)
+	assert.Equal(t, repository.JobRun{ID: 1, Job: "digest", Trigger: repository.TriggerCron, Outcome: repository.JobSuccess, Items: 3},
+		withoutTimes(history.runs[0]))
+	assert.Equal(t, repository.JobFailure, history.runs[1].Outcome)
+	assert.Equal(t, repository.TriggerManual, history.runs[2].Trigger, "runs by hand are always recorded")
+	for _, run := range history.runs {
+		assert.NotNil(t, run.FinishedAt)
+	}
+	assert.Contains(t, logs.String(), `"items":3`)
+}
+
+func withoutTimes(run repository.JobRun) repository.JobRun {
+	run.StartedAt, run.FinishedAt = time.Time{}, nil
+	return run
+}
+
+func TestJobRunnerLogsHistoryIDAsRunID(t *testing.T) {
+	logs := captureLogs(t)
+	runner := &JobRunner{Runs: &fakeJobRuns{}}
+
+	require.NoError(t, runner.Run(t.Context(), "stock", repository.TriggerCron, &fakeTask{}))
+
+	for _, record := range logRecords(t, logs) {
+		assert.Equal(t, "1", record["run_id"])
+	}
+}
+
+func TestJobRunnerRunsWithoutHistory(t *testing.T) {
+	captureLogs(t)
+	task := &fakeTask{}
+
+	require.NoError(t, (&JobRunner{Runs: &fakeJobRuns{startErr: errors.New("db down")}}).Run(t.Context(), "stock", repository.TriggerCron, task))
+	var noRunner *JobRunner
+	require.NoError(t, noRunner.Run(t.Context(), "stock", repository.TriggerCron, task))
+	assert.Equal(t, 2, task.runs)
+}
+
+func TestJobRoutes(t *testing.T) {
+	settings := util.AppsSettings{WalletSettings: util.WalletSettings{SecretKey: "secret", Password: "pw"}}
+	token := util.JwtCreateToken(settings.WalletSettings, "pw")
+	captureLogs(t)
+
+	history := &fakeJobRuns{}
+	runner := &JobRunner{Runs: history}
+	services := MainServices{WalletService: &fakeWallets{}, NewsService: &fakeTask{}, StockService: &fakeStocks{}, Jobs: runner}
+	require.NoError(t, runner.Run(t.Context(), "news", repository.TriggerCron, services.NewsService))
+	require.NoError(t, runner.Run(t.Context(), "news", repository.TriggerManual, services.NewsService))
+
+	c := cron.New(cron.WithSeconds())
+	runner.useCron(t.Context(), c)
+	require.NoError(t, runner.setSchedule("stock", services.StockService, defaultSchedules["stock"]))
+	c.Start()
+	defer c.Stop()
+
+	r := InitRouter(services, settings)
+	get := func(path, auth string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+		return w.Code, body
+	}
+
+	t.Run("needs a token", func(t *testing.T) {
+		code, _ := get("/api/jobs", "")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("jobs with next and last run", func(t *testing.T) {
+		code, body := get("/api/jobs", token)
+		require.Equal(t, http.StatusOK, code)
+		jobs := body["data"].([]any)
+		require.Len(t, jobs, 2, "only jobs turned on are listed")
+
+		news := jobs[0].(map[string]any)
+		assert.Equal(t, "news", news["name"])
+		assert.Nil(t, news["next_run"], "news is not scheduled here")
+		assert.Equal(t, float64(2), news["last_run"].(map[string]any)["id"])
+		assert.Equal(t, repository.TriggerManual, news["last_run"].(map[string]any)["trigger"])
+
+		stock := jobs[1].(map[string]any)
+		assert.Equal(t, "stock", stock["name"])
+		assert.Equal(t, "0 0 19 * * *", stock["schedule"])
+		assert.Equal(t, "Asia/Jakarta", stock["timezone"])
+		assert.Equal(t, true, stock["enabled"])
+		assert.NotEmpty(t, stock["next_run"])
+		assert.Nil(t, stock["last_run"])
+	})
+
+	t.Run("runs of a job", func(t *testing.T) {
+		code, body := get("/api/jobs/news/runs?limit=1", token)
+		require.Equal(t, http.StatusOK, code)
+		runs := body["data"].([]any)
+		require.Len(t, runs, 1)
+		assert.Equal(t, float64(2), runs[0].(map[string]any)["id"])
+		assert.Equal(t, repository.JobSuccess, runs[0].(map[string]any)["outcome"])
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		code, _ := get("/api/jobs/instagram/runs", token)
+		assert.Equal(t, http.StatusNotFound, code, "instagram is turned off")
+		code, _ = get("/api/jobs/news/runs?limit=none", token)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("history error", func(t *testing.T) {
+		history.listErr = errors.New("db down")
+		defer func() { history.listErr = nil }()
+		code, _ := get("/api/jobs", token)
+		assert.Equal(t, http.StatusInternalServerError, code)
+	})
+
+	t.Run("no history kept", func(t *testing.T) {
+		runner.Runs = nil
+		defer func() { runner.Runs = history }()
+		code, _ := get("/api/jobs/news/runs", token)
+		assert.Equal(t, http.StatusNotImplemented, code)
+		code, body := get("/api/jobs", token)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Nil(t, body["data"].([]any)[0].(map[string]any)["last_run"])
+	})
+}
+
+func TestJobRunnerTimesOut(t *testing.T) {
+	captureLogs(t)
+	history := &fakeJobRuns{}
+	runner := &JobRunner{Runs: history, Timeouts: util.JobTimeouts{Default: time.Hour, ByJob: map[string]time.Duration{"news": 10 * time.Millisecond}}}
+
+	err := runner.Run(t.Context(), "news", repository.TriggerCron, newBlockingTask())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "job news timed out after 10ms: context deadline exceeded")
+	require.Len(t, history.runs, 1)
+	assert.Equal(t, repository.JobFailure, history.runs[0].Outcome)
+	assert.Equal(t, err.Error(), history.runs[0].Error)
+}
+
+func TestJobRunnerCancelStopsTriggeredRuns(t *testing.T) {
+	captureLogs(t)
+	history := &fakeJobRuns{}
+	runner := &JobRunner{Runs: history}
+	ctx, cancel := context.WithCancel(t.Context())
+	runner.useCron(ctx, cron.New(cron.WithSeconds()))
+	task := newBlockingTask()
+
+	_, err := runner.Trigger("news", repository.TriggerManual, task)
+	require.NoError(t, err)
+	<-task.started
+
+	cancel()
+	runner.Wait()
+	require.Len(t, history.runs, 1)
+	assert.Equal(t, repository.JobFailure, history.runs[0].Outcome)
+	assert.Equal(t, "context canceled", history.runs[0].Error)
+}
+
+func TestTriggerTakesGuardBeforeReturning(t *testing.T) {
+	captureLogs(t)
+	runner := &JobRunner{Runs: &fakeJobRuns{}}
+	task := newBlockingTask()
+
+	_, err := runner.Trigger("news", repository.TriggerManual, task)
+	require.NoError(t, err)
+	// The first run may not have started yet; the second is refused anyway.
+	_, err = runner.Trigger("news", repository.TriggerManual, task)
+	assert.ErrorIs(t, err, service.ErrAlreadyRunning)
+
+	close(task.release)
+	runner.Wait()
+	_, err = runner.Trigger("news", repository.TriggerManual, task)
+	require.NoError(t, err, "the guard is given back once the run is over")
+	<-task.started
+	<-task.started
+	runner.Wait()
+}
+
+func TestTriggerFailsWhenRunCannotBeRecorded(t *testing.T) {
+	captureLogs(t)
+	runner := &JobRunner{Runs: &fakeJobRuns{startErr: errors.New("db down")}}
+	task := newBlockingTask()
+
+	runID, err := runner.Trigger("news", repository.TriggerManual, task)
+	require.Error(t, err)
+	assert.Empty(t, runID)
+	runner.Wait()
+	assert.Empty(t, task.started, "the job is not started")
+	assert.False(t, task.running.Load(), "its guard is given back")
+}
+
+func TestTriggerJobRoute(t *testing.T) {
+	settings := util.AppsSettings{WalletSettings: util.WalletSettings{SecretKey: "secret", Password: "pw"}}
+	token := util.JwtCreateToken(settings.WalletSettings, "pw")
+	captureLogs(t)
+
+	history := &fakeJobRuns{}
+	runner := &JobRunner{Runs: history}
+	news := newBlockingTask()
+	services := MainServices{WalletService: &fakeWallets{}, NewsService: news, StockService: &fakeStocks{}, Jobs: runner}
+	r := InitRouter(services, settings)
+	call := func(method, path, auth string) (int, map[string]any) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+		return w.Code, body
+	}
+
+	code, _ := call(http.MethodPost, "/api/jobs/news/trigger", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = call(http.MethodPost, "/api/jobs/instagram/trigger", token)
+	assert.Equal(t, http.StatusNotFound, code, "instagram is turned off")
+
+	code, body := call(http.MethodPost, "/api/jobs/news/trigger", token)
+	require.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, map[string]any{"job": "news", "run_id": "1"}, body["data"])
+	<-news.started
+
+	code, body = call(http.MethodPost, "/api/jobs/news/trigger", token)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "job news is already running", body["error"])
+
+	code, body = call(http.MethodGet, "/api/jobs/runs/1", token)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, repository.JobRunning, body["data"].(map[string]any)["outcome"])
+	assert.Equal(t, repository.TriggerManual, body["data"].(map[string]any)["trigger"])
+
+	close(news.release)
+	require.Eventually(t, func() bool {
+		_, body := call(http.MethodGet, "/api/jobs/runs/1", token)
+		return body["data"].(map[string]any)["outcome"] == repository.JobSuccess
+	}, time.Second, 5*time.Millisecond)
+	_, body = call(http.MethodGet, "/api/jobs/runs/1", token)
+	assert.Equal(t, float64(1), body["data"].(map[string]any)["items"])
+
+	code, _ = call(http.MethodGet, "/api/jobs/runs/2", token)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = call(http.MethodGet, "/api/jobs/runs/latest", token)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	runner.Runs = nil
+	code, _ = call(http.MethodGet, "/api/jobs/runs/1", token)
+	assert.Equal(t, http.StatusNotImplemented, code)
+	code, body = call(http.MethodPost, "/api/jobs/stock/trigger", token)
+	assert.Equal(t, http.StatusAccepted, code, "jobs still run without history")
+	assert.Len(t, body["data"].(map[string]any)["run_id"], 16)
+
+	runner.Runs = &fakeJobRuns{startErr: errors.New("db down")}
+	code, _ = call(http.MethodPost, "/api/jobs/stock/trigger", token)
+	assert.Equal(t, http.StatusInternalServerError, code, "a run that is not recorded cannot be polled")
+	runner.Wait()
+}
+
+func TestRunBotCommand(t *testing.T) {
+	captureLogs(t)
+	history := &fakeJobRuns{}
+	news := newBlockingTask()
+	bot := &fakeBot{}
+	registerJobCommands(bot, &JobRunner{Runs: history}, map[string]ScheduledTask{"news": news, "stock": &fakeTask{}})
+	run := bot.commands["run"]
+	require.NotNil(t, run)
+
+	_, err := run(t.Context(), service.BotCommand{})
+	var ve service.ValidationError
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, "usage: /run news|stock", ve.Message)
+
+	_, err = run(t.Context(), service.BotCommand{Args: []string{"weather"}})
+	require.ErrorAs(t, err, &ve)
+
+	reply, err := run(t.Context(), service.BotCommand{Args: []string{"NEWS"}})
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(reply.Text, "*news* started, run 1"), reply.Text)
+	<-news.started
+
+	_, err = run(t.Context(), service.BotCommand{Args: []string{"news"}})
+	require.ErrorAs(t, err, &ve)
+	assert.Equal(t, "news is already running", ve.Message)
+
+	close(news.release)
+	require.Eventually(t, func() bool {
+		runs, _ := history.List(t.Context(), "news", 1)
+		return len(runs) == 1 && runs[0].Outcome == repository.JobSuccess
+	}, time.Second, 5*time.Millisecond)
+	runs, _ := history.List(t.Context(), "news", 1)
+	assert.Equal(t, repository.TriggerBot, runs[0].Trigger)
+}
+
+// blockingTask runs until released and, like the services, runs once at a
+// time.
+type blockingTask struct {
+	running atomic.Bool
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingTask() *blockingTask {
+	return &blockingTask{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (b *blockingTask) TryStart(ctx context.Context) (context.Context, func(), bool) {
+	if !b.running.CompareAndSwap(false, true) {
+		return ctx, nil, false
+	}
+	return ctx, func() { b.running.Store(false) }, true
+}
+
+func (b *blockingTask) Run(ctx context.Context) (int, error) {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return 1, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
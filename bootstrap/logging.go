@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"seanmcapp/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID is what a request id given by the client or the Heroku
+// router may look like; anything else is replaced by a fresh one.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestIDMiddleware gives every request an id, taken from X-Request-ID when
+// it has a usable one, echoes it back and puts it in the request context so
+// everything logged while serving it carries request_id.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = util.NewID()
+		}
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(util.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// requestLogger logs one line per request in place of gin's text logger.
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(c.Request.Context(), level, "request",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// recoverer turns a panicking handler into a 500 and logs the panic with the
+// request id, instead of gin's plain-text dump.
+func recoverer() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, r any) {
+		slog.ErrorContext(c.Request.Context(), "handler panicked", "error", fmt.Sprint(r), "stack", string(debug.Stack()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+// registerLogLevelRoutes lets an authenticated user read and change the log
+// level of the running process, e.g. to turn on debug logs for a while.
+func registerLogLevelRoutes(admin *gin.RouterGroup) {
+	admin.GET("/log-level", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"level": util.LogLevel().String()})
+	})
+
+	admin.PUT("/log-level", func(c *gin.Context) {
+		var body struct {
+			Level string `json:"level"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		level, err := util.ParseLogLevel(body.Level)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "level must be debug, info, warn or error"})
+			return
+		}
+
+		previous := util.LogLevel()
+		util.SetLogLevel(level)
+		slog.WarnContext(c.Request.Context(), "log level changed", "from", previous.String(), "to", level.String())
+		c.JSON(http.StatusOK, gin.H{"level": level.String()})
+	})
+}
+
+// fatal logs msg as an error and exits, for failures the app cannot start
+// without.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
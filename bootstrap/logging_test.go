@@ -0,0 +1,142 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"seanmcapp/repository"
+	"seanmcapp/util"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(util.NewLogger(&buf))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logRecords decodes the JSON lines of buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	logs := captureLogs(t)
+	r := gin.New()
+	r.Use(requestIDMiddleware(), requestLogger(), recoverer())
+	r.GET("/items/:id", func(c *gin.Context) {
+		slog.InfoContext(c.Request.Context(), "serving item")
+		c.String(http.StatusOK, util.RequestID(c.Request.Context()))
+	})
+	r.GET("/boom", func(*gin.Context) { panic("boom") })
+
+	t.Run("given id is kept", func(t *testing.T) {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+		req.Header.Set(requestIDHeader, "heroku-abc-123")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, "heroku-abc-123", w.Header().Get(requestIDHeader))
+		assert.Equal(t, "heroku-abc-123", w.Body.String())
+		records := logRecords(t, logs)
+		require.Len(t, records, 2)
+		assert.Equal(t, "serving item", records[0]["msg"])
+		assert.Equal(t, "heroku-abc-123", records[0]["request_id"])
+		assert.Equal(t, "request", records[1]["msg"])
+		assert.Equal(t, "/items/:id", records[1]["route"])
+		assert.Equal(t, float64(http.StatusOK), records[1]["status"])
+		assert.Equal(t, "heroku-abc-123", records[1]["request_id"])
+	})
+
+	t.Run("unusable id is replaced", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+		req.Header.Set(requestIDHeader, "not valid\n")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Len(t, w.Header().Get(requestIDHeader), 16)
+		assert.Equal(t, w.Header().Get(requestIDHeader), w.Body.String())
+	})
+
+	t.Run("panic is logged with the request id", func(t *testing.T) {
+		logs.Reset()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		records := logRecords(t, logs)
+		require.Len(t, records, 2)
+		assert.Equal(t, "handler panicked", records[0]["msg"])
+		assert.Equal(t, "boom", records[0]["error"])
+		assert.Equal(t, w.Header().Get(requestIDHeader), records[0]["request_id"])
+		assert.Equal(t, "ERROR", records[1]["level"])
+	})
+}
+
+func TestLogLevelRoutes(t *testing.T) {
+	defer util.SetLogLevel(util.LogLevel())
+	util.SetLogLevel(slog.LevelInfo)
+	captureLogs(t)
+
+	settings := util.AppsSettings{WalletSettings: util.WalletSettings{SecretKey: "secret", Password: "pw"}}
+	token := util.JwtCreateToken(settings.WalletSettings, "pw")
+	r := InitRouter(MainServices{WalletService: &fakeWallets{}}, settings)
+
+	call := func(method, body, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/admin/log-level", strings.NewReader(body))
+		req.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodPut, `{"level":"debug"}`, "").Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPut, `{"level":"verbose"}`, token).Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPut, `level=debug`, token).Code)
+	assert.Equal(t, slog.LevelInfo, util.LogLevel())
+
+	w := call(http.MethodPut, `{"level":"debug"}`, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"DEBUG"}`, w.Body.String())
+	assert.Equal(t, slog.LevelDebug, util.LogLevel())
+
+	w = call(http.MethodGet, "", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"DEBUG"}`, w.Body.String())
+}
+
+func TestJobRunnerLogsRunID(t *testing.T) {
+	logs := captureLogs(t)
+
+	require.Error(t, (&JobRunner{}).Run(t.Context(), "news", repository.TriggerCron, &fakeTask{err: errors.New("no news")}))
+
+	records := logRecords(t, logs)
+	require.Len(t, records, 2)
+	assert.Equal(t, "job started", records[0]["msg"])
+	assert.Equal(t, "job failed", records[1]["msg"])
+	assert.Equal(t, "news", records[1]["job"])
+	assert.Equal(t, "no news", records[1]["error"])
+	assert.NotEmpty(t, records[0]["run_id"])
+	assert.Equal(t, records[0]["run_id"], records[1]["run_id"], "both lines carry the same run id")
+}
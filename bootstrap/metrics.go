@@ -0,0 +1,138 @@
+package bootstrap
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"seanmcapp/external"
+	"seanmcapp/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "seanmcapp_http_requests_total",
+		Help: "HTTP requests by method, gin route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "seanmcapp_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and gin route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "seanmcapp_job_runs_total",
+		Help: "Scheduled job runs by job and outcome: success, failure or skipped (previous run still going).",
+	}, []string{"job", "outcome"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "seanmcapp_job_duration_seconds",
+		Help:    "Duration of scheduled job runs by job.",
+		Buckets: []float64{.1, .5, 1, 5, 15, 30, 60, 120, 300, 600, 1800},
+	}, []string{"job"})
+
+	jobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "seanmcapp_job_last_success_timestamp_seconds",
+		Help: "When each scheduled job last succeeded, as a Unix time.",
+	}, []string{"job"})
+
+	telegramRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "seanmcapp_telegram_rejected_updates_total",
+		Help: "Telegram updates refused by cause: secret (webhook secret missing or wrong) or chat (not on the allowlist).",
+	}, []string{"cause"})
+)
+
+// metricsMiddleware records every request under its gin route, so paths with
+// ids are counted together. Unmatched requests are counted as "unmatched".
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeJob records the outcome of one run of job, one of the
+// repository.Job* outcomes.
+func observeJob(job string, start time.Time, outcome string) {
+	jobRuns.WithLabelValues(job, outcome).Inc()
+	switch outcome {
+	case repository.JobSkipped:
+		return
+	case repository.JobSuccess:
+		jobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+	jobDuration.WithLabelValues(job).Observe(time.Since(start).Seconds())
+}
+
+// countGauge reports a number read on every scrape, such as the rows of a
+// table. A failed read leaves it out of that scrape rather than reporting 0.
+type countGauge struct {
+	desc  *prometheus.Desc
+	count func() (int, error)
+}
+
+func (g *countGauge) Describe(ch chan<- *prometheus.Desc) { ch <- g.desc }
+
+func (g *countGauge) Collect(ch chan<- prometheus.Metric) {
+	n, err := g.count()
+	if err != nil {
+		slog.Warn("collecting metric", "metric", g.desc.String(), "error", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, float64(n))
+}
+
+// Metrics answers /metrics with the metrics of the process, the API clients,
+// HTTP routes, jobs and any gauges added.
+type Metrics struct {
+	registry *prometheus.Registry
+}
+
+func NewMetrics() *Metrics {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, jobRuns, jobDuration, jobLastSuccess, telegramRejections,
+	)
+	reg.MustRegister(external.Collectors()...)
+	return &Metrics{registry: reg}
+}
+
+// AddGauge adds a gauge whose value is read with count on every scrape.
+func (m *Metrics) AddGauge(name, help string, count func() (int, error)) {
+	m.registry.MustRegister(&countGauge{desc: prometheus.NewDesc(name, help, nil, nil), count: count})
+}
+
+// registerMetricsRoutes counts every request and serves /metrics. With a
+// token, scrapers must send it as a bearer token; without one /metrics is open.
+func registerMetricsRoutes(r *gin.Engine, metrics *Metrics, token string) {
+	if metrics == nil {
+		return
+	}
+	r.Use(metricsMiddleware())
+
+	handler := promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+	r.GET("/metrics", func(c *gin.Context) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	})
+}
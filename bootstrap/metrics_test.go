@@ -0,0 +1,98 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"seanmcapp/repository"
+	"seanmcapp/service"
+)
+
+func scrape(r *gin.Engine, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMetricsRoutes(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.AddGauge("seanmcapp_test_rows", "Rows.", func() (int, error) { return 3, nil })
+	metrics.AddGauge("seanmcapp_test_broken", "Rows of a table that cannot be read.", func() (int, error) {
+		return 0, errors.New("db down")
+	})
+
+	r := gin.New()
+	registerMetricsRoutes(r, metrics, "")
+	r.GET("/items/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	items := httpRequests.WithLabelValues(http.MethodGet, "/items/:id", "204")
+	unmatched := httpRequests.WithLabelValues(http.MethodGet, "unmatched", "404")
+	itemsBefore, unmatchedBefore := testutil.ToFloat64(items), testutil.ToFloat64(unmatched)
+	for _, path := range []string{"/items/1", "/items/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, itemsBefore+2, testutil.ToFloat64(items), "requests are counted by route, not path")
+	assert.Equal(t, unmatchedBefore+1, testutil.ToFloat64(unmatched))
+
+	w := scrape(r, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "seanmcapp_test_rows 3")
+	assert.NotContains(t, body, "seanmcapp_test_broken", "a gauge that cannot be read is left out")
+	assert.Contains(t, body, `seanmcapp_http_requests_total{method="GET",route="/items/:id",status="204"}`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestMetricsRequiresToken(t *testing.T) {
+	r := gin.New()
+	registerMetricsRoutes(r, NewMetrics(), "scrape-token")
+
+	assert.Equal(t, http.StatusUnauthorized, scrape(r, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, scrape(r, "Bearer wrong").Code)
+	assert.Equal(t, http.StatusOK, scrape(r, "Bearer scrape-token").Code)
+}
+
+func TestMetricsTurnedOff(t *testing.T) {
+	r := gin.New()
+	registerMetricsRoutes(r, nil, "")
+	assert.Equal(t, http.StatusNotFound, scrape(r, "").Code)
+}
+
+func TestJobRunnerRecordsMetrics(t *testing.T) {
+	tests := map[string]struct {
+		task    ScheduledTask
+		outcome string
+		wantErr string
+	}{
+		"success": {task: &fakeTask{}, outcome: "success"},
+		"failure": {task: &fakeTask{err: errors.New("no news")}, outcome: "failure", wantErr: "no news"},
+		"skipped": {task: &fakeTask{err: fmt.Errorf("news run: %w", service.ErrAlreadyRunning)}, outcome: "skipped", wantErr: "news run: already running"},
+		"panic":   {task: panickingTask{}, outcome: "failure", wantErr: "job panic panicked: boom"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			runs := jobRuns.WithLabelValues(name, tt.outcome)
+			before := testutil.ToFloat64(runs)
+
+			err := (&JobRunner{}).Run(t.Context(), name, repository.TriggerManual, tt.task)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+			assert.Equal(t, before+1, testutil.ToFloat64(runs))
+		})
+	}
+}
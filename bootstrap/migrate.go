@@ -0,0 +1,87 @@
+package bootstrap
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"seanmcapp/repository"
+	"strconv"
+)
+
+// prepareSchema refuses to run against a database migrated by a newer build,
+// then applies pending migrations when autoMigrate is set, or warns about
+// them when it is not.
+func prepareSchema(migrator *repository.Migrator, autoMigrate bool) error {
+	version, err := migrator.Check()
+	if err != nil {
+		return err
+	}
+
+	if !autoMigrate {
+		if version < migrator.Latest() {
+			slog.Warn("database schema is behind this build; run `migrate up`", "version", version, "expected", migrator.Latest())
+		}
+		return nil
+	}
+
+	applied, err := migrator.Up()
+	for _, v := range applied {
+		slog.Info("applied migration", "version", v)
+	}
+	return err
+}
+
+// runMigrate is the migrate command: "up", "down [steps]" (one step by
+// default) or "status".
+func runMigrate(db *sql.DB, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return usageError("migrate up | down [steps] | status")
+	}
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+	case "down":
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return usageError(fmt.Sprintf("invalid number of steps %q", args[1]))
+			}
+			steps = n
+		}
+	default:
+		return usageError(fmt.Sprintf("unknown migrate command %q", args[0]))
+	}
+
+	migrator, err := repository.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, v := range applied {
+			fmt.Fprintf(out, "applied migration %04d\n", v)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "database schema is up to date")
+		}
+		return err
+	case "down":
+		reverted, err := migrator.Down(steps)
+		for _, v := range reverted {
+			fmt.Fprintf(out, "reverted migration %04d\n", v)
+		}
+		if err == nil && len(reverted) < steps {
+			fmt.Fprintf(out, "stopped at the baseline, migration %04d is never reverted\n", repository.BaselineVersion)
+		}
+		return err
+	default:
+		version, err := migrator.Check()
+		if err == nil {
+			fmt.Fprintf(out, "database schema is at version %d, latest is %d\n", version, migrator.Latest())
+		}
+		return err
+	}
+}
@@ -0,0 +1,84 @@
+package bootstrap
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"seanmcapp/repository"
+)
+
+func newTestMigrator(t *testing.T, dbVersion int) (*repository.Migrator, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(dbVersion))
+
+	return &repository.Migrator{DB: db, Migrations: []repository.Migration{
+		{Version: 1, Name: "baseline", Up: "CREATE TABLE a (id INT)", Down: "DROP TABLE a"},
+	}}, mock
+}
+
+func TestPrepareSchemaRefusesNewerDatabase(t *testing.T) {
+	migrator, mock := newTestMigrator(t, 2)
+
+	err := prepareSchema(migrator, true)
+
+	var ahead *repository.SchemaAheadError
+	assert.ErrorAs(t, err, &ahead)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPrepareSchemaWithoutAutoMigrate(t *testing.T) {
+	migrator, mock := newTestMigrator(t, 0)
+
+	require.NoError(t, prepareSchema(migrator, false))
+	assert.NoError(t, mock.ExpectationsWereMet(), "nothing is applied")
+}
+
+func TestPrepareSchemaAutoMigrate(t *testing.T) {
+	migrator, mock := newTestMigrator(t, 0)
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0)")).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE a (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations")).WithArgs(1, "baseline").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, prepareSchema(migrator, true))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRunMigrateRejectsBadArgs(t *testing.T) {
+	for _, args := range [][]string{nil, {"sideways"}, {"down", "zero"}, {"down", "0"}} {
+		var usage usageError
+		assert.ErrorAs(t, runMigrate(nil, args, io.Discard), &usage, "%v", args)
+	}
+}
+
+func TestRunMigrateDownStopsAtBaseline(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(repository.BaselineVersion))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var out bytes.Buffer
+	require.NoError(t, runMigrate(db, []string{"down"}, &out))
+	assert.Equal(t, "stopped at the baseline, migration 0001 is never reverted\n", out.String())
+	assert.NoError(t, mock.ExpectationsWereMet(), "nothing is reverted")
+}
@@ -0,0 +1,80 @@
+package bootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"seanmcapp/service"
+	"seanmcapp/util"
+)
+
+// newNotificationRouter builds the channels named in the notify settings and
+// routes every service to its own. Channels are shared between services, so a
+// service routed to "telegram:personal" goes through the same outbox as any other.
+func newNotificationRouter(settings util.NotifySettings, telegram util.TelegramSettings, telegramClient external.TelegramClient, outbox service.OutboxService, digestRepo repository.DigestRepo) *service.NotificationRouter {
+	channels := make(map[string]external.Notifier)
+	channel := func(name string) external.Notifier {
+		if n, ok := channels[name]; ok {
+			return n
+		}
+
+		var n external.Notifier
+		switch name {
+		case util.NotifyTelegramPersonal:
+			n = withQuietHours(settings.QuietHours, "personal", digestRepo,
+				&service.TelegramNotifier{Outbox: outbox, TelegramClient: telegramClient, ChatID: telegram.PersonalChatID})
+		case util.NotifyTelegramGroup:
+			n = withQuietHours(settings.QuietHours, "group", digestRepo,
+				&service.TelegramNotifier{Outbox: outbox, TelegramClient: telegramClient, ChatID: telegram.GroupChatID})
+		case util.NotifyWebhook:
+			n = external.NewWebhookNotifier(settings.WebhookURL)
+		case util.NotifyDiscord:
+			n = external.NewDiscordNotifier(settings.DiscordWebhookURL)
+		case util.NotifyEmail:
+			addr := fmt.Sprintf("%s:%d", settings.SMTP.Host, settings.SMTP.Port)
+			n = external.NewEmailNotifier(addr, settings.SMTP.Username, settings.SMTP.Password, settings.SMTP.From, settings.SMTP.To)
+		default:
+			// util.GetAppSettings has already rejected unknown channels.
+			panic("unknown notification channel " + name)
+		}
+		channels[name] = n
+		return n
+	}
+
+	router := &service.NotificationRouter{Routes: make(map[string][]external.Notifier)}
+	for source, names := range settings.Routes {
+		for _, name := range names {
+			router.Routes[source] = append(router.Routes[source], channel(name))
+		}
+	}
+	return router
+}
+
+// quietHoursFor is the quiet hours of chat ("personal" or "group") for
+// source: its own when it has some, the chat's otherwise.
+func quietHoursFor(rules map[string]util.QuietHours, chat, source string) util.QuietHours {
+	if hours, ok := rules[chat+"."+source]; ok {
+		return hours
+	}
+	return rules[chat]
+}
+
+// withQuietHours puts the quiet hours configured for chat ("personal" or
+// "group") in front of its notifier. Chats without any are left as they are.
+func withQuietHours(rules map[string]util.QuietHours, chat string, digestRepo repository.DigestRepo, next *service.TelegramNotifier) external.Notifier {
+	quiet := &service.QuietHoursNotifier{Next: next, ChatID: next.ChatID, DigestRepo: digestRepo, BySource: make(map[string]util.QuietHours)}
+	configured := false
+	for key, hours := range rules {
+		if key == chat {
+			quiet.Hours, configured = hours, true
+		} else if source, ok := strings.CutPrefix(key, chat+"."); ok {
+			quiet.BySource[source], configured = hours, true
+		}
+	}
+	if !configured {
+		return next
+	}
+	return quiet
+}
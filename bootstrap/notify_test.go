@@ -0,0 +1,71 @@
+package bootstrap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"seanmcapp/external"
+	"seanmcapp/service"
+	"seanmcapp/util"
+)
+
+func TestNewNotificationRouter(t *testing.T) {
+	settings := util.NotifySettings{
+		Routes: map[string][]string{
+			service.SourceStock:     {util.NotifyEmail, util.NotifyTelegramPersonal},
+			service.SourceNews:      {util.NotifyTelegramGroup},
+			service.SourceInstagram: {util.NotifyTelegramPersonal, util.NotifyWebhook},
+		},
+		WebhookURL: "https://hooks.example.com",
+		SMTP:       util.SMTPSettings{Host: "smtp.example.com", Port: 587, From: "bot@example.com", To: []string{"me@example.com"}},
+	}
+	telegram := util.TelegramSettings{PersonalChatID: 1, GroupChatID: -2}
+
+	router := newNotificationRouter(settings, telegram, nil, nil, nil)
+
+	stock := router.Routes[service.SourceStock]
+	require.Len(t, stock, 2)
+	email, ok := stock[0].(*external.EmailNotifier)
+	require.True(t, ok)
+	assert.Equal(t, "smtp.example.com:587", email.Addr)
+	assert.Equal(t, int64(1), stock[1].(*service.TelegramNotifier).ChatID)
+
+	require.Len(t, router.Routes[service.SourceNews], 1)
+	assert.Equal(t, int64(-2), router.Routes[service.SourceNews][0].(*service.TelegramNotifier).ChatID)
+
+	// Channels are built once and shared between the services routed to them.
+	instagram := router.Routes[service.SourceInstagram]
+	require.Len(t, instagram, 2)
+	assert.Same(t, stock[1], instagram[0])
+	assert.IsType(t, &external.WebhookNotifier{}, instagram[1])
+}
+
+func TestNewNotificationRouterQuietHours(t *testing.T) {
+	settings := util.NotifySettings{
+		Routes: map[string][]string{
+			service.SourceInstagram: {util.NotifyTelegramPersonal},
+			service.SourceNews:      {util.NotifyTelegramGroup},
+		},
+		QuietHours: map[string]util.QuietHours{
+			"personal":       {Start: 22 * 60, End: 7 * 60},
+			"personal.stock": {},
+		},
+	}
+	telegram := util.TelegramSettings{PersonalChatID: 1, GroupChatID: -2}
+
+	router := newNotificationRouter(settings, telegram, nil, nil, nil)
+
+	quiet, ok := router.Routes[service.SourceInstagram][0].(*service.QuietHoursNotifier)
+	require.True(t, ok, "the personal chat has quiet hours")
+	assert.Equal(t, int64(1), quiet.ChatID)
+	assert.Equal(t, util.QuietHours{Start: 22 * 60, End: 7 * 60}, quiet.Hours)
+	assert.Equal(t, map[string]util.QuietHours{service.SourceStock: {}}, quiet.BySource)
+
+	assert.IsType(t, &service.TelegramNotifier{}, router.Routes[service.SourceNews][0], "the group chat has none")
+
+	assert.Equal(t, util.QuietHours{Start: 22 * 60, End: 7 * 60}, quietHoursFor(settings.QuietHours, "personal", service.SourceInstagram))
+	assert.Equal(t, util.QuietHours{}, quietHoursFor(settings.QuietHours, "personal", service.SourceStock))
+	assert.Equal(t, util.QuietHours{}, quietHoursFor(settings.QuietHours, "group", service.SourceInstagram))
+}
@@ -0,0 +1,62 @@
+package bootstrap
+
+import (
+	"context"
+	"log/slog"
+	"seanmcapp/service"
+	"time"
+)
+
+const outboxPollInterval = 5 * time.Second
+
+// OutboxWorker drains the notification outbox in the background. It runs
+// alongside the cron scheduler and is stopped with it on shutdown.
+type OutboxWorker struct {
+	Outbox   service.OutboxService
+	Interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Start begins draining in the background until Stop is called.
+func (w *OutboxWorker) Start() {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = outboxPollInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			// A batch is finished even on shutdown, see Stop.
+			safeRun(func() { w.Outbox.Drain(context.WithoutCancel(ctx)) })
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	slog.Info("draining notification outbox", "interval", interval.String())
+}
+
+// Stop returns a context that is done once the batch being sent (if any) has
+// finished, mirroring cron.Cron.Stop.
+func (w *OutboxWorker) Stop() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	if w.cancel == nil {
+		cancel()
+		return ctx
+	}
+	w.cancel()
+	go func() {
+		<-w.done
+		cancel()
+	}()
+	return ctx
+}
@@ -0,0 +1,54 @@
+package bootstrap
+
+import (
+	"context"
+	"database/sql"
+	"seanmcapp/repository"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOutbox struct {
+	drains atomic.Int32
+}
+
+func (f *fakeOutbox) Enqueue(context.Context, int64, ...string) error { return nil }
+func (f *fakeOutbox) EnqueueKind(context.Context, int64, string, ...string) error {
+	return nil
+}
+func (f *fakeOutbox) EnqueueWith(context.Context, int64, func(*sql.Tx) error, ...string) error {
+	return nil
+}
+func (f *fakeOutbox) Drain(context.Context) { f.drains.Add(1) }
+func (f *fakeOutbox) Stats() (repository.OutboxStats, error) {
+	return repository.OutboxStats{}, nil
+}
+
+func TestOutboxWorker(t *testing.T) {
+	outbox := &fakeOutbox{}
+	w := &OutboxWorker{Outbox: outbox, Interval: time.Millisecond}
+
+	w.Start()
+	assert.Eventually(t, func() bool { return outbox.drains.Load() >= 3 }, time.Second, time.Millisecond)
+
+	select {
+	case <-w.Stop().Done():
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop")
+	}
+	stopped := outbox.drains.Load()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, stopped, outbox.drains.Load(), "no drains after Stop")
+}
+
+func TestOutboxWorkerStopBeforeStart(t *testing.T) {
+	w := &OutboxWorker{}
+	select {
+	case <-w.Stop().Done():
+	default:
+		t.Fatal("Stop on a worker that never started should be done immediately")
+	}
+}
@@ -0,0 +1,101 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"seanmcapp/service"
+	"time"
+)
+
+const (
+	pollTimeout    = 30 * time.Second
+	pollRetryDelay = 5 * time.Second
+)
+
+// UpdatePoller feeds the bot from getUpdates long polling instead of the
+// webhook, for local development and deployments without a public HTTPS URL.
+type UpdatePoller struct {
+	TelegramClient external.TelegramClient
+	OffsetRepo     repository.TelegramOffsetRepo
+	Bot            service.BotService
+	Botname        string
+	Allowed        chatAllowlist
+	cancel         context.CancelFunc
+	done           chan struct{}
+}
+
+// Start begins polling in the background until Stop is called.
+func (p *UpdatePoller) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		p.run(ctx)
+	}()
+	slog.Info("polling telegram for updates")
+}
+
+// Stop aborts the in-flight long poll, and the requests of the update being
+// handled (if any), and returns a context that is done once that update has
+// finished, mirroring cron.Cron.Stop.
+func (p *UpdatePoller) Stop() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	if p.cancel == nil {
+		cancel()
+		return ctx
+	}
+	p.cancel()
+	go func() {
+		<-p.done
+		cancel()
+	}()
+	return ctx
+}
+
+func (p *UpdatePoller) run(ctx context.Context) {
+	offset, err := p.OffsetRepo.Get(ctx, p.Botname)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		slog.Error("loading telegram update offset", "service", "telegram", "error", err)
+	}
+	if offset > 0 {
+		offset++ // resume after the last processed update
+	}
+
+	for ctx.Err() == nil {
+		updates, err := p.TelegramClient.GetUpdates(ctx, offset, pollTimeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("polling telegram updates", "service", "telegram", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollRetryDelay):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			p.handle(ctx, update)
+			offset = update.UpdateID + 1
+			// Saved even on shutdown, so a handled update is not handled again.
+			if err := p.OffsetRepo.Save(context.WithoutCancel(ctx), p.Botname, update.UpdateID); err != nil {
+				slog.Error("saving telegram update offset", "service", "telegram", "update_id", update.UpdateID, "error", err)
+			}
+		}
+	}
+}
+
+func (p *UpdatePoller) handle(ctx context.Context, update external.TelegramUpdate) {
+	if !p.Allowed.allows(update) {
+		chatID, _ := update.ChatID()
+		recordRejection("chat", fmt.Sprintf("polled update %d", update.UpdateID), fmt.Sprintf("chat %d is not allowed", chatID))
+		return
+	}
+	safeRun(func() { p.Bot.HandleUpdate(ctx, update) })
+}
@@ -0,0 +1,120 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUpdatesClient serves the queued batches, then blocks until cancelled like
+// an idle long poll. Only GetUpdates is implemented.
+type fakeUpdatesClient struct {
+	external.TelegramClient
+	mu      sync.Mutex
+	batches [][]external.TelegramUpdate
+	offsets []int64
+}
+
+func (f *fakeUpdatesClient) GetUpdates(ctx context.Context, offset int64, _ time.Duration) ([]external.TelegramUpdate, error) {
+	f.mu.Lock()
+	f.offsets = append(f.offsets, offset)
+	if len(f.batches) > 0 {
+		batch := f.batches[0]
+		f.batches = f.batches[1:]
+		f.mu.Unlock()
+		return batch, nil
+	}
+	f.mu.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+type fakeOffsetRepo struct {
+	mu     sync.Mutex
+	stored int64
+	getErr error
+	saved  []int64
+}
+
+func (f *fakeOffsetRepo) Get(context.Context, string) (int64, error) {
+	return f.stored, f.getErr
+}
+
+func (f *fakeOffsetRepo) Save(_ context.Context, _ string, updateID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saved = append(f.saved, updateID)
+	return nil
+}
+
+func (f *fakeOffsetRepo) savedIDs() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int64(nil), f.saved...)
+}
+
+func chatUpdate(updateID, chatID int64) external.TelegramUpdate {
+	text := "/help"
+	return external.TelegramUpdate{UpdateID: updateID, Message: &external.TelegramResult{
+		Chat: external.TelegramChat{ID: chatID},
+		Text: &text,
+	}}
+}
+
+func TestUpdatePoller(t *testing.T) {
+	client := &fakeUpdatesClient{batches: [][]external.TelegramUpdate{
+		{chatUpdate(11, 42), chatUpdate(12, 7)},
+	}}
+	repo := &fakeOffsetRepo{stored: 10}
+	bot := &fakeBot{}
+	p := &UpdatePoller{TelegramClient: client, OffsetRepo: repo, Bot: bot, Botname: "bot", Allowed: newChatAllowlist([]int64{42})}
+	rejected := telegramRejections.WithLabelValues("chat")
+	rejectedBefore := testutil.ToFloat64(rejected)
+
+	p.Start()
+	require.Eventually(t, func() bool { return len(repo.savedIDs()) == 2 }, time.Second, 5*time.Millisecond)
+
+	select {
+	case <-p.Stop().Done():
+	case <-time.After(time.Second):
+		t.Fatal("poller did not stop")
+	}
+
+	// Resumes after the stored offset, then acknowledges the whole batch.
+	assert.Equal(t, []int64{11, 13}, client.offsets)
+	assert.Equal(t, []int64{11, 12}, repo.savedIDs())
+	// The foreign chat's update is consumed but never reaches the bot.
+	require.Len(t, bot.updates, 1)
+	assert.Equal(t, int64(11), bot.updates[0].UpdateID)
+	assert.ErrorIs(t, bot.ctxs[0].Err(), context.Canceled, "handled under the poller's context")
+	assert.Equal(t, rejectedBefore+1, testutil.ToFloat64(rejected))
+}
+
+func TestUpdatePollerStartsFromZeroWithoutStoredOffset(t *testing.T) {
+	client := &fakeUpdatesClient{}
+	repo := &fakeOffsetRepo{getErr: repository.ErrNotFound}
+	p := &UpdatePoller{TelegramClient: client, OffsetRepo: repo, Bot: &fakeBot{}, Allowed: newChatAllowlist(nil)}
+
+	p.Start()
+	require.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.offsets) == 1
+	}, time.Second, 5*time.Millisecond)
+	<-p.Stop().Done()
+
+	assert.Equal(t, []int64{0}, client.offsets)
+}
+
+func TestUpdatePollerStopBeforeStart(t *testing.T) {
+	p := &UpdatePoller{}
+	assert.True(t, errors.Is(p.Stop().Err(), context.Canceled))
+}
@@ -1,6 +1,7 @@
 package bootstrap
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"os"
@@ -57,14 +58,14 @@ func resolve[T any](c *gin.Context, result T, err error) {
 	}
 }
 
-func handleJSON[Req any, Res any](fn func(Req) (Res, error)) gin.HandlerFunc {
+func handleJSON[Req any, Res any](fn func(context.Context, Req) (Res, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var payload Req
 		if err := c.ShouldBindJSON(&payload); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
 			return
 		}
-		res, err := fn(payload)
+		res, err := fn(c.Request.Context(), payload)
 		resolve(c, res, err)
 	}
 }
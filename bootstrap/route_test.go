@@ -1,6 +1,7 @@
 package bootstrap
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -50,7 +51,7 @@ type sampleReq struct {
 
 func TestHandleJSON(t *testing.T) {
 	r := gin.New()
-	r.POST("/t", handleJSON(func(req sampleReq) (int, error) {
+	r.POST("/t", handleJSON(func(_ context.Context, req sampleReq) (int, error) {
 		return req.Value * 2, nil
 	}))
 
@@ -114,3 +115,23 @@ func TestServeIndexMissingFile(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+
+func TestInitRouterSkipsTurnedOffFeatures(t *testing.T) {
+	routes := func(services MainServices) []string {
+		var paths []string
+		for _, route := range InitRouter(services, util.AppsSettings{}).Routes() {
+			paths = append(paths, route.Method+" "+route.Path)
+		}
+		return paths
+	}
+
+	walletOnly := routes(MainServices{WalletService: &fakeWallets{}})
+	assert.Contains(t, walletOnly, "POST /api/wallet/login")
+	for _, path := range walletOnly {
+		assert.NotContains(t, path, "/api/stock", "stock is off")
+		assert.NotEqual(t, "POST /api/webhook", path, "telegram is off")
+	}
+
+	withStock := routes(MainServices{WalletService: &fakeWallets{}, StockService: &fakeStocks{}})
+	assert.Contains(t, withStock, "POST /api/stock/getAll")
+}
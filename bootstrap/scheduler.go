@@ -1,26 +1,43 @@
 package bootstrap
 
 import (
+	"context"
+	"log/slog"
+	"time"
+
+	"seanmcapp/repository"
+
 	"github.com/robfig/cron/v3"
 )
 
 
+// ScheduledTask is a job. Run returns how many items it processed, e.g.
+// stocks checked or headlines sent, and stops early once ctx is done.
 type ScheduledTask interface {
-	Run()
+	Run(ctx context.Context) (int, error)
 }
 
 type Scheduler struct {
+	Name     string // job label in logs, metrics and the job history
 	Task     ScheduledTask
+	Runner   *JobRunner
+	Claims   repository.JobClaimRepo // nil runs the job on every instance
 	CronExpr string
 	Repeat   bool
 }
 
+// claimTimeout bounds claiming an execution, so a slow database delays a run
+// by seconds at most before it is skipped.
+const claimTimeout = 5 * time.Second
+
 func (s *Scheduler) Schedule(cronEngine *cron.Cron) (cron.EntryID, error) {
 	var entryID cron.EntryID
 	var err error
 
 	entryID, err = cronEngine.AddFunc(s.CronExpr, func() {
-		s.Task.Run()
+		// Prev is the time this execution was scheduled for, the same on
+		// every instance however late each one fires.
+		s.run(cronEngine.Entry(entryID).Prev)
 		if !s.Repeat {
 			cronEngine.Remove(entryID)
 		}
@@ -28,3 +45,30 @@ func (s *Scheduler) Schedule(cronEngine *cron.Cron) (cron.EntryID, error) {
 
 	return entryID, err
 }
+
+// run runs the execution scheduled at scheduledAt unless another instance
+// already has: with Claims, only the instance that claims it runs the job,
+// the others skip it.
+func (s *Scheduler) run(scheduledAt time.Time) {
+	ctx := s.Runner.runContext()
+	if s.Claims == nil {
+		s.Runner.Run(ctx, s.Name, repository.TriggerCron, s.Task)
+		return
+	}
+	if scheduledAt.IsZero() { // run by hand, outside the cron
+		scheduledAt = time.Now().Truncate(time.Second)
+	}
+
+	claimCtx, cancel := context.WithTimeout(ctx, claimTimeout)
+	ok, err := s.Claims.Claim(claimCtx, s.Name, scheduledAt)
+	cancel()
+	if err != nil {
+		slog.Error("claiming job run, skipping this run", "job", s.Name, "scheduled_at", scheduledAt, "error", err)
+		return
+	}
+	if !ok {
+		slog.Info("job run claimed by another instance, skipping", "job", s.Name, "scheduled_at", scheduledAt)
+		return
+	}
+	s.Runner.Run(ctx, s.Name, repository.TriggerCron, s.Task)
+}
@@ -1,16 +1,31 @@
 package bootstrap
 
 import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"seanmcapp/repository"
 )
 
-type fakeTask struct{ runs int }
+type fakeTask struct {
+	runs  int
+	items int
+	err   error
+}
 
-func (f *fakeTask) Run() { f.runs++ }
+func (f *fakeTask) Run(context.Context) (int, error) {
+	f.runs++
+	return f.items, f.err
+}
 
 func TestScheduleInvalidExpr(t *testing.T) {
 	c := cron.New(cron.WithSeconds())
@@ -48,3 +63,95 @@ func TestScheduleOnce(t *testing.T) {
 	assert.Empty(t, c.Entries(), "one-shot task should remove itself after running")
 }
 
+func TestScheduleClaimsExecution(t *testing.T) {
+	claimQuery := regexp.QuoteMeta("INSERT INTO job_claims (job, scheduled_at)")
+	cleanupQuery := regexp.QuoteMeta("DELETE FROM job_claims")
+
+	tests := map[string]struct {
+		expect  func(mock sqlmock.Sqlmock)
+		wantRun bool
+		wantLog string
+	}{
+		"unclaimed": {
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(claimQuery).WithArgs("news", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(cleanupQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantRun: true,
+		},
+		"claimed by another instance": {
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(claimQuery).WithArgs("news", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantLog: "job run claimed by another instance, skipping",
+		},
+		"claim error": {
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(claimQuery).WillReturnError(errors.New("db down"))
+			},
+			wantLog: "claiming job run, skipping this run",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			logs := captureLogs(t)
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			tt.expect(mock)
+
+			c := cron.New(cron.WithSeconds())
+			task := &fakeTask{}
+			s := &Scheduler{Name: "news", Task: task, Claims: &repository.JobClaimRepoImpl{DB: db}, CronExpr: "0 0 9 * * *", Repeat: true}
+			id, err := s.Schedule(c)
+			require.NoError(t, err)
+			c.Entry(id).Job.Run()
+
+			assert.Equal(t, tt.wantRun, task.runs == 1)
+			if tt.wantLog != "" {
+				assert.Contains(t, logs.String(), tt.wantLog)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// fakeClaims keeps claims in memory, shared like the job_claims table.
+type fakeClaims struct {
+	mu      sync.Mutex
+	claimed map[string]bool
+	ctxs    []context.Context
+}
+
+func (f *fakeClaims) Claim(ctx context.Context, job string, scheduledAt time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ctxs = append(f.ctxs, ctx)
+	key := job + "@" + scheduledAt.UTC().String()
+	if f.claimed[key] {
+		return false, nil
+	}
+	f.claimed[key] = true
+	return true, nil
+}
+
+func TestScheduledExecutionRunsOnce(t *testing.T) {
+	captureLogs(t)
+	claims := &fakeClaims{claimed: make(map[string]bool)}
+	task := &fakeTask{}
+	first := &Scheduler{Name: "news", Task: task, Claims: claims}
+	second := &Scheduler{Name: "news", Task: task, Claims: claims}
+	scheduledAt := time.Date(2026, time.March, 10, 9, 0, 0, 0, time.UTC)
+
+	first.run(scheduledAt)
+	// The second instance fires after the first has finished its run.
+	second.run(scheduledAt)
+	assert.Equal(t, 1, task.runs, "the finished execution is not run again")
+
+	second.run(scheduledAt.Add(24 * time.Hour))
+	assert.Equal(t, 2, task.runs, "the next execution runs")
+
+	deadline, ok := claims.ctxs[0].Deadline()
+	require.True(t, ok, "claiming is bounded")
+	assert.WithinDuration(t, time.Now().Add(claimTimeout), deadline, claimTimeout)
+}
@@ -0,0 +1,226 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"seanmcapp/repository"
+	"seanmcapp/service"
+
+	"github.com/robfig/cron/v3"
+)
+
+// defaultTimezone is the timezone schedules are read in unless they name
+// another.
+const defaultTimezone = "Asia/Jakarta"
+
+// defaultSchedules are used for jobs the job_schedules table has no row for,
+// and for all of them without Postgres.
+var defaultSchedules = map[string]repository.JobSchedule{
+	"news":      {Job: "news", CronExpr: "0 0 9 * * *", Timezone: defaultTimezone, Enabled: true},
+	"stock":     {Job: "stock", CronExpr: "0 0 19 * * *", Timezone: defaultTimezone, Enabled: true},
+	"instagram": {Job: "instagram", CronExpr: "0 0 * * * *", Timezone: defaultTimezone, Enabled: true},
+	"digest":    {Job: "digest", CronExpr: "0 * * * * *", Timezone: defaultTimezone, Enabled: true},
+}
+
+// scheduleReloadInterval is how often each instance re-reads job_schedules,
+// so a schedule changed through another instance reaches it too.
+const scheduleReloadInterval = time.Minute
+
+// cronParser reads cron expressions the way InitScheduler's cron does, with
+// a leading seconds field.
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// validateSchedule checks s's cron expression and timezone, filling in the
+// default timezone when it has none.
+func validateSchedule(s *repository.JobSchedule) error {
+	s.CronExpr = strings.TrimSpace(s.CronExpr)
+	if s.Timezone == "" {
+		s.Timezone = defaultTimezone
+	}
+	if strings.HasPrefix(s.CronExpr, "CRON_TZ=") || strings.HasPrefix(s.CronExpr, "TZ=") {
+		return service.ValidationError{Message: "set the timezone on its own, not in the cron expression"}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return service.ValidationError{Message: fmt.Sprintf("unknown timezone %q", s.Timezone)}
+	}
+	if _, err := cronParser.Parse(s.CronExpr); err != nil {
+		return service.ValidationError{Message: fmt.Sprintf("invalid cron expression %q: %v", s.CronExpr, err)}
+	}
+	return nil
+}
+
+// loadSchedules is the schedule of every job: the stored one when there is
+// one, the default otherwise.
+func (r *JobRunner) loadSchedules(ctx context.Context) map[string]repository.JobSchedule {
+	schedules := make(map[string]repository.JobSchedule, len(defaultSchedules))
+	for name, s := range defaultSchedules {
+		schedules[name] = s
+	}
+	if r.Schedules == nil {
+		return schedules
+	}
+
+	stored, err := r.Schedules.List(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "loading job schedules, using the defaults", "error", err)
+		return schedules
+	}
+	for _, s := range stored {
+		if _, ok := schedules[s.Job]; ok {
+			schedules[s.Job] = s
+		}
+	}
+	return schedules
+}
+
+// watchSchedules reloads the schedules of tasks every interval until ctx is
+// done.
+func (r *JobRunner) watchSchedules(ctx context.Context, interval time.Duration, tasks map[string]ScheduledTask) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reloadSchedules(ctx, tasks)
+		}
+	}
+}
+
+// reloadSchedules reschedules the jobs of tasks whose stored schedule has
+// changed, e.g. by UpdateSchedule on another instance. When the table cannot
+// be read, or a stored schedule is invalid, the current schedules are kept;
+// an invalid one is reported once, not on every reload.
+func (r *JobRunner) reloadSchedules(ctx context.Context, tasks map[string]ScheduledTask) {
+	stored, err := r.Schedules.List(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "reloading job schedules, keeping the current ones", "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reloaded == nil {
+		r.reloaded = make(map[string]time.Time)
+	}
+	for _, s := range stored {
+		task, ok := tasks[s.Job]
+		if !ok || r.reloaded[s.Job].Equal(s.UpdatedAt) {
+			continue
+		}
+		r.reloaded[s.Job] = s.UpdatedAt
+
+		current := r.entries[s.Job].schedule
+		if err := validateSchedule(&s); err != nil {
+			slog.Error("invalid job schedule, keeping the current one", "job", s.Job, "cron", s.CronExpr, "error", err)
+			continue
+		}
+		if s.CronExpr == current.CronExpr && s.Timezone == current.Timezone && s.Enabled == current.Enabled {
+			continue
+		}
+		if err := r.setScheduleLocked(s.Job, task, s); err != nil {
+			slog.Error("rescheduling job", "job", s.Job, "error", err)
+			continue
+		}
+		slog.Warn("job schedule reloaded", "job", s.Job,
+			"from", current.CronExpr, "to", s.CronExpr, "timezone", s.Timezone, "enabled", s.Enabled)
+	}
+}
+
+// useCron makes the runner schedule jobs on c, running them and the triggered
+// ones under ctx. Until then schedules are only recorded.
+func (r *JobRunner) useCron(ctx context.Context, c *cron.Cron) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctx = ctx
+	r.cron = c
+	r.entries = make(map[string]jobEntry)
+}
+
+// setSchedule (re)schedules task as name on s, replacing its cron entry, or
+// only removing it when s is disabled.
+func (r *JobRunner) setSchedule(name string, task ScheduledTask, s repository.JobSchedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.setScheduleLocked(name, task, s)
+}
+
+func (r *JobRunner) setScheduleLocked(name string, task ScheduledTask, s repository.JobSchedule) error {
+	if err := validateSchedule(&s); err != nil {
+		return err
+	}
+
+	entry := jobEntry{schedule: s}
+	if s.Enabled && r.cron != nil {
+		scheduler := &Scheduler{Name: name, Task: task, Runner: r, Claims: r.Claims, CronExpr: "CRON_TZ=" + s.Timezone + " " + s.CronExpr, Repeat: true}
+		id, err := scheduler.Schedule(r.cron)
+		if err != nil {
+			return err
+		}
+		entry.id = id
+	}
+	if old, ok := r.entries[name]; ok && old.id != 0 {
+		r.cron.Remove(old.id)
+	}
+	if r.entries == nil {
+		r.entries = make(map[string]jobEntry)
+	}
+	r.entries[name] = entry
+	return nil
+}
+
+// UpdateSchedule changes the schedule of name, starting from its current one,
+// stores it and reschedules the job straight away. Other instances pick the
+// change up on their next reload.
+func (r *JobRunner) UpdateSchedule(ctx context.Context, name string, task ScheduledTask, change func(*repository.JobSchedule)) (repository.JobSchedule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, ok := r.entries[name]
+	if !ok {
+		previous.schedule = defaultSchedules[name]
+	}
+	s := previous.schedule
+	s.Job = name
+	change(&s)
+	if err := validateSchedule(&s); err != nil {
+		return repository.JobSchedule{}, err
+	}
+
+	saved, err := r.Schedules.Save(ctx, s)
+	if err != nil {
+		return repository.JobSchedule{}, err
+	}
+	if err := r.setScheduleLocked(name, task, saved); err != nil {
+		return repository.JobSchedule{}, err
+	}
+	slog.Warn("job schedule changed", "job", name,
+		"from", previous.schedule.CronExpr, "to", saved.CronExpr, "timezone", saved.Timezone, "enabled", saved.Enabled)
+	return saved, nil
+}
+
+// Schedule is name's current schedule; ok is false when it is not scheduled.
+func (r *JobRunner) Schedule(name string) (s repository.JobSchedule, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[name]
+	return entry.schedule, ok
+}
+
+// Next is when name runs next. ok is false when it is not scheduled or is
+// disabled, or before the cron has started.
+func (r *JobRunner) Next(name string) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[name]
+	if !ok || entry.id == 0 {
+		return time.Time{}, false
+	}
+	next := r.cron.Entry(entry.id).Next
+	return next, !next.IsZero()
+}
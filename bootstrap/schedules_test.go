@@ -0,0 +1,286 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"seanmcapp/repository"
+	"seanmcapp/service"
+	"seanmcapp/util"
+)
+
+// fakeJobSchedules keeps the stored schedules in memory.
+type fakeJobSchedules struct {
+	stored  []repository.JobSchedule
+	listErr error
+	saveErr error
+}
+
+func (f *fakeJobSchedules) List(context.Context) ([]repository.JobSchedule, error) {
+	return f.stored, f.listErr
+}
+
+func (f *fakeJobSchedules) Save(_ context.Context, s repository.JobSchedule) (repository.JobSchedule, error) {
+	if f.saveErr != nil {
+		return repository.JobSchedule{}, f.saveErr
+	}
+	s.UpdatedAt = time.Now()
+	f.stored = append(f.stored, s)
+	return s, nil
+}
+
+func TestValidateSchedule(t *testing.T) {
+	tests := map[string]struct {
+		schedule repository.JobSchedule
+		wantErr  string
+	}{
+		"ok":               {schedule: repository.JobSchedule{CronExpr: " 0 30 16 * * 1-5 ", Timezone: "Asia/Singapore"}},
+		"descriptor":       {schedule: repository.JobSchedule{CronExpr: "@hourly"}},
+		"without seconds":  {schedule: repository.JobSchedule{CronExpr: "0 9 * * *"}, wantErr: `invalid cron expression "0 9 * * *"`},
+		"nonsense":         {schedule: repository.JobSchedule{CronExpr: "every day"}, wantErr: "invalid cron expression"},
+		"unknown timezone": {schedule: repository.JobSchedule{CronExpr: "0 0 9 * * *", Timezone: "Mars/Olympus"}, wantErr: `unknown timezone "Mars/Olympus"`},
+		"timezone inline":  {schedule: repository.JobSchedule{CronExpr: "CRON_TZ=UTC 0 0 9 * * *"}, wantErr: "set the timezone on its own"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := tt.schedule
+			err := validateSchedule(&s)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, strings.TrimSpace(tt.schedule.CronExpr), s.CronExpr)
+				assert.NotEmpty(t, s.Timezone)
+				return
+			}
+			var ve service.ValidationError
+			require.ErrorAs(t, err, &ve)
+			assert.Contains(t, ve.Message, tt.wantErr)
+		})
+	}
+
+	s := repository.JobSchedule{CronExpr: "0 0 9 * * *"}
+	require.NoError(t, validateSchedule(&s))
+	assert.Equal(t, "Asia/Jakarta", s.Timezone)
+}
+
+func TestLoadSchedules(t *testing.T) {
+	captureLogs(t)
+	assert.Equal(t, defaultSchedules, (&JobRunner{}).loadSchedules(t.Context()))
+
+	stock := repository.JobSchedule{Job: "stock", CronExpr: "0 30 16 * * 1-5", Timezone: "Asia/Jakarta"}
+	runner := &JobRunner{Schedules: &fakeJobSchedules{stored: []repository.JobSchedule{
+		stock,
+		{Job: "weather", CronExpr: "@hourly", Timezone: "UTC", Enabled: true},
+	}}}
+	schedules := runner.loadSchedules(t.Context())
+	assert.Equal(t, stock, schedules["stock"])
+	assert.Equal(t, defaultSchedules["news"], schedules["news"], "jobs without a row keep the default")
+	assert.NotContains(t, schedules, "weather")
+
+	runner.Schedules = &fakeJobSchedules{listErr: errors.New("db down")}
+	assert.Equal(t, defaultSchedules, runner.loadSchedules(t.Context()))
+}
+
+func TestJobRunnerSetSchedule(t *testing.T) {
+	c := cron.New(cron.WithSeconds())
+	runner := &JobRunner{}
+	runner.useCron(t.Context(), c)
+	task := &fakeTask{}
+
+	require.NoError(t, runner.setSchedule("news", task, defaultSchedules["news"]))
+	_, ok := runner.Next("news")
+	assert.False(t, ok, "cron computes the next run once started")
+
+	c.Start()
+	defer c.Stop()
+	next, ok := runner.Next("news")
+	require.True(t, ok)
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	assert.Equal(t, 9, next.In(jakarta).Hour())
+	assert.True(t, next.After(time.Now()))
+
+	t.Run("timezone", func(t *testing.T) {
+		require.NoError(t, runner.setSchedule("news", task, repository.JobSchedule{CronExpr: "0 0 9 * * *", Timezone: "America/New_York", Enabled: true}))
+		newYork, err := time.LoadLocation("America/New_York")
+		require.NoError(t, err)
+		next, ok := runner.Next("news")
+		require.True(t, ok)
+		assert.Equal(t, 9, next.In(newYork).Hour())
+		assert.Len(t, c.Entries(), 1, "the old entry is replaced")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		require.NoError(t, runner.setSchedule("news", task, repository.JobSchedule{CronExpr: "0 0 9 * * *", Enabled: false}))
+		_, ok := runner.Next("news")
+		assert.False(t, ok)
+		assert.Empty(t, c.Entries())
+		s, ok := runner.Schedule("news")
+		require.True(t, ok)
+		assert.False(t, s.Enabled)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Error(t, runner.setSchedule("news", task, repository.JobSchedule{CronExpr: "daily", Enabled: true}))
+		s, _ := runner.Schedule("news")
+		assert.Equal(t, "0 0 9 * * *", s.CronExpr, "an invalid schedule changes nothing")
+	})
+
+	_, ok = runner.Schedule("stock")
+	assert.False(t, ok)
+}
+
+func TestInitSchedulerUsesStoredSchedules(t *testing.T) {
+	captureLogs(t)
+	runner := &JobRunner{Schedules: &fakeJobSchedules{stored: []repository.JobSchedule{
+		{Job: "news", CronExpr: "0 15 7 * * *", Timezone: "Asia/Jakarta", Enabled: true},
+		{Job: "stock", CronExpr: "every evening", Timezone: "Asia/Jakarta", Enabled: true},
+	}}}
+	services := MainServices{NewsService: &fakeTask{}, StockService: &fakeStocks{}, Jobs: runner, Health: NewHealth()}
+
+	c := InitScheduler(t.Context(), services)
+	defer c.Stop()
+
+	news, _ := runner.Schedule("news")
+	assert.Equal(t, "0 15 7 * * *", news.CronExpr)
+	stock, _ := runner.Schedule("stock")
+	assert.Equal(t, defaultSchedules["stock"], stock, "an invalid stored schedule falls back to the default")
+	_, ok := runner.Schedule("instagram")
+	assert.False(t, ok, "turned-off features are not scheduled")
+	assert.Len(t, c.Entries(), 2)
+}
+
+func TestReloadSchedulesPicksUpOtherInstancesChanges(t *testing.T) {
+	logs := captureLogs(t)
+	shared := &fakeJobSchedules{}
+	tasks := map[string]ScheduledTask{"news": &fakeTask{}, "stock": &fakeStocks{}}
+	instance := func() (*JobRunner, *cron.Cron) {
+		runner := &JobRunner{Schedules: shared}
+		c := cron.New(cron.WithSeconds())
+		runner.useCron(t.Context(), c)
+		for _, name := range sortedJobNames(tasks) {
+			require.NoError(t, runner.setSchedule(name, tasks[name], runner.loadSchedules(t.Context())[name]))
+		}
+		return runner, c
+	}
+	a, _ := instance()
+	b, bCron := instance()
+
+	_, err := a.UpdateSchedule(t.Context(), "stock", tasks["stock"], func(s *repository.JobSchedule) { s.CronExpr = "0 30 16 * * 1-5" })
+	require.NoError(t, err)
+	stock, _ := b.Schedule("stock")
+	assert.Equal(t, "0 0 19 * * *", stock.CronExpr, "b has not reloaded yet")
+
+	b.reloadSchedules(t.Context(), tasks)
+	stock, _ = b.Schedule("stock")
+	assert.Equal(t, "0 30 16 * * 1-5", stock.CronExpr)
+	assert.Len(t, bCron.Entries(), 2, "the old entry is replaced")
+
+	logs.Reset()
+	a.reloadSchedules(t.Context(), tasks)
+	assert.NotContains(t, logs.String(), "job schedule reloaded", "a already runs its own change")
+
+	t.Run("disabled elsewhere", func(t *testing.T) {
+		_, err := a.UpdateSchedule(t.Context(), "news", tasks["news"], func(s *repository.JobSchedule) { s.Enabled = false })
+		require.NoError(t, err)
+		b.reloadSchedules(t.Context(), tasks)
+		_, ok := b.Next("news")
+		assert.False(t, ok)
+		assert.Len(t, bCron.Entries(), 1)
+	})
+
+	t.Run("invalid or unreadable schedules are kept", func(t *testing.T) {
+		logs.Reset()
+		for i := range shared.stored {
+			if shared.stored[i].Job == "stock" {
+				shared.stored[i].CronExpr, shared.stored[i].UpdatedAt = "daily", time.Now()
+			}
+		}
+		b.reloadSchedules(t.Context(), tasks)
+		b.reloadSchedules(t.Context(), tasks)
+		stock, _ := b.Schedule("stock")
+		assert.Equal(t, "0 30 16 * * 1-5", stock.CronExpr)
+		assert.Equal(t, 1, strings.Count(logs.String(), "invalid job schedule"), "reported once")
+
+		shared.listErr = errors.New("db down")
+		defer func() { shared.listErr = nil }()
+		b.reloadSchedules(t.Context(), tasks)
+		stock, _ = b.Schedule("stock")
+		assert.Equal(t, "0 30 16 * * 1-5", stock.CronExpr)
+	})
+}
+
+func TestScheduleRoute(t *testing.T) {
+	settings := util.AppsSettings{WalletSettings: util.WalletSettings{SecretKey: "secret", Password: "pw"}}
+	token := util.JwtCreateToken(settings.WalletSettings, "pw")
+	captureLogs(t)
+
+	schedules := &fakeJobSchedules{}
+	runner := &JobRunner{Schedules: schedules}
+	services := MainServices{WalletService: &fakeWallets{}, NewsService: &fakeTask{}, StockService: &fakeStocks{}, Jobs: runner}
+	c := cron.New(cron.WithSeconds())
+	runner.useCron(t.Context(), c)
+	require.NoError(t, runner.setSchedule("stock", services.StockService, defaultSchedules["stock"]))
+	c.Start()
+	defer c.Stop()
+
+	r := InitRouter(services, settings)
+	put := func(path, body, auth string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Authorization", auth)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var res map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res), w.Body.String())
+		return w.Code, res
+	}
+
+	code, _ := put("/api/jobs/stock/schedule", `{"cron":"0 30 16 * * 1-5"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = put("/api/jobs/instagram/schedule", `{"cron":"0 30 16 * * 1-5"}`, token)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = put("/api/jobs/stock/schedule", `{"cron":`, token)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, body := put("/api/jobs/stock/schedule", `{"cron":"0 30 16 * *"}`, token)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body["error"], "invalid cron expression")
+	assert.Empty(t, schedules.stored, "invalid schedules are not saved")
+
+	code, body = put("/api/jobs/stock/schedule", `{"cron":"0 30 16 * * *"}`, token)
+	require.Equal(t, http.StatusOK, code, body)
+	saved := body["data"].(map[string]any)
+	assert.Equal(t, "0 30 16 * * *", saved["cron"])
+	assert.Equal(t, "Asia/Jakarta", saved["timezone"], "fields left out keep their value")
+	assert.Equal(t, true, saved["enabled"])
+	require.Len(t, schedules.stored, 1)
+	next, ok := runner.Next("stock")
+	require.True(t, ok)
+	assert.Equal(t, 30, next.Minute(), "rescheduled without a restart")
+
+	code, body = put("/api/jobs/news/schedule", `{"enabled":false}`, token)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Equal(t, "0 0 9 * * *", body["data"].(map[string]any)["cron"], "a job without a schedule starts from its default")
+	_, ok = runner.Next("news")
+	assert.False(t, ok)
+
+	schedules.saveErr = errors.New("db down")
+	code, _ = put("/api/jobs/stock/schedule", `{"enabled":false}`, token)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	_, ok = runner.Next("stock")
+	assert.True(t, ok, "a schedule that was not saved is not applied")
+
+	runner.Schedules = nil
+	code, _ = put("/api/jobs/stock/schedule", `{"enabled":false}`, token)
+	assert.Equal(t, http.StatusNotImplemented, code)
+}
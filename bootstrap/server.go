@@ -1,7 +1,9 @@
 package bootstrap
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"seanmcapp/util"
 	"strconv"
@@ -12,17 +14,22 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
-func InitRouter(mainServices MainServices, walletSettings util.WalletSettings) *gin.Engine {
-	r := gin.Default()
+func InitRouter(mainServices MainServices, settings util.AppsSettings) *gin.Engine {
+	walletSettings := settings.WalletSettings
+	r := gin.New()
+	r.Use(requestIDMiddleware(), requestLogger(), recoverer())
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:8080", "https://seanmcapp.herokuapp.com"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", requestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", requestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	registerMetricsRoutes(r, mainServices.Metrics, settings.MetricsToken)
+	registerHealthRoutes(r, mainServices.Health)
+
 	// Frontend routes
 	r.GET("/", serveIndex)
 	r.Static("/static", util.GetFrontendPath()+"/static")
@@ -31,9 +38,13 @@ func InitRouter(mainServices MainServices, walletSettings util.WalletSettings) *
 	// API routes
 	api := r.Group("/api")
 	{
-		api.POST("/webhook", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"status": "ok"})
-		})
+		if mainServices.BotService != nil {
+			api.POST("/webhook",
+				webhookSecretMiddleware(telegramSecretHeader, settings.TelegramSettings.WebhookSecret),
+				telegramAllowlistMiddleware(newChatAllowlist(settings.TelegramSettings.AllowedChatIDs)),
+				telegramWebhook(mainServices.BotService),
+			)
+		}
 
 		wallet := api.Group("/wallet")
 		{
@@ -56,7 +67,7 @@ func InitRouter(mainServices MainServices, walletSettings util.WalletSettings) *
 			wallet.GET("/dashboard", authMiddleware(walletSettings), func(c *gin.Context) {
 				dateStr := c.Query("date")
 				date, _ := strconv.Atoi(dateStr)
-				res, err := mainServices.WalletService.Dashboard(date)
+				res, err := mainServices.WalletService.Dashboard(c.Request.Context(), date)
 				resolve(c, res, err)
 			})
 
@@ -66,38 +77,44 @@ func InitRouter(mainServices MainServices, walletSettings util.WalletSettings) *
 			wallet.DELETE("/delete/:id", authMiddleware(walletSettings), func(c *gin.Context) {
 				idStr := c.Param("id")
 				id, _ := strconv.Atoi(idStr)
-				res, err := mainServices.WalletService.Delete(id)
+				res, err := mainServices.WalletService.Delete(c.Request.Context(), id)
 				resolve(c, res, err)
 			})
 		}
 
-		stock := api.Group("/stock")
-		{
-			stock.POST("/getAll", authMiddleware(walletSettings), func(c *gin.Context) {
-				res, err := mainServices.StockService.GetAll()
-				resolve(c, res, err)
-			})
-
-			stock.POST("/refresh", authMiddleware(walletSettings), func(c *gin.Context) {
-				res, err := mainServices.StockService.RefreshPrices()
-				resolve(c, res, err)
-			})
-
-			stock.POST("/create", authMiddleware(walletSettings), handleJSON(mainServices.StockService.Create))
-			stock.POST("/update", authMiddleware(walletSettings), handleJSON(mainServices.StockService.Update))
+		if mainServices.StockService != nil {
+			stock := api.Group("/stock")
+			{
+				stock.POST("/getAll", authMiddleware(walletSettings), func(c *gin.Context) {
+					res, err := mainServices.StockService.GetAll(c.Request.Context())
+					resolve(c, res, err)
+				})
+
+				stock.POST("/refresh", authMiddleware(walletSettings), func(c *gin.Context) {
+					res, err := mainServices.StockService.RefreshPrices(c.Request.Context())
+					resolve(c, res, err)
+				})
+
+				stock.POST("/create", authMiddleware(walletSettings), handleJSON(mainServices.StockService.Create))
+				stock.POST("/update", authMiddleware(walletSettings), handleJSON(mainServices.StockService.Update))
+
+				stock.DELETE("/delete/:id", authMiddleware(walletSettings), func(c *gin.Context) {
+					name := c.Param("id")
+					res, err := mainServices.StockService.Delete(c.Request.Context(), name)
+					resolve(c, res, err)
+				})
+			}
+		}
 
-			stock.DELETE("/delete/:id", authMiddleware(walletSettings), func(c *gin.Context) {
-				name := c.Param("id")
-				res, err := mainServices.StockService.Delete(name)
-				resolve(c, res, err)
-			})
+		registerLogLevelRoutes(api.Group("/admin", authMiddleware(walletSettings)))
+		if mainServices.Jobs != nil {
+			registerJobRoutes(api.Group("/jobs", authMiddleware(walletSettings)), mainServices)
 		}
 
-		instagram := api.Group("/instagram")
-		{
-			instagram.GET("/trigger", func(c *gin.Context) {
-				go safeRun(mainServices.InstagramService.Run)
-				c.JSON(http.StatusOK, gin.H{"data": "Instagram fetch triggered"})
+		if mainServices.OutboxService != nil {
+			api.GET("/outbox/stats", authMiddleware(walletSettings), func(c *gin.Context) {
+				res, err := mainServices.OutboxService.Stats()
+				resolve(c, res, err)
 			})
 		}
 	}
@@ -108,34 +125,46 @@ func InitRouter(mainServices MainServices, walletSettings util.WalletSettings) *
 func safeRun(fn func()) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("[ERROR] recovered from panic in background job: %v", r)
+			slog.Error("recovered from panic in background job", "error", fmt.Sprint(r))
 		}
 	}()
 	fn()
 }
 
-func InitScheduler(mainServices MainServices) *cron.Cron {
-	loc, _ := time.LoadLocation("Asia/Jakarta")
+// InitScheduler schedules the jobs that are turned on and starts the cron.
+// Cancelling ctx stops the runs in progress, scheduled or triggered.
+func InitScheduler(ctx context.Context, mainServices MainServices) *cron.Cron {
+	loc, _ := time.LoadLocation(defaultTimezone)
 	c := cron.New(
 		cron.WithSeconds(),
 		cron.WithLocation(loc),
 		cron.WithChain(cron.Recover(cron.DefaultLogger)),
 	)
 
-	schedulers := []*Scheduler{
-		{Task: mainServices.NewsService, CronExpr: "0 0 9 * * *", Repeat: true},
-		{Task: mainServices.StockService, CronExpr: "0 0 19 * * *", Repeat: true},
-		{Task: mainServices.InstagramService, CronExpr: "0 0 * * * *", Repeat: true},
+	runner := mainServices.Jobs
+	if runner == nil {
+		runner = &JobRunner{}
 	}
-
-	for _, s := range schedulers {
-		_, err := s.Schedule(c)
-		if err != nil {
-			log.Fatalf("Failed to schedule task: %v", err)
+	runner.useCron(ctx, c)
+	schedules := runner.loadSchedules(ctx)
+	tasks := enabledJobs(mainServices) // turned-off features are not scheduled
+	for _, name := range sortedJobNames(tasks) {
+		if err := runner.setSchedule(name, tasks[name], schedules[name]); err != nil {
+			slog.Error("invalid job schedule, using the default", "job", name, "cron", schedules[name].CronExpr, "error", err)
+			if err := runner.setSchedule(name, tasks[name], defaultSchedules[name]); err != nil {
+				fatal("failed to schedule job", "job", name, "error", err)
+			}
 		}
 	}
 
-	log.Println("Running scheduled jobs...")
+	if runner.Schedules != nil {
+		go runner.watchSchedules(ctx, scheduleReloadInterval, tasks)
+	}
+
+	slog.Info("running scheduled jobs")
 	c.Start()
+	if mainServices.Health != nil {
+		mainServices.Health.SchedulerStarted()
+	}
 	return c
 }
@@ -0,0 +1,100 @@
+package bootstrap
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"seanmcapp/external"
+	"seanmcapp/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	telegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	telegramUpdateKey    = "telegramUpdate"
+)
+
+// recordRejection logs a refused update and counts it by cause, "secret" or
+// "chat", so a burst of forged or foreign traffic stands out in /metrics.
+func recordRejection(cause, source, reason string) {
+	telegramRejections.WithLabelValues(cause).Inc()
+	slog.Warn("rejected telegram update", "source", source, "reason", reason)
+}
+
+func requestSource(c *gin.Context) string {
+	return fmt.Sprintf("%s %s from %s", c.Request.Method, c.FullPath(), c.ClientIP())
+}
+
+// webhookSecretMiddleware only lets through requests whose header carries the
+// shared secret. An empty secret rejects everything rather than failing open.
+func webhookSecretMiddleware(header, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(header)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			recordRejection("secret", requestSource(c), "invalid "+header)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid secret token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// chatAllowlist is the set of chats the bot accepts updates from.
+type chatAllowlist map[int64]struct{}
+
+func newChatAllowlist(chatIDs []int64) chatAllowlist {
+	allowed := make(chatAllowlist, len(chatIDs))
+	for _, id := range chatIDs {
+		allowed[id] = struct{}{}
+	}
+	return allowed
+}
+
+func (a chatAllowlist) allows(update external.TelegramUpdate) bool {
+	chatID, ok := update.ChatID()
+	if !ok {
+		return false
+	}
+	_, ok = a[chatID]
+	return ok
+}
+
+// telegramAllowlistMiddleware decodes the update and drops it unless it comes
+// from an allowed chat. Dropped updates are still answered with 200, otherwise
+// Telegram would keep redelivering them.
+func telegramAllowlistMiddleware(allowed chatAllowlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var update external.TelegramUpdate
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		if !allowed.allows(update) {
+			chatID, _ := update.ChatID()
+			recordRejection("chat", requestSource(c), fmt.Sprintf("chat %d is not allowed", chatID))
+			c.AbortWithStatusJSON(http.StatusOK, gin.H{"status": "ignored"})
+			return
+		}
+		c.Set(telegramUpdateKey, update)
+		c.Next()
+	}
+}
+
+// telegramWebhook hands a Telegram update to the bot. Telegram redelivers
+// anything that isn't answered with 200, so handler failures are reported back
+// to the chat by the bot rather than through the status code.
+func telegramWebhook(bot service.BotService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var update external.TelegramUpdate
+		if decoded, ok := c.Get(telegramUpdateKey); ok {
+			update = decoded.(external.TelegramUpdate)
+		} else if err := c.ShouldBindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		bot.HandleUpdate(c.Request.Context(), update)
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
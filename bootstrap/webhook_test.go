@@ -0,0 +1,140 @@
+package bootstrap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"seanmcapp/external"
+	"seanmcapp/service"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBot struct {
+	updates  []external.TelegramUpdate
+	ctxs     []context.Context // each update's
+	commands map[string]service.BotHandler
+}
+
+func (f *fakeBot) Register(name, _ string, handler service.BotHandler) {
+	if f.commands == nil {
+		f.commands = make(map[string]service.BotHandler)
+	}
+	f.commands[name] = handler
+}
+func (f *fakeBot) RegisterCallback(string, service.BotCallbackHandler) {}
+func (f *fakeBot) HandleUpdate(ctx context.Context, u external.TelegramUpdate) {
+	f.updates = append(f.updates, u)
+	f.ctxs = append(f.ctxs, ctx)
+}
+
+func chatUpdateBody(chatID string) string {
+	return `{"update_id":5,"message":{"message_id":1,"chat":{"id":` + chatID + `,"type":"private"},"text":"/help"}}`
+}
+
+func TestTelegramWebhook(t *testing.T) {
+	bot := &fakeBot{}
+	r := gin.New()
+	r.POST("/webhook", telegramWebhook(bot))
+
+	t.Run("update is handed to the bot", func(t *testing.T) {
+		type key struct{}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(chatUpdateBody("42")))
+		r.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), key{}, "request")))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, bot.updates, 1)
+		assert.Equal(t, int64(5), bot.updates[0].UpdateID)
+		assert.Equal(t, "/help", *bot.updates[0].Message.Text)
+		assert.Equal(t, "request", bot.ctxs[0].Value(key{}), "under the request's context")
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`nope`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestWebhookGuards(t *testing.T) {
+	bot := &fakeBot{}
+	secretRejections, chatRejections := telegramRejections.WithLabelValues("secret"), telegramRejections.WithLabelValues("chat")
+	secretBefore, chatBefore := testutil.ToFloat64(secretRejections), testutil.ToFloat64(chatRejections)
+	r := gin.New()
+	r.POST("/webhook",
+		webhookSecretMiddleware(telegramSecretHeader, "s3cret"),
+		telegramAllowlistMiddleware(newChatAllowlist([]int64{42, -100})),
+		telegramWebhook(bot),
+	)
+
+	send := func(secret, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		if secret != "" {
+			req.Header.Set(telegramSecretHeader, secret)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("allowed chat with valid secret", func(t *testing.T) {
+		w := send("s3cret", chatUpdateBody("-100"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, bot.updates, 1)
+		assert.Equal(t, secretBefore, testutil.ToFloat64(secretRejections))
+		assert.Equal(t, chatBefore, testutil.ToFloat64(chatRejections))
+	})
+
+	t.Run("missing or wrong secret", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, send("", chatUpdateBody("42")).Code)
+		assert.Equal(t, http.StatusUnauthorized, send("wrong", chatUpdateBody("42")).Code)
+		assert.Equal(t, secretBefore+2, testutil.ToFloat64(secretRejections))
+	})
+
+	t.Run("foreign chat is acknowledged but dropped", func(t *testing.T) {
+		w := send("s3cret", chatUpdateBody("7"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "ignored")
+		assert.Equal(t, chatBefore+1, testutil.ToFloat64(chatRejections))
+	})
+
+	t.Run("update without a chat is dropped", func(t *testing.T) {
+		w := send("s3cret", `{"update_id":6}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, chatBefore+2, testutil.ToFloat64(chatRejections))
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send("s3cret", `nope`).Code)
+	})
+
+	assert.Len(t, bot.updates, 1, "only the allowed update reached the bot")
+}
+
+func TestWebhookSecretEmptyFailsClosed(t *testing.T) {
+	r := gin.New()
+	r.POST("/hook", webhookSecretMiddleware(telegramSecretHeader, ""), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/hook", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestChatAllowlistCallbackQuery(t *testing.T) {
+	allowed := newChatAllowlist([]int64{42})
+	update := external.TelegramUpdate{CallbackQuery: &external.TelegramCallbackQuery{
+		Message: &external.TelegramResult{Chat: external.TelegramChat{ID: 42}},
+	}}
+	assert.True(t, allowed.allows(update))
+
+	update.CallbackQuery.Message.Chat.ID = 1
+	assert.False(t, allowed.allows(update))
+}
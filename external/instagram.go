@@ -1,9 +1,14 @@
 package external
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"time"
+
 	http "github.com/bogdanfinn/fhttp"
 	tls_client "github.com/bogdanfinn/tls-client"
 	"github.com/bogdanfinn/tls-client/profiles"
@@ -19,7 +24,7 @@ const (
 var ErrSessionExpired = errors.New("instagram session expired or blocked — please update IG_SESSION_ID")
 
 type InstagramClient interface {
-	Get(url string) ([]byte, error)
+	Get(ctx context.Context, url string) ([]byte, error)
 }
 
 type InstagramClientImpl struct {
@@ -47,8 +52,8 @@ func NewInstagramClient(sessionID, csrfToken string) *InstagramClientImpl {
 	}
 }
 
-func (c *InstagramClientImpl) Get(url string) ([]byte, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (c *InstagramClientImpl) Get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -59,11 +64,14 @@ func (c *InstagramClientImpl) Get(url string) ([]byte, error) {
 	req.Header.Set("Referer", "https://www.instagram.com/")
 	req.Header.Set("User-Agent", igUserAgent)
 
+	start := time.Now()
 	resp, err := c.client.Do(req)
 	if err != nil {
+		observeOutbound("instagram", instagramOperation(req.URL.Path), start, 0, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	observeOutbound("instagram", instagramOperation(req.URL.Path), start, resp.StatusCode, nil)
 
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
 		return nil, fmt.Errorf("%w (HTTP %d)", ErrSessionExpired, resp.StatusCode)
@@ -74,3 +82,15 @@ func (c *InstagramClientImpl) Get(url string) ([]byte, error) {
 
 	return io.ReadAll(resp.Body)
 }
+
+// instagramOperation names an API call by its path without the /api/v1 prefix
+// and ids, e.g. "feed/user" for /api/v1/feed/user/123/.
+func instagramOperation(urlPath string) string {
+	var parts []string
+	for _, part := range strings.Split(strings.Trim(strings.TrimPrefix(urlPath, "/api/v1"), "/"), "/") {
+		if _, err := strconv.ParseUint(part, 10, 64); err != nil && part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
@@ -18,7 +18,7 @@ func TestInstagramGetOK(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	body, err := NewInstagramClient("sid", "csrf").Get(srv.URL)
+	body, err := NewInstagramClient("sid", "csrf").Get(t.Context(), srv.URL)
 	require.NoError(t, err)
 	assert.JSONEq(t, `{"ok":true}`, string(body))
 }
@@ -29,7 +29,7 @@ func TestInstagramGetUnauthorized(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	_, err := NewInstagramClient("sid", "csrf").Get(srv.URL)
+	_, err := NewInstagramClient("sid", "csrf").Get(t.Context(), srv.URL)
 	require.Error(t, err)
 	assert.ErrorIs(t, err, ErrSessionExpired)
 }
@@ -40,7 +40,7 @@ func TestInstagramGetUnexpectedStatus(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	_, err := NewInstagramClient("sid", "csrf").Get(srv.URL)
+	_, err := NewInstagramClient("sid", "csrf").Get(t.Context(), srv.URL)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "unexpected status")
 }
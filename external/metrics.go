@@ -0,0 +1,78 @@
+package external
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	outboundRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "seanmcapp_outbound_requests_total",
+		Help: "Calls to external APIs by client, operation and HTTP status (\"error\" when no response came back).",
+	}, []string{"client", "operation", "status"})
+
+	outboundDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "seanmcapp_outbound_request_duration_seconds",
+		Help:    "Latency of calls to external APIs by client and operation.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"client", "operation"})
+)
+
+// Collectors are the metrics of the API clients, for the /metrics registry.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{outboundRequests, outboundDuration}
+}
+
+// observeOutbound records one call to an external API. status is the HTTP
+// status code, ignored when err is set.
+func observeOutbound(client, operation string, start time.Time, status int, err error) {
+	label := strconv.Itoa(status)
+	if err != nil {
+		label = "error"
+	}
+	outboundRequests.WithLabelValues(client, operation, label).Inc()
+	outboundDuration.WithLabelValues(client, operation).Observe(time.Since(start).Seconds())
+}
+
+// instrumentedTransport records every request made through it.
+type instrumentedTransport struct {
+	client    string
+	operation func(req *http.Request) string
+	next      http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	observeOutbound(t.client, t.operation(req), start, status, err)
+	return resp, err
+}
+
+// instrument makes c record its calls as client. operation names the API call
+// of a request; nil names every call after the client.
+func instrument(c *http.Client, client string, operation func(req *http.Request) string) *http.Client {
+	if operation == nil {
+		operation = func(*http.Request) string { return client }
+	}
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.Transport = &instrumentedTransport{client: client, operation: operation, next: next}
+	return c
+}
+
+// telegramOperation is the Bot API method, the last element of the path. The
+// element before it holds the bot token, so the path is never used whole.
+func telegramOperation(req *http.Request) string {
+	return strings.ToLower(path.Base(req.URL.Path))
+}
@@ -0,0 +1,53 @@
+package external
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentRecordsStatusAndErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	client := instrument(&http.Client{}, "test-client", nil)
+	teapots := testutil.ToFloat64(outboundRequests.WithLabelValues("test-client", "test-client", "418"))
+	failures := testutil.ToFloat64(outboundRequests.WithLabelValues("test-client", "test-client", "error"))
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	srv.Close()
+	_, err = client.Get(srv.URL)
+	require.Error(t, err)
+
+	assert.Equal(t, teapots+1, testutil.ToFloat64(outboundRequests.WithLabelValues("test-client", "test-client", "418")))
+	assert.Equal(t, failures+1, testutil.ToFloat64(outboundRequests.WithLabelValues("test-client", "test-client", "error")))
+}
+
+func TestInstagramGetIsRecorded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	ok := outboundRequests.WithLabelValues("instagram", "feed/user", "200")
+	before := testutil.ToFloat64(ok)
+
+	_, err := NewInstagramClient("sid", "csrf").Get(t.Context(), srv.URL+"/api/v1/feed/user/123/")
+	require.NoError(t, err)
+
+	assert.Equal(t, before+1, testutil.ToFloat64(ok))
+}
+
+func TestOperationNames(t *testing.T) {
+	assert.Equal(t, "feed/user", instagramOperation("/api/v1/feed/user/123/"))
+	assert.Equal(t, "users/web_profile_info", instagramOperation("/api/v1/users/web_profile_info/"))
+	assert.Equal(t, "feed/reels_media", instagramOperation("/api/v1/feed/reels_media/"))
+
+	req := httptest.NewRequest(http.MethodPost, "https://api.telegram.org/bot123:secret/sendMessage", nil)
+	assert.Equal(t, "sendmessage", telegramOperation(req), "the token is never part of the label")
+}
@@ -0,0 +1,140 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notification is a message for whoever follows a service, independent of the
+// channel it ends up on.
+type Notification struct {
+	Source string // the service it comes from, e.g. "stock"; used for routing
+	Title  string // subject for channels that have one, e.g. email
+	Body   *Message
+	Urgent bool // delivered right away, even during quiet hours
+}
+
+// Notifier delivers notifications to one channel, giving up once ctx is done.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// discordMaxContent is the longest message content a Discord webhook accepts.
+const discordMaxContent = 2000
+
+// WebhookNotifier POSTs every notification as JSON to a URL:
+//
+//	{"source": "stock", "title": "...", "text": "..."}
+type WebhookNotifier struct {
+	URL    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, client: instrument(newHTTPClient(), "webhook", nil)}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.client, w.URL, map[string]string{
+		"source": n.Source,
+		"title":  n.Title,
+		"text":   n.Body.PlainText(),
+	})
+}
+
+// DiscordNotifier posts to a Discord (or Discord-compatible, e.g. Slack's
+// legacy) incoming webhook.
+type DiscordNotifier struct {
+	URL    string
+	client *http.Client
+}
+
+func NewDiscordNotifier(url string) *DiscordNotifier {
+	return &DiscordNotifier{URL: url, client: instrument(newHTTPClient(), "discord", nil)}
+}
+
+func (d *DiscordNotifier) Notify(ctx context.Context, n Notification) error {
+	content := n.Body.PlainText()
+	if n.Title != "" {
+		content = "**" + n.Title + "**\n" + content
+	}
+	if runes := []rune(content); len(runes) > discordMaxContent {
+		content = string(runes[:discordMaxContent-1]) + "…"
+	}
+	return postJSON(ctx, d.client, d.URL, map[string]string{"content": content})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook %s responded %d: %s", url, resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
+// EmailNotifier sends each notification as an HTML email over SMTP.
+type EmailNotifier struct {
+	Addr     string // host:port
+	Username string // empty for servers that accept mail without auth
+	Password string
+	From     string
+	To       []string
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewEmailNotifier(addr, username, password, from string, to []string) *EmailNotifier {
+	return &EmailNotifier{Addr: addr, Username: username, Password: password, From: from, To: to, sendMail: smtp.SendMail}
+}
+
+// Notify sends n as one email. net/smtp cannot be cancelled, so ctx is only
+// checked before connecting.
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	subject := n.Title
+	if subject == "" {
+		subject = "Notification from " + n.Source
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Body.Render(ParseModeHTML), "\n", "<br>\r\n"))
+	msg.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, _ := strings.Cut(e.Addr, ":")
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	return e.sendMail(e.Addr, auth, e.From, e.To, msg.Bytes())
+}
@@ -0,0 +1,183 @@
+package external
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNotification() Notification {
+	return Notification{
+		Source: "news",
+		Title:  "Seanmctoday",
+		Body:   NewMessage().Text("Top story: ").Bold("a < b").Text(" - ").Link("read", "https://example.com/a?x=1&y=2"),
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	require.NoError(t, NewWebhookNotifier(srv.URL).Notify(t.Context(), testNotification()))
+	assert.Equal(t, map[string]string{
+		"source": "news",
+		"title":  "Seanmctoday",
+		"text":   "Top story: a < b - read (https://example.com/a?x=1&y=2)",
+	}, got)
+}
+
+func TestWebhookNotifierErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	err := NewWebhookNotifier(srv.URL).Notify(t.Context(), testNotification())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "502")
+	assert.Contains(t, err.Error(), "nope")
+}
+
+func TestDiscordNotifier(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	require.NoError(t, NewDiscordNotifier(srv.URL).Notify(t.Context(), testNotification()))
+	assert.Equal(t, "**Seanmctoday**\nTop story: a < b - read (https://example.com/a?x=1&y=2)", got["content"])
+}
+
+func TestDiscordNotifierTruncates(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	note := Notification{Source: "news", Body: NewMessage().Text(strings.Repeat("é", 3000))}
+	require.NoError(t, NewDiscordNotifier(srv.URL).Notify(t.Context(), note))
+	assert.Len(t, []rune(got["content"]), discordMaxContent)
+	assert.True(t, strings.HasSuffix(got["content"], "…"))
+}
+
+// smtpMail is what the fake SMTP server received in one session.
+type smtpMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// startFakeSMTP accepts a single SMTP session on localhost, speaking just
+// enough of the protocol for net/smtp.SendMail, and reports what it received.
+func startFakeSMTP(t *testing.T) (string, <-chan smtpMail) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	mails := make(chan smtpMail, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		var mail smtpMail
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				mail.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				mail.to = append(mail.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				mail.data = data.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				mails <- mail
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), mails
+}
+
+func TestEmailNotifier(t *testing.T) {
+	addr, mails := startFakeSMTP(t)
+
+	n := NewEmailNotifier(addr, "", "", "bot@example.com", []string{"me@example.com", "you@example.com"})
+	require.NoError(t, n.Notify(t.Context(), testNotification()))
+
+	mail := <-mails
+	assert.Equal(t, "bot@example.com", mail.from)
+	assert.Equal(t, []string{"me@example.com", "you@example.com"}, mail.to)
+	assert.Contains(t, mail.data, "Subject: Seanmctoday\r\n")
+	assert.Contains(t, mail.data, "To: me@example.com, you@example.com\r\n")
+	assert.Contains(t, mail.data, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, mail.data, `Top story: <b>a &lt; b</b> - <a href="https://example.com/a?x=1&amp;y=2">read</a>`)
+}
+
+func TestEmailNotifierDefaultSubject(t *testing.T) {
+	var msg string
+	n := NewEmailNotifier("smtp.example.com:587", "user", "pass", "bot@example.com", []string{"me@example.com"})
+	n.sendMail = func(addr string, a smtp.Auth, from string, to []string, body []byte) error {
+		assert.Equal(t, "smtp.example.com:587", addr)
+		assert.NotNil(t, a, "credentials are sent when a username is set")
+		msg = string(body)
+		return nil
+	}
+
+	require.NoError(t, n.Notify(t.Context(), Notification{Source: "stock", Body: NewMessage().Text("BBCA hitting best price")}))
+	assert.Contains(t, msg, "Subject: Notification from stock\r\n")
+}
+
+func TestMessagePlainText(t *testing.T) {
+	msg := NewMessage().Text("1. ").Bold("bold").Text(" ").Code("x_y").Text(" ").Link("https://a.io", "https://a.io").Text(" ").Link("", "https://b.io")
+	assert.Equal(t, "1. bold x_y https://a.io https://b.io", msg.PlainText())
+}
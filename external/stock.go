@@ -1,6 +1,7 @@
 package external
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,7 +11,7 @@ import (
 )
 
 type StockClient interface {
-	GetPrice(name string) (int64, error)
+	GetPrice(ctx context.Context, name string) (int64, error)
 }
 
 type StockClientImpl struct {
@@ -18,17 +19,17 @@ type StockClientImpl struct {
 }
 
 func NewStockClient() *StockClientImpl {
-	return &StockClientImpl{client: newHTTPClient()}
+	return &StockClientImpl{client: instrument(newHTTPClient(), "stock", nil)}
 }
 
 var stockURLTemplate = "https://query1.finance.yahoo.com/v8/finance/chart/{{name}}.jk"
 
 const browserUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
 
-func (s *StockClientImpl) GetPrice(name string) (int64, error) {
+func (s *StockClientImpl) GetPrice(ctx context.Context, name string) (int64, error) {
 	stockURL := strings.NewReplacer("{{name}}", name).Replace(stockURLTemplate)
 
-	req, err := http.NewRequest(http.MethodGet, stockURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stockURL, nil)
 	if err != nil {
 		return 0, fmt.Errorf("cannot build request: %w", err)
 	}
@@ -1,9 +1,11 @@
 package external
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -22,7 +24,7 @@ func TestStockGetPrice(t *testing.T) {
 	defer srv.Close()
 	defer withStockURL(srv.URL + "/{{name}}")()
 
-	price, err := NewStockClient().GetPrice("BBCA")
+	price, err := NewStockClient().GetPrice(t.Context(), "BBCA")
 	require.NoError(t, err)
 	assert.Equal(t, int64(1234), price)
 }
@@ -34,7 +36,7 @@ func TestStockGetPriceNotFound(t *testing.T) {
 	defer srv.Close()
 	defer withStockURL(srv.URL + "/{{name}}")()
 
-	_, err := NewStockClient().GetPrice("BBCA")
+	_, err := NewStockClient().GetPrice(t.Context(), "BBCA")
 	assert.Error(t, err)
 }
 
@@ -44,6 +46,19 @@ func TestStockGetPriceRequestError(t *testing.T) {
 	srv.Close()
 	defer withStockURL(url + "/{{name}}")()
 
-	_, err := NewStockClient().GetPrice("BBCA")
+	_, err := NewStockClient().GetPrice(t.Context(), "BBCA")
 	assert.Error(t, err)
 }
+
+func TestStockGetPriceCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	defer withStockURL(srv.URL + "/{{name}}")()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := NewStockClient().GetPrice(ctx, "BBCA")
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -2,9 +2,10 @@ package external
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -16,10 +17,17 @@ import (
 const uploadTimeout = 120 * time.Second
 
 type TelegramClient interface {
-	SendMessage(chatId int64, text string) (TelegramResponse, error)
-	SendPhoto(chatId int64, photoURL, caption string) (TelegramResponse, error)
-	SendVideo(chatId int64, videoURL, caption string) (TelegramResponse, error)
-	SendVideoUpload(chatId int64, data []byte, filename, caption string) (TelegramResponse, error)
+	SendMessage(ctx context.Context, chatId int64, text string) (TelegramResponse, error)
+	SendPhoto(ctx context.Context, chatId int64, photoURL, caption string) (TelegramResponse, error)
+	SendVideo(ctx context.Context, chatId int64, videoURL, caption string) (TelegramResponse, error)
+	SendVideoUpload(ctx context.Context, chatId int64, data []byte, filename, caption string) (TelegramResponse, error)
+	SendMediaGroup(ctx context.Context, chatId int64, media []InputMedia) (TelegramResponse, error)
+	SendMediaGroupUpload(ctx context.Context, chatId int64, media []InputMedia) (TelegramResponse, error)
+	SendMessageWithKeyboard(ctx context.Context, chatId int64, text string, keyboard InlineKeyboardMarkup) (TelegramResponse, error)
+	AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error
+	EditMessageText(ctx context.Context, chatId int64, messageID int, text string, keyboard *InlineKeyboardMarkup) (TelegramResponse, error)
+	EditMessageReplyMarkup(ctx context.Context, chatId int64, messageID int, keyboard *InlineKeyboardMarkup) (TelegramResponse, error)
+	GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]TelegramUpdate, error)
 }
 
 type TelegramClientImpl struct {
@@ -27,52 +35,142 @@ type TelegramClientImpl struct {
 	Botname      string
 	client       *http.Client
 	uploadClient *http.Client
+	pollClient   *http.Client
 }
 
 func NewTelegramClient(endpoint, botname string) *TelegramClientImpl {
 	return &TelegramClientImpl{
 		Endpoint:     endpoint,
 		Botname:      botname,
-		client:       newHTTPClient(),
-		uploadClient: &http.Client{Timeout: uploadTimeout},
+		client:       instrument(newHTTPClient(), "telegram", telegramOperation),
+		uploadClient: instrument(&http.Client{Timeout: uploadTimeout}, "telegram", telegramOperation),
+		// Long polling holds the request open, so the deadline comes from the
+		// per-call context instead of a fixed client timeout.
+		pollClient: instrument(&http.Client{}, "telegram", telegramOperation),
 	}
 }
 
-func (t *TelegramClientImpl) SendMessage(chatId int64, text string) (TelegramResponse, error) {
+func (t *TelegramClientImpl) SendMessage(ctx context.Context, chatId int64, text string) (TelegramResponse, error) {
 	sanitized := url.QueryEscape(text)
-	reqURL := fmt.Sprintf("%s/sendmessage?chat_id=%d&text=%s&parse_mode=markdown&disable_web_page_preview=true&disable_notification=true", t.Endpoint, chatId, sanitized)
+	reqURL := fmt.Sprintf("%s/sendmessage?chat_id=%d&text=%s&parse_mode=%s&disable_web_page_preview=true&disable_notification=true", t.Endpoint, chatId, sanitized, TelegramParseMode)
 
-	resp, err := t.client.Get(reqURL)
+	resp, err := t.get(ctx, reqURL)
 	if err != nil {
-		log.Println("Failed to send telegram message", err)
+		slog.ErrorContext(ctx, "failed to send message", "service", "telegram", "chat_id", chatId, "error", err)
 		return TelegramResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	var telegramResp TelegramResponse
-	err = json.NewDecoder(resp.Body).Decode(&telegramResp)
+	err = decodeTelegramResponse(resp, &telegramResp)
 	if err != nil {
-		log.Println("Failed to decode telegram send message response", err)
+		slog.ErrorContext(ctx, "failed to decode send message response", "service", "telegram", "chat_id", chatId, "error", err)
 		return TelegramResponse{}, err
 	}
 	return telegramResp, nil
 }
 
-func (t *TelegramClientImpl) SendPhoto(chatId int64, photoURL, caption string) (TelegramResponse, error) {
+// SendMessageWithKeyboard sends a message with inline buttons underneath; a
+// press comes back as a callback_query update carrying the button's data.
+func (t *TelegramClientImpl) SendMessageWithKeyboard(ctx context.Context, chatId int64, text string, keyboard InlineKeyboardMarkup) (TelegramResponse, error) {
+	markup, err := json.Marshal(keyboard)
+	if err != nil {
+		return TelegramResponse{}, err
+	}
+	reqURL := fmt.Sprintf("%s/sendmessage?chat_id=%d&text=%s&parse_mode=%s&disable_web_page_preview=true&disable_notification=true&reply_markup=%s", t.Endpoint, chatId, url.QueryEscape(text), TelegramParseMode, url.QueryEscape(string(markup)))
+
+	resp, err := t.get(ctx, reqURL)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to send message with keyboard", "service", "telegram", "chat_id", chatId, "error", err)
+		return TelegramResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var telegramResp TelegramResponse
+	if err := decodeTelegramResponse(resp, &telegramResp); err != nil {
+		slog.ErrorContext(ctx, "failed to decode send message response", "service", "telegram", "chat_id", chatId, "error", err)
+		return TelegramResponse{}, err
+	}
+	return telegramResp, nil
+}
+
+// AnswerCallbackQuery acknowledges a button press so the client stops showing
+// a spinner; a non-empty text is shown as a short toast.
+func (t *TelegramClientImpl) AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error {
+	reqURL := fmt.Sprintf("%s/answercallbackquery?callback_query_id=%s&text=%s", t.Endpoint, url.QueryEscape(callbackQueryID), url.QueryEscape(text))
+
+	resp, err := t.get(ctx, reqURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var answerResp struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answerResp); err != nil {
+		return fmt.Errorf("decoding answerCallbackQuery response: %w", err)
+	}
+	if !answerResp.Ok {
+		return fmt.Errorf("answerCallbackQuery failed: %s", answerResp.Description)
+	}
+	return nil
+}
+
+// EditMessageText replaces the text of a message the bot sent earlier. A nil
+// keyboard removes any inline buttons it had.
+func (t *TelegramClientImpl) EditMessageText(ctx context.Context, chatId int64, messageID int, text string, keyboard *InlineKeyboardMarkup) (TelegramResponse, error) {
+	reqURL := fmt.Sprintf("%s/editmessagetext?chat_id=%d&message_id=%d&text=%s&parse_mode=%s&disable_web_page_preview=true", t.Endpoint, chatId, messageID, url.QueryEscape(text), TelegramParseMode)
+	return t.editMessage(ctx, reqURL, keyboard)
+}
+
+// EditMessageReplyMarkup swaps only the inline buttons of a message, e.g. to
+// turn an action button into a confirmation. A nil keyboard removes them.
+func (t *TelegramClientImpl) EditMessageReplyMarkup(ctx context.Context, chatId int64, messageID int, keyboard *InlineKeyboardMarkup) (TelegramResponse, error) {
+	reqURL := fmt.Sprintf("%s/editmessagereplymarkup?chat_id=%d&message_id=%d", t.Endpoint, chatId, messageID)
+	return t.editMessage(ctx, reqURL, keyboard)
+}
+
+func (t *TelegramClientImpl) editMessage(ctx context.Context, reqURL string, keyboard *InlineKeyboardMarkup) (TelegramResponse, error) {
+	if keyboard != nil {
+		markup, err := json.Marshal(keyboard)
+		if err != nil {
+			return TelegramResponse{}, err
+		}
+		reqURL += "&reply_markup=" + url.QueryEscape(string(markup))
+	}
+
+	resp, err := t.get(ctx, reqURL)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to edit message", "service", "telegram", "error", err)
+		return TelegramResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var telegramResp TelegramResponse
+	if err := decodeTelegramResponse(resp, &telegramResp); err != nil {
+		slog.ErrorContext(ctx, "failed to decode edit message response", "service", "telegram", "error", err)
+		return TelegramResponse{}, err
+	}
+	return telegramResp, nil
+}
+
+func (t *TelegramClientImpl) SendPhoto(ctx context.Context, chatId int64, photoURL, caption string) (TelegramResponse, error) {
 	sanitized := url.QueryEscape(caption)
-	reqURL := fmt.Sprintf("%s/sendphoto?chat_id=%d&photo=%s&caption=%s&parse_mode=markdown&disable_notification=true", t.Endpoint, chatId, url.QueryEscape(photoURL), sanitized)
+	reqURL := fmt.Sprintf("%s/sendphoto?chat_id=%d&photo=%s&caption=%s&parse_mode=%s&disable_notification=true", t.Endpoint, chatId, url.QueryEscape(photoURL), sanitized, TelegramParseMode)
 
-	resp, err := t.client.Get(reqURL)
+	resp, err := t.get(ctx, reqURL)
 	if err != nil {
-		log.Println("Failed to send telegram photo", err)
+		slog.ErrorContext(ctx, "failed to send photo", "service", "telegram", "chat_id", chatId, "error", err)
 		return TelegramResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	var telegramResp TelegramResponse
-	err = json.NewDecoder(resp.Body).Decode(&telegramResp)
+	err = decodeTelegramResponse(resp, &telegramResp)
 	if err != nil {
-		log.Println("Failed to decode telegram send photo response", err)
+		slog.ErrorContext(ctx, "failed to decode send photo response", "service", "telegram", "chat_id", chatId, "error", err)
 		return TelegramResponse{}, err
 	}
 	return telegramResp, nil
@@ -81,19 +179,19 @@ func (t *TelegramClientImpl) SendPhoto(chatId int64, photoURL, caption string) (
 // SendVideo asks Telegram to fetch the video from a remote URL. Telegram caps
 // remote-URL videos at ~20MB; larger files come back with Ok=false and should be
 // retried via SendVideoUpload.
-func (t *TelegramClientImpl) SendVideo(chatId int64, videoURL, caption string) (TelegramResponse, error) {
-	reqURL := fmt.Sprintf("%s/sendvideo?chat_id=%d&video=%s&caption=%s&parse_mode=markdown&disable_notification=true", t.Endpoint, chatId, url.QueryEscape(videoURL), url.QueryEscape(caption))
+func (t *TelegramClientImpl) SendVideo(ctx context.Context, chatId int64, videoURL, caption string) (TelegramResponse, error) {
+	reqURL := fmt.Sprintf("%s/sendvideo?chat_id=%d&video=%s&caption=%s&parse_mode=%s&disable_notification=true", t.Endpoint, chatId, url.QueryEscape(videoURL), url.QueryEscape(caption), TelegramParseMode)
 
-	resp, err := t.client.Get(reqURL)
+	resp, err := t.get(ctx, reqURL)
 	if err != nil {
-		log.Println("Failed to send telegram video", err)
+		slog.ErrorContext(ctx, "failed to send video", "service", "telegram", "chat_id", chatId, "error", err)
 		return TelegramResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	var telegramResp TelegramResponse
-	if err := json.NewDecoder(resp.Body).Decode(&telegramResp); err != nil {
-		log.Println("Failed to decode telegram send video response", err)
+	if err := decodeTelegramResponse(resp, &telegramResp); err != nil {
+		slog.ErrorContext(ctx, "failed to decode send video response", "service", "telegram", "chat_id", chatId, "error", err)
 		return TelegramResponse{}, err
 	}
 	return telegramResp, nil
@@ -101,13 +199,13 @@ func (t *TelegramClientImpl) SendVideo(chatId int64, videoURL, caption string) (
 
 // SendVideoUpload multipart-uploads the raw video bytes. This raises the size
 // ceiling to Telegram's 50MB bot upload limit.
-func (t *TelegramClientImpl) SendVideoUpload(chatId int64, data []byte, filename, caption string) (TelegramResponse, error) {
+func (t *TelegramClientImpl) SendVideoUpload(ctx context.Context, chatId int64, data []byte, filename, caption string) (TelegramResponse, error) {
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
 
 	_ = writer.WriteField("chat_id", strconv.FormatInt(chatId, 10))
 	_ = writer.WriteField("caption", caption)
-	_ = writer.WriteField("parse_mode", "markdown")
+	_ = writer.WriteField("parse_mode", string(TelegramParseMode))
 	_ = writer.WriteField("disable_notification", "true")
 
 	part, err := writer.CreateFormFile("video", filename)
@@ -122,7 +220,7 @@ func (t *TelegramClientImpl) SendVideoUpload(chatId int64, data []byte, filename
 	}
 
 	reqURL := fmt.Sprintf("%s/sendvideo", t.Endpoint)
-	req, err := http.NewRequest("POST", reqURL, &body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, &body)
 	if err != nil {
 		return TelegramResponse{}, err
 	}
@@ -130,22 +228,119 @@ func (t *TelegramClientImpl) SendVideoUpload(chatId int64, data []byte, filename
 
 	resp, err := t.uploadClient.Do(req)
 	if err != nil {
-		log.Println("Failed to upload telegram video", err)
+		slog.ErrorContext(ctx, "failed to upload video", "service", "telegram", "chat_id", chatId, "error", err)
 		return TelegramResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	var telegramResp TelegramResponse
-	if err := json.NewDecoder(resp.Body).Decode(&telegramResp); err != nil {
-		log.Println("Failed to decode telegram upload video response", err)
+	if err := decodeTelegramResponse(resp, &telegramResp); err != nil {
+		slog.ErrorContext(ctx, "failed to decode upload video response", "service", "telegram", "chat_id", chatId, "error", err)
 		return TelegramResponse{}, err
 	}
 	return telegramResp, nil
 }
 
+// GetUpdates long-polls for updates with an id of at least offset. Telegram holds
+// the request open for up to timeout when nothing is pending. It fails while a
+// webhook is registered for the bot.
+func (t *TelegramClientImpl) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]TelegramUpdate, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout+httpTimeout)
+	defer cancel()
+
+	reqURL := fmt.Sprintf("%s/getupdates?offset=%d&timeout=%d", t.Endpoint, offset, int(timeout.Seconds()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.pollClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var updatesResp struct {
+		Ok          bool             `json:"ok"`
+		Description string           `json:"description"`
+		Result      []TelegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&updatesResp); err != nil {
+		return nil, fmt.Errorf("decoding getUpdates response: %w", err)
+	}
+	if !updatesResp.Ok {
+		return nil, fmt.Errorf("getUpdates failed: %s", updatesResp.Description)
+	}
+	return updatesResp.Result, nil
+}
+
+// GetMe returns the bot's own user. It changes nothing, so it is used to
+// check Telegram can be reached with the configured token.
+func (t *TelegramClientImpl) GetMe(ctx context.Context) (TelegramUser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.Endpoint+"/getme", nil)
+	if err != nil {
+		return TelegramUser{}, err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return TelegramUser{}, err
+	}
+	defer resp.Body.Close()
+
+	var meResp struct {
+		Ok          bool         `json:"ok"`
+		Description string       `json:"description"`
+		Result      TelegramUser `json:"result"`
+	}
+	if err := decodeTelegramResponse(resp, &meResp); err != nil {
+		return TelegramUser{}, fmt.Errorf("decoding getMe response: %w", err)
+	}
+	if !meResp.Ok {
+		return TelegramUser{}, fmt.Errorf("getMe failed: %s", meResp.Description)
+	}
+	return meResp.Result, nil
+}
+
+// get makes a Bot API call that fits in a query string.
+func (t *TelegramClientImpl) get(ctx context.Context, reqURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.client.Do(req)
+}
+
+// decodeTelegramResponse decodes a Bot API reply into v. A proxy in front of
+// Telegram may answer a 5xx with an HTML page, so when the body isn't JSON the
+// HTTP status is kept as a TelegramAPIError for the retry logic to see.
+func decodeTelegramResponse(resp *http.Response, v any) error {
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &TelegramAPIError{Code: resp.StatusCode, Description: resp.Status}
+		}
+		return err
+	}
+	return nil
+}
+
 type TelegramResponse struct {
-	Ok     bool           `json:"ok"`
-	Result TelegramResult `json:"result"`
+	Ok          bool                        `json:"ok"`
+	Result      TelegramResult              `json:"result"`
+	ErrorCode   int                         `json:"error_code"`
+	Description string                      `json:"description"`
+	Parameters  *TelegramResponseParameters `json:"parameters"`
+
+	// MessageIDs lists every message a send produced when it had to be split
+	// (see ReliableTelegramClient) or was a media group; Result is then the
+	// first of them.
+	MessageIDs []int `json:"-"`
+}
+
+// TelegramResponseParameters explains some failed requests, e.g. how long to
+// back off after a 429.
+type TelegramResponseParameters struct {
+	RetryAfter int `json:"retry_after"` // seconds
 }
 
 type TelegramResult struct {
@@ -157,6 +352,45 @@ type TelegramResult struct {
 	Caption   *string       `json:"caption"`
 }
 
+// TelegramUpdate is the payload Telegram delivers to the bot webhook or returns
+// from getUpdates. At most one of the optional fields is set.
+type TelegramUpdate struct {
+	UpdateID      int64                  `json:"update_id"`
+	Message       *TelegramResult        `json:"message"`
+	EditedMessage *TelegramResult        `json:"edited_message"`
+	CallbackQuery *TelegramCallbackQuery `json:"callback_query"`
+}
+
+// ChatID returns the chat the update originated from, if it carries one.
+func (u TelegramUpdate) ChatID() (int64, bool) {
+	switch {
+	case u.Message != nil:
+		return u.Message.Chat.ID, true
+	case u.EditedMessage != nil:
+		return u.EditedMessage.Chat.ID, true
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil:
+		return u.CallbackQuery.Message.Chat.ID, true
+	}
+	return 0, false
+}
+
+type TelegramCallbackQuery struct {
+	ID      string          `json:"id"`
+	From    TelegramUser    `json:"from"`
+	Message *TelegramResult `json:"message"`
+	Data    string          `json:"data"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"` // at most 64 bytes
+	URL          string `json:"url,omitempty"`
+}
+
 type TelegramUser struct {
 	ID        int64   `json:"id"`
 	IsBot     bool    `json:"is_bot"`
@@ -0,0 +1,320 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTelegramRateLimited = errors.New("telegram rate limit exceeded")
+	ErrChatNotFound        = errors.New("telegram chat not found")
+	ErrMessageTooLong      = errors.New("telegram message is too long")
+)
+
+// TelegramAPIError is a request Telegram answered with ok=false (or a 5xx). It
+// unwraps to one of the sentinel errors above when the failure is recognised.
+type TelegramAPIError struct {
+	Method      string
+	Code        int
+	Description string
+	RetryAfter  time.Duration
+	kind        error
+}
+
+func (e *TelegramAPIError) Error() string {
+	return fmt.Sprintf("telegram %s failed (%d): %s", e.Method, e.Code, e.Description)
+}
+
+func (e *TelegramAPIError) Unwrap() error { return e.kind }
+
+func newTelegramAPIError(method string, resp TelegramResponse) *TelegramAPIError {
+	apiErr := &TelegramAPIError{Method: method, Code: resp.ErrorCode, Description: resp.Description}
+	if resp.Parameters != nil {
+		apiErr.RetryAfter = time.Duration(resp.Parameters.RetryAfter) * time.Second
+	}
+
+	description := strings.ToLower(resp.Description)
+	switch {
+	case resp.ErrorCode == http.StatusTooManyRequests:
+		apiErr.kind = ErrTelegramRateLimited
+	case strings.Contains(description, "chat not found"):
+		apiErr.kind = ErrChatNotFound
+	case strings.Contains(description, "too long"):
+		apiErr.kind = ErrMessageTooLong
+	}
+	return apiErr
+}
+
+const (
+	deliveryMaxRetries  = 3
+	deliveryBaseBackoff = time.Second
+	deliveryMaxBackoff  = 30 * time.Second
+
+	// Telegram allows roughly one message per second in a private chat and
+	// twenty per minute in a group; a small burst keeps short runs snappy.
+	privateChatInterval = time.Second
+	groupChatInterval   = 3 * time.Second
+	chatBurst           = 3
+)
+
+// ReliableTelegramClient wraps a TelegramClient so every send is paced per chat,
+// 429s wait out retry_after, 5xx answers are retried with backoff, and ok=false
+// comes back as a TelegramAPIError instead of a silently ignored response.
+// Messages and captions over Telegram's limits are split first, each part being
+// paced and retried on its own. Methods it does not override go straight to
+// the wrapped client. Waits end early, with ctx's error, once ctx is done.
+type ReliableTelegramClient struct {
+	TelegramClient
+	limiter *chatLimiter
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+func NewReliableTelegramClient(client TelegramClient) *ReliableTelegramClient {
+	return &ReliableTelegramClient{
+		TelegramClient: client,
+		limiter:        newChatLimiter(time.Now),
+		sleep:          sleepContext,
+	}
+}
+
+func (r *ReliableTelegramClient) SendMessage(ctx context.Context, chatId int64, text string) (TelegramResponse, error) {
+	return r.sendChunks(ctx, chatId, SplitMessage(text, MaxMessageLength), nil)
+}
+
+// SendMessageWithKeyboard puts the keyboard under the last chunk of a split
+// message, right where the reader finishes.
+func (r *ReliableTelegramClient) SendMessageWithKeyboard(ctx context.Context, chatId int64, text string, keyboard InlineKeyboardMarkup) (TelegramResponse, error) {
+	return r.sendChunks(ctx, chatId, SplitMessage(text, MaxMessageLength), &keyboard)
+}
+
+func (r *ReliableTelegramClient) SendPhoto(ctx context.Context, chatId int64, photoURL, caption string) (TelegramResponse, error) {
+	caption, followUps := splitCaption(caption)
+	resp, err := r.deliver(ctx, "sendPhoto", chatId, func() (TelegramResponse, error) {
+		return r.TelegramClient.SendPhoto(ctx, chatId, photoURL, caption)
+	})
+	return r.sendFollowUps(ctx, chatId, resp, err, followUps)
+}
+
+func (r *ReliableTelegramClient) SendVideo(ctx context.Context, chatId int64, videoURL, caption string) (TelegramResponse, error) {
+	caption, followUps := splitCaption(caption)
+	resp, err := r.deliver(ctx, "sendVideo", chatId, func() (TelegramResponse, error) {
+		return r.TelegramClient.SendVideo(ctx, chatId, videoURL, caption)
+	})
+	return r.sendFollowUps(ctx, chatId, resp, err, followUps)
+}
+
+func (r *ReliableTelegramClient) SendVideoUpload(ctx context.Context, chatId int64, data []byte, filename, caption string) (TelegramResponse, error) {
+	caption, followUps := splitCaption(caption)
+	resp, err := r.deliver(ctx, "sendVideo", chatId, func() (TelegramResponse, error) {
+		return r.TelegramClient.SendVideoUpload(ctx, chatId, data, filename, caption)
+	})
+	return r.sendFollowUps(ctx, chatId, resp, err, followUps)
+}
+
+// SendMediaGroup moves a caption that is too long for the album into
+// follow-up messages, like SendPhoto does.
+func (r *ReliableTelegramClient) SendMediaGroup(ctx context.Context, chatId int64, media []InputMedia) (TelegramResponse, error) {
+	media, followUps := splitGroupCaption(media)
+	resp, err := r.deliver(ctx, "sendMediaGroup", chatId, func() (TelegramResponse, error) {
+		return r.TelegramClient.SendMediaGroup(ctx, chatId, media)
+	})
+	return r.sendFollowUps(ctx, chatId, resp, err, followUps)
+}
+
+func (r *ReliableTelegramClient) SendMediaGroupUpload(ctx context.Context, chatId int64, media []InputMedia) (TelegramResponse, error) {
+	media, followUps := splitGroupCaption(media)
+	resp, err := r.deliver(ctx, "sendMediaGroup", chatId, func() (TelegramResponse, error) {
+		return r.TelegramClient.SendMediaGroupUpload(ctx, chatId, media)
+	})
+	return r.sendFollowUps(ctx, chatId, resp, err, followUps)
+}
+
+func splitGroupCaption(media []InputMedia) ([]InputMedia, []string) {
+	if len(media) == 0 {
+		return media, nil
+	}
+	media = append([]InputMedia(nil), media...)
+	var followUps []string
+	media[0].Caption, followUps = splitCaption(media[0].Caption)
+	return media, followUps
+}
+
+// sendChunks sends the parts of a split message in order and stops at the
+// first one that fails. The returned response is the first chunk's, with the
+// ids of every chunk sent.
+func (r *ReliableTelegramClient) sendChunks(ctx context.Context, chatId int64, chunks []string, keyboard *InlineKeyboardMarkup) (TelegramResponse, error) {
+	var first TelegramResponse
+	var ids []int
+	for i, chunk := range chunks {
+		resp, err := r.deliver(ctx, "sendMessage", chatId, func() (TelegramResponse, error) {
+			if keyboard != nil && i == len(chunks)-1 {
+				return r.TelegramClient.SendMessageWithKeyboard(ctx, chatId, chunk, *keyboard)
+			}
+			return r.TelegramClient.SendMessage(ctx, chatId, chunk)
+		})
+		if i == 0 {
+			first = resp
+		}
+		if err != nil {
+			first.MessageIDs = ids
+			if i > 0 {
+				err = fmt.Errorf("sending part %d/%d: %w", i+1, len(chunks), err)
+			}
+			return first, err
+		}
+		ids = append(ids, resp.Result.MessageID)
+	}
+	first.MessageIDs = ids
+	return first, nil
+}
+
+// sendFollowUps sends a caption that was too long for the media as messages
+// after it. A failed media send is returned untouched so callers can fall back.
+func (r *ReliableTelegramClient) sendFollowUps(ctx context.Context, chatId int64, media TelegramResponse, err error, followUps []string) (TelegramResponse, error) {
+	if err != nil || !media.Ok {
+		return media, err
+	}
+	if len(media.MessageIDs) == 0 {
+		media.MessageIDs = []int{media.Result.MessageID}
+	}
+	if len(followUps) == 0 {
+		return media, nil
+	}
+
+	caption, err := r.sendChunks(ctx, chatId, followUps, nil)
+	media.MessageIDs = append(media.MessageIDs, caption.MessageIDs...)
+	if err != nil {
+		return media, fmt.Errorf("sending caption: %w", err)
+	}
+	return media, nil
+}
+
+func (r *ReliableTelegramClient) EditMessageText(ctx context.Context, chatId int64, messageID int, text string, keyboard *InlineKeyboardMarkup) (TelegramResponse, error) {
+	return r.deliver(ctx, "editMessageText", chatId, func() (TelegramResponse, error) {
+		return r.TelegramClient.EditMessageText(ctx, chatId, messageID, text, keyboard)
+	})
+}
+
+func (r *ReliableTelegramClient) EditMessageReplyMarkup(ctx context.Context, chatId int64, messageID int, keyboard *InlineKeyboardMarkup) (TelegramResponse, error) {
+	return r.deliver(ctx, "editMessageReplyMarkup", chatId, func() (TelegramResponse, error) {
+		return r.TelegramClient.EditMessageReplyMarkup(ctx, chatId, messageID, keyboard)
+	})
+}
+
+// deliver runs send until it succeeds, fails permanently, or runs out of
+// retries. Transport errors are not retried: the request may have reached
+// Telegram, and sending it again could post the message twice.
+func (r *ReliableTelegramClient) deliver(ctx context.Context, method string, chatID int64, send func() (TelegramResponse, error)) (TelegramResponse, error) {
+	for attempt := 0; ; attempt++ {
+		if err := r.sleep(ctx, r.limiter.reserve(chatID)); err != nil {
+			return TelegramResponse{}, err
+		}
+
+		resp, err := send()
+		if err == nil && !resp.Ok {
+			err = newTelegramAPIError(method, resp)
+		}
+		if err == nil {
+			return resp, nil
+		}
+
+		var apiErr *TelegramAPIError
+		if !errors.As(err, &apiErr) || attempt >= deliveryMaxRetries {
+			return resp, err
+		}
+		apiErr.Method = method
+
+		var delay time.Duration
+		switch {
+		case errors.Is(apiErr, ErrTelegramRateLimited):
+			delay = apiErr.RetryAfter
+			if delay <= 0 {
+				delay = backoff(attempt)
+			}
+		case apiErr.Code >= http.StatusInternalServerError:
+			delay = backoff(attempt)
+		default:
+			return resp, err
+		}
+
+		slog.WarnContext(ctx, "retrying telegram call", "service", "telegram", "method", method, "retry_in", delay.String(), "attempt", attempt+1, "max_attempts", deliveryMaxRetries, "error", apiErr)
+		if err := r.sleep(ctx, delay); err != nil {
+			return resp, err
+		}
+	}
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil || d <= 0 {
+		return err
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func backoff(attempt int) time.Duration {
+	delay := deliveryBaseBackoff << attempt
+	if delay > deliveryMaxBackoff {
+		return deliveryMaxBackoff
+	}
+	return delay
+}
+
+// chatLimiter is a token bucket per chat. reserve takes a token and returns
+// how long the caller has to wait before it may use it.
+type chatLimiter struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	buckets map[int64]*chatBucket
+}
+
+type chatBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newChatLimiter(now func() time.Time) *chatLimiter {
+	return &chatLimiter{now: now, buckets: make(map[int64]*chatBucket)}
+}
+
+func (l *chatLimiter) reserve(chatID int64) time.Duration {
+	interval := privateChatInterval
+	if chatID < 0 { // group and channel ids are negative
+		interval = groupChatInterval
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[chatID]
+	if !ok {
+		b = &chatBucket{tokens: chatBurst, last: now}
+		l.buckets[chatID] = b
+	}
+
+	b.tokens += float64(now.Sub(b.last)) / float64(interval)
+	if b.tokens > chatBurst {
+		b.tokens = chatBurst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens * float64(interval))
+}
@@ -0,0 +1,155 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestReliableClient points a ReliableTelegramClient at handler and records
+// every sleep instead of waiting.
+func newTestReliableClient(t *testing.T, handler http.HandlerFunc) (*ReliableTelegramClient, *[]time.Duration) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	var slept []time.Duration
+	c := NewReliableTelegramClient(NewTelegramClient(srv.URL, "bot"))
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		if d > 0 {
+			slept = append(slept, d)
+		}
+		return nil
+	}
+	return c, &slept
+}
+
+func TestReliableClientHonoursRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	c, slept := newTestReliableClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":3}}`))
+	})
+
+	resp, err := c.SendMessage(t.Context(), 5, "hi")
+	require.NoError(t, err)
+	assert.Equal(t, 3, resp.Result.MessageID)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, []time.Duration{7 * time.Second}, *slept)
+}
+
+func TestReliableClientGivesUpOnPersistentRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	c, _ := newTestReliableClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":1}}`))
+	})
+
+	_, err := c.SendPhoto(t.Context(), 5, "http://img", "")
+	assert.ErrorIs(t, err, ErrTelegramRateLimited)
+	assert.Equal(t, int32(deliveryMaxRetries+1), calls.Load())
+}
+
+func TestReliableClientBacksOffOnServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	c, slept := newTestReliableClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`<html>bad gateway</html>`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":4}}`))
+	})
+
+	resp, err := c.SendVideo(t.Context(), 5, "http://vid", "")
+	require.NoError(t, err)
+	assert.True(t, resp.Ok)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *slept)
+}
+
+func TestReliableClientStopsWaitingWhenContextIsDone(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":60}}`))
+	}))
+	t.Cleanup(srv.Close)
+	c := NewReliableTelegramClient(NewTelegramClient(srv.URL, "bot"))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.SendMessage(ctx, 5, "hi")
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second, "the 60s retry_after is not waited out")
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestReliableClientTypedErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"chat not found", `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, ErrChatNotFound},
+		{"message too long", `{"ok":false,"error_code":400,"description":"Bad Request: message is too long"}`, ErrMessageTooLong},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			c, _ := newTestReliableClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(tc.body))
+			})
+
+			resp, err := c.SendMessage(t.Context(), 5, "hi")
+			assert.ErrorIs(t, err, tc.want)
+			assert.False(t, resp.Ok)
+			assert.Equal(t, int32(1), calls.Load(), "client errors are not retried")
+
+			var apiErr *TelegramAPIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, "sendMessage", apiErr.Method)
+			assert.Equal(t, http.StatusBadRequest, apiErr.Code)
+		})
+	}
+}
+
+func TestChatLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newChatLimiter(func() time.Time { return now })
+
+	for i := 0; i < chatBurst; i++ {
+		assert.Zero(t, l.reserve(5), "burst %d", i)
+	}
+	assert.Equal(t, privateChatInterval, l.reserve(5))
+	assert.Equal(t, 2*privateChatInterval, l.reserve(5))
+	assert.Zero(t, l.reserve(6), "other chats have their own bucket")
+
+	now = now.Add(10 * time.Second)
+	assert.Zero(t, l.reserve(5), "tokens refill over time")
+}
+
+func TestChatLimiterGroupsAreSlower(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newChatLimiter(func() time.Time { return now })
+
+	for i := 0; i < chatBurst; i++ {
+		l.reserve(-100)
+	}
+	assert.Equal(t, groupChatInterval, l.reserve(-100))
+}
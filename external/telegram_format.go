@@ -0,0 +1,174 @@
+package external
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+type ParseMode string
+
+const (
+	ParseModeMarkdownV2 ParseMode = "MarkdownV2"
+	ParseModeHTML       ParseMode = "HTML"
+)
+
+// TelegramParseMode is how TelegramClientImpl asks Telegram to parse every text
+// and caption it sends. Build them with Message so they are escaped for it.
+const TelegramParseMode = ParseModeMarkdownV2
+
+var (
+	markdownV2Escaper = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+		"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+		"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+	markdownV2CodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+	markdownV2URLEscaper  = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+)
+
+type messagePartKind int
+
+const (
+	partText messagePartKind = iota
+	partBold
+	partItalic
+	partCode
+	partPre
+	partLink
+)
+
+type messagePart struct {
+	kind messagePartKind
+	text string
+	url  string
+}
+
+// Message builds a formatted Telegram message from plain strings. Every piece
+// is escaped when rendered, so user content such as usernames, captions or
+// headlines can never break the formatting.
+//
+//	external.NewMessage().Text("New post from ").Bold(username).Text("\n").Link(title, url)
+type Message struct {
+	parts []messagePart
+}
+
+func NewMessage() *Message {
+	return &Message{}
+}
+
+func (m *Message) Text(s string) *Message {
+	return m.add(messagePart{kind: partText, text: s})
+}
+
+func (m *Message) Textf(format string, args ...any) *Message {
+	return m.Text(fmt.Sprintf(format, args...))
+}
+
+func (m *Message) Bold(s string) *Message {
+	return m.add(messagePart{kind: partBold, text: s})
+}
+
+func (m *Message) Italic(s string) *Message {
+	return m.add(messagePart{kind: partItalic, text: s})
+}
+
+// Code is inline monospace text.
+func (m *Message) Code(s string) *Message {
+	return m.add(messagePart{kind: partCode, text: s})
+}
+
+// Pre is a monospace block, e.g. for fixed-width tables.
+func (m *Message) Pre(s string) *Message {
+	return m.add(messagePart{kind: partPre, text: s})
+}
+
+func (m *Message) Link(text, url string) *Message {
+	return m.add(messagePart{kind: partLink, text: text, url: url})
+}
+
+// Append adds the parts of other to m.
+func (m *Message) Append(other *Message) *Message {
+	m.parts = append(m.parts, other.parts...)
+	return m
+}
+
+func (m *Message) IsEmpty() bool {
+	return len(m.parts) == 0
+}
+
+func (m *Message) add(p messagePart) *Message {
+	if p.text != "" || p.kind == partLink {
+		m.parts = append(m.parts, p)
+	}
+	return m
+}
+
+// String renders the message for TelegramParseMode, ready to be sent.
+func (m *Message) String() string {
+	return m.Render(TelegramParseMode)
+}
+
+func (m *Message) Render(mode ParseMode) string {
+	var b strings.Builder
+	for _, p := range m.parts {
+		if mode == ParseModeHTML {
+			writeHTML(&b, p)
+		} else {
+			writeMarkdownV2(&b, p)
+		}
+	}
+	return b.String()
+}
+
+// PlainText renders the message without any markup, for channels that show
+// text as-is. Links are written as "text (url)".
+func (m *Message) PlainText() string {
+	var b strings.Builder
+	for _, p := range m.parts {
+		switch {
+		case p.kind == partLink && p.text != "" && p.text != p.url:
+			b.WriteString(p.text + " (" + p.url + ")")
+		case p.kind == partLink:
+			b.WriteString(p.url)
+		default:
+			b.WriteString(p.text)
+		}
+	}
+	return b.String()
+}
+
+func writeMarkdownV2(b *strings.Builder, p messagePart) {
+	switch p.kind {
+	case partText:
+		b.WriteString(markdownV2Escaper.Replace(p.text))
+	case partBold:
+		b.WriteString("*" + markdownV2Escaper.Replace(p.text) + "*")
+	case partItalic:
+		b.WriteString("_" + markdownV2Escaper.Replace(p.text) + "_")
+	case partCode:
+		b.WriteString("`" + markdownV2CodeEscaper.Replace(p.text) + "`")
+	case partPre:
+		b.WriteString("```\n" + markdownV2CodeEscaper.Replace(strings.TrimSuffix(p.text, "\n")) + "\n```")
+	case partLink:
+		b.WriteString("[" + markdownV2Escaper.Replace(p.text) + "](" + markdownV2URLEscaper.Replace(p.url) + ")")
+	}
+}
+
+func writeHTML(b *strings.Builder, p messagePart) {
+	text := html.EscapeString(p.text)
+	switch p.kind {
+	case partText:
+		b.WriteString(text)
+	case partBold:
+		b.WriteString("<b>" + text + "</b>")
+	case partItalic:
+		b.WriteString("<i>" + text + "</i>")
+	case partCode:
+		b.WriteString("<code>" + text + "</code>")
+	case partPre:
+		b.WriteString("<pre>" + html.EscapeString(strings.TrimSuffix(p.text, "\n")) + "</pre>")
+	case partLink:
+		b.WriteString(`<a href="` + html.EscapeString(p.url) + `">` + text + "</a>")
+	}
+}
@@ -0,0 +1,68 @@
+package external
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageMarkdownV2(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *Message
+		want string
+	}{
+		{"plain text escapes every special character", NewMessage().Text("1+1=2. (ok) #tag [x] a_b *c* ~d~ `e` |f| {g} !h >i -j \\k"),
+			"1\\+1\\=2\\. \\(ok\\) \\#tag \\[x\\] a\\_b \\*c\\* \\~d\\~ \\`e\\` \\|f\\| \\{g\\} \\!h \\>i \\-j \\\\k"},
+		{"bold and italic", NewMessage().Bold("jjuya_o0o").Text(" ").Italic("v1.2"), "*jjuya\\_o0o* _v1\\.2_"},
+		{"link escapes text and url separately", NewMessage().Link("Title (live)", "https://x.com/a_(b)"), "[Title \\(live\\)](https://x.com/a_(b\\))"},
+		{"code keeps everything but backticks", NewMessage().Code("a_b`c"), "`a_b\\`c`"},
+		{"pre block", NewMessage().Pre("BBCA  9000\n"), "```\nBBCA  9000\n```"},
+		{"empty parts are dropped", NewMessage().Text("").Bold(""), ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.msg.String())
+		})
+	}
+}
+
+func TestMessageHTML(t *testing.T) {
+	msg := NewMessage().
+		Text("a < b & c\n").
+		Bold("<me>").
+		Italic("i").
+		Code("x<y").
+		Link("news & more", `https://x.com/?a=1&b="2"`).
+		Pre("if a < b {}")
+
+	assert.Equal(t, `a &lt; b &amp; c
+<b>&lt;me&gt;</b><i>i</i><code>x&lt;y</code><a href="https://x.com/?a=1&amp;b=&#34;2&#34;">news &amp; more</a><pre>if a &lt; b {}</pre>`, msg.Render(ParseModeHTML))
+}
+
+func TestMessageAppend(t *testing.T) {
+	header := NewMessage().Bold("Watchlist")
+	assert.True(t, NewMessage().IsEmpty())
+	assert.Equal(t, "*Watchlist*\n", NewMessage().Append(header).Text("\n").String())
+}
+
+func TestSplitMessageUnderstandsBuilderOutput(t *testing.T) {
+	msg := NewMessage().Text("intro\n").Code("a\\`b c").Text(" end").String()
+	for _, chunk := range SplitMessage(msg, 14) {
+		assert.NotContains(t, chunk, "`a\\`b\n")
+		assert.Equal(t, 0, countUnescaped(chunk, '`')%2, chunk)
+	}
+}
+
+func countUnescaped(s string, c byte) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case c:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,143 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	InputMediaPhoto = "photo"
+	InputMediaVideo = "video"
+
+	// MaxMediaGroupSize is the most items Telegram accepts in one album; it
+	// also needs at least two.
+	MaxMediaGroupSize = 10
+)
+
+// InputMedia is one item of a media group. Media is a URL for Telegram to
+// fetch; for SendMediaGroupUpload set Data and Filename instead.
+type InputMedia struct {
+	Type      string    `json:"type"` // InputMediaPhoto or InputMediaVideo
+	Media     string    `json:"media"`
+	Caption   string    `json:"caption,omitempty"`
+	ParseMode ParseMode `json:"parse_mode,omitempty"`
+	Data      []byte    `json:"-"`
+	Filename  string    `json:"-"`
+}
+
+// SendMediaGroup sends up to MaxMediaGroupSize photos and videos as one album.
+// Telegram shows the caption of the first item under the whole album. The
+// response's Result is the first message, MessageIDs lists all of them.
+func (t *TelegramClientImpl) SendMediaGroup(ctx context.Context, chatId int64, media []InputMedia) (TelegramResponse, error) {
+	payload, err := json.Marshal(withParseMode(media))
+	if err != nil {
+		return TelegramResponse{}, err
+	}
+	reqURL := fmt.Sprintf("%s/sendmediagroup?chat_id=%d&media=%s&disable_notification=true", t.Endpoint, chatId, url.QueryEscape(string(payload)))
+
+	resp, err := t.get(ctx, reqURL)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to send media group", "service", "telegram", "chat_id", chatId, "error", err)
+		return TelegramResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	return decodeMediaGroupResponse(resp)
+}
+
+// SendMediaGroupUpload is SendMediaGroup for items that carry their bytes, e.g.
+// videos over the ~20MB remote-URL limit. Items without Data are still fetched
+// by Telegram from their URL.
+func (t *TelegramClientImpl) SendMediaGroupUpload(ctx context.Context, chatId int64, media []InputMedia) (TelegramResponse, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	items := withParseMode(media)
+	for i := range items {
+		if items[i].Data == nil {
+			continue
+		}
+		field := fmt.Sprintf("file%d", i)
+		items[i].Media = "attach://" + field
+		part, err := writer.CreateFormFile(field, items[i].Filename)
+		if err != nil {
+			return TelegramResponse{}, err
+		}
+		if _, err := part.Write(items[i].Data); err != nil {
+			return TelegramResponse{}, err
+		}
+	}
+
+	payload, err := json.Marshal(items)
+	if err != nil {
+		return TelegramResponse{}, err
+	}
+	_ = writer.WriteField("chat_id", strconv.FormatInt(chatId, 10))
+	_ = writer.WriteField("media", string(payload))
+	_ = writer.WriteField("disable_notification", "true")
+	if err := writer.Close(); err != nil {
+		return TelegramResponse{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/sendmediagroup", t.Endpoint), &body)
+	if err != nil {
+		return TelegramResponse{}, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := t.uploadClient.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to upload media group", "service", "telegram", "chat_id", chatId, "error", err)
+		return TelegramResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	return decodeMediaGroupResponse(resp)
+}
+
+func withParseMode(media []InputMedia) []InputMedia {
+	items := append([]InputMedia(nil), media...)
+	for i := range items {
+		if items[i].Caption != "" && items[i].ParseMode == "" {
+			items[i].ParseMode = TelegramParseMode
+		}
+	}
+	return items
+}
+
+// decodeMediaGroupResponse folds the array of sent messages into a
+// TelegramResponse so media groups fit the same error handling as other sends.
+func decodeMediaGroupResponse(resp *http.Response) (TelegramResponse, error) {
+	var groupResp struct {
+		Ok          bool                        `json:"ok"`
+		Result      []TelegramResult            `json:"result"`
+		ErrorCode   int                         `json:"error_code"`
+		Description string                      `json:"description"`
+		Parameters  *TelegramResponseParameters `json:"parameters"`
+	}
+	if err := decodeTelegramResponse(resp, &groupResp); err != nil {
+		slog.Error("failed to decode media group response", "service", "telegram", "error", err)
+		return TelegramResponse{}, err
+	}
+
+	telegramResp := TelegramResponse{
+		Ok:          groupResp.Ok,
+		ErrorCode:   groupResp.ErrorCode,
+		Description: groupResp.Description,
+		Parameters:  groupResp.Parameters,
+	}
+	for i, m := range groupResp.Result {
+		if i == 0 {
+			telegramResp.Result = m
+		}
+		telegramResp.MessageIDs = append(telegramResp.MessageIDs, m.MessageID)
+	}
+	return telegramResp, nil
+}
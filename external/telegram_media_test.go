@@ -0,0 +1,101 @@
+package external
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mediaGroupOK = `{"ok":true,"result":[{"message_id":21,"chat":{"id":5,"type":"private"}},{"message_id":22,"chat":{"id":5,"type":"private"}}]}`
+
+func TestTelegramSendMediaGroup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Path, "/sendmediagroup")
+		assert.Equal(t, "5", r.URL.Query().Get("chat_id"))
+
+		var media []InputMedia
+		require.NoError(t, json.Unmarshal([]byte(r.URL.Query().Get("media")), &media))
+		require.Len(t, media, 2)
+		assert.Equal(t, InputMedia{Type: InputMediaPhoto, Media: "http://img/1", Caption: "*hi*", ParseMode: TelegramParseMode}, media[0])
+		assert.Equal(t, InputMedia{Type: InputMediaVideo, Media: "http://vid/2"}, media[1])
+		_, _ = w.Write([]byte(mediaGroupOK))
+	}))
+	defer srv.Close()
+
+	resp, err := NewTelegramClient(srv.URL, "bot").SendMediaGroup(t.Context(), 5, []InputMedia{
+		{Type: InputMediaPhoto, Media: "http://img/1", Caption: "*hi*"},
+		{Type: InputMediaVideo, Media: "http://vid/2"},
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.Ok)
+	assert.Equal(t, 21, resp.Result.MessageID)
+	assert.Equal(t, []int{21, 22}, resp.MessageIDs)
+}
+
+func TestTelegramSendMediaGroupUpload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Path, "/sendmediagroup")
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "5", r.FormValue("chat_id"))
+
+		var media []InputMedia
+		require.NoError(t, json.Unmarshal([]byte(r.FormValue("media")), &media))
+		assert.Equal(t, "http://img/1", media[0].Media)
+		assert.Equal(t, "attach://file1", media[1].Media)
+
+		file, hdr, err := r.FormFile("file1")
+		require.NoError(t, err)
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "clip.mp4", hdr.Filename)
+		assert.Equal(t, "bytes", string(data))
+		_, _ = w.Write([]byte(mediaGroupOK))
+	}))
+	defer srv.Close()
+
+	resp, err := NewTelegramClient(srv.URL, "bot").SendMediaGroupUpload(t.Context(), 5, []InputMedia{
+		{Type: InputMediaPhoto, Media: "http://img/1"},
+		{Type: InputMediaVideo, Data: []byte("bytes"), Filename: "clip.mp4"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{21, 22}, resp.MessageIDs)
+}
+
+func TestTelegramSendMediaGroupRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: failed to get HTTP URL content"}`))
+	}))
+	defer srv.Close()
+
+	resp, err := NewTelegramClient(srv.URL, "bot").SendMediaGroup(t.Context(), 5, []InputMedia{{Type: InputMediaPhoto, Media: "x"}, {Type: InputMediaPhoto, Media: "y"}})
+	require.NoError(t, err)
+	assert.False(t, resp.Ok)
+	assert.Equal(t, 400, resp.ErrorCode)
+}
+
+func TestReliableClientMovesLongAlbumCaptionToFollowUp(t *testing.T) {
+	var texts []string
+	c, _ := newTestReliableClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "sendmediagroup") {
+			var media []InputMedia
+			require.NoError(t, json.Unmarshal([]byte(r.URL.Query().Get("media")), &media))
+			assert.Empty(t, media[0].Caption)
+			_, _ = w.Write([]byte(mediaGroupOK))
+			return
+		}
+		texts = append(texts, r.URL.Query().Get("text"))
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":23}}`))
+	})
+
+	caption := strings.Repeat("c", MaxCaptionLength+1)
+	resp, err := c.SendMediaGroup(t.Context(), 5, []InputMedia{{Type: InputMediaPhoto, Media: "x", Caption: caption}, {Type: InputMediaPhoto, Media: "y"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{caption}, texts)
+	assert.Equal(t, []int{21, 22, 23}, resp.MessageIDs)
+}
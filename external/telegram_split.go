@@ -0,0 +1,207 @@
+package external
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	MaxMessageLength = 4096
+	MaxCaptionLength = 1024
+
+	preFence = "```"
+)
+
+// TextLength is the length Telegram checks against its limits, in UTF-16 code
+// units. Markdown syntax is counted too, which keeps the estimate on the safe
+// side.
+func TextLength(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// SplitMessage breaks text into chunks of at most limit characters. It cuts
+// between paragraphs where it can, then between lines, then between words, and
+// never inside a markdown entity or link. A ``` block that has to be split is
+// closed at the end of one chunk and reopened at the start of the next.
+func SplitMessage(text string, limit int) []string {
+	var chunks []string
+	for TextLength(text) > limit {
+		cut, inPre := splitPoint(text, limit)
+		chunk := strings.TrimRight(text[:cut], "\n ")
+		rest := strings.TrimLeft(text[cut:], "\n")
+		if inPre {
+			chunk += "\n" + preFence
+			rest = preFence + "\n" + rest
+		}
+		if strings.TrimSpace(chunk) != "" {
+			chunks = append(chunks, chunk)
+		}
+		text = rest
+	}
+	if strings.TrimSpace(text) != "" || len(chunks) == 0 {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// splitPoint returns the byte offset to cut text at so the first part fits in
+// limit, and whether that offset lies inside a ``` block. The separator at the
+// cut is dropped, so it does not count against the limit.
+func splitPoint(text string, limit int) (int, bool) {
+	var paragraph, line, preLine, space int
+	var s markdownScanner
+
+	length := 0
+	for i, r := range text {
+		if length > limit {
+			break
+		}
+		before := length
+		length += utf16.RuneLen(r)
+		end := i + utf8.RuneLen(r)
+
+		s.next(text, i)
+		switch {
+		case s.state == entityNone && r == '\n' && end < len(text) && text[end] == '\n':
+			paragraph = end
+		case s.state == entityNone && r == '\n':
+			line = end
+		case s.state == entityPre && r == '\n' && i > s.preStart+len(preFence) && before+len("\n"+preFence) <= limit:
+			// leave room to close the block
+			preLine = end
+		case s.state == entityNone && r == ' ':
+			space = end
+		}
+	}
+
+	switch {
+	case paragraph > 0:
+		return paragraph, false
+	case line > 0:
+		return line, false
+	case preLine > 0:
+		return preLine, true
+	case space > 0:
+		return space, false
+	}
+	return hardCut(text, limit), false
+}
+
+// hardCut is the last resort for a single word longer than the limit: cut on
+// the last rune that fits, but never between a backslash and what it escapes.
+func hardCut(text string, limit int) int {
+	length, cut := 0, 0
+	for i, r := range text {
+		length += utf16.RuneLen(r)
+		if length > limit {
+			break
+		}
+		cut = i + utf8.RuneLen(r)
+	}
+	if cut > 1 && text[cut-1] == '\\' {
+		cut--
+	}
+	if cut == 0 {
+		_, cut = utf8.DecodeRuneInString(text)
+	}
+	return cut
+}
+
+type markdownEntity int
+
+const (
+	entityNone markdownEntity = iota
+	entityBold
+	entityItalic
+	entityCode
+	entityPre
+	entityLinkText
+	entityLinkURL
+)
+
+// markdownScanner tracks which MarkdownV2 entity the text is in, for the
+// entities Message produces. It does not follow nesting, which Message never
+// emits, so one state is enough.
+type markdownScanner struct {
+	state   markdownEntity
+	escaped bool // the previous rune was an escaping backslash
+	skip    int  // bytes of a ``` fence still to consume
+	// preStart is where the open ``` block began; cutting on the line right
+	// after its fence would leave an empty block behind.
+	preStart int
+}
+
+func (s *markdownScanner) next(text string, i int) {
+	if s.skip > 0 {
+		s.skip--
+		return
+	}
+	if s.escaped {
+		s.escaped = false
+		return
+	}
+
+	c := text[i]
+	if c == '\\' {
+		s.escaped = true // escapes work everywhere in MarkdownV2, even in code
+		return
+	}
+	fence := strings.HasPrefix(text[i:], preFence)
+	switch s.state {
+	case entityNone:
+		switch {
+		case fence:
+			s.state, s.skip, s.preStart = entityPre, len(preFence)-1, i
+		case c == '`':
+			s.state = entityCode
+		case c == '*':
+			s.state = entityBold
+		case c == '_':
+			s.state = entityItalic
+		case c == '[':
+			s.state = entityLinkText
+		}
+	case entityPre:
+		if fence {
+			s.state, s.skip = entityNone, len(preFence)-1
+		}
+	case entityCode:
+		if c == '`' {
+			s.state = entityNone
+		}
+	case entityBold:
+		if c == '*' {
+			s.state = entityNone
+		}
+	case entityItalic:
+		if c == '_' {
+			s.state = entityNone
+		}
+	case entityLinkText:
+		if c == ']' {
+			if strings.HasPrefix(text[i+1:], "(") {
+				s.state, s.skip = entityLinkURL, 1
+			} else {
+				s.state = entityNone
+			}
+		}
+	case entityLinkURL:
+		if c == ')' {
+			s.state = entityNone
+		}
+	}
+}
+
+// splitCaption keeps a caption that fits on the media itself; a longer one is
+// sent as follow-up messages instead, since Telegram rejects the whole request.
+func splitCaption(caption string) (string, []string) {
+	if TextLength(caption) <= MaxCaptionLength {
+		return caption, nil
+	}
+	return "", SplitMessage(caption, MaxMessageLength)
+}
@@ -0,0 +1,149 @@
+package external
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitMessageShortTextIsUntouched(t *testing.T) {
+	assert.Equal(t, []string{"hello"}, SplitMessage("hello", 10))
+	assert.Equal(t, []string{""}, SplitMessage("", 10))
+}
+
+func TestSplitMessageBoundaries(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"paragraphs first", "aaaa bbbb\ncccc\n\ndddd", 18, []string{"aaaa bbbb\ncccc", "dddd"}},
+		{"then lines", "aaaa bbbb\ncccc dddd", 16, []string{"aaaa bbbb", "cccc dddd"}},
+		{"then words", "aaaa bbbb cccc", 13, []string{"aaaa bbbb", "cccc"}},
+		{"hard cut as a last resort", "abcdefghijkl", 5, []string{"abcde", "fghij", "kl"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, SplitMessage(tc.text, tc.limit))
+		})
+	}
+}
+
+func TestSplitMessageKeepsEntitiesWhole(t *testing.T) {
+	t.Run("link is not cut", func(t *testing.T) {
+		text := "news [a long title](https://example.com/x) tail"
+		chunks := SplitMessage(text, 45)
+		require.Len(t, chunks, 2)
+		for _, chunk := range chunks {
+			assert.Equal(t, strings.Count(chunk, "["), strings.Count(chunk, ")"), chunk)
+		}
+	})
+
+	t.Run("bold spanning lines is not cut", func(t *testing.T) {
+		chunks := SplitMessage("intro\n*bold\ntext* end", 18)
+		assert.Equal(t, []string{"intro", "*bold\ntext* end"}, chunks)
+	})
+
+	t.Run("escaped markers do not open entities", func(t *testing.T) {
+		chunks := SplitMessage("snake\\_case\nnext line", 18)
+		assert.Equal(t, []string{"snake\\_case", "next line"}, chunks)
+	})
+}
+
+func TestSplitMessageReopensCodeBlocks(t *testing.T) {
+	rows := make([]string, 30)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("BBC%02d  9000  8000", i)
+	}
+	text := "Watchlist\n```\n" + strings.Join(rows, "\n") + "\n```"
+
+	chunks := SplitMessage(text, 200)
+	require.Greater(t, len(chunks), 1)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, TextLength(chunk), 200)
+		assert.Equal(t, 0, strings.Count(chunk, "```")%2, "every chunk closes its code block: %q", chunk)
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.Join(chunks, "\n"), "\n") {
+		if line != "Watchlist" && line != "```" {
+			got = append(got, line)
+		}
+	}
+	assert.Equal(t, rows, got, "no row is lost or broken")
+}
+
+func TestSplitMessageCountsUTF16(t *testing.T) {
+	assert.Equal(t, 2, TextLength("📰"))
+	for _, chunk := range SplitMessage(strings.Repeat("📰", 10), 9) {
+		assert.LessOrEqual(t, TextLength(chunk), 9)
+	}
+}
+
+func TestReliableClientSplitsLongMessages(t *testing.T) {
+	var texts []string
+	var id atomic.Int32
+	c, _ := newTestReliableClient(t, func(w http.ResponseWriter, r *http.Request) {
+		texts = append(texts, r.URL.Query().Get("text"))
+		_, _ = fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, id.Add(1))
+	})
+
+	paragraph := strings.Repeat("x", 3000)
+	resp, err := c.SendMessage(t.Context(), 5, paragraph+"\n\n"+paragraph)
+	require.NoError(t, err)
+	assert.Equal(t, []string{paragraph, paragraph}, texts)
+	assert.Equal(t, 1, resp.Result.MessageID)
+	assert.Equal(t, []int{1, 2}, resp.MessageIDs)
+}
+
+func TestReliableClientMovesLongCaptionToFollowUp(t *testing.T) {
+	var captions, texts []string
+	var id atomic.Int32
+	c, _ := newTestReliableClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "sendphoto") {
+			captions = append(captions, r.URL.Query().Get("caption"))
+		} else {
+			texts = append(texts, r.URL.Query().Get("text"))
+		}
+		_, _ = fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, id.Add(1))
+	})
+
+	t.Run("short caption stays on the photo", func(t *testing.T) {
+		resp, err := c.SendPhoto(t.Context(), 5, "http://img", "nice")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"nice"}, captions)
+		assert.Empty(t, texts)
+		assert.Equal(t, []int{1}, resp.MessageIDs)
+	})
+
+	t.Run("long caption follows the photo", func(t *testing.T) {
+		caption := strings.Repeat("y", MaxCaptionLength+1)
+		resp, err := c.SendPhoto(t.Context(), 5, "http://img", caption)
+		require.NoError(t, err)
+		assert.Equal(t, "", captions[1])
+		assert.Equal(t, []string{caption}, texts)
+		assert.Equal(t, []int{2, 3}, resp.MessageIDs)
+	})
+}
+
+func TestReliableClientKeyboardGoesOnLastChunk(t *testing.T) {
+	var markups []string
+	c, _ := newTestReliableClient(t, func(w http.ResponseWriter, r *http.Request) {
+		markups = append(markups, r.URL.Query().Get("reply_markup"))
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	})
+
+	paragraph := strings.Repeat("z", 3000)
+	keyboard := InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{{Text: "Undo", CallbackData: "x:1"}}}}
+	_, err := c.SendMessageWithKeyboard(t.Context(), 5, paragraph+"\n\n"+paragraph, keyboard)
+	require.NoError(t, err)
+	require.Len(t, markups, 2)
+	assert.Empty(t, markups[0])
+	assert.Contains(t, markups[1], "Undo")
+}
@@ -1,9 +1,12 @@
 package external
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -17,7 +20,7 @@ func TestTelegramSendMessage(t *testing.T) {
 	defer srv.Close()
 
 	c := NewTelegramClient(srv.URL, "bot")
-	resp, err := c.SendMessage(5, "hello")
+	resp, err := c.SendMessage(t.Context(), 5, "hello")
 	require.NoError(t, err)
 	assert.True(t, resp.Ok)
 	assert.Equal(t, 10, resp.Result.MessageID)
@@ -31,7 +34,7 @@ func TestTelegramSendPhoto(t *testing.T) {
 	defer srv.Close()
 
 	c := NewTelegramClient(srv.URL, "bot")
-	resp, err := c.SendPhoto(5, "http://img/1", "caption")
+	resp, err := c.SendPhoto(t.Context(), 5, "http://img/1", "caption")
 	require.NoError(t, err)
 	assert.True(t, resp.Ok)
 }
@@ -43,7 +46,7 @@ func TestTelegramDecodeError(t *testing.T) {
 	defer srv.Close()
 
 	c := NewTelegramClient(srv.URL, "bot")
-	_, err := c.SendMessage(5, "hello")
+	_, err := c.SendMessage(t.Context(), 5, "hello")
 	assert.Error(t, err)
 }
 
@@ -53,7 +56,7 @@ func TestTelegramRequestError(t *testing.T) {
 	srv.Close() // server no longer listening -> request fails
 
 	c := NewTelegramClient(url, "bot")
-	_, err := c.SendMessage(5, "hello")
+	_, err := c.SendMessage(t.Context(), 5, "hello")
 	assert.Error(t, err)
 }
 
@@ -63,7 +66,7 @@ func TestTelegramSendPhotoErrors(t *testing.T) {
 			_, _ = w.Write([]byte(`not-json`))
 		}))
 		defer srv.Close()
-		_, err := NewTelegramClient(srv.URL, "bot").SendPhoto(5, "http://img", "cap")
+		_, err := NewTelegramClient(srv.URL, "bot").SendPhoto(t.Context(), 5, "http://img", "cap")
 		assert.Error(t, err)
 	})
 
@@ -71,7 +74,7 @@ func TestTelegramSendPhotoErrors(t *testing.T) {
 		srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
 		url := srv.URL
 		srv.Close()
-		_, err := NewTelegramClient(url, "bot").SendPhoto(5, "http://img", "cap")
+		_, err := NewTelegramClient(url, "bot").SendPhoto(t.Context(), 5, "http://img", "cap")
 		assert.Error(t, err)
 	})
 }
@@ -84,7 +87,7 @@ func TestTelegramSendVideo(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	resp, err := NewTelegramClient(srv.URL, "bot").SendVideo(5, "http://vid/1", "cap")
+	resp, err := NewTelegramClient(srv.URL, "bot").SendVideo(t.Context(), 5, "http://vid/1", "cap")
 	require.NoError(t, err)
 	assert.True(t, resp.Ok)
 	assert.Equal(t, 12, resp.Result.MessageID)
@@ -103,7 +106,7 @@ func TestTelegramSendVideoUpload(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	resp, err := NewTelegramClient(srv.URL, "bot").SendVideoUpload(5, []byte("bytes"), "clip.mp4", "cap")
+	resp, err := NewTelegramClient(srv.URL, "bot").SendVideoUpload(t.Context(), 5, []byte("bytes"), "clip.mp4", "cap")
 	require.NoError(t, err)
 	assert.True(t, resp.Ok)
 	assert.Equal(t, 13, resp.Result.MessageID)
@@ -115,7 +118,7 @@ func TestTelegramSendVideoErrors(t *testing.T) {
 			_, _ = w.Write([]byte(`not-json`))
 		}))
 		defer srv.Close()
-		_, err := NewTelegramClient(srv.URL, "bot").SendVideo(5, "http://vid/1", "cap")
+		_, err := NewTelegramClient(srv.URL, "bot").SendVideo(t.Context(), 5, "http://vid/1", "cap")
 		assert.Error(t, err)
 	})
 
@@ -123,7 +126,7 @@ func TestTelegramSendVideoErrors(t *testing.T) {
 		srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
 		url := srv.URL
 		srv.Close()
-		_, err := NewTelegramClient(url, "bot").SendVideo(5, "http://vid/1", "cap")
+		_, err := NewTelegramClient(url, "bot").SendVideo(t.Context(), 5, "http://vid/1", "cap")
 		assert.Error(t, err)
 	})
 }
@@ -134,7 +137,7 @@ func TestTelegramSendVideoUploadErrors(t *testing.T) {
 			_, _ = w.Write([]byte(`not-json`))
 		}))
 		defer srv.Close()
-		_, err := NewTelegramClient(srv.URL, "bot").SendVideoUpload(5, []byte("bytes"), "clip.mp4", "cap")
+		_, err := NewTelegramClient(srv.URL, "bot").SendVideoUpload(t.Context(), 5, []byte("bytes"), "clip.mp4", "cap")
 		assert.Error(t, err)
 	})
 
@@ -142,8 +145,148 @@ func TestTelegramSendVideoUploadErrors(t *testing.T) {
 		srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
 		url := srv.URL
 		srv.Close()
-		_, err := NewTelegramClient(url, "bot").SendVideoUpload(5, []byte("bytes"), "clip.mp4", "cap")
+		_, err := NewTelegramClient(url, "bot").SendVideoUpload(t.Context(), 5, []byte("bytes"), "clip.mp4", "cap")
 		assert.Error(t, err)
 	})
 }
 
+func TestTelegramUpdateDecode(t *testing.T) {
+	raw := `{"update_id":9,"callback_query":{"id":"cb1","from":{"id":3,"is_bot":false,"first_name":"Sean"},
+		"message":{"message_id":4,"chat":{"id":5,"type":"private"}},"data":"wallet:undo:12"}}`
+
+	var update TelegramUpdate
+	require.NoError(t, json.Unmarshal([]byte(raw), &update))
+	assert.Equal(t, int64(9), update.UpdateID)
+	assert.Nil(t, update.Message)
+	require.NotNil(t, update.CallbackQuery)
+	assert.Equal(t, "wallet:undo:12", update.CallbackQuery.Data)
+	assert.Equal(t, int64(5), update.CallbackQuery.Message.Chat.ID)
+}
+
+func TestTelegramGetUpdates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Path, "/getupdates")
+		assert.Equal(t, "8", r.URL.Query().Get("offset"))
+		assert.Equal(t, "30", r.URL.Query().Get("timeout"))
+		_, _ = w.Write([]byte(`{"ok":true,"result":[{"update_id":8,"message":{"message_id":1,"chat":{"id":5,"type":"private"},"text":"/help"}}]}`))
+	}))
+	defer srv.Close()
+
+	updates, err := NewTelegramClient(srv.URL, "bot").GetUpdates(context.Background(), 8, 30*time.Second)
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	assert.Equal(t, int64(8), updates[0].UpdateID)
+	assert.Equal(t, "/help", *updates[0].Message.Text)
+}
+
+func TestTelegramGetUpdatesErrors(t *testing.T) {
+	t.Run("not ok", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Conflict: can't use getUpdates method while webhook is active"}`))
+		}))
+		defer srv.Close()
+		_, err := NewTelegramClient(srv.URL, "bot").GetUpdates(context.Background(), 0, time.Second)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "webhook is active")
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer srv.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewTelegramClient(srv.URL, "bot").GetUpdates(ctx, 0, time.Second)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestTelegramSendMessageWithKeyboard(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Path, "/sendmessage")
+		assert.JSONEq(t, `{"inline_keyboard":[[{"text":"Undo","callback_data":"wallet:undo:1"}]]}`, r.URL.Query().Get("reply_markup"))
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":14,"chat":{"id":5,"type":"private"}}}`))
+	}))
+	defer srv.Close()
+
+	keyboard := InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{{Text: "Undo", CallbackData: "wallet:undo:1"}}}}
+	resp, err := NewTelegramClient(srv.URL, "bot").SendMessageWithKeyboard(t.Context(), 5, "saved", keyboard)
+	require.NoError(t, err)
+	assert.Equal(t, 14, resp.Result.MessageID)
+}
+
+func TestTelegramAnswerCallbackQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Path, "/answercallbackquery")
+		if r.URL.Query().Get("callback_query_id") == "stale" {
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Bad Request: query is too old"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	defer srv.Close()
+
+	c := NewTelegramClient(srv.URL, "bot")
+	assert.NoError(t, c.AnswerCallbackQuery(t.Context(), "cb1", ""))
+	assert.ErrorContains(t, c.AnswerCallbackQuery(t.Context(), "stale", ""), "too old")
+}
+
+func TestTelegramEditMessage(t *testing.T) {
+	var paths []string
+	var markups []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		markups = append(markups, r.URL.Query().Get("reply_markup"))
+		assert.Equal(t, "5", r.URL.Query().Get("chat_id"))
+		assert.Equal(t, "14", r.URL.Query().Get("message_id"))
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":14,"chat":{"id":5,"type":"private"}}}`))
+	}))
+	defer srv.Close()
+
+	c := NewTelegramClient(srv.URL, "bot")
+	keyboard := &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{{Text: "Yes", CallbackData: "a:yes"}}}}
+
+	_, err := c.EditMessageText(t.Context(), 5, 14, "removed", nil)
+	require.NoError(t, err)
+	_, err = c.EditMessageReplyMarkup(t.Context(), 5, 14, keyboard)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/editmessagetext", "/editmessagereplymarkup"}, paths)
+	assert.Empty(t, markups[0], "no reply_markup removes the buttons")
+	assert.JSONEq(t, `{"inline_keyboard":[[{"text":"Yes","callback_data":"a:yes"}]]}`, markups[1])
+}
+
+func TestTelegramEditMessageErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`not-json`))
+	}))
+	defer srv.Close()
+	_, err := NewTelegramClient(srv.URL, "bot").EditMessageText(t.Context(), 5, 14, "x", nil)
+	assert.Error(t, err)
+}
+
+func TestTelegramGetMe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/getme", r.URL.Path)
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"id":42,"is_bot":true,"first_name":"Seanmc","username":"seanmcbot"}}`))
+	}))
+	defer srv.Close()
+
+	me, err := NewTelegramClient(srv.URL, "bot").GetMe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), me.ID)
+	assert.True(t, me.IsBot)
+}
+
+func TestTelegramGetMeRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewTelegramClient(srv.URL, "bot").GetMe(context.Background())
+	assert.EqualError(t, err, "getMe failed: Unauthorized")
+}
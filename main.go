@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,19 +15,37 @@ import (
 )
 
 func main() {
+	util.SetupLogging()
+
 	err := godotenv.Load()
 	if err != nil {
-		log.Println(".env file not found, relying on system environment variables")
+		slog.Info(".env file not found, relying on system environment variables")
+	}
+
+	if len(os.Args) > 1 {
+		os.Exit(bootstrap.RunCLI(os.Args[1:], os.Stdout))
 	}
 
 	settings := util.GetAppSettings()
+	util.SetLogLevel(settings.LogLevel)
 
 	mainServices, db := bootstrap.GetMainServices(settings)
-	defer db.Close()
+	if db != nil {
+		defer db.Close()
+	}
 
-	cronScheduler := bootstrap.InitScheduler(mainServices)
+	// Cancelled on shutdown so running jobs stop instead of being waited for.
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	cronScheduler := bootstrap.InitScheduler(jobsCtx, mainServices)
+	if mainServices.OutboxWorker != nil {
+		mainServices.OutboxWorker.Start()
+	}
+	if mainServices.UpdatePoller != nil && settings.TelegramSettings.PollUpdates {
+		mainServices.UpdatePoller.Start()
+	}
 
-	router := bootstrap.InitRouter(mainServices, settings.WalletSettings)
+	router := bootstrap.InitRouter(mainServices, settings)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -38,29 +56,52 @@ func main() {
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
+			slog.Error("server error", "error", err)
+			os.Exit(1)
 		}
 	}()
-	log.Println("server started on :" + port)
+	slog.Info("server started", "port", port)
 
 	// Wait for SIGTERM (Heroku dyno restart) or SIGINT (Ctrl-C).
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 	<-ctx.Done()
 
-	log.Println("shutting down gracefully...")
+	slog.Info("shutting down gracefully")
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("graceful shutdown failed: %v", err)
+		slog.Error("graceful shutdown failed", "error", err)
 	}
 
-	// Let in-flight cron jobs finish (bounded by the same deadline) so a
-	// background job isn't severed mid-write on a Heroku restart.
+	// Cancel in-flight jobs, scheduled or triggered, and let them wind down
+	// (bounded by the same deadline) so none is severed mid-write on a Heroku
+	// restart.
+	cancelJobs()
+	jobsDone := make(chan struct{})
+	go func() {
+		<-cronScheduler.Stop().Done()
+		mainServices.Jobs.Wait()
+		close(jobsDone)
+	}()
 	select {
-	case <-cronScheduler.Stop().Done():
+	case <-jobsDone:
 	case <-shutdownCtx.Done():
-		log.Println("cron jobs did not finish before shutdown deadline")
+		slog.Warn("jobs did not stop before shutdown deadline")
+	}
+	if mainServices.OutboxWorker != nil {
+		select {
+		case <-mainServices.OutboxWorker.Stop().Done():
+		case <-shutdownCtx.Done():
+			slog.Warn("outbox worker did not finish before shutdown deadline")
+		}
+	}
+	if mainServices.UpdatePoller != nil {
+		select {
+		case <-mainServices.UpdatePoller.Stop().Done():
+		case <-shutdownCtx.Done():
+			slog.Warn("telegram poller did not finish before shutdown deadline")
+		}
 	}
 }
@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contractCase is one behavior every implementation of a repository interface
+// must have, so the in-memory repositories cannot drift from the Postgres
+// ones. Each case starts from the seed data below, and reads back what it
+// wrote through the same repo.
+type contractCase[R any] struct {
+	name  string
+	check func(t *testing.T, repo R)
+}
+
+// runContract runs every case against a repo holding just the seed data.
+func runContract[R any](t *testing.T, cases []contractCase[R], newRepo func(t *testing.T) R) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, newRepo(t))
+		})
+	}
+}
+
+func seedWallets() []Wallet {
+	rent, salary := 1, 2
+	return []Wallet{
+		{ID: &rent, Date: 202406, Name: "Rent", Category: "Rent", Currency: "SGD", Amount: -1500, Done: true, Account: "DBS"},
+		{ID: &salary, Date: 202406, Name: "Salary", Category: "Income", Currency: "SGD", Amount: 5000, Done: false, Account: "DBS"},
+	}
+}
+
+func seedAllocations() map[string]int {
+	return map[string]int{"Rent": 1500}
+}
+
+func seedStocks() []Stock {
+	current, buy, lot := int64(9150), int64(8500), int64(10)
+	return []Stock{
+		{Name: "BBCA", BestPrice: 8000, CurrentPrice: &current, FairPrice: 10000, Status: true, BuyPrice: &buy, Lot: &lot},
+		{Name: "TLKM", BestPrice: 3000, FairPrice: 4000},
+	}
+}
+
+func seedInstagramAccounts() []InstagramAccount {
+	return []InstagramAccount{{ID: 1, Username: "foo", LastShortcodes: "AAA", UserID: "123", LastStoryIDs: "111"}}
+}
+
+func walletWithID(id int, name string) Wallet {
+	return Wallet{ID: &id, Date: 202407, Name: name, Category: "Daily", Currency: "SGD", Amount: -20, Done: false, Account: "DBS"}
+}
+
+// Read-backs of what the cases leave behind.
+
+func assertWallets(t *testing.T, repo WalletRepo, want []Wallet) {
+	t.Helper()
+	got, err := repo.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+}
+
+func assertStocks(t *testing.T, repo StockRepo, want []Stock) {
+	t.Helper()
+	got, err := repo.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+}
+
+func assertInstagramAccounts(t *testing.T, repo InstagramAccountRepo, want []InstagramAccount) {
+	t.Helper()
+	got, err := repo.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+}
+
+var walletContract = []contractCase[WalletRepo]{
+	{"get all returns every wallet", func(t *testing.T, repo WalletRepo) {
+		assertWallets(t, repo, seedWallets())
+	}},
+	{"get allocations", func(t *testing.T, repo WalletRepo) {
+		got, err := repo.GetAllocations(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, seedAllocations(), got)
+	}},
+	{"insert adds a wallet with a new id", func(t *testing.T, repo WalletRepo) {
+		id, err := repo.Insert(t.Context(), walletWithID(0, "Lunch"))
+		require.NoError(t, err)
+		assert.NotContains(t, []int{1, 2}, id)
+		assert.Positive(t, id)
+		assertWallets(t, repo, append(seedWallets(), walletWithID(id, "Lunch")))
+	}},
+	{"update replaces the wallet", func(t *testing.T, repo WalletRepo) {
+		id, err := repo.Update(t.Context(), walletWithID(2, "Bonus"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, id)
+		assertWallets(t, repo, []Wallet{seedWallets()[0], walletWithID(2, "Bonus")})
+	}},
+	{"update missing is not found", func(t *testing.T, repo WalletRepo) {
+		_, err := repo.Update(t.Context(), walletWithID(99, "Ghost"))
+		assert.ErrorIs(t, err, ErrNotFound)
+		assertWallets(t, repo, seedWallets())
+	}},
+	{"update without id fails", func(t *testing.T, repo WalletRepo) {
+		w := walletWithID(0, "Lunch")
+		w.ID = nil
+		_, err := repo.Update(t.Context(), w)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrNotFound)
+		assertWallets(t, repo, seedWallets())
+	}},
+	{"delete removes the wallet", func(t *testing.T, repo WalletRepo) {
+		id, err := repo.Delete(t.Context(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, id)
+		assertWallets(t, repo, seedWallets()[1:])
+	}},
+	{"delete missing is not found", func(t *testing.T, repo WalletRepo) {
+		_, err := repo.Delete(t.Context(), 99)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assertWallets(t, repo, seedWallets())
+	}},
+}
+
+var stockContract = []contractCase[StockRepo]{
+	{"get all returns every stock", func(t *testing.T, repo StockRepo) {
+		assertStocks(t, repo, seedStocks())
+	}},
+	{"create adds the stock", func(t *testing.T, repo StockRepo) {
+		current := int64(5000)
+		asii := Stock{Name: "ASII", BestPrice: 4500, CurrentPrice: &current, FairPrice: 6000, Status: true}
+		name, err := repo.Create(t.Context(), asii)
+		require.NoError(t, err)
+		assert.Equal(t, "ASII", name)
+		assertStocks(t, repo, append(seedStocks(), asii))
+	}},
+	{"create existing fails", func(t *testing.T, repo StockRepo) {
+		_, err := repo.Create(t.Context(), Stock{Name: "TLKM", BestPrice: 1})
+		assert.Error(t, err)
+		assertStocks(t, repo, seedStocks())
+	}},
+	{"update replaces the stock", func(t *testing.T, repo StockRepo) {
+		tlkm := Stock{Name: "TLKM", BestPrice: 2900, FairPrice: 4100}
+		name, err := repo.Update(t.Context(), tlkm)
+		require.NoError(t, err)
+		assert.Equal(t, "TLKM", name)
+		assertStocks(t, repo, []Stock{seedStocks()[0], tlkm})
+	}},
+	{"update clears what is left out", func(t *testing.T, repo StockRepo) {
+		bbca := Stock{Name: "BBCA", BestPrice: 8000, FairPrice: 10000}
+		_, err := repo.Update(t.Context(), bbca)
+		require.NoError(t, err)
+		assertStocks(t, repo, []Stock{bbca, seedStocks()[1]})
+	}},
+	{"update missing is not found", func(t *testing.T, repo StockRepo) {
+		_, err := repo.Update(t.Context(), Stock{Name: "GOTO"})
+		assert.ErrorIs(t, err, ErrNotFound)
+		assertStocks(t, repo, seedStocks())
+	}},
+	{"update without name fails", func(t *testing.T, repo StockRepo) {
+		_, err := repo.Update(t.Context(), Stock{})
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrNotFound)
+	}},
+	{"delete removes the stock", func(t *testing.T, repo StockRepo) {
+		name, err := repo.Delete(t.Context(), "BBCA")
+		require.NoError(t, err)
+		assert.Equal(t, "BBCA", name)
+		assertStocks(t, repo, seedStocks()[1:])
+	}},
+	{"delete missing is not found", func(t *testing.T, repo StockRepo) {
+		_, err := repo.Delete(t.Context(), "GOTO")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assertStocks(t, repo, seedStocks())
+	}},
+}
+
+var instagramContract = []contractCase[InstagramAccountRepo]{
+	{"get all returns every account", func(t *testing.T, repo InstagramAccountRepo) {
+		assertInstagramAccounts(t, repo, seedInstagramAccounts())
+	}},
+	{"update last shortcodes", func(t *testing.T, repo InstagramAccountRepo) {
+		require.NoError(t, repo.UpdateLastShortcodes(t.Context(), "foo", "BBB,AAA"))
+		want := seedInstagramAccounts()
+		want[0].LastShortcodes = "BBB,AAA"
+		assertInstagramAccounts(t, repo, want)
+	}},
+	{"update user id", func(t *testing.T, repo InstagramAccountRepo) {
+		require.NoError(t, repo.UpdateUserID(t.Context(), "foo", "456"))
+		want := seedInstagramAccounts()
+		want[0].UserID = "456"
+		assertInstagramAccounts(t, repo, want)
+	}},
+	{"update last story ids", func(t *testing.T, repo InstagramAccountRepo) {
+		require.NoError(t, repo.UpdateLastStoryIDs(t.Context(), "foo", "222"))
+		want := seedInstagramAccounts()
+		want[0].LastStoryIDs = "222"
+		assertInstagramAccounts(t, repo, want)
+	}},
+	{"update unknown account is a no-op", func(t *testing.T, repo InstagramAccountRepo) {
+		require.NoError(t, repo.UpdateUserID(t.Context(), "bar", "456"))
+		assertInstagramAccounts(t, repo, seedInstagramAccounts())
+	}},
+}
+
+func TestMemoryRepoContract(t *testing.T) {
+	store := func() *MemoryStore {
+		s, err := NewMemoryStore("")
+		require.NoError(t, err)
+		s.data = MemoryData{Wallets: seedWallets(), Allocations: seedAllocations(), Stocks: seedStocks(), InstagramAccounts: seedInstagramAccounts()}
+		return s
+	}
+
+	t.Run("wallet", func(t *testing.T) {
+		runContract(t, walletContract, func(t *testing.T) WalletRepo { return &WalletRepoMemory{Store: store()} })
+	})
+	t.Run("stock", func(t *testing.T) {
+		runContract(t, stockContract, func(t *testing.T) StockRepo { return &StockRepoMemory{Store: store()} })
+	})
+	t.Run("instagram", func(t *testing.T) {
+		runContract(t, instagramContract, func(t *testing.T) InstagramAccountRepo {
+			return &InstagramAccountRepoMemory{Store: store()}
+		})
+	})
+}
+
+// TestPostgresRepoContract runs the contract against the Postgres database
+// named by TEST_DATABASE_URL, as CI does, and is skipped without one. The
+// database is migrated, and its tables emptied and seeded before each case.
+func TestPostgresRepoContract(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	migrator, err := NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	seeded := func(t *testing.T) *sql.DB {
+		seedPostgres(t, db)
+		return db
+	}
+	t.Run("wallet", func(t *testing.T) {
+		runContract(t, walletContract, func(t *testing.T) WalletRepo { return &WalletRepoImpl{DB: seeded(t)} })
+	})
+	t.Run("stock", func(t *testing.T) {
+		runContract(t, stockContract, func(t *testing.T) StockRepo { return &StockRepoImpl{DB: seeded(t)} })
+	})
+	t.Run("instagram", func(t *testing.T) {
+		runContract(t, instagramContract, func(t *testing.T) InstagramAccountRepo {
+			return &InstagramAccountRepoImpl{DB: seeded(t)}
+		})
+	})
+}
+
+// seedPostgres replaces what the contract tables hold with the seed data,
+// keeping the seeded ids and moving their sequences past them.
+func seedPostgres(t *testing.T, db *sql.DB) {
+	t.Helper()
+	ctx := t.Context()
+	exec := func(query string, args ...any) {
+		t.Helper()
+		_, err := db.ExecContext(ctx, query, args...)
+		require.NoError(t, err, query)
+	}
+
+	exec("TRUNCATE wallets, allocations, stocks, instagram_accounts RESTART IDENTITY")
+	for _, w := range seedWallets() {
+		exec("INSERT INTO wallets (id, date, name, category, currency, amount, done, account) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			*w.ID, w.Date, w.Name, w.Category, w.Currency, w.Amount, w.Done, w.Account)
+	}
+	for category, amount := range seedAllocations() {
+		exec("INSERT INTO allocations (category, amount) VALUES ($1, $2)", category, amount)
+	}
+	for _, s := range seedStocks() {
+		exec("INSERT INTO stocks (name, best_price, current_price, fair_price, status, buy_price, lot) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			s.Name, s.BestPrice, s.CurrentPrice, s.FairPrice, boolToBit(s.Status), s.BuyPrice, s.Lot)
+	}
+	for _, a := range seedInstagramAccounts() {
+		exec("INSERT INTO instagram_accounts (id, username, last_shortcodes, user_id, last_story_ids) VALUES ($1, $2, $3, $4, $5)",
+			a.ID, a.Username, a.LastShortcodes, a.UserID, a.LastStoryIDs)
+	}
+	exec("SELECT setval(pg_get_serial_sequence('wallets', 'id'), (SELECT MAX(id) FROM wallets))")
+	exec("SELECT setval(pg_get_serial_sequence('instagram_accounts', 'id'), (SELECT MAX(id) FROM instagram_accounts))")
+}
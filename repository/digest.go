@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DigestItem is a notification held back during a chat's quiet hours. Items
+// are sent together as one digest once ReleaseAt has passed.
+type DigestItem struct {
+	ID        int       `db:"id"`
+	ChatID    int64     `db:"chat_id"`
+	Source    string    `db:"source"`
+	Text      string    `db:"text"`
+	ReleaseAt time.Time `db:"release_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type DigestRepo interface {
+	Hold(ctx context.Context, item DigestItem) error
+	Due(ctx context.Context) ([]DigestItem, error)
+	Delete(ctx context.Context, ids ...int) error
+	DeleteIn(ctx context.Context, tx *sql.Tx, ids ...int) error
+}
+
+type DigestRepoImpl struct {
+	DB *sql.DB
+}
+
+func (r *DigestRepoImpl) Hold(ctx context.Context, item DigestItem) error {
+	_, err := r.DB.ExecContext(ctx, "INSERT INTO digest_items (chat_id, source, text, release_at) VALUES ($1, $2, $3, $4)",
+		item.ChatID, item.Source, item.Text, item.ReleaseAt)
+	return err
+}
+
+// Due returns every item whose quiet hours are over, per chat in the order
+// they were held.
+func (r *DigestRepoImpl) Due(ctx context.Context) ([]DigestItem, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, chat_id, source, text, release_at, created_at
+		FROM digest_items WHERE release_at <= now()
+		ORDER BY chat_id, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []DigestItem
+	for rows.Next() {
+		var item DigestItem
+		if err := rows.Scan(&item.ID, &item.ChatID, &item.Source, &item.Text, &item.ReleaseAt, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *DigestRepoImpl) Delete(ctx context.Context, ids ...int) error {
+	return deleteDigestItems(ctx, r.DB, ids)
+}
+
+// DeleteIn deletes the items in tx, e.g. the one queuing their digest.
+func (r *DigestRepoImpl) DeleteIn(ctx context.Context, tx *sql.Tx, ids ...int) error {
+	return deleteDigestItems(ctx, tx, ids)
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func deleteDigestItems(ctx context.Context, db execer, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, "DELETE FROM digest_items WHERE id = ANY($1)", pq.Array(ids))
+	return err
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestHold(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &DigestRepoImpl{DB: db}
+	releaseAt := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO digest_items (chat_id, source, text, release_at)")).
+		WithArgs(int64(42), "instagram", "new post", releaseAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.NoError(t, repo.Hold(t.Context(), DigestItem{ChatID: 42, Source: "instagram", Text: "new post", ReleaseAt: releaseAt}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDigestDue(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &DigestRepoImpl{DB: db}
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "chat_id", "source", "text", "release_at", "created_at"}).
+		AddRow(1, 42, "news", "headline", now, now).
+		AddRow(2, 42, "stock", "BBCA", now, now)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM digest_items WHERE release_at <= now()")).WillReturnRows(rows)
+
+	got, err := repo.Due(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []DigestItem{
+		{ID: 1, ChatID: 42, Source: "news", Text: "headline", ReleaseAt: now, CreatedAt: now},
+		{ID: 2, ChatID: 42, Source: "stock", Text: "BBCA", ReleaseAt: now, CreatedAt: now},
+	}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDigestDelete(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &DigestRepoImpl{DB: db}
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM digest_items WHERE id = ANY($1)")).
+		WithArgs(pq.Array([]int{1, 2})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	require.NoError(t, repo.Delete(t.Context(), 1, 2))
+	require.NoError(t, repo.Delete(t.Context()), "nothing to delete is not a query")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,30 +1,31 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 )
 
 type InstagramAccount struct {
-	ID             int    `db:"id"`
-	Username       string `db:"username"`
-	LastShortcodes string `db:"last_shortcodes"` // comma-separated post shortcodes, e.g. "ABC123,DEF456,..."
-	UserID         string `db:"user_id"`         // numeric instagram user id; empty when not yet resolved
-	LastStoryIDs   string `db:"last_story_ids"`  // comma-separated story pks currently seen
+	ID             int    `db:"id" json:"id"`
+	Username       string `db:"username" json:"username"`
+	LastShortcodes string `db:"last_shortcodes" json:"last_shortcodes"` // comma-separated post shortcodes, e.g. "ABC123,DEF456,..."
+	UserID         string `db:"user_id" json:"user_id"`                 // numeric instagram user id; empty when not yet resolved
+	LastStoryIDs   string `db:"last_story_ids" json:"last_story_ids"`   // comma-separated story pks currently seen
 }
 
 type InstagramAccountRepo interface {
-	GetAll() ([]InstagramAccount, error)
-	UpdateLastShortcodes(username string, shortcodes string) error
-	UpdateUserID(username string, userID string) error
-	UpdateLastStoryIDs(username string, storyIDs string) error
+	GetAll(ctx context.Context) ([]InstagramAccount, error)
+	UpdateLastShortcodes(ctx context.Context, username string, shortcodes string) error
+	UpdateUserID(ctx context.Context, username string, userID string) error
+	UpdateLastStoryIDs(ctx context.Context, username string, storyIDs string) error
 }
 
 type InstagramAccountRepoImpl struct {
 	DB *sql.DB
 }
 
-func (r *InstagramAccountRepoImpl) GetAll() ([]InstagramAccount, error) {
-	rows, err := r.DB.Query("SELECT id, username, COALESCE(last_shortcodes, ''), COALESCE(user_id, ''), COALESCE(last_story_ids, '') FROM instagram_accounts")
+func (r *InstagramAccountRepoImpl) GetAll(ctx context.Context) ([]InstagramAccount, error) {
+	rows, err := r.DB.QueryContext(ctx, "SELECT id, username, COALESCE(last_shortcodes, ''), COALESCE(user_id, ''), COALESCE(last_story_ids, '') FROM instagram_accounts")
 	if err != nil {
 		return nil, err
 	}
@@ -41,17 +42,17 @@ func (r *InstagramAccountRepoImpl) GetAll() ([]InstagramAccount, error) {
 	return accounts, nil
 }
 
-func (r *InstagramAccountRepoImpl) UpdateLastShortcodes(username string, shortcodes string) error {
-	_, err := r.DB.Exec("UPDATE instagram_accounts SET last_shortcodes = $1 WHERE username = $2", shortcodes, username)
+func (r *InstagramAccountRepoImpl) UpdateLastShortcodes(ctx context.Context, username string, shortcodes string) error {
+	_, err := r.DB.ExecContext(ctx, "UPDATE instagram_accounts SET last_shortcodes = $1 WHERE username = $2", shortcodes, username)
 	return err
 }
 
-func (r *InstagramAccountRepoImpl) UpdateUserID(username string, userID string) error {
-	_, err := r.DB.Exec("UPDATE instagram_accounts SET user_id = $1 WHERE username = $2", userID, username)
+func (r *InstagramAccountRepoImpl) UpdateUserID(ctx context.Context, username string, userID string) error {
+	_, err := r.DB.ExecContext(ctx, "UPDATE instagram_accounts SET user_id = $1 WHERE username = $2", userID, username)
 	return err
 }
 
-func (r *InstagramAccountRepoImpl) UpdateLastStoryIDs(username string, storyIDs string) error {
-	_, err := r.DB.Exec("UPDATE instagram_accounts SET last_story_ids = $1 WHERE username = $2", storyIDs, username)
+func (r *InstagramAccountRepoImpl) UpdateLastStoryIDs(ctx context.Context, username string, storyIDs string) error {
+	_, err := r.DB.ExecContext(ctx, "UPDATE instagram_accounts SET last_story_ids = $1 WHERE username = $2", storyIDs, username)
 	return err
 }
@@ -20,7 +20,7 @@ func TestInstagramGetAll(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, COALESCE(last_shortcodes, ''), COALESCE(user_id, ''), COALESCE(last_story_ids, '') FROM instagram_accounts")).
 		WillReturnRows(rows)
 
-	got, err := repo.GetAll()
+	got, err := repo.GetAll(t.Context())
 	require.NoError(t, err)
 	require.Len(t, got, 2)
 	assert.Equal(t, 1, got[0].ID)
@@ -40,7 +40,7 @@ func TestInstagramUpdateLastShortcodes(t *testing.T) {
 		WithArgs("AAA,BBB", "foo").
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err := repo.UpdateLastShortcodes("foo", "AAA,BBB")
+	err := repo.UpdateLastShortcodes(t.Context(), "foo", "AAA,BBB")
 	require.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -53,7 +53,7 @@ func TestInstagramUpdateUserID(t *testing.T) {
 		WithArgs("123", "foo").
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err := repo.UpdateUserID("foo", "123")
+	err := repo.UpdateUserID(t.Context(), "foo", "123")
 	require.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -66,7 +66,7 @@ func TestInstagramUpdateLastStoryIDs(t *testing.T) {
 		WithArgs("111,222", "foo").
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err := repo.UpdateLastStoryIDs("foo", "111,222")
+	err := repo.UpdateLastStoryIDs(t.Context(), "foo", "111,222")
 	require.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -78,6 +78,6 @@ func TestInstagramGetAllQueryError(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, COALESCE(last_shortcodes, ''), COALESCE(user_id, ''), COALESCE(last_story_ids, '') FROM instagram_accounts")).
 		WillReturnError(errors.New("query failed"))
 
-	_, err := repo.GetAll()
+	_, err := repo.GetAll(t.Context())
 	assert.Error(t, err)
 }
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// jobClaimRetention is how long a claim is kept. Instances only fire an
+// execution within seconds of each other, so a week leaves plenty of margin.
+const jobClaimRetention = 7 * 24 * time.Hour
+
+// JobClaimRepo lets one instance run each scheduled execution of a job, when
+// several run side by side, e.g. two dynos, or the old and new one during a
+// deploy.
+type JobClaimRepo interface {
+	// Claim records that this instance runs job's execution scheduled at
+	// scheduledAt. ok is false when another instance already claimed it,
+	// whether that run is still going or long done.
+	Claim(ctx context.Context, job string, scheduledAt time.Time) (ok bool, err error)
+}
+
+// JobClaimRepoImpl keeps a row per execution in job_claims, keyed by job and
+// scheduled time, so the first instance to insert it runs the job. Claims are
+// not released: an instance that fires late, after the run has finished,
+// still finds the execution taken. If the claiming instance dies mid-run,
+// that execution is lost, and the next one runs as usual.
+type JobClaimRepoImpl struct {
+	DB *sql.DB
+}
+
+func (r *JobClaimRepoImpl) Claim(ctx context.Context, job string, scheduledAt time.Time) (bool, error) {
+	res, err := r.DB.ExecContext(ctx,
+		"INSERT INTO job_claims (job, scheduled_at) VALUES ($1, $2) ON CONFLICT (job, scheduled_at) DO NOTHING",
+		job, scheduledAt.UTC())
+	if err != nil {
+		return false, err
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil || claimed == 0 {
+		return false, err
+	}
+
+	// Old claims are cleared as new ones are made. A failure only leaves them
+	// for the next claim to clear.
+	_, _ = r.DB.ExecContext(ctx, "DELETE FROM job_claims WHERE job = $1 AND scheduled_at < $2",
+		job, scheduledAt.Add(-jobClaimRetention).UTC())
+	return true, nil
+}
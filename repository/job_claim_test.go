@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobClaimClaim(t *testing.T) {
+	claimQuery := regexp.QuoteMeta("INSERT INTO job_claims (job, scheduled_at) VALUES ($1, $2) ON CONFLICT (job, scheduled_at) DO NOTHING")
+	cleanupQuery := regexp.QuoteMeta("DELETE FROM job_claims WHERE job = $1 AND scheduled_at < $2")
+	scheduledAt := time.Date(2026, time.March, 10, 2, 0, 0, 0, time.UTC)
+
+	t.Run("first to claim", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec(claimQuery).WithArgs("news", scheduledAt).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(cleanupQuery).WithArgs("news", scheduledAt.Add(-jobClaimRetention)).WillReturnResult(sqlmock.NewResult(0, 3))
+
+		ok, err := (&JobClaimRepoImpl{DB: db}).Claim(t.Context(), "news", scheduledAt)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("claimed elsewhere", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec(claimQuery).WithArgs("news", scheduledAt).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		ok, err := (&JobClaimRepoImpl{DB: db}).Claim(t.Context(), "news", scheduledAt)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("same execution in another timezone", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec(claimQuery).WithArgs("news", scheduledAt).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		jakarta := time.FixedZone("WIB", 7*60*60)
+		_, err := (&JobClaimRepoImpl{DB: db}).Claim(t.Context(), "news", scheduledAt.In(jakarta))
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec(claimQuery).WillReturnError(errors.New("boom"))
+
+		ok, err := (&JobClaimRepoImpl{DB: db}).Claim(t.Context(), "news", scheduledAt)
+		assert.EqualError(t, err, "boom")
+		assert.False(t, ok)
+	})
+
+	t.Run("cleanup error", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec(claimQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(cleanupQuery).WillReturnError(errors.New("boom"))
+
+		ok, err := (&JobClaimRepoImpl{DB: db}).Claim(t.Context(), "news", scheduledAt)
+		require.NoError(t, err)
+		assert.True(t, ok, "the claim stands")
+	})
+}
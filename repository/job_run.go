@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Job run triggers and outcomes.
+const (
+	TriggerCron   = "cron"
+	TriggerManual = "manual" // CLI or HTTP
+	TriggerBot    = "bot"
+
+	JobRunning = "running"
+	JobSuccess = "success"
+	JobFailure = "failure"
+	JobSkipped = "skipped" // the previous run had not finished
+)
+
+// JobRun is one execution of a scheduled job. FinishedAt is nil while it is
+// running, or when the process died before it finished.
+type JobRun struct {
+	ID         int        `db:"id" json:"id"`
+	Job        string     `db:"job" json:"job"`
+	Trigger    string     `db:"triggered_by" json:"trigger"`
+	StartedAt  time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt *time.Time `db:"finished_at" json:"finished_at,omitempty"`
+	Outcome    string     `db:"outcome" json:"outcome"`
+	Error      string     `db:"error" json:"error,omitempty"`
+	Items      int        `db:"items" json:"items"`
+}
+
+// jobRunRetention is how long a run is kept in the history.
+const jobRunRetention = 90 * 24 * time.Hour
+
+type JobRunRepo interface {
+	// Start records a run as running and returns its id. Runs of job older
+	// than the retention are dropped.
+	Start(ctx context.Context, job, trigger string, startedAt time.Time) (int, error)
+	// Finish records how run.ID ended: FinishedAt, Outcome, Error and Items.
+	Finish(ctx context.Context, run JobRun) error
+	// Get returns one run, or ErrNotFound.
+	Get(ctx context.Context, id int) (JobRun, error)
+	// List returns the latest runs of job, newest first.
+	List(ctx context.Context, job string, limit int) ([]JobRun, error)
+}
+
+type JobRunRepoImpl struct {
+	DB *sql.DB
+}
+
+func (r *JobRunRepoImpl) Start(ctx context.Context, job, trigger string, startedAt time.Time) (int, error) {
+	var id int
+	err := r.DB.QueryRowContext(ctx, "INSERT INTO job_runs (job, triggered_by, started_at) VALUES ($1, $2, $3) RETURNING id",
+		job, trigger, startedAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	// Old runs are cleared as new ones start. A failure only leaves them for
+	// the next run to clear.
+	_, _ = r.DB.ExecContext(ctx, "DELETE FROM job_runs WHERE job = $1 AND started_at < $2",
+		job, startedAt.Add(-jobRunRetention))
+	return id, nil
+}
+
+func (r *JobRunRepoImpl) Finish(ctx context.Context, run JobRun) error {
+	res, err := r.DB.ExecContext(ctx, "UPDATE job_runs SET finished_at = $1, outcome = $2, error = $3, items = $4 WHERE id = $5",
+		run.FinishedAt, run.Outcome, run.Error, run.Items, run.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const jobRunColumns = "id, job, triggered_by, started_at, finished_at, outcome, error, items"
+
+func (r *JobRunRepoImpl) Get(ctx context.Context, id int) (JobRun, error) {
+	run, err := scanJobRun(r.DB.QueryRowContext(ctx, "SELECT "+jobRunColumns+" FROM job_runs WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return JobRun{}, ErrNotFound
+	}
+	return run, err
+}
+
+func (r *JobRunRepoImpl) List(ctx context.Context, job string, limit int) ([]JobRun, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT `+jobRunColumns+`
+		FROM job_runs WHERE job = $1
+		ORDER BY started_at DESC, id DESC LIMIT $2`, job, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func scanJobRun(row interface{ Scan(...any) error }) (JobRun, error) {
+	var run JobRun
+	err := row.Scan(&run.ID, &run.Job, &run.Trigger, &run.StartedAt, &run.FinishedAt, &run.Outcome, &run.Error, &run.Items)
+	return run, err
+}
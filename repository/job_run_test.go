@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobRunStart(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &JobRunRepoImpl{DB: db}
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO job_runs (job, triggered_by, started_at)")).
+		WithArgs("news", TriggerCron, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM job_runs WHERE job = $1 AND started_at < $2")).
+		WithArgs("news", now.Add(-jobRunRetention)).
+		WillReturnError(errors.New("lock timeout"))
+
+	id, err := repo.Start(t.Context(), "news", TriggerCron, now)
+	require.NoError(t, err, "failing to clear old runs does not fail the start")
+	assert.Equal(t, 7, id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobRunFinish(t *testing.T) {
+	now := time.Now()
+	run := JobRun{ID: 7, FinishedAt: &now, Outcome: JobFailure, Error: "no news", Items: 0}
+
+	t.Run("success", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE job_runs SET finished_at = $1, outcome = $2, error = $3, items = $4 WHERE id = $5")).
+			WithArgs(&now, JobFailure, "no news", 0, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, (&JobRunRepoImpl{DB: db}).Finish(t.Context(), run))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown run", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec("UPDATE job_runs").WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.ErrorIs(t, (&JobRunRepoImpl{DB: db}).Finish(t.Context(), run), ErrNotFound)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		mock.ExpectExec("UPDATE job_runs").WillReturnError(errors.New("boom"))
+		assert.EqualError(t, (&JobRunRepoImpl{DB: db}).Finish(t.Context(), run), "boom")
+	})
+}
+
+func TestJobRunList(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &JobRunRepoImpl{DB: db}
+	started := time.Date(2026, 10, 17, 19, 0, 0, 0, time.UTC)
+	finished := started.Add(time.Minute)
+	rows := sqlmock.NewRows([]string{"id", "job", "triggered_by", "started_at", "finished_at", "outcome", "error", "items"}).
+		AddRow(8, "stock", TriggerManual, started.Add(time.Hour), nil, JobRunning, "", 0).
+		AddRow(7, "stock", TriggerCron, started, finished, JobSuccess, "", 12)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM job_runs WHERE job = $1")).WithArgs("stock", 20).WillReturnRows(rows)
+
+	got, err := repo.List(t.Context(), "stock", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []JobRun{
+		{ID: 8, Job: "stock", Trigger: TriggerManual, StartedAt: started.Add(time.Hour), Outcome: JobRunning},
+		{ID: 7, Job: "stock", Trigger: TriggerCron, StartedAt: started, FinishedAt: &finished, Outcome: JobSuccess, Items: 12},
+	}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectQuery("FROM job_runs").WillReturnError(errors.New("boom"))
+	_, err = repo.List(t.Context(), "stock", 20)
+	assert.Error(t, err)
+}
+
+func TestJobRunGet(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &JobRunRepoImpl{DB: db}
+	started := time.Date(2026, 10, 17, 19, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM job_runs WHERE id = $1")).WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "job", "triggered_by", "started_at", "finished_at", "outcome", "error", "items"}).
+			AddRow(8, "news", TriggerManual, started, nil, JobSkipped, "news run: already running", 0))
+
+	got, err := repo.Get(t.Context(), 8)
+	require.NoError(t, err)
+	assert.Equal(t, JobRun{ID: 8, Job: "news", Trigger: TriggerManual, StartedAt: started, Outcome: JobSkipped, Error: "news run: already running"}, got)
+
+	mock.ExpectQuery("FROM job_runs").WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = repo.Get(t.Context(), 9)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
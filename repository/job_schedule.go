@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// JobSchedule is when a scheduled job runs: a cron expression with seconds,
+// read in Timezone. A disabled job only runs when triggered.
+type JobSchedule struct {
+	Job       string    `db:"job" json:"job"`
+	CronExpr  string    `db:"cron_expr" json:"cron"`
+	Timezone  string    `db:"timezone" json:"timezone"`
+	Enabled   bool      `db:"enabled" json:"enabled"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type JobScheduleRepo interface {
+	List(ctx context.Context) ([]JobSchedule, error)
+	// Save creates or replaces the schedule of s.Job and returns it as stored.
+	Save(ctx context.Context, s JobSchedule) (JobSchedule, error)
+}
+
+type JobScheduleRepoImpl struct {
+	DB *sql.DB
+}
+
+func (r *JobScheduleRepoImpl) List(ctx context.Context) ([]JobSchedule, error) {
+	rows, err := r.DB.QueryContext(ctx, "SELECT job, cron_expr, timezone, enabled, updated_at FROM job_schedules ORDER BY job")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []JobSchedule{}
+	for rows.Next() {
+		var s JobSchedule
+		if err := rows.Scan(&s.Job, &s.CronExpr, &s.Timezone, &s.Enabled, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+func (r *JobScheduleRepoImpl) Save(ctx context.Context, s JobSchedule) (JobSchedule, error) {
+	err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO job_schedules (job, cron_expr, timezone, enabled, updated_at) VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (job) DO UPDATE SET cron_expr = $2, timezone = $3, enabled = $4, updated_at = NOW()
+		RETURNING updated_at`,
+		s.Job, s.CronExpr, s.Timezone, s.Enabled).Scan(&s.UpdatedAt)
+	return s, err
+}
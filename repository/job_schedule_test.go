@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobScheduleList(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &JobScheduleRepoImpl{DB: db}
+	updated := time.Date(2026, 10, 17, 19, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT job, cron_expr, timezone, enabled, updated_at FROM job_schedules")).
+		WillReturnRows(sqlmock.NewRows([]string{"job", "cron_expr", "timezone", "enabled", "updated_at"}).
+			AddRow("news", "0 0 9 * * *", "Asia/Jakarta", true, updated).
+			AddRow("stock", "0 30 16 * * 1-5", "Asia/Singapore", false, updated))
+
+	got, err := repo.List(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []JobSchedule{
+		{Job: "news", CronExpr: "0 0 9 * * *", Timezone: "Asia/Jakarta", Enabled: true, UpdatedAt: updated},
+		{Job: "stock", CronExpr: "0 30 16 * * 1-5", Timezone: "Asia/Singapore", UpdatedAt: updated},
+	}, got)
+
+	mock.ExpectQuery("FROM job_schedules").WillReturnError(errors.New("boom"))
+	_, err = repo.List(t.Context())
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestJobScheduleSave(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &JobScheduleRepoImpl{DB: db}
+	updated := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO job_schedules (job, cron_expr, timezone, enabled, updated_at)")).
+		WithArgs("stock", "0 30 16 * * 1-5", "Asia/Jakarta", true).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(updated))
+
+	got, err := repo.Save(t.Context(), JobSchedule{Job: "stock", CronExpr: "0 30 16 * * 1-5", Timezone: "Asia/Jakarta", Enabled: true})
+	require.NoError(t, err)
+	assert.Equal(t, JobSchedule{Job: "stock", CronExpr: "0 30 16 * * 1-5", Timezone: "Asia/Jakarta", Enabled: true, UpdatedAt: updated}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
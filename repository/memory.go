@@ -0,0 +1,292 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// MemoryData is everything a MemoryStore holds, and the layout of its file.
+type MemoryData struct {
+	Wallets           []Wallet           `json:"wallets"`
+	Allocations       map[string]int     `json:"allocations"`
+	Stocks            []Stock            `json:"stocks"`
+	InstagramAccounts []InstagramAccount `json:"instagram_accounts"`
+}
+
+func (d MemoryData) clone() MemoryData {
+	return MemoryData{
+		Wallets:           slices.Clone(d.Wallets),
+		Allocations:       maps.Clone(d.Allocations),
+		Stocks:            slices.Clone(d.Stocks),
+		InstagramAccounts: slices.Clone(d.InstagramAccounts),
+	}
+}
+
+// MemoryStore backs the in-memory repositories, for running locally without
+// Postgres. With a path every change is written to that JSON file, and the
+// file is read back on start.
+type MemoryStore struct {
+	mu   sync.Mutex
+	path string
+	data MemoryData
+}
+
+// NewMemoryStore returns a store kept in path, or only in memory when path is
+// empty. A missing file starts the store empty.
+func NewMemoryStore(path string) (*MemoryStore, error) {
+	s := &MemoryStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &s.data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, w := range s.data.Wallets {
+		if w.ID == nil {
+			return nil, fmt.Errorf("%s: wallet %d has no id", path, i)
+		}
+	}
+	return s, nil
+}
+
+func (s *MemoryStore) view(fn func(d *MemoryData)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.data)
+}
+
+// update applies fn to a copy of the data and keeps it only when fn succeeds
+// and, with a file, the copy is saved, so a failure changes nothing.
+func (s *MemoryStore) update(fn func(d *MemoryData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.data.clone()
+	if err := fn(&next); err != nil {
+		return err
+	}
+	if err := s.save(next); err != nil {
+		return err
+	}
+	s.data = next
+	return nil
+}
+
+// save writes data next to the file and renames it into place, so a crash
+// never leaves a half-written file behind.
+func (s *MemoryStore) save(data MemoryData) error {
+	if s.path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+type WalletRepoMemory struct {
+	Store *MemoryStore
+}
+
+func (r *WalletRepoMemory) GetAll(_ context.Context) ([]Wallet, error) {
+	var wallets []Wallet
+	r.Store.view(func(d *MemoryData) {
+		for _, w := range d.Wallets {
+			wallets = append(wallets, copyWallet(w))
+		}
+	})
+	return wallets, nil
+}
+
+func (r *WalletRepoMemory) GetAllocations(_ context.Context) (map[string]int, error) {
+	allocations := make(map[string]int)
+	r.Store.view(func(d *MemoryData) {
+		maps.Copy(allocations, d.Allocations)
+	})
+	return allocations, nil
+}
+
+func (r *WalletRepoMemory) Insert(_ context.Context, wallet Wallet) (int, error) {
+	var id int
+	err := r.Store.update(func(d *MemoryData) error {
+		for _, w := range d.Wallets {
+			id = max(id, *w.ID)
+		}
+		id++
+		wallet.ID = &id
+		d.Wallets = append(d.Wallets, wallet)
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+func (r *WalletRepoMemory) Update(_ context.Context, wallet Wallet) (int, error) {
+	if wallet.ID == nil {
+		return -1, errors.New("wallet ID is required")
+	}
+	id := *wallet.ID
+	err := r.Store.update(func(d *MemoryData) error {
+		i := slices.IndexFunc(d.Wallets, func(w Wallet) bool { return *w.ID == id })
+		if i < 0 {
+			return ErrNotFound
+		}
+		wallet.ID = &id
+		d.Wallets[i] = wallet
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+func (r *WalletRepoMemory) Delete(_ context.Context, id int) (int, error) {
+	err := r.Store.update(func(d *MemoryData) error {
+		i := slices.IndexFunc(d.Wallets, func(w Wallet) bool { return *w.ID == id })
+		if i < 0 {
+			return ErrNotFound
+		}
+		d.Wallets = slices.Delete(d.Wallets, i, i+1)
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return id, nil
+}
+
+// copyWallet keeps callers from changing a stored wallet through its ID.
+func copyWallet(w Wallet) Wallet {
+	id := *w.ID
+	w.ID = &id
+	return w
+}
+
+type StockRepoMemory struct {
+	Store *MemoryStore
+}
+
+func (r *StockRepoMemory) GetAll(_ context.Context) ([]Stock, error) {
+	var stocks []Stock
+	r.Store.view(func(d *MemoryData) {
+		stocks = slices.Clone(d.Stocks)
+	})
+	return stocks, nil
+}
+
+func (r *StockRepoMemory) Create(_ context.Context, stock Stock) (string, error) {
+	err := r.Store.update(func(d *MemoryData) error {
+		if slices.ContainsFunc(d.Stocks, func(s Stock) bool { return s.Name == stock.Name }) {
+			return fmt.Errorf("stock %s already exists", stock.Name)
+		}
+		d.Stocks = append(d.Stocks, stock)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return stock.Name, nil
+}
+
+func (r *StockRepoMemory) Update(_ context.Context, stock Stock) (string, error) {
+	if stock.Name == "" {
+		return "", errors.New("stock name is required")
+	}
+	err := r.Store.update(func(d *MemoryData) error {
+		i := slices.IndexFunc(d.Stocks, func(s Stock) bool { return s.Name == stock.Name })
+		if i < 0 {
+			return ErrNotFound
+		}
+		d.Stocks[i] = stock
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return stock.Name, nil
+}
+
+func (r *StockRepoMemory) Delete(_ context.Context, name string) (string, error) {
+	err := r.Store.update(func(d *MemoryData) error {
+		i := slices.IndexFunc(d.Stocks, func(s Stock) bool { return s.Name == name })
+		if i < 0 {
+			return ErrNotFound
+		}
+		d.Stocks = slices.Delete(d.Stocks, i, i+1)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// InstagramAccountRepoMemory has no way to add accounts, like the Postgres
+// one; list them in the store's file.
+type InstagramAccountRepoMemory struct {
+	Store *MemoryStore
+}
+
+func (r *InstagramAccountRepoMemory) GetAll(_ context.Context) ([]InstagramAccount, error) {
+	var accounts []InstagramAccount
+	r.Store.view(func(d *MemoryData) {
+		accounts = slices.Clone(d.InstagramAccounts)
+	})
+	return accounts, nil
+}
+
+func (r *InstagramAccountRepoMemory) UpdateLastShortcodes(_ context.Context, username string, shortcodes string) error {
+	return r.updateAccount(username, func(a *InstagramAccount) { a.LastShortcodes = shortcodes })
+}
+
+func (r *InstagramAccountRepoMemory) UpdateUserID(_ context.Context, username string, userID string) error {
+	return r.updateAccount(username, func(a *InstagramAccount) { a.UserID = userID })
+}
+
+func (r *InstagramAccountRepoMemory) UpdateLastStoryIDs(_ context.Context, username string, storyIDs string) error {
+	return r.updateAccount(username, func(a *InstagramAccount) { a.LastStoryIDs = storyIDs })
+}
+
+// updateAccount changes the named account. Like an UPDATE matching no rows,
+// an unknown username is not an error.
+func (r *InstagramAccountRepoMemory) updateAccount(username string, fn func(a *InstagramAccount)) error {
+	return r.Store.update(func(d *MemoryData) error {
+		for i := range d.InstagramAccounts {
+			if d.InstagramAccounts[i].Username == username {
+				fn(&d.InstagramAccounts[i])
+			}
+		}
+		return nil
+	})
+}
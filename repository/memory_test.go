@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorePersistsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seanmcapp.json")
+	store, err := NewMemoryStore(path)
+	require.NoError(t, err)
+
+	wallets := &WalletRepoMemory{Store: store}
+	id, err := wallets.Insert(t.Context(), walletWithID(0, "Lunch"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	_, err = (&StockRepoMemory{Store: store}).Create(t.Context(), Stock{Name: "BBCA", BestPrice: 8000})
+	require.NoError(t, err)
+
+	reopened, err := NewMemoryStore(path)
+	require.NoError(t, err)
+	got, err := (&WalletRepoMemory{Store: reopened}).GetAll(t.Context())
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "Lunch", got[0].Name)
+	stocks, err := (&StockRepoMemory{Store: reopened}).GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []Stock{{Name: "BBCA", BestPrice: 8000}}, stocks)
+}
+
+func TestMemoryStoreReadsChangesBack(t *testing.T) {
+	store, err := NewMemoryStore("")
+	require.NoError(t, err)
+	store.data = MemoryData{Wallets: seedWallets(), InstagramAccounts: seedInstagramAccounts()}
+
+	wallets := &WalletRepoMemory{Store: store}
+	_, err = wallets.Update(t.Context(), walletWithID(2, "Bonus"))
+	require.NoError(t, err)
+	_, err = wallets.Delete(t.Context(), 1)
+	require.NoError(t, err)
+	id, err := wallets.Insert(t.Context(), walletWithID(0, "Lunch"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, id, "ids are never reused")
+
+	got, err := wallets.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []Wallet{walletWithID(2, "Bonus"), walletWithID(3, "Lunch")}, got)
+
+	*got[0].ID = 7
+	again, _ := wallets.GetAll(t.Context())
+	assert.Equal(t, 2, *again[0].ID, "returned wallets do not alias the store")
+
+	accounts := &InstagramAccountRepoMemory{Store: store}
+	require.NoError(t, accounts.UpdateLastShortcodes(t.Context(), "foo", "BBB,AAA"))
+	require.NoError(t, accounts.UpdateUserID(t.Context(), "foo", "456"))
+	require.NoError(t, accounts.UpdateLastStoryIDs(t.Context(), "foo", "222"))
+	all, _ := accounts.GetAll(t.Context())
+	assert.Equal(t, []InstagramAccount{{ID: 1, Username: "foo", LastShortcodes: "BBB,AAA", UserID: "456", LastStoryIDs: "222"}}, all)
+}
+
+func TestMemoryStoreFailedSaveChangesNothing(t *testing.T) {
+	store, err := NewMemoryStore(filepath.Join(t.TempDir(), "missing-dir", "seanmcapp.json"))
+	require.NoError(t, err)
+
+	stocks := &StockRepoMemory{Store: store}
+	_, err = stocks.Create(t.Context(), Stock{Name: "BBCA"})
+	assert.Error(t, err)
+
+	got, err := stocks.GetAll(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestNewMemoryStoreRejectsBadFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"broken.json":       `{"wallets": [`,
+		"wallet-no-id.json": `{"wallets": [{"name": "Rent"}]}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := NewMemoryStore(path)
+		assert.Error(t, err, name)
+	}
+}
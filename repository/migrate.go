@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one schema change, read from migrations/NNNN_name.up.sql and
+// its matching .down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaAheadError means the database has migrations this binary does not
+// know about, i.e. it was migrated by a newer release.
+type SchemaAheadError struct {
+	DBVersion     int
+	LatestVersion int
+}
+
+func (e *SchemaAheadError) Error() string {
+	return fmt.Sprintf("database schema is at version %d but this build only knows up to %d; deploy a newer build", e.DBVersion, e.LatestVersion)
+}
+
+// Migrator applies the embedded migrations and records each applied version
+// in schema_migrations.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration // sorted by version
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		rawVersion, name, hasName := strings.Cut(base, "_")
+		version, err := strconv.Atoi(rawVersion)
+		if !ok || !hasName || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s is not named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest is the newest version this build knows about.
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Version returns the newest version applied to the database, 0 for none.
+func (m *Migrator) Version() (int, error) {
+	return m.version(context.Background(), m.DB)
+}
+
+func (m *Migrator) version(ctx context.Context, db migrationDB) (int, error) {
+	if err := ensureTable(ctx, db); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Check returns the database version, with a SchemaAheadError when the
+// database is newer than this build.
+func (m *Migrator) Check() (int, error) {
+	return m.check(context.Background(), m.DB)
+}
+
+func (m *Migrator) check(ctx context.Context, db migrationDB) (int, error) {
+	version, err := m.version(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if version > m.Latest() {
+		return version, &SchemaAheadError{DBVersion: version, LatestVersion: m.Latest()}
+	}
+	return version, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the versions applied. It holds the migration lock throughout,
+// so of two instances booting together the second waits and then finds
+// nothing left to apply.
+func (m *Migrator) Up() ([]int, error) {
+	var applied []int
+	err := m.locked(func(ctx context.Context, conn *sql.Conn) error {
+		current, err := m.check(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if migration.Version <= current {
+				continue
+			}
+			err := inTx(ctx, conn, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// BaselineVersion is the migration that creates the schema the app started
+// out with. It holds production data and is never reverted.
+const BaselineVersion = 1
+
+// Down reverts the newest steps migrations and returns the versions reverted.
+// It stops at the baseline, however many steps are asked for, and holds the
+// migration lock like Up.
+func (m *Migrator) Down(steps int) ([]int, error) {
+	var reverted []int
+	err := m.locked(func(ctx context.Context, conn *sql.Conn) error {
+		current, err := m.check(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.Migrations[i]
+			if migration.Version > current {
+				continue
+			}
+			if migration.Version <= BaselineVersion {
+				break
+			}
+			err := inTx(ctx, conn, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting %04d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// migrationLockID is the Postgres advisory lock taken while migrating. Any
+// constant works as long as nothing else in the database uses it.
+const migrationLockID = 5_412_001
+
+// migrationDB is what migrating needs of a *sql.DB or a *sql.Conn.
+type migrationDB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// locked runs fn holding the migration lock. The lock belongs to a session,
+// so fn gets the one connection that holds it and must not use the pool.
+func (m *Migrator) locked(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("taking the migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			// Keep the session, and so the lock, out of the pool.
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+	return fn(ctx, conn)
+}
+
+func ensureTable(ctx context.Context, db migrationDB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	return err
+}
+
+// inTx runs a migration script and its bookkeeping statement together, so a
+// failed migration leaves neither the schema nor schema_migrations changed.
+func inTx(ctx context.Context, db migrationDB, script, bookkeeping string, args ...any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
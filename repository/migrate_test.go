@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock := newMockDB(t)
+	return &Migrator{DB: db, Migrations: []Migration{
+		{Version: 1, Name: "baseline", Up: "CREATE TABLE a (id INT)", Down: "DROP TABLE a"},
+		{Version: 2, Name: "more", Up: "CREATE TABLE b (id INT)", Down: "DROP TABLE b"},
+	}}, mock
+}
+
+func expectVersion(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(version), 0) FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+// expectLocked expects the migration lock around the expectations script
+// sets, reading version first.
+func expectLocked(mock sqlmock.Sqlmock, version int, script func()) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectVersion(mock, version)
+	script()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := NewMigrator(nil)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, m.Migrations)
+	for i, migration := range m.Migrations {
+		assert.Equal(t, i+1, migration.Version, "versions are consecutive")
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+	assert.Equal(t, len(m.Migrations), m.Latest())
+}
+
+func TestLoadMigrationsRejectsBadFiles(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name":     {"m/first.up.sql": {Data: []byte("x")}},
+		"missing down": {"m/0001_a.up.sql": {Data: []byte("x")}},
+		"name clash":   {"m/0001_a.up.sql": {Data: []byte("x")}, "m/0001_b.down.sql": {Data: []byte("x")}},
+		"direction":    {"m/0001_a.sideways.sql": {Data: []byte("x")}},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadMigrations(fsys, "m")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMigratorUp(t *testing.T) {
+	m, mock := testMigrator(t)
+	expectLocked(mock, 1, func() {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE b (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version, name)")).WithArgs(2, "more").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	})
+
+	applied, err := m.Up()
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorUpRollsBackFailedMigration(t *testing.T) {
+	m, mock := testMigrator(t)
+	expectLocked(mock, 0, func() {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE a (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations")).WithArgs(1, "baseline").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE b (id INT)")).WillReturnError(errors.New("syntax error"))
+		mock.ExpectRollback()
+	})
+
+	applied, err := m.Up()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "0002_more")
+	assert.Equal(t, []int{1}, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorDown(t *testing.T) {
+	m, mock := testMigrator(t)
+	expectLocked(mock, 2, func() {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DROP TABLE b")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	})
+
+	reverted, err := m.Down(1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, reverted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorDownStopsAtBaseline(t *testing.T) {
+	m, mock := testMigrator(t)
+	expectLocked(mock, 2, func() {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DROP TABLE b")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	})
+
+	reverted, err := m.Down(5)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, reverted)
+	assert.NoError(t, mock.ExpectationsWereMet(), "the baseline is not dropped")
+}
+
+func TestMigratorRefusesNewerSchema(t *testing.T) {
+	m, mock := testMigrator(t)
+	expectLocked(mock, 3, func() {})
+
+	_, err := m.Up()
+
+	var ahead *SchemaAheadError
+	require.ErrorAs(t, err, &ahead)
+	assert.Equal(t, SchemaAheadError{DBVersion: 3, LatestVersion: 2}, *ahead)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorUpNeedsTheLock(t *testing.T) {
+	m, mock := testMigrator(t)
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(migrationLockID).WillReturnError(errors.New("connection reset"))
+
+	applied, err := m.Up()
+	assert.ErrorContains(t, err, "taking the migration lock")
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet(), "nothing is read or applied without the lock")
+}
@@ -0,0 +1,2 @@
+-- The baseline holds production data and is never reverted: Migrator.Down
+-- stops at version 1, so this file is intentionally empty.
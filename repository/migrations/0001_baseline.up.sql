@@ -0,0 +1,35 @@
+-- Tables carried over from the original app. IF NOT EXISTS lets databases
+-- created before migrations existed adopt this version as they are.
+CREATE TABLE IF NOT EXISTS wallets (
+    id       SERIAL PRIMARY KEY,
+    date     INTEGER NOT NULL,
+    name     TEXT    NOT NULL,
+    category TEXT    NOT NULL,
+    currency TEXT    NOT NULL,
+    amount   INTEGER NOT NULL,
+    done     BOOLEAN NOT NULL DEFAULT FALSE,
+    account  TEXT    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS allocations (
+    category TEXT PRIMARY KEY,
+    amount   INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS stocks (
+    name          TEXT PRIMARY KEY,
+    best_price    BIGINT NOT NULL,
+    current_price BIGINT,
+    fair_price    BIGINT NOT NULL,
+    status        BIT(1) NOT NULL DEFAULT B'0', -- 0 wishlist, 1 bought
+    buy_price     BIGINT,
+    lot           BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS instagram_accounts (
+    id              SERIAL PRIMARY KEY,
+    username        TEXT NOT NULL UNIQUE,
+    last_shortcodes TEXT,
+    user_id         TEXT,
+    last_story_ids  TEXT
+);
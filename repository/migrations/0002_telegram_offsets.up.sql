@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS telegram_offsets (
+    botname   TEXT PRIMARY KEY,
+    update_id BIGINT NOT NULL
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS digest_items (
+    id         SERIAL PRIMARY KEY,
+    chat_id    BIGINT      NOT NULL,
+    source     TEXT        NOT NULL,
+    text       TEXT        NOT NULL,
+    release_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS digest_items_release_at_idx ON digest_items (release_at);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+    id           SERIAL PRIMARY KEY,
+    job          TEXT        NOT NULL,
+    triggered_by TEXT        NOT NULL,
+    started_at   TIMESTAMPTZ NOT NULL,
+    finished_at  TIMESTAMPTZ,
+    outcome      TEXT        NOT NULL DEFAULT 'running',
+    error        TEXT        NOT NULL DEFAULT '',
+    items        INTEGER     NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS job_runs_job_started_at_idx ON job_runs (job, started_at DESC);
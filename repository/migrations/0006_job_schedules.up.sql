@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS job_schedules (
+    job        TEXT PRIMARY KEY,
+    cron_expr  TEXT        NOT NULL,
+    timezone   TEXT        NOT NULL DEFAULT 'Asia/Jakarta',
+    enabled    BOOLEAN     NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO job_schedules (job, cron_expr) VALUES
+    ('news', '0 0 9 * * *'),
+    ('stock', '0 0 19 * * *'),
+    ('instagram', '0 0 * * * *'),
+    ('digest', '0 * * * * *')
+ON CONFLICT (job) DO NOTHING;
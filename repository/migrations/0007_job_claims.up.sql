@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS job_claims (
+    job          TEXT        NOT NULL,
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    claimed_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (job, scheduled_at)
+);
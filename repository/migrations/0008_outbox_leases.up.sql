@@ -0,0 +1,3 @@
+-- A message an instance has claimed to send is leased to it until
+-- locked_until, so other instances draining the outbox leave it alone.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+DELETE FROM outbox WHERE kind <> 'text';
+ALTER TABLE outbox DROP COLUMN IF EXISTS kind;
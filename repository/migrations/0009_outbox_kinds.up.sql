@@ -0,0 +1,3 @@
+-- What a message is: a plain text message, or, e.g. for 'instagram', a
+-- payload in text that the kind's handler delivers.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'text';
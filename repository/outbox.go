@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+
+	// OutboxText is the kind of a plain text message, the default.
+	OutboxText = "text"
+)
+
+const (
+	// outboxLease is how long a claimed message is left to the instance that
+	// claimed it, long enough for a batch with retries and video uploads.
+	outboxLease = 15 * time.Minute
+	// outboxClaimLockID is the advisory lock Due claims messages under.
+	outboxClaimLockID = 5_412_002
+)
+
+// OutboxMessage is a Telegram message waiting to be delivered. Rows stay
+// pending until Telegram accepts them or they fail permanently. Text is the
+// message itself, or the payload of a Kind other than OutboxText.
+type OutboxMessage struct {
+	ID            int       `db:"id"`
+	ChatID        int64     `db:"chat_id"`
+	Kind          string    `db:"kind"` // empty is OutboxText
+	Text          string    `db:"text"`
+	Status        string    `db:"status"`
+	Attempts      int       `db:"attempts"`
+	LastError     string    `db:"last_error"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+type OutboxStats struct {
+	Pending int `json:"pending"`
+	Failed  int `json:"failed"`
+}
+
+type OutboxRepo interface {
+	Enqueue(ctx context.Context, messages ...OutboxMessage) error
+	EnqueueWith(ctx context.Context, write func(tx *sql.Tx) error, messages ...OutboxMessage) error
+	Due(ctx context.Context, limit int) ([]OutboxMessage, error)
+	MarkSent(ctx context.Context, id int) error
+	Reschedule(ctx context.Context, id int, nextAttemptAt time.Time, lastError string) error
+	MarkFailed(ctx context.Context, id int, lastError string) error
+	Stats() (OutboxStats, error)
+}
+
+type OutboxRepoImpl struct {
+	DB *sql.DB
+}
+
+// Enqueue stores all messages in one transaction, so a run's notifications are
+// either all queued or none are.
+func (r *OutboxRepoImpl) Enqueue(ctx context.Context, messages ...OutboxMessage) error {
+	return r.EnqueueWith(ctx, nil, messages...)
+}
+
+// EnqueueWith stores messages in the same transaction as write, the change
+// they report, so they are queued only if that change is saved and the change
+// is only saved with them. A nil write queues the messages on their own.
+func (r *OutboxRepoImpl) EnqueueWith(ctx context.Context, write func(tx *sql.Tx) error, messages ...OutboxMessage) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if write != nil {
+		if err := write(tx); err != nil {
+			return err
+		}
+	}
+	for _, m := range messages {
+		kind := m.Kind
+		if kind == "" {
+			kind = OutboxText
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO outbox (chat_id, kind, text) VALUES ($1, $2, $3)", m.ChatID, kind, m.Text); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Due claims up to limit pending messages whose next attempt is due, oldest
+// first, and leases them for outboxLease: other instances draining the outbox
+// leave them alone until they are marked, or until the lease runs out, e.g.
+// when this instance died sending them. A chat's messages wait behind an
+// earlier one of the chat that is waiting to be retried or leased, so each
+// chat gets its messages in the order they were queued. Instances claim one
+// at a time, under an advisory lock; one that finds it taken claims nothing
+// this time round.
+func (r *OutboxRepoImpl) Due(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", outboxClaimLockID).Scan(&locked); err != nil || !locked {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE outbox SET locked_until = now() + make_interval(secs => $3)
+		WHERE id IN (
+			SELECT id FROM outbox o
+			WHERE status = $1 AND next_attempt_at <= now() AND (locked_until IS NULL OR locked_until <= now())
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox earlier
+				WHERE earlier.chat_id = o.chat_id AND earlier.status = $1 AND earlier.id < o.id
+				AND (earlier.next_attempt_at > now() OR earlier.locked_until > now()))
+			ORDER BY id LIMIT $2
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, chat_id, kind, text, status, attempts, COALESCE(last_error, ''), next_attempt_at, created_at`,
+		OutboxPending, limit, outboxLease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.Kind, &m.Text, &m.Status, &m.Attempts, &m.LastError, &m.NextAttemptAt, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+func (r *OutboxRepoImpl) MarkSent(ctx context.Context, id int) error {
+	return r.update(ctx, "UPDATE outbox SET status = $1, attempts = attempts + 1, last_error = NULL, locked_until = NULL WHERE id = $2", OutboxSent, id)
+}
+
+func (r *OutboxRepoImpl) Reschedule(ctx context.Context, id int, nextAttemptAt time.Time, lastError string) error {
+	return r.update(ctx, "UPDATE outbox SET attempts = attempts + 1, next_attempt_at = $1, last_error = $2, locked_until = NULL WHERE id = $3", nextAttemptAt, lastError, id)
+}
+
+func (r *OutboxRepoImpl) MarkFailed(ctx context.Context, id int, lastError string) error {
+	return r.update(ctx, "UPDATE outbox SET status = $1, attempts = attempts + 1, last_error = $2, locked_until = NULL WHERE id = $3", OutboxFailed, lastError, id)
+}
+
+func (r *OutboxRepoImpl) Stats() (OutboxStats, error) {
+	var stats OutboxStats
+	err := r.DB.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE status = $1), COUNT(*) FILTER (WHERE status = $2)
+		FROM outbox`,
+		OutboxPending, OutboxFailed).Scan(&stats.Pending, &stats.Failed)
+	return stats, err
+}
+
+func (r *OutboxRepoImpl) update(ctx context.Context, query string, args ...any) error {
+	res, err := r.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
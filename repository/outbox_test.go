@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxEnqueue(t *testing.T) {
+	t.Run("all messages in one transaction", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &OutboxRepoImpl{DB: db}
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox (chat_id, kind, text)")).WithArgs(int64(1), OutboxText, "a").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox (chat_id, kind, text)")).WithArgs(int64(1), "instagram", `{"id":"A"}`).WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, repo.Enqueue(t.Context(), OutboxMessage{ChatID: 1, Text: "a"}, OutboxMessage{ChatID: 1, Kind: "instagram", Text: `{"id":"A"}`}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("with the write it reports", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &OutboxRepoImpl{DB: db}
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM digest_items")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox (chat_id, kind, text)")).WithArgs(int64(1), OutboxText, "a").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		write := func(tx *sql.Tx) error { return (&DigestRepoImpl{}).DeleteIn(t.Context(), tx, 5) }
+		require.NoError(t, repo.EnqueueWith(t.Context(), write, OutboxMessage{ChatID: 1, Text: "a"}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a failed write queues nothing", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &OutboxRepoImpl{DB: db}
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		write := func(*sql.Tx) error { return errors.New("boom") }
+		assert.EqualError(t, repo.EnqueueWith(t.Context(), write, OutboxMessage{ChatID: 1, Text: "a"}), "boom")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("a failed insert rolls back the batch", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &OutboxRepoImpl{DB: db}
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox")).WillReturnError(errors.New("boom"))
+		mock.ExpectRollback()
+
+		assert.Error(t, repo.Enqueue(t.Context(), OutboxMessage{ChatID: 1, Text: "a"}))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestOutboxDue(t *testing.T) {
+	t.Run("claims due messages under the lock", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &OutboxRepoImpl{DB: db}
+		now := time.Now()
+		rows := sqlmock.NewRows([]string{"id", "chat_id", "kind", "text", "status", "attempts", "last_error", "next_attempt_at", "created_at"}).
+			AddRow(4, 42, "instagram", `{"id":"A"}`, OutboxPending, 0, "", now, now).
+			AddRow(3, 42, OutboxText, "hello", OutboxPending, 1, "timeout", now, now)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_xact_lock($1)")).WithArgs(outboxClaimLockID).
+			WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(`UPDATE outbox SET locked_until = now\(\) \+ make_interval\(secs => \$3\)\s+WHERE id IN \(\s+SELECT id FROM outbox o\s+`+
+			`WHERE status = \$1 AND next_attempt_at <= now\(\) AND \(locked_until IS NULL OR locked_until <= now\(\)\)\s+`+
+			`AND NOT EXISTS \(\s+SELECT 1 FROM outbox earlier\s+WHERE earlier.chat_id = o.chat_id AND earlier.status = \$1 AND earlier.id < o.id\s+`+
+			`AND \(earlier.next_attempt_at > now\(\) OR earlier.locked_until > now\(\)\)\)\s+ORDER BY id LIMIT \$2\s+FOR UPDATE SKIP LOCKED\)`).
+			WithArgs(OutboxPending, 10, outboxLease.Seconds()).
+			WillReturnRows(rows)
+		mock.ExpectCommit()
+
+		got, err := repo.Due(t.Context(), 10)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, OutboxMessage{ID: 3, ChatID: 42, Kind: OutboxText, Text: "hello", Status: OutboxPending, Attempts: 1, LastError: "timeout", NextAttemptAt: now, CreatedAt: now}, got[0])
+		assert.Equal(t, 4, got[1].ID, "oldest first")
+		assert.Equal(t, "instagram", got[1].Kind)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("claims nothing while another instance claims", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &OutboxRepoImpl{DB: db}
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_xact_lock($1)")).
+			WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+		mock.ExpectRollback()
+
+		got, err := repo.Due(t.Context(), 10)
+		require.NoError(t, err)
+		assert.Empty(t, got)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestOutboxMarkSent(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &OutboxRepoImpl{DB: db}
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET status = $1, attempts = attempts + 1, last_error = NULL, locked_until = NULL")).WithArgs(OutboxSent, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, repo.MarkSent(t.Context(), 3))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &OutboxRepoImpl{DB: db}
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.ErrorIs(t, repo.MarkSent(t.Context(), 3), ErrNotFound)
+	})
+}
+
+func TestOutboxRescheduleAndFail(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &OutboxRepoImpl{DB: db}
+	next := time.Now().Add(time.Minute)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET attempts = attempts + 1, next_attempt_at = $1")).
+		WithArgs(next, "timeout", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox SET status = $1")).
+		WithArgs(OutboxFailed, "chat not found", 4).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, repo.Reschedule(t.Context(), 3, next, "timeout"))
+	require.NoError(t, repo.MarkFailed(t.Context(), 4, "chat not found"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxStats(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &OutboxRepoImpl{DB: db}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FILTER (WHERE status = $1)")).
+		WithArgs(OutboxPending, OutboxFailed).
+		WillReturnRows(sqlmock.NewRows([]string{"pending", "failed"}).AddRow(4, 1))
+
+	got, err := repo.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, OutboxStats{Pending: 4, Failed: 1}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
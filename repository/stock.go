@@ -1,33 +1,34 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
 
 type Stock struct {
-	Name         string `db:"name"`
-	BestPrice    int64  `db:"best_price"`
-	CurrentPrice *int64 `db:"current_price"`
-	FairPrice    int64  `db:"fair_price"`
-	Status       bool   `db:"status"` // 0 -> wishlist, 1 -> bought
-	BuyPrice     *int64 `db:"buy_price"`
-	Lot          *int64 `db:"lot"`
+	Name         string `db:"name" json:"name"`
+	BestPrice    int64  `db:"best_price" json:"best_price"`
+	CurrentPrice *int64 `db:"current_price" json:"current_price"`
+	FairPrice    int64  `db:"fair_price" json:"fair_price"`
+	Status       bool   `db:"status" json:"status"` // 0 -> wishlist, 1 -> bought
+	BuyPrice     *int64 `db:"buy_price" json:"buy_price"`
+	Lot          *int64 `db:"lot" json:"lot"`
 }
 
 type StockRepo interface {
-	GetAll() ([]Stock, error)
-	Create(stock Stock) (string, error)
-	Update(stock Stock) (string, error)
-	Delete(name string) (string, error)
+	GetAll(ctx context.Context) ([]Stock, error)
+	Create(ctx context.Context, stock Stock) (string, error)
+	Update(ctx context.Context, stock Stock) (string, error)
+	Delete(ctx context.Context, name string) (string, error)
 }
 
 type StockRepoImpl struct {
 	DB *sql.DB
 }
 
-func (r *StockRepoImpl) GetAll() ([]Stock, error) {
-	rows, err := r.DB.Query("SELECT * FROM stocks")
+func (r *StockRepoImpl) GetAll(ctx context.Context) ([]Stock, error) {
+	rows, err := r.DB.QueryContext(ctx, "SELECT name, best_price, current_price, fair_price, status, buy_price, lot FROM stocks")
 	if err != nil {
 		return nil, err
 	}
@@ -51,9 +52,9 @@ func boolToBit(b bool) string {
 	return "0"
 }
 
-func (r *StockRepoImpl) Create(stock Stock) (string, error) {
+func (r *StockRepoImpl) Create(ctx context.Context, stock Stock) (string, error) {
 	var name string
-	err := r.DB.QueryRow(`
+	err := r.DB.QueryRowContext(ctx, `
 		INSERT INTO stocks (name, best_price, current_price, fair_price, status, buy_price, lot)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING name`,
@@ -61,12 +62,12 @@ func (r *StockRepoImpl) Create(stock Stock) (string, error) {
 	return name, err
 }
 
-func (r *StockRepoImpl) Update(stock Stock) (string, error) {
+func (r *StockRepoImpl) Update(ctx context.Context, stock Stock) (string, error) {
 	if stock.Name == "" {
 		return "", errors.New("stock name is required")
 	}
 	var name string
-	err := r.DB.QueryRow(`
+	err := r.DB.QueryRowContext(ctx, `
 		UPDATE stocks SET best_price=$1, current_price=$2, fair_price=$3, status=$4, buy_price=$5, lot=$6
 		WHERE name=$7 RETURNING name`,
 		stock.BestPrice, stock.CurrentPrice, stock.FairPrice, boolToBit(stock.Status), stock.BuyPrice, stock.Lot, stock.Name).Scan(&name)
@@ -76,9 +77,9 @@ func (r *StockRepoImpl) Update(stock Stock) (string, error) {
 	return name, err
 }
 
-func (r *StockRepoImpl) Delete(name string) (string, error) {
+func (r *StockRepoImpl) Delete(ctx context.Context, name string) (string, error) {
 	var deletedName string
-	err := r.DB.QueryRow("DELETE FROM stocks WHERE name=$1 RETURNING name", name).Scan(&deletedName)
+	err := r.DB.QueryRowContext(ctx, "DELETE FROM stocks WHERE name=$1 RETURNING name", name).Scan(&deletedName)
 	if err == sql.ErrNoRows {
 		return "", ErrNotFound
 	}
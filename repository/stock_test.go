@@ -17,9 +17,9 @@ func TestStockGetAll(t *testing.T) {
 
 	rows := sqlmock.NewRows([]string{"name", "best_price", "current_price", "fair_price", "status", "buy_price", "lot"}).
 		AddRow("BBCA", 100, 150, 200, true, 90, 5)
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM stocks")).WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, best_price, current_price, fair_price, status, buy_price, lot FROM stocks")).WillReturnRows(rows)
 
-	got, err := repo.GetAll()
+	got, err := repo.GetAll(t.Context())
 	require.NoError(t, err)
 	require.Len(t, got, 1)
 	assert.Equal(t, "BBCA", got[0].Name)
@@ -34,7 +34,7 @@ func TestStockCreate(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO stocks")).
 		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("BBCA"))
 
-	name, err := repo.Create(Stock{Name: "BBCA", BestPrice: 100, FairPrice: 200, Status: true})
+	name, err := repo.Create(t.Context(), Stock{Name: "BBCA", BestPrice: 100, FairPrice: 200, Status: true})
 	require.NoError(t, err)
 	assert.Equal(t, "BBCA", name)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -44,7 +44,7 @@ func TestStockUpdate(t *testing.T) {
 	t.Run("requires name", func(t *testing.T) {
 		db, _ := newMockDB(t)
 		repo := &StockRepoImpl{DB: db}
-		_, err := repo.Update(Stock{})
+		_, err := repo.Update(t.Context(), Stock{})
 		assert.Error(t, err)
 	})
 
@@ -53,7 +53,7 @@ func TestStockUpdate(t *testing.T) {
 		repo := &StockRepoImpl{DB: db}
 		mock.ExpectQuery(regexp.QuoteMeta("UPDATE stocks")).
 			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("BBCA"))
-		name, err := repo.Update(Stock{Name: "BBCA"})
+		name, err := repo.Update(t.Context(), Stock{Name: "BBCA"})
 		require.NoError(t, err)
 		assert.Equal(t, "BBCA", name)
 	})
@@ -62,7 +62,7 @@ func TestStockUpdate(t *testing.T) {
 		db, mock := newMockDB(t)
 		repo := &StockRepoImpl{DB: db}
 		mock.ExpectQuery(regexp.QuoteMeta("UPDATE stocks")).WillReturnError(sql.ErrNoRows)
-		_, err := repo.Update(Stock{Name: "BBCA"})
+		_, err := repo.Update(t.Context(), Stock{Name: "BBCA"})
 		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
@@ -73,7 +73,7 @@ func TestStockDelete(t *testing.T) {
 		repo := &StockRepoImpl{DB: db}
 		mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM stocks")).
 			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("BBCA"))
-		name, err := repo.Delete("BBCA")
+		name, err := repo.Delete(t.Context(), "BBCA")
 		require.NoError(t, err)
 		assert.Equal(t, "BBCA", name)
 	})
@@ -82,7 +82,7 @@ func TestStockDelete(t *testing.T) {
 		db, mock := newMockDB(t)
 		repo := &StockRepoImpl{DB: db}
 		mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM stocks")).WillReturnError(sql.ErrNoRows)
-		_, err := repo.Delete("BBCA")
+		_, err := repo.Delete(t.Context(), "BBCA")
 		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
@@ -91,9 +91,9 @@ func TestStockGetAllError(t *testing.T) {
 	db, mock := newMockDB(t)
 	repo := &StockRepoImpl{DB: db}
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM stocks")).WillReturnError(errors.New("query failed"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, best_price, current_price, fair_price, status, buy_price, lot FROM stocks")).WillReturnError(errors.New("query failed"))
 
-	_, err := repo.GetAll()
+	_, err := repo.GetAll(t.Context())
 	assert.Error(t, err)
 }
 
@@ -103,6 +103,6 @@ func TestStockCreateError(t *testing.T) {
 
 	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO stocks")).WillReturnError(errors.New("insert failed"))
 
-	_, err := repo.Create(Stock{Name: "BBCA", BestPrice: 100, FairPrice: 200, Status: true})
+	_, err := repo.Create(t.Context(), Stock{Name: "BBCA", BestPrice: 100, FairPrice: 200, Status: true})
 	assert.Error(t, err)
 }
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TelegramOffsetRepo remembers the last update processed in long-polling mode,
+// so a restart resumes where the previous process stopped.
+type TelegramOffsetRepo interface {
+	Get(ctx context.Context, botname string) (int64, error)
+	Save(ctx context.Context, botname string, updateID int64) error
+}
+
+type TelegramOffsetRepoImpl struct {
+	DB *sql.DB
+}
+
+func (r *TelegramOffsetRepoImpl) Get(ctx context.Context, botname string) (int64, error) {
+	var updateID int64
+	err := r.DB.QueryRowContext(ctx, "SELECT update_id FROM telegram_offsets WHERE botname=$1", botname).Scan(&updateID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return updateID, err
+}
+
+func (r *TelegramOffsetRepoImpl) Save(ctx context.Context, botname string, updateID int64) error {
+	_, err := r.DB.ExecContext(ctx, `
+		INSERT INTO telegram_offsets (botname, update_id) VALUES ($1, $2)
+		ON CONFLICT (botname) DO UPDATE SET update_id = EXCLUDED.update_id`,
+		botname, updateID)
+	return err
+}
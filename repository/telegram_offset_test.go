@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelegramOffsetGet(t *testing.T) {
+	t.Run("stored offset", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &TelegramOffsetRepoImpl{DB: db}
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT update_id FROM telegram_offsets WHERE botname=$1")).
+			WithArgs("seanmcbot").
+			WillReturnRows(sqlmock.NewRows([]string{"update_id"}).AddRow(900))
+
+		got, err := repo.Get(t.Context(), "seanmcbot")
+		require.NoError(t, err)
+		assert.Equal(t, int64(900), got)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("nothing stored yet", func(t *testing.T) {
+		db, mock := newMockDB(t)
+		repo := &TelegramOffsetRepoImpl{DB: db}
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT update_id FROM telegram_offsets")).WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.Get(t.Context(), "seanmcbot")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestTelegramOffsetSave(t *testing.T) {
+	db, mock := newMockDB(t)
+	repo := &TelegramOffsetRepoImpl{DB: db}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO telegram_offsets (botname, update_id)")).
+		WithArgs("seanmcbot", int64(901)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, repo.Save(t.Context(), "seanmcbot", 901))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
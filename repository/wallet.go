@@ -1,35 +1,36 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
 
 type Wallet struct {
-	ID       *int   `db:"id"`
-	Date     int    `db:"date"`
-	Name     string `db:"name"`
-	Category string `db:"category"`
-	Currency string `db:"currency"`
-	Amount   int    `db:"amount"`
-	Done     bool   `db:"done"`
-	Account  string `db:"account"`
+	ID       *int   `db:"id" json:"id"`
+	Date     int    `db:"date" json:"date"`
+	Name     string `db:"name" json:"name"`
+	Category string `db:"category" json:"category"`
+	Currency string `db:"currency" json:"currency"`
+	Amount   int    `db:"amount" json:"amount"`
+	Done     bool   `db:"done" json:"done"`
+	Account  string `db:"account" json:"account"`
 }
 
 type WalletRepo interface {
-	GetAll() ([]Wallet, error)
-	GetAllocations() (map[string]int, error)
-	Insert(wallet Wallet) (int, error)
-	Update(wallet Wallet) (int, error)
-	Delete(id int) (int, error)
+	GetAll(ctx context.Context) ([]Wallet, error)
+	GetAllocations(ctx context.Context) (map[string]int, error)
+	Insert(ctx context.Context, wallet Wallet) (int, error)
+	Update(ctx context.Context, wallet Wallet) (int, error)
+	Delete(ctx context.Context, id int) (int, error)
 }
 
 type WalletRepoImpl struct {
 	DB *sql.DB
 }
 
-func (r *WalletRepoImpl) GetAll() ([]Wallet, error) {
-	rows, err := r.DB.Query("SELECT * FROM wallets")
+func (r *WalletRepoImpl) GetAll(ctx context.Context) ([]Wallet, error) {
+	rows, err := r.DB.QueryContext(ctx, "SELECT id, date, name, category, currency, amount, done, account FROM wallets")
 	if err != nil {
 		return nil, err
 	}
@@ -46,8 +47,8 @@ func (r *WalletRepoImpl) GetAll() ([]Wallet, error) {
 	return wallets, nil
 }
 
-func (r *WalletRepoImpl) GetAllocations() (map[string]int, error) {
-	rows, err := r.DB.Query("SELECT category, amount FROM allocations")
+func (r *WalletRepoImpl) GetAllocations(ctx context.Context) (map[string]int, error) {
+	rows, err := r.DB.QueryContext(ctx, "SELECT category, amount FROM allocations")
 	if err != nil {
 		return nil, err
 	}
@@ -65,9 +66,9 @@ func (r *WalletRepoImpl) GetAllocations() (map[string]int, error) {
 	return allocations, nil
 }
 
-func (r *WalletRepoImpl) Insert(wallet Wallet) (int, error) {
+func (r *WalletRepoImpl) Insert(ctx context.Context, wallet Wallet) (int, error) {
 	var id int
-	err := r.DB.QueryRow(`
+	err := r.DB.QueryRowContext(ctx, `
 		INSERT INTO wallets (date, name, category, currency, amount, done, account)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id`,
@@ -81,12 +82,12 @@ func (r *WalletRepoImpl) Insert(wallet Wallet) (int, error) {
 	return id, err
 }
 
-func (r *WalletRepoImpl) Update(wallet Wallet) (int, error) {
+func (r *WalletRepoImpl) Update(ctx context.Context, wallet Wallet) (int, error) {
 	if wallet.ID == nil {
 		return -1, errors.New("wallet ID is required")
 	}
 	var id int
-	err := r.DB.QueryRow(`
+	err := r.DB.QueryRowContext(ctx, `
 		UPDATE wallets SET date=$1, name=$2, category=$3, currency=$4,
 		amount=$5, done=$6, account=$7 WHERE id=$8 RETURNING id`,
 		wallet.Date, wallet.Name, wallet.Category, wallet.Currency,
@@ -97,9 +98,9 @@ func (r *WalletRepoImpl) Update(wallet Wallet) (int, error) {
 	return id, err
 }
 
-func (r *WalletRepoImpl) Delete(id int) (int, error) {
+func (r *WalletRepoImpl) Delete(ctx context.Context, id int) (int, error) {
 	var deletedID int
-	err := r.DB.QueryRow("DELETE FROM wallets WHERE id=$1 RETURNING id", id).Scan(&deletedID)
+	err := r.DB.QueryRowContext(ctx, "DELETE FROM wallets WHERE id=$1 RETURNING id", id).Scan(&deletedID)
 	if err == sql.ErrNoRows {
 		return -1, ErrNotFound
 	}
@@ -25,9 +25,9 @@ func TestWalletGetAll(t *testing.T) {
 
 	rows := sqlmock.NewRows([]string{"id", "date", "name", "category", "currency", "amount", "done", "account"}).
 		AddRow(1, 202406, "a", "Daily", "SGD", -100, true, "DBS")
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM wallets")).WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, date, name, category, currency, amount, done, account FROM wallets")).WillReturnRows(rows)
 
-	got, err := repo.GetAll()
+	got, err := repo.GetAll(t.Context())
 	require.NoError(t, err)
 	require.Len(t, got, 1)
 	assert.Equal(t, "a", got[0].Name)
@@ -42,7 +42,7 @@ func TestWalletGetAllocations(t *testing.T) {
 	rows := sqlmock.NewRows([]string{"category", "amount"}).AddRow("Daily", 1000).AddRow("Rent", 500)
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT category, amount FROM allocations")).WillReturnRows(rows)
 
-	got, err := repo.GetAllocations()
+	got, err := repo.GetAllocations(t.Context())
 	require.NoError(t, err)
 	assert.Equal(t, map[string]int{"Daily": 1000, "Rent": 500}, got)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -55,7 +55,7 @@ func TestWalletInsert(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO wallets")).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(99))
 
-	id, err := repo.Insert(Wallet{Date: 202406, Name: "a", Account: "DBS"})
+	id, err := repo.Insert(t.Context(), Wallet{Date: 202406, Name: "a", Account: "DBS"})
 	require.NoError(t, err)
 	assert.Equal(t, 99, id)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -65,7 +65,7 @@ func TestWalletUpdate(t *testing.T) {
 	t.Run("requires id", func(t *testing.T) {
 		db, _ := newMockDB(t)
 		repo := &WalletRepoImpl{DB: db}
-		_, err := repo.Update(Wallet{})
+		_, err := repo.Update(t.Context(), Wallet{})
 		assert.Error(t, err)
 	})
 
@@ -75,7 +75,7 @@ func TestWalletUpdate(t *testing.T) {
 		id := 5
 		mock.ExpectQuery(regexp.QuoteMeta("UPDATE wallets")).
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
-		got, err := repo.Update(Wallet{ID: &id})
+		got, err := repo.Update(t.Context(), Wallet{ID: &id})
 		require.NoError(t, err)
 		assert.Equal(t, 5, got)
 	})
@@ -85,7 +85,7 @@ func TestWalletUpdate(t *testing.T) {
 		repo := &WalletRepoImpl{DB: db}
 		id := 5
 		mock.ExpectQuery(regexp.QuoteMeta("UPDATE wallets")).WillReturnError(sql.ErrNoRows)
-		_, err := repo.Update(Wallet{ID: &id})
+		_, err := repo.Update(t.Context(), Wallet{ID: &id})
 		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
@@ -96,7 +96,7 @@ func TestWalletDelete(t *testing.T) {
 		repo := &WalletRepoImpl{DB: db}
 		mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM wallets")).
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
-		got, err := repo.Delete(7)
+		got, err := repo.Delete(t.Context(), 7)
 		require.NoError(t, err)
 		assert.Equal(t, 7, got)
 	})
@@ -105,7 +105,7 @@ func TestWalletDelete(t *testing.T) {
 		db, mock := newMockDB(t)
 		repo := &WalletRepoImpl{DB: db}
 		mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM wallets")).WillReturnError(sql.ErrNoRows)
-		_, err := repo.Delete(7)
+		_, err := repo.Delete(t.Context(), 7)
 		assert.ErrorIs(t, err, ErrNotFound)
 	})
 }
@@ -114,9 +114,9 @@ func TestWalletGetAllError(t *testing.T) {
 	db, mock := newMockDB(t)
 	repo := &WalletRepoImpl{DB: db}
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM wallets")).WillReturnError(errors.New("query failed"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, date, name, category, currency, amount, done, account FROM wallets")).WillReturnError(errors.New("query failed"))
 
-	_, err := repo.GetAll()
+	_, err := repo.GetAll(t.Context())
 	assert.Error(t, err)
 }
 
@@ -126,7 +126,7 @@ func TestWalletGetAllocationsError(t *testing.T) {
 
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT category, amount FROM allocations")).WillReturnError(errors.New("query failed"))
 
-	_, err := repo.GetAllocations()
+	_, err := repo.GetAllocations(t.Context())
 	assert.Error(t, err)
 }
 
@@ -136,6 +136,6 @@ func TestWalletInsertError(t *testing.T) {
 
 	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO wallets")).WillReturnError(errors.New("insert failed"))
 
-	_, err := repo.Insert(Wallet{Date: 202406, Name: "a", Account: "DBS"})
+	_, err := repo.Insert(t.Context(), Wallet{Date: 202406, Name: "a", Account: "DBS"})
 	assert.Error(t, err)
 }
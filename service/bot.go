@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"seanmcapp/external"
+	"strings"
+)
+
+type BotService interface {
+	Register(name, description string, handler BotHandler)
+	RegisterCallback(namespace string, handler BotCallbackHandler)
+	HandleUpdate(ctx context.Context, update external.TelegramUpdate)
+}
+
+// BotCommand is a parsed "/name arg1 arg2" message addressed to the bot.
+type BotCommand struct {
+	ChatID    int64
+	MessageID int
+	From      *external.TelegramUser
+	Name      string // lower-cased, without the leading slash or @botname suffix
+	Args      []string
+}
+
+// BotCallback is a press on an inline button whose callback data is
+// "<namespace>:<data>".
+type BotCallback struct {
+	ID        string
+	ChatID    int64
+	MessageID int
+	From      external.TelegramUser
+	Namespace string
+	Data      string
+}
+
+// BotReply is what the bot sends back to the chat. Text is already formatted
+// (build it with external.Message); an empty Text sends nothing.
+type BotReply struct {
+	Text     string
+	Keyboard *external.InlineKeyboardMarkup
+
+	// Edit (callbacks only) updates the message whose button was pressed
+	// instead of sending a new one. With an empty Text only the buttons are
+	// replaced; a nil Keyboard removes them.
+	Edit bool
+	// Toast (callbacks only) is shown briefly to whoever pressed the button.
+	Toast string
+}
+
+// BotHandler answers a command under the context of the update that carried
+// it. A ValidationError is shown to the user verbatim.
+type BotHandler func(ctx context.Context, cmd BotCommand) (BotReply, error)
+
+// BotCallbackHandler answers a button press, like BotHandler does for commands.
+type BotCallbackHandler func(ctx context.Context, cb BotCallback) (BotReply, error)
+
+type botCommand struct {
+	description string
+	handler     BotHandler
+}
+
+type BotServiceImpl struct {
+	TelegramClient external.TelegramClient
+	Botname        string
+	commands       map[string]botCommand
+	order          []string // registration order, used for the help listing
+	callbacks      map[string]BotCallbackHandler
+}
+
+func NewBotService(telegramClient external.TelegramClient, botname string) *BotServiceImpl {
+	s := &BotServiceImpl{
+		TelegramClient: telegramClient,
+		Botname:        strings.TrimPrefix(botname, "@"),
+		commands:       make(map[string]botCommand),
+		callbacks:      make(map[string]BotCallbackHandler),
+	}
+	s.Register("help", "show this message", func(context.Context, BotCommand) (BotReply, error) {
+		return BotReply{Text: external.NewMessage().Text(s.help()).String()}, nil
+	})
+	return s
+}
+
+// Register adds (or replaces) a command. It is meant to be called while wiring
+// the services, before the bot starts receiving updates.
+func (s *BotServiceImpl) Register(name, description string, handler BotHandler) {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	if _, exists := s.commands[name]; !exists {
+		s.order = append(s.order, name)
+	}
+	s.commands[name] = botCommand{description: description, handler: handler}
+}
+
+// RegisterCallback routes button presses whose callback data starts with
+// "<namespace>:" to handler.
+func (s *BotServiceImpl) RegisterCallback(namespace string, handler BotCallbackHandler) {
+	s.callbacks[namespace] = handler
+}
+
+// HandleUpdate answers a command or button press. ctx is the webhook
+// request's or the poller's; replying stops once it is done.
+func (s *BotServiceImpl) HandleUpdate(ctx context.Context, update external.TelegramUpdate) {
+	if update.CallbackQuery != nil {
+		s.handleCallback(ctx, *update.CallbackQuery)
+		return
+	}
+
+	// Edited messages are deliberately not dispatched: replaying a command
+	// because its text was edited would repeat side effects such as /spend.
+	msg := update.Message
+	if msg == nil || msg.Text == nil {
+		return
+	}
+
+	cmd, ok := parseBotCommand(*msg.Text, s.Botname)
+	if !ok {
+		return
+	}
+	cmd.ChatID = msg.Chat.ID
+	cmd.MessageID = msg.MessageID
+	cmd.From = msg.From
+
+	s.send(ctx, cmd.ChatID, "/"+cmd.Name, s.dispatch(ctx, cmd))
+}
+
+func (s *BotServiceImpl) dispatch(ctx context.Context, cmd BotCommand) BotReply {
+	c, ok := s.commands[cmd.Name]
+	if !ok {
+		return BotReply{Text: external.NewMessage().Textf("Unknown command /%s\n\n%s", cmd.Name, s.help()).String()}
+	}
+
+	reply, err := c.handler(ctx, cmd)
+	if err != nil {
+		return errorReply("/"+cmd.Name, err)
+	}
+	return reply
+}
+
+func (s *BotServiceImpl) handleCallback(ctx context.Context, query external.TelegramCallbackQuery) {
+	// Always acknowledge the press, otherwise the button keeps spinning.
+	var toast string
+	defer func() {
+		if err := s.TelegramClient.AnswerCallbackQuery(ctx, query.ID, toast); err != nil {
+			slog.ErrorContext(ctx, "answering callback query", "service", "bot", "query_id", query.ID, "error", err)
+		}
+	}()
+
+	if query.Message == nil {
+		return // the message is too old for Telegram to include it
+	}
+	namespace, data, _ := strings.Cut(query.Data, ":")
+	handler, ok := s.callbacks[namespace]
+	if !ok {
+		slog.WarnContext(ctx, "no handler for callback data", "service", "bot", "data", query.Data)
+		return
+	}
+
+	cb := BotCallback{
+		ID:        query.ID,
+		ChatID:    query.Message.Chat.ID,
+		MessageID: query.Message.MessageID,
+		From:      query.From,
+		Namespace: namespace,
+		Data:      data,
+	}
+	reply, err := handler(ctx, cb)
+	if err != nil {
+		reply = errorReply("callback "+namespace, err)
+	}
+	toast = reply.Toast
+
+	if !reply.Edit {
+		s.send(ctx, cb.ChatID, "callback "+namespace, reply)
+		return
+	}
+	if reply.Text != "" {
+		_, err = s.TelegramClient.EditMessageText(ctx, cb.ChatID, cb.MessageID, reply.Text, reply.Keyboard)
+	} else {
+		_, err = s.TelegramClient.EditMessageReplyMarkup(ctx, cb.ChatID, cb.MessageID, reply.Keyboard)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "editing message for callback", "service", "bot", "callback", namespace, "chat_id", cb.ChatID, "error", err)
+	}
+}
+
+func (s *BotServiceImpl) send(ctx context.Context, chatID int64, source string, reply BotReply) {
+	if reply.Text == "" {
+		return
+	}
+
+	var err error
+	if reply.Keyboard != nil {
+		_, err = s.TelegramClient.SendMessageWithKeyboard(ctx, chatID, reply.Text, *reply.Keyboard)
+	} else {
+		_, err = s.TelegramClient.SendMessage(ctx, chatID, reply.Text)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "sending reply", "service", "bot", "command", source, "chat_id", chatID, "error", err)
+	}
+}
+
+func errorReply(source string, err error) BotReply {
+	var ve ValidationError
+	if errors.As(err, &ve) {
+		return BotReply{Text: external.NewMessage().Text(ve.Message).String()}
+	}
+	slog.Error("handling command", "service", "bot", "command", source, "error", err)
+	return BotReply{Text: external.NewMessage().Text("⚠️ Something went wrong, please try again later.").String()}
+}
+
+// confirmKeyboard asks before a destructive action. The buttons carry
+// "<namespace>:<confirm>" and "<namespace>:<cancel>" as callback data.
+func confirmKeyboard(namespace, confirm, cancel string) *external.InlineKeyboardMarkup {
+	return &external.InlineKeyboardMarkup{InlineKeyboard: [][]external.InlineKeyboardButton{{
+		{Text: "✅ Confirm", CallbackData: namespace + ":" + confirm},
+		{Text: "✖️ Cancel", CallbackData: namespace + ":" + cancel},
+	}}}
+}
+
+func (s *BotServiceImpl) help() string {
+	lines := []string{"Available commands:"}
+	for _, name := range s.order {
+		lines = append(lines, fmt.Sprintf("/%s - %s", name, s.commands[name].description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseBotCommand splits a message into command name and arguments. In groups
+// Telegram appends the bot username (/stock@seanmcbot); commands addressed to
+// another bot are ignored.
+func parseBotCommand(text, botname string) (BotCommand, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return BotCommand{}, false
+	}
+
+	name := strings.TrimPrefix(fields[0], "/")
+	if at := strings.Index(name, "@"); at >= 0 {
+		if botname != "" && !strings.EqualFold(name[at+1:], botname) {
+			return BotCommand{}, false
+		}
+		name = name[:at]
+	}
+	if name == "" {
+		return BotCommand{}, false
+	}
+	return BotCommand{Name: strings.ToLower(name), Args: fields[1:]}, true
+}
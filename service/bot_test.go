@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"seanmcapp/external"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func textUpdate(chatID int64, text string) external.TelegramUpdate {
+	return external.TelegramUpdate{
+		UpdateID: 1,
+		Message: &external.TelegramResult{
+			MessageID: 7,
+			Chat:      external.TelegramChat{ID: chatID, Type: "private"},
+			Text:      &text,
+		},
+	}
+}
+
+func TestParseBotCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantOK   bool
+		wantName string
+		wantArgs []string
+	}{
+		{"plain command", "/stock", true, "stock", []string{}},
+		{"with args", "/spend 45 Daily  lunch", true, "spend", []string{"45", "Daily", "lunch"}},
+		{"addressed to this bot", "/Stock@seanmcbot BBCA", true, "stock", []string{"BBCA"}},
+		{"addressed to another bot", "/stock@otherbot", false, "", nil},
+		{"not a command", "hello /stock", false, "", nil},
+		{"bare slash", "/", false, "", nil},
+		{"empty", "   ", false, "", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, ok := parseBotCommand(tc.text, "seanmcbot")
+			assert.Equal(t, tc.wantOK, ok)
+			if tc.wantOK {
+				assert.Equal(t, tc.wantName, cmd.Name)
+				assert.Equal(t, tc.wantArgs, cmd.Args)
+			}
+		})
+	}
+}
+
+func TestBotDispatchesRegisteredCommand(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "@seanmcbot")
+
+	var got BotCommand
+	bot.Register("/echo", "repeat the arguments", func(_ context.Context, cmd BotCommand) (BotReply, error) {
+		got = cmd
+		return BotReply{Text: "echo: " + cmd.Args[0]}, nil
+	})
+
+	bot.HandleUpdate(t.Context(), textUpdate(42, "/echo hi"))
+
+	assert.Equal(t, int64(42), got.ChatID)
+	assert.Equal(t, 7, got.MessageID)
+	require.Len(t, tg.messages, 1)
+	assert.Equal(t, telegramMessage{42, "echo: hi"}, tg.messages[0])
+}
+
+func TestBotHandlesUpdateUnderItsContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(t.Context(), key{}, "update")
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+
+	var got []any
+	bot.Register("ping", "", func(ctx context.Context, _ BotCommand) (BotReply, error) {
+		got = append(got, ctx.Value(key{}))
+		return BotReply{Text: "pong"}, nil
+	})
+	bot.RegisterCallback("ns", func(ctx context.Context, _ BotCallback) (BotReply, error) {
+		got = append(got, ctx.Value(key{}))
+		return BotReply{}, nil
+	})
+
+	bot.HandleUpdate(ctx, textUpdate(42, "/ping"))
+	assert.Equal(t, "update", tg.ctx.Value(key{}), "the reply is sent under it too")
+	tg.ctx = nil
+	bot.HandleUpdate(ctx, callbackUpdate(42, "ns:x"))
+	assert.Equal(t, "update", tg.ctx.Value(key{}), "and the callback answered")
+
+	assert.Equal(t, []any{"update", "update"}, got)
+}
+
+func TestBotUnknownCommandRepliesWithHelp(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+	bot.Register("stock", "show the watchlist", func(context.Context, BotCommand) (BotReply, error) { return BotReply{}, nil })
+
+	bot.HandleUpdate(t.Context(), textUpdate(42, "/nope"))
+
+	require.Len(t, tg.messages, 1)
+	assert.Equal(t, "Unknown command /nope\n\nAvailable commands:\n/help \\- show this message\n/stock \\- show the watchlist", tg.messages[0].text)
+}
+
+func TestBotHandlerErrors(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+	bot.Register("bad", "", func(context.Context, BotCommand) (BotReply, error) {
+		return BotReply{}, ValidationError{Message: "usage: /bad <x>"}
+	})
+	bot.Register("boom", "", func(context.Context, BotCommand) (BotReply, error) { return BotReply{}, errors.New("db down") })
+
+	bot.HandleUpdate(t.Context(), textUpdate(1, "/bad"))
+	bot.HandleUpdate(t.Context(), textUpdate(1, "/boom"))
+
+	require.Len(t, tg.messages, 2)
+	assert.Equal(t, "usage: /bad <x\\>", tg.messages[0].text, "validation messages are escaped, not parsed")
+	assert.NotContains(t, tg.messages[1].text, "db down", "internal errors are not leaked to the chat")
+}
+
+func TestBotIgnoresNonCommandUpdates(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+	edited := "/help"
+
+	bot.HandleUpdate(t.Context(), textUpdate(1, "just chatting"))
+	bot.HandleUpdate(t.Context(), external.TelegramUpdate{EditedMessage: &external.TelegramResult{Text: &edited}})
+	bot.HandleUpdate(t.Context(), external.TelegramUpdate{Message: &external.TelegramResult{}}) // e.g. a photo without text
+
+	assert.Empty(t, tg.messages)
+}
+
+func TestBotEmptyReplySendsNothing(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+	bot.Register("quiet", "", func(context.Context, BotCommand) (BotReply, error) { return BotReply{}, nil })
+
+	bot.HandleUpdate(t.Context(), textUpdate(1, "/quiet"))
+	assert.Empty(t, tg.messages)
+}
+
+func callbackUpdate(chatID int64, data string) external.TelegramUpdate {
+	return external.TelegramUpdate{CallbackQuery: &external.TelegramCallbackQuery{
+		ID:      "cb1",
+		Message: &external.TelegramResult{MessageID: 9, Chat: external.TelegramChat{ID: chatID}},
+		Data:    data,
+	}}
+}
+
+func TestBotRoutesCallbacksByNamespace(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+
+	var got BotCallback
+	bot.RegisterCallback("wallet", func(_ context.Context, cb BotCallback) (BotReply, error) {
+		got = cb
+		return BotReply{Text: "done"}, nil
+	})
+
+	bot.HandleUpdate(t.Context(), callbackUpdate(42, "wallet:undo:12"))
+
+	assert.Equal(t, BotCallback{ID: "cb1", ChatID: 42, MessageID: 9, Namespace: "wallet", Data: "undo:12"}, got)
+	assert.Equal(t, []string{"cb1"}, tg.answered)
+	require.Len(t, tg.messages, 1)
+	assert.Equal(t, "done", tg.messages[0].text)
+}
+
+func TestBotUnknownCallbackIsStillAnswered(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+
+	bot.HandleUpdate(t.Context(), callbackUpdate(42, "nope:1"))
+
+	assert.Equal(t, []string{"cb1"}, tg.answered)
+	assert.Empty(t, tg.messages)
+}
+
+func TestBotReplyWithKeyboard(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+	keyboard := external.InlineKeyboardMarkup{InlineKeyboard: [][]external.InlineKeyboardButton{{{Text: "Undo", CallbackData: "x:1"}}}}
+	bot.Register("buttons", "", func(context.Context, BotCommand) (BotReply, error) {
+		return BotReply{Text: "pick one", Keyboard: &keyboard}, nil
+	})
+
+	bot.HandleUpdate(t.Context(), textUpdate(42, "/buttons"))
+
+	assert.Empty(t, tg.messages)
+	require.Len(t, tg.keyboard, 1)
+	assert.Equal(t, "pick one", tg.keyboard[0].text)
+	assert.Equal(t, keyboard, tg.keyboard[0].keyboard)
+}
+
+func TestBotCallbackEditsPressedMessage(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+	keyboard := confirmKeyboard("ns", "yes", "no")
+	bot.RegisterCallback("ns", func(_ context.Context, cb BotCallback) (BotReply, error) {
+		switch cb.Data {
+		case "ask":
+			return BotReply{Edit: true, Keyboard: keyboard}, nil
+		default:
+			return BotReply{Edit: true, Text: "done", Toast: "Done!"}, nil
+		}
+	})
+
+	bot.HandleUpdate(t.Context(), callbackUpdate(42, "ns:ask"))
+	bot.HandleUpdate(t.Context(), callbackUpdate(42, "ns:yes"))
+
+	assert.Empty(t, tg.messages)
+	require.Len(t, tg.edits, 2)
+	assert.Equal(t, telegramEdit{42, 9, "", keyboard}, tg.edits[0])
+	assert.Equal(t, telegramEdit{42, 9, "done", nil}, tg.edits[1])
+	assert.Equal(t, []string{"", "Done!"}, tg.toasts)
+}
+
+func TestConfirmKeyboard(t *testing.T) {
+	keyboard := confirmKeyboard("wallet", "delete:1", "keep:1")
+	require.Len(t, keyboard.InlineKeyboard, 1)
+	assert.Equal(t, "wallet:delete:1", keyboard.InlineKeyboard[0][0].CallbackData)
+	assert.Equal(t, "wallet:keep:1", keyboard.InlineKeyboard[0][1].CallbackData)
+}
@@ -1,19 +1,48 @@
 package service
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync/atomic"
 )
 
+// ErrAlreadyRunning is returned by a job that was skipped because its previous
+// run has not finished.
+var ErrAlreadyRunning = errors.New("already running")
+
 type runGuard struct {
 	running atomic.Bool
 }
 
-func (g *runGuard) run(name string, fn func()) {
+// claimedGuard marks a context whose run already holds the guard.
+type claimedGuard struct{ g *runGuard }
+
+// busy reports whether a run is in progress.
+func (g *runGuard) busy() bool {
+	return g.running.Load()
+}
+
+// tryStart takes the guard now for a run started later under the returned
+// context, which then goes ahead without taking it again. It reports false
+// while a run is in progress; otherwise release gives the guard back once
+// that run is over.
+func (g *runGuard) tryStart(ctx context.Context) (context.Context, func(), bool) {
+	if !g.running.CompareAndSwap(false, true) {
+		return ctx, nil, false
+	}
+	return context.WithValue(ctx, claimedGuard{g}, true), func() { g.running.Store(false) }, true
+}
+
+func (g *runGuard) run(ctx context.Context, name string, fn func() error) error {
+	if ctx.Value(claimedGuard{g}) != nil {
+		return fn() // tryStart took the guard and its caller gives it back
+	}
 	if !g.running.CompareAndSwap(false, true) {
-		log.Printf("[INFO] %s already in progress, skipping", name)
-		return
+		slog.InfoContext(ctx, "already in progress, skipping", "job", name)
+		return fmt.Errorf("%s: %w", name, ErrAlreadyRunning)
 	}
 	defer g.running.Store(false)
-	fn()
+	return fn()
 }
@@ -1,10 +1,12 @@
 package service
 
 import (
+	"context"
 	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRunGuard(t *testing.T) {
@@ -17,22 +19,45 @@ func TestRunGuard(t *testing.T) {
 
 	// First run blocks until released, holding the guard.
 	go func() {
-		g.run("job", func() {
+		_ = g.run(context.Background(), "job", func() error {
 			close(started)
 			<-release
+			return nil
 		})
 		close(done)
 	}()
 
 	<-started
+	assert.True(t, g.busy())
 	// While the first run is in progress, a concurrent run is skipped.
-	g.run("job", func() { secondRan.Store(true) })
+	err := g.run(context.Background(), "job", func() error { secondRan.Store(true); return nil })
+	assert.ErrorIs(t, err, ErrAlreadyRunning)
 	assert.False(t, secondRan.Load(), "concurrent run should be skipped")
 
 	close(release)
 	<-done
+	assert.False(t, g.busy())
 
 	// Once the first run finished, the guard is free again.
-	g.run("job", func() { secondRan.Store(true) })
+	err = g.run(context.Background(), "job", func() error { secondRan.Store(true); return nil })
+	assert.NoError(t, err)
 	assert.True(t, secondRan.Load(), "run after release should execute")
 }
+
+func TestRunGuardTryStart(t *testing.T) {
+	var g runGuard
+
+	ctx, release, ok := g.tryStart(context.Background())
+	require.True(t, ok)
+	_, _, ok = g.tryStart(context.Background())
+	assert.False(t, ok, "the guard is already taken")
+	assert.ErrorIs(t, g.run(context.Background(), "job", func() error { return nil }), ErrAlreadyRunning)
+
+	ran := false
+	require.NoError(t, g.run(ctx, "job", func() error { ran = true; return nil }))
+	assert.True(t, ran, "the run tryStart was taken for goes ahead")
+	assert.True(t, g.busy(), "until it is released")
+
+	release()
+	assert.False(t, g.busy())
+}
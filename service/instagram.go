@@ -1,12 +1,15 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"seanmcapp/external"
 	"seanmcapp/repository"
+	"seanmcapp/util"
 	"strings"
 	"time"
 
@@ -27,21 +30,24 @@ const (
 )
 
 type InstagramService interface {
-	Run()
+	Run(ctx context.Context) (int, error)
 }
 
 type InstagramServiceImpl struct {
 	InstagramAccountRepo repository.InstagramAccountRepo
 	InstagramClient      external.InstagramClient
 	TelegramClient       external.TelegramClient
+	Notifier             external.Notifier // alerts, nil sends straight to PersonalChatID; posts and stories always go to PersonalChatID
+	Outbox               OutboxService     // posts and stories are queued in it, see Deliver; nil sends them straight away
 	PersonalChatID       int64
+	QuietHours           util.QuietHours // the personal chat's, for Instagram; accounts are checked once they are over
 	guard                runGuard
 }
 
 type igMedia struct {
-	IsVideo      bool
-	URL          string
-	ThumbnailURL string
+	IsVideo      bool   `json:"is_video,omitempty"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
 }
 
 type igPost struct {
@@ -56,7 +62,7 @@ type igStory struct {
 	Media   igMedia
 }
 
-var sleepFn = time.Sleep
+var sleepFn = sleepContext
 var hourFn = func() int { return time.Now().Hour() }
 
 func init() {
@@ -90,134 +96,211 @@ func randomDuration(min, max time.Duration) time.Duration {
 	return min + time.Duration(rand.Int63n(int64(max-min)))
 }
 
-func sleepRandom(min, max time.Duration) {
-	sleepFn(randomDuration(min, max))
+// sleepContext waits d, or returns ctx's error as soon as ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func sleepRandom(ctx context.Context, min, max time.Duration) error {
+	return sleepFn(ctx, randomDuration(min, max))
+}
+
+// TryStart takes the job's guard for a run started later under the
+// returned context, or reports false while a run is in progress.
+func (s *InstagramServiceImpl) TryStart(ctx context.Context) (context.Context, func(), bool) {
+	return s.guard.tryStart(ctx)
+}
+
+// accountsDue selects the accounts of hour's bucket and, after missed hourly
+// runs that checked nothing, of the buckets of those hours too, each once.
+func accountsDue(accounts []repository.InstagramAccount, hour, missed int) []repository.InstagramAccount {
+	due := selectAccountsForHour(accounts, hour)
+	seen := make(map[string]bool, len(due))
+	for _, account := range due {
+		seen[account.Username] = true
+	}
+	for back := 1; back <= missed; back++ {
+		for _, account := range selectAccountsForHour(accounts, (hour-back+24)%24) {
+			if !seen[account.Username] {
+				seen[account.Username] = true
+				due = append(due, account)
+			}
+		}
+	}
+	return due
 }
 
-func (s *InstagramServiceImpl) Run() {
-	s.guard.run("instagram run", func() {
-		accounts, err := s.InstagramAccountRepo.GetAll()
+// hoursQuietBefore counts the hourly runs right before now that fell in q's
+// quiet hours and so checked nothing.
+func hoursQuietBefore(q util.QuietHours, now time.Time) int {
+	missed := 0
+	for missed < 23 {
+		if _, quiet := quietUntil(q, now.Add(-time.Duration(missed+1)*time.Hour)); !quiet {
+			break
+		}
+		missed++
+	}
+	return missed
+}
+
+// Run checks the accounts due this hour and returns how many were checked.
+// During quiet hours nothing is checked: posts stay new until a run after
+// them and then arrive whole, media and summary together, rather than the
+// media at night and the summary in the morning digest. The first run after
+// quiet hours also checks the accounts of the hours they skipped.
+func (s *InstagramServiceImpl) Run(ctx context.Context) (int, error) {
+	checked := 0
+	err := s.guard.run(ctx, "instagram run", func() error {
+		if until, quiet := quietUntil(s.QuietHours, nowFn()); quiet {
+			slog.InfoContext(ctx, "quiet hours, checking accounts once they are over", "service", SourceInstagram, "until", until)
+			return nil
+		}
+
+		accounts, err := s.InstagramAccountRepo.GetAll(ctx)
 		if err != nil {
-			log.Println("[ERROR] fetching instagram accounts:", err)
-			return
+			return fmt.Errorf("fetching instagram accounts: %w", err)
 		}
 
-		accounts = selectAccountsForHour(accounts, hourFn())
+		accounts = accountsDue(accounts, hourFn(), hoursQuietBefore(s.QuietHours, nowFn()))
 		if len(accounts) == 0 {
-			log.Println("[INFO] no Instagram accounts selected for this hour")
-			return
+			slog.InfoContext(ctx, "no accounts selected for this hour", "service", SourceInstagram)
+			return nil
 		}
 
 		// Add a small random delay before the whole account loop runs.
-		sleepRandom(30*time.Second, 90*time.Second)
+		if err := sleepRandom(ctx, 30*time.Second, 90*time.Second); err != nil {
+			return err
+		}
 
 		for i, account := range accounts {
 			if i > 0 {
-				sleepRandom(5*time.Second, 12*time.Second)
+				if err := sleepRandom(ctx, 5*time.Second, 12*time.Second); err != nil {
+					return fmt.Errorf("stopped after %d accounts: %w", checked, err)
+				}
 			}
 
-			log.Printf("Checking Instagram account: %s", account.Username)
+			slog.InfoContext(ctx, "checking account", "service", SourceInstagram, "account", account.Username)
 
-			if errors.Is(s.processAccount(account), external.ErrSessionExpired) {
+			if err := s.processAccount(ctx, account); errors.Is(err, external.ErrSessionExpired) {
 				// Every account will fail the same way, so alert once and stop the run.
-				log.Printf("[ERROR] instagram session expired while checking %s", account.Username)
-				if _, sendErr := s.TelegramClient.SendMessage(s.PersonalChatID, "⚠️ Instagram session expired — please update *IG_SESSION_ID*."); sendErr != nil {
-					log.Printf("[ERROR] sending session-expired alert: %v", sendErr)
+				alert := external.Notification{Source: SourceInstagram, Title: "Instagram session expired", Body: sessionExpiredMessage(), Urgent: true}
+				if sendErr := notify(ctx, s.Notifier, s.TelegramClient, s.PersonalChatID, alert); sendErr != nil {
+					slog.ErrorContext(ctx, "sending session-expired alert", "service", SourceInstagram, "error", sendErr)
 				}
-				return
+				return fmt.Errorf("checking %s: %w", account.Username, err)
 			}
+			checked++
 		}
 
-		log.Printf("===== Instagram run/trigger is completed =====")
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "run completed", "service", SourceInstagram, "accounts", checked)
+		return nil
 	})
+	return checked, err
 }
 
 // processAccount resolves the id and processes posts then stories for one account.
 // It returns ErrSessionExpired if any call indicates the session is no longer valid;
 // all other errors are logged internally and swallowed.
-func (s *InstagramServiceImpl) processAccount(account repository.InstagramAccount) error {
-	userID, err := s.resolveUserID(account)
+func (s *InstagramServiceImpl) processAccount(ctx context.Context, account repository.InstagramAccount) error {
+	userID, err := s.resolveUserID(ctx, account)
 	if err != nil {
 		if errors.Is(err, external.ErrSessionExpired) {
 			return err
 		}
-		log.Printf("[ERROR] resolving user id for %s: %v", account.Username, err)
+		slog.ErrorContext(ctx, "resolving user id", "service", SourceInstagram, "account", account.Username, "error", err)
 		return nil
 	}
 
-	if err := s.processPosts(account, userID); errors.Is(err, external.ErrSessionExpired) {
+	if err := s.processPosts(ctx, account, userID); errors.Is(err, external.ErrSessionExpired) {
 		return err
 	}
-	if err := s.processStories(account, userID); errors.Is(err, external.ErrSessionExpired) {
+	if err := s.processStories(ctx, account, userID); errors.Is(err, external.ErrSessionExpired) {
 		return err
 	}
 	return nil
 }
 
 // processPosts fetches, notifies and persists the latest posts for an account.
-func (s *InstagramServiceImpl) processPosts(account repository.InstagramAccount, userID string) error {
-	posts, err := s.fetchLatestPosts(account.Username, userID)
+func (s *InstagramServiceImpl) processPosts(ctx context.Context, account repository.InstagramAccount, userID string) error {
+	posts, err := s.fetchLatestPosts(ctx, account.Username, userID)
 	if err != nil {
 		if errors.Is(err, external.ErrSessionExpired) {
 			return err
 		}
-		log.Printf("[ERROR] fetching posts for %s: %v", account.Username, err)
+		slog.ErrorContext(ctx, "fetching posts", "service", SourceInstagram, "account", account.Username, "error", err)
 		return nil
 	}
 
 	newPosts := detectNewPosts(account.LastShortcodes, posts)
 	if len(newPosts) > 0 {
-		s.notify(account.Username, newPosts)
+		if err := s.notify(ctx, account.Username, newPosts); err != nil {
+			// Left unrecorded, so the next run finds them new again.
+			slog.ErrorContext(ctx, "queueing posts", "service", SourceInstagram, "account", account.Username, "error", err)
+			return nil
+		}
 	} else {
-		log.Printf("No new posts for %s", account.Username)
+		slog.DebugContext(ctx, "no new posts", "service", SourceInstagram, "account", account.Username)
 	}
 
 	shortcodes := make([]string, len(posts))
 	for i, p := range posts {
 		shortcodes[i] = p.Shortcode
 	}
-	if err := s.InstagramAccountRepo.UpdateLastShortcodes(account.Username, strings.Join(shortcodes, ",")); err != nil {
-		log.Printf("[ERROR] updating shortcodes for %s: %v", account.Username, err)
+	if err := s.InstagramAccountRepo.UpdateLastShortcodes(ctx, account.Username, strings.Join(shortcodes, ",")); err != nil {
+		slog.ErrorContext(ctx, "updating shortcodes", "service", SourceInstagram, "account", account.Username, "error", err)
 	}
 	return nil
 }
 
 // processStories fetches, notifies and persists the latest stories for an account.
-func (s *InstagramServiceImpl) processStories(account repository.InstagramAccount, userID string) error {
-	stories, err := s.fetchLatestStories(account.Username, userID)
+func (s *InstagramServiceImpl) processStories(ctx context.Context, account repository.InstagramAccount, userID string) error {
+	stories, err := s.fetchLatestStories(ctx, account.Username, userID)
 	if err != nil {
 		if errors.Is(err, external.ErrSessionExpired) {
 			return err
 		}
-		log.Printf("[ERROR] fetching stories for %s: %v", account.Username, err)
+		slog.ErrorContext(ctx, "fetching stories", "service", SourceInstagram, "account", account.Username, "error", err)
 		return nil
 	}
 
 	newStories := detectNewStories(account.LastStoryIDs, stories)
 	if len(newStories) > 0 {
-		s.notifyStories(account.Username, newStories)
+		if err := s.notifyStories(ctx, account.Username, newStories); err != nil {
+			slog.ErrorContext(ctx, "queueing stories", "service", SourceInstagram, "account", account.Username, "error", err)
+			return nil
+		}
 	} else {
-		log.Printf("No new stories for %s", account.Username)
+		slog.DebugContext(ctx, "no new stories", "service", SourceInstagram, "account", account.Username)
 	}
 
 	ids := make([]string, len(stories))
 	for i, st := range stories {
 		ids[i] = st.ID
 	}
-	if err := s.InstagramAccountRepo.UpdateLastStoryIDs(account.Username, strings.Join(ids, ",")); err != nil {
-		log.Printf("[ERROR] updating story ids for %s: %v", account.Username, err)
+	if err := s.InstagramAccountRepo.UpdateLastStoryIDs(ctx, account.Username, strings.Join(ids, ",")); err != nil {
+		slog.ErrorContext(ctx, "updating story ids", "service", SourceInstagram, "account", account.Username, "error", err)
 	}
 	return nil
 }
 
 // resolveUserID returns the account's numeric id, resolving it from the profile
 // endpoint and persisting it the first time it is seen.
-func (s *InstagramServiceImpl) resolveUserID(account repository.InstagramAccount) (string, error) {
+func (s *InstagramServiceImpl) resolveUserID(ctx context.Context, account repository.InstagramAccount) (string, error) {
 	if account.UserID != "" {
 		return account.UserID, nil
 	}
 
-	profileBody, err := s.InstagramClient.Get(igProfileBase + account.Username)
+	profileBody, err := s.InstagramClient.Get(ctx, igProfileBase+account.Username)
 	if err != nil {
 		return "", err
 	}
@@ -227,15 +310,15 @@ func (s *InstagramServiceImpl) resolveUserID(account repository.InstagramAccount
 		return "", fmt.Errorf("could not resolve user id for %s", account.Username)
 	}
 
-	if err := s.InstagramAccountRepo.UpdateUserID(account.Username, userID); err != nil {
-		log.Printf("[ERROR] updating user_id for %s: %v", account.Username, err)
+	if err := s.InstagramAccountRepo.UpdateUserID(ctx, account.Username, userID); err != nil {
+		slog.ErrorContext(ctx, "updating user id", "service", SourceInstagram, "account", account.Username, "error", err)
 	}
 	return userID, nil
 }
 
-func (s *InstagramServiceImpl) fetchLatestPosts(username, userID string) ([]igPost, error) {
+func (s *InstagramServiceImpl) fetchLatestPosts(ctx context.Context, username, userID string) ([]igPost, error) {
 	feedURL := fmt.Sprintf("%s%s/?count=%d", igFeedBase, userID, igMaxPosts)
-	feedBody, err := s.InstagramClient.Get(feedURL)
+	feedBody, err := s.InstagramClient.Get(ctx, feedURL)
 	if err != nil {
 		return nil, err
 	}
@@ -306,8 +389,8 @@ func singleMedia(node gjson.Result) (igMedia, bool) {
 
 // fetchLatestStories returns the account's currently active story items. An
 // account with no active story yields an empty slice (not an error).
-func (s *InstagramServiceImpl) fetchLatestStories(username, userID string) ([]igStory, error) {
-	body, err := s.InstagramClient.Get(igStoriesBase + userID)
+func (s *InstagramServiceImpl) fetchLatestStories(ctx context.Context, username, userID string) ([]igStory, error) {
+	body, err := s.InstagramClient.Get(ctx, igStoriesBase+userID)
 	if err != nil {
 		return nil, err
 	}
@@ -377,100 +460,261 @@ func detectNewPosts(storedRaw string, current []igPost) []igPost {
 	return newPosts
 }
 
-func (s *InstagramServiceImpl) notify(username string, newPosts []igPost) {
+// OutboxKindInstagram is the outbox kind of an igDelivery, queued as JSON.
+const OutboxKindInstagram = "instagram"
+
+// igDelivery is one piece of a post or story as it goes out to Telegram: an
+// album of several media, one photo or video, or without media, the summary.
+// A post or story is queued as its deliveries, in order.
+type igDelivery struct {
+	Account string    `json:"account"`
+	ID      string    `json:"id"`              // post shortcode or story id
+	Link    string    `json:"link"`            // what a video too big to send links to
+	Index   int       `json:"index,omitempty"` // of Media[0] in the post, for upload names
+	Media   []igMedia `json:"media,omitempty"`
+	Caption string    `json:"caption,omitempty"`
+}
+
+// postDeliveries sends a carousel as albums of up to MaxMediaGroupSize, the
+// first captioned with the summary, and a single photo or video followed by
+// the summary. An item left over on its own goes out alone.
+func postDeliveries(username string, p igPost) []igDelivery {
+	link := fmt.Sprintf("%s%s/", igPostBase, p.Shortcode)
+	summary := igSummary("📸 New post from ", username, link, p.Caption).String()
+	base := igDelivery{Account: username, ID: p.Shortcode, Link: link}
+
+	var deliveries []igDelivery
+	for start := 0; start < len(p.Media); {
+		end := min(start+external.MaxMediaGroupSize, len(p.Media))
+		d := base
+		d.Index, d.Media = start, p.Media[start:end]
+		if start == 0 && end-start > 1 {
+			d.Caption = summary
+		}
+		deliveries = append(deliveries, d)
+		start = end
+	}
+	if len(p.Media) == 1 {
+		d := base
+		d.Caption = summary
+		deliveries = append(deliveries, d)
+	}
+	return deliveries
+}
+
+// storyDeliveries sends a story's photo or video followed by its summary.
+func storyDeliveries(username string, st igStory) []igDelivery {
+	link := fmt.Sprintf("%s%s/%s/", igStoryBase, username, st.ID)
+	media := igDelivery{Account: username, ID: st.ID, Link: link, Media: []igMedia{st.Media}}
+	summary := igDelivery{Account: username, ID: st.ID, Link: link, Caption: igSummary("👀 New story from ", username, link, st.Caption).String()}
+	return []igDelivery{media, summary}
+}
+
+func (s *InstagramServiceImpl) notify(ctx context.Context, username string, newPosts []igPost) error {
+	var deliveries []igDelivery
 	for _, p := range newPosts {
-		postLink := fmt.Sprintf("%s%s/", igPostBase, p.Shortcode)
+		deliveries = append(deliveries, postDeliveries(username, p)...)
+	}
+	return s.send(ctx, deliveries)
+}
+
+func (s *InstagramServiceImpl) notifyStories(ctx context.Context, username string, newStories []igStory) error {
+	var deliveries []igDelivery
+	for _, st := range newStories {
+		deliveries = append(deliveries, storyDeliveries(username, st)...)
+	}
+	return s.send(ctx, deliveries)
+}
+
+// send queues deliveries for the personal chat in the outbox, so they survive
+// a restart or a Telegram outage and are retried, and only fails when they
+// could not be queued. Without an outbox they are sent straight away, and
+// what fails is logged.
+func (s *InstagramServiceImpl) send(ctx context.Context, deliveries []igDelivery) error {
+	if s.Outbox != nil {
+		payloads := make([]string, len(deliveries))
+		for i, d := range deliveries {
+			payload, err := json.Marshal(d)
+			if err != nil {
+				return err
+			}
+			payloads[i] = string(payload)
+		}
+		return s.Outbox.EnqueueKind(ctx, s.PersonalChatID, OutboxKindInstagram, payloads...)
+	}
 
-		for i, m := range p.Media {
-			s.sendMedia(username, p.Shortcode, postLink, i, m)
-			sleepRandom(1100*time.Millisecond, 2600*time.Millisecond)
+	for i, d := range deliveries {
+		if i > 0 && sleepRandom(ctx, 1100*time.Millisecond, 2700*time.Millisecond) != nil {
+			return nil
+		}
+		if err := s.deliver(ctx, s.PersonalChatID, d); err != nil {
+			slog.ErrorContext(ctx, "sending to telegram", "service", SourceInstagram, "account", d.Account, "id", d.ID, "error", err)
 		}
+	}
+	return nil
+}
 
-		summary := fmt.Sprintf("📸 New post from *%s*\n🔗 [%s](%s)", escapeMarkdown(username), escapeMarkdown(postLink), postLink)
-		if caption := strings.TrimSpace(p.Caption); caption != "" {
-			summary += "\n\n" + escapeMarkdown(caption)
+// Deliver is the outbox handler of OutboxKindInstagram.
+func (s *InstagramServiceImpl) Deliver(ctx context.Context, chatID int64, payload string) error {
+	var d igDelivery
+	if err := json.Unmarshal([]byte(payload), &d); err != nil {
+		return fmt.Errorf("reading instagram delivery: %w", err)
+	}
+	return s.deliver(ctx, chatID, d)
+}
+
+// deliver sends d to chatID, falling back as far as it can, and fails only
+// when nothing of it was delivered, so a retry cannot repeat part of it. An
+// album that cannot be sent as one goes out one item at a time, followed by
+// its caption.
+func (s *InstagramServiceImpl) deliver(ctx context.Context, chatID int64, d igDelivery) error {
+	switch len(d.Media) {
+	case 0:
+		_, err := s.TelegramClient.SendMessage(ctx, chatID, d.Caption)
+		return err
+	case 1:
+		return s.sendMedia(ctx, chatID, d, d.Index, d.Media[0])
+	}
+
+	albumErr := s.sendAlbum(ctx, chatID, d)
+	if albumErr == nil {
+		return nil
+	}
+	delivered := false
+	for i, m := range d.Media {
+		if s.sendMedia(ctx, chatID, d, d.Index+i, m) == nil {
+			delivered = true
 		}
-		if _, err := s.TelegramClient.SendMessage(s.PersonalChatID, summary); err != nil {
-			log.Printf("[ERROR] sending summary for %s/%s: %v", username, p.Shortcode, err)
+	}
+	if d.Caption != "" {
+		if _, err := s.TelegramClient.SendMessage(ctx, chatID, d.Caption); err != nil {
+			slog.ErrorContext(ctx, "sending post summary", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
+		} else {
+			delivered = true
 		}
-		sleepRandom(1100*time.Millisecond, 2700*time.Millisecond)
 	}
+	if !delivered {
+		return albumErr
+	}
+	return nil
 }
 
-func (s *InstagramServiceImpl) notifyStories(username string, newStories []igStory) {
-	for _, st := range newStories {
-		storyLink := fmt.Sprintf("%s%s/%s/", igStoryBase, username, st.ID)
+// sendAlbum tries a URL-based media group first and, when it holds videos,
+// retries with the videos uploaded, mirroring sendVideo.
+func (s *InstagramServiceImpl) sendAlbum(ctx context.Context, chatID int64, d igDelivery) error {
+	items := make([]external.InputMedia, len(d.Media))
+	hasVideo := false
+	for i, m := range d.Media {
+		items[i] = external.InputMedia{Type: external.InputMediaPhoto, Media: m.URL}
+		if m.IsVideo {
+			items[i].Type = external.InputMediaVideo
+			hasVideo = true
+		}
+	}
+	items[0].Caption = d.Caption
 
-		s.sendMedia(username, st.ID, storyLink, 0, st.Media)
-		sleepRandom(1300*time.Millisecond, 3000*time.Millisecond)
+	resp, err := s.TelegramClient.SendMediaGroup(ctx, chatID, items)
+	if err = sendError(resp, err); err == nil {
+		return nil
+	}
+	if !hasVideo {
+		slog.ErrorContext(ctx, "sending album", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
+		return err
+	}
 
-		summary := fmt.Sprintf("👀 New story from *%s*\n🔗 [%s](%s)", escapeMarkdown(username), escapeMarkdown(storyLink), storyLink)
-		if caption := strings.TrimSpace(st.Caption); caption != "" {
-			summary += "\n\n" + escapeMarkdown(caption)
+	for i, m := range d.Media {
+		if !m.IsVideo {
+			continue
 		}
-		if _, err := s.TelegramClient.SendMessage(s.PersonalChatID, summary); err != nil {
-			log.Printf("[ERROR] sending story summary for %s/%s: %v", username, st.ID, err)
+		data, err := s.InstagramClient.Get(ctx, m.URL)
+		if err == nil && len(data) > igMaxUploadBytes {
+			err = fmt.Errorf("video is %d bytes, over the upload limit", len(data))
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "downloading album video", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
+			return err
 		}
-		sleepRandom(1300*time.Millisecond, 3000*time.Millisecond)
+		items[i].Data = data
+		items[i].Filename = fmt.Sprintf("%s_%d.mp4", d.ID, d.Index+i)
 	}
+
+	resp, err = s.TelegramClient.SendMediaGroupUpload(ctx, chatID, items)
+	if err = sendError(resp, err); err != nil {
+		slog.ErrorContext(ctx, "uploading album", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
+	}
+	return err
 }
 
-func (s *InstagramServiceImpl) sendMedia(username, shortcode, postLink string, index int, m igMedia) {
+func (s *InstagramServiceImpl) sendMedia(ctx context.Context, chatID int64, d igDelivery, index int, m igMedia) error {
 	if !m.IsVideo {
-		if _, err := s.TelegramClient.SendPhoto(s.PersonalChatID, m.URL, ""); err != nil {
-			log.Printf("[ERROR] sending photo for %s/%s: %v", username, shortcode, err)
+		_, err := s.TelegramClient.SendPhoto(ctx, chatID, m.URL, "")
+		if err != nil {
+			slog.ErrorContext(ctx, "sending photo", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
 		}
-		return
+		return err
 	}
-	s.sendVideo(username, shortcode, postLink, index, m)
+	return s.sendVideo(ctx, chatID, d, index, m)
 }
 
 // sendVideo tries the cheap URL-based send first, then falls back to downloading
 // and multipart-uploading (up to 50MB), and finally to a thumbnail + link note.
-func (s *InstagramServiceImpl) sendVideo(username, shortcode, postLink string, index int, m igMedia) {
-	if resp, err := s.TelegramClient.SendVideo(s.PersonalChatID, m.URL, ""); err == nil && resp.Ok {
-		return
+func (s *InstagramServiceImpl) sendVideo(ctx context.Context, chatID int64, d igDelivery, index int, m igMedia) error {
+	if resp, err := s.TelegramClient.SendVideo(ctx, chatID, m.URL, ""); sendError(resp, err) == nil {
+		return nil
 	}
 
-	data, err := s.InstagramClient.Get(m.URL)
+	data, err := s.InstagramClient.Get(ctx, m.URL)
 	if err != nil {
-		log.Printf("[ERROR] downloading video for %s/%s: %v", username, shortcode, err)
-		s.sendVideoFallback(username, shortcode, postLink, m)
-		return
+		slog.ErrorContext(ctx, "downloading video", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
+		return s.sendVideoFallback(ctx, chatID, d, m)
 	}
 	if len(data) > igMaxUploadBytes {
-		s.sendVideoFallback(username, shortcode, postLink, m)
-		return
+		return s.sendVideoFallback(ctx, chatID, d, m)
 	}
 
-	filename := fmt.Sprintf("%s_%d.mp4", shortcode, index)
-	if resp, err := s.TelegramClient.SendVideoUpload(s.PersonalChatID, data, filename, ""); err != nil || !resp.Ok {
-		log.Printf("[ERROR] uploading video for %s/%s (ok=%t): %v", username, shortcode, resp.Ok, err)
-		s.sendVideoFallback(username, shortcode, postLink, m)
+	filename := fmt.Sprintf("%s_%d.mp4", d.ID, index)
+	resp, err := s.TelegramClient.SendVideoUpload(ctx, chatID, data, filename, "")
+	if err = sendError(resp, err); err != nil {
+		slog.ErrorContext(ctx, "uploading video", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
+		return s.sendVideoFallback(ctx, chatID, d, m)
 	}
+	return nil
 }
 
-func (s *InstagramServiceImpl) sendVideoFallback(username, shortcode, postLink string, m igMedia) {
-	note := fmt.Sprintf("🎬 This one's a video — too big to preview here. Watch it on Instagram 👉 %s", postLink)
+func (s *InstagramServiceImpl) sendVideoFallback(ctx context.Context, chatID int64, d igDelivery, m igMedia) error {
+	note := external.NewMessage().Text("🎬 This one's a video — too big to preview here. Watch it on Instagram 👉 " + d.Link).String()
 	if m.ThumbnailURL == "" {
-		if _, err := s.TelegramClient.SendMessage(s.PersonalChatID, note); err != nil {
-			log.Printf("[ERROR] sending video fallback note for %s/%s: %v", username, shortcode, err)
+		_, err := s.TelegramClient.SendMessage(ctx, chatID, note)
+		if err != nil {
+			slog.ErrorContext(ctx, "sending video fallback note", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
 		}
-		return
+		return err
+	}
+	_, err := s.TelegramClient.SendPhoto(ctx, chatID, m.ThumbnailURL, note)
+	if err != nil {
+		slog.ErrorContext(ctx, "sending video fallback", "service", SourceInstagram, "account", d.Account, "shortcode", d.ID, "error", err)
 	}
-	if _, err := s.TelegramClient.SendPhoto(s.PersonalChatID, m.ThumbnailURL, note); err != nil {
-		log.Printf("[ERROR] sending video fallback for %s/%s: %v", username, shortcode, err)
+	return err
+}
+
+// sendError is err, or an error for a response Telegram did not accept.
+func sendError(resp external.TelegramResponse, err error) error {
+	if err == nil && !resp.Ok {
+		return errors.New("telegram did not accept the message")
+	}
+	return err
+}
+
+// igSummary is the message following a post or story's media: who posted it,
+// a link back to Instagram and the caption, if any.
+func igSummary(heading, username, link, caption string) *external.Message {
+	msg := external.NewMessage().Text(heading).Bold(username).Text("\n🔗 ").Link(link, link)
+	if caption = strings.TrimSpace(caption); caption != "" {
+		msg.Text("\n\n" + caption)
 	}
+	return msg
 }
 
-// escapeMarkdown neutralises the legacy Telegram markdown control characters so
-// an arbitrary Instagram caption cannot break the summary message formatting.
-func escapeMarkdown(s string) string {
-	replacer := strings.NewReplacer(
-		"_", "\\_",
-		"*", "\\*",
-		"`", "\\`",
-		"[", "\\[",
-	)
-	return replacer.Replace(s)
+func sessionExpiredMessage() *external.Message {
+	return external.NewMessage().Text("⚠️ Instagram session expired — please update ").Bold("IG_SESSION_ID").Text(".")
 }
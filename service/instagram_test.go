@@ -1,11 +1,13 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"seanmcapp/external"
 	"seanmcapp/repository"
+	"seanmcapp/util"
 	"strings"
 	"testing"
 	"time"
@@ -15,7 +17,10 @@ import (
 )
 
 func TestMain(m *testing.M) {
-	sleepFn = func(time.Duration) {}
+	sleepFn = func(ctx context.Context, _ time.Duration) error { return ctx.Err() }
+	// Hour 23 selects bucket 0 for any small account list, so fixtures that
+	// leave ID unset are always checked regardless of when the tests run.
+	hourFn = func() int { return 23 }
 	os.Exit(m.Run())
 }
 
@@ -57,7 +62,7 @@ func TestResolveUserID(t *testing.T) {
 		repo := &fakeInstagramRepo{}
 		svc := &InstagramServiceImpl{InstagramClient: client, InstagramAccountRepo: repo}
 
-		id, err := svc.resolveUserID(repository.InstagramAccount{Username: "foo"})
+		id, err := svc.resolveUserID(t.Context(), repository.InstagramAccount{Username: "foo"})
 		require.NoError(t, err)
 		assert.Equal(t, "123", id)
 		assert.Equal(t, "123", repo.updatedUserIDs["foo"])
@@ -72,7 +77,7 @@ func TestResolveUserID(t *testing.T) {
 		}}
 		svc := &InstagramServiceImpl{InstagramClient: client, InstagramAccountRepo: repo}
 
-		id, err := svc.resolveUserID(repository.InstagramAccount{Username: "foo"})
+		id, err := svc.resolveUserID(t.Context(), repository.InstagramAccount{Username: "foo"})
 		require.NoError(t, err)
 		assert.Equal(t, "123", id)
 	})
@@ -86,7 +91,7 @@ func TestResolveUserID(t *testing.T) {
 		repo := &fakeInstagramRepo{}
 		svc := &InstagramServiceImpl{InstagramClient: client, InstagramAccountRepo: repo}
 
-		id, err := svc.resolveUserID(repository.InstagramAccount{Username: "foo", UserID: "999"})
+		id, err := svc.resolveUserID(t.Context(), repository.InstagramAccount{Username: "foo", UserID: "999"})
 		require.NoError(t, err)
 		assert.Equal(t, "999", id)
 		assert.Empty(t, called)
@@ -97,7 +102,7 @@ func TestResolveUserID(t *testing.T) {
 		svc := &InstagramServiceImpl{InstagramClient: &fakeInstagramClient{
 			getFn: func(string) ([]byte, error) { return nil, errors.New("net") },
 		}}
-		_, err := svc.resolveUserID(repository.InstagramAccount{Username: "foo"})
+		_, err := svc.resolveUserID(t.Context(), repository.InstagramAccount{Username: "foo"})
 		assert.Error(t, err)
 	})
 
@@ -105,7 +110,7 @@ func TestResolveUserID(t *testing.T) {
 		svc := &InstagramServiceImpl{InstagramClient: &fakeInstagramClient{
 			getFn: func(string) ([]byte, error) { return []byte(`{"data":{"user":{}}}`), nil },
 		}}
-		_, err := svc.resolveUserID(repository.InstagramAccount{Username: "foo"})
+		_, err := svc.resolveUserID(t.Context(), repository.InstagramAccount{Username: "foo"})
 		assert.Error(t, err)
 	})
 }
@@ -116,7 +121,7 @@ func TestFetchLatestPosts(t *testing.T) {
 	}}
 	svc := &InstagramServiceImpl{InstagramClient: client, InstagramAccountRepo: &fakeInstagramRepo{}}
 
-	posts, err := svc.fetchLatestPosts("foo", "123")
+	posts, err := svc.fetchLatestPosts(t.Context(), "foo", "123")
 	require.NoError(t, err)
 	require.Len(t, posts, 2)
 	assert.Equal(t, "AAA", posts[0].Shortcode)
@@ -130,7 +135,7 @@ func TestFetchLatestPostsErrors(t *testing.T) {
 		svc := &InstagramServiceImpl{InstagramClient: &fakeInstagramClient{
 			getFn: func(string) ([]byte, error) { return nil, errors.New("net") },
 		}}
-		_, err := svc.fetchLatestPosts("foo", "123")
+		_, err := svc.fetchLatestPosts(t.Context(), "foo", "123")
 		assert.Error(t, err)
 	})
 
@@ -138,7 +143,7 @@ func TestFetchLatestPostsErrors(t *testing.T) {
 		svc := &InstagramServiceImpl{InstagramClient: &fakeInstagramClient{
 			getFn: func(string) ([]byte, error) { return []byte(`{}`), nil },
 		}}
-		_, err := svc.fetchLatestPosts("foo", "123")
+		_, err := svc.fetchLatestPosts(t.Context(), "foo", "123")
 		assert.Error(t, err)
 	})
 }
@@ -179,7 +184,7 @@ func TestProcessAccountSwallowsNonSessionErrors(t *testing.T) {
 	tg := &fakeTelegramClient{}
 	svc := &InstagramServiceImpl{InstagramAccountRepo: repo, InstagramClient: client, TelegramClient: tg}
 
-	err := svc.processAccount(repository.InstagramAccount{Username: "foo", UserID: "123"})
+	err := svc.processAccount(t.Context(), repository.InstagramAccount{Username: "foo", UserID: "123"})
 	require.NoError(t, err)
 	assert.Equal(t, "111,222", repo.updatedStoryIDs["foo"])
 }
@@ -194,7 +199,7 @@ func TestProcessAccountExpiresWhenStoriesSessionExpired(t *testing.T) {
 	repo := &fakeInstagramRepo{}
 	svc := &InstagramServiceImpl{InstagramAccountRepo: repo, InstagramClient: client}
 
-	err := svc.processAccount(repository.InstagramAccount{Username: "foo", UserID: "123"})
+	err := svc.processAccount(t.Context(), repository.InstagramAccount{Username: "foo", UserID: "123"})
 	require.Error(t, err)
 	assert.True(t, errors.Is(err, external.ErrSessionExpired))
 }
@@ -204,7 +209,7 @@ func TestNotifySendsPhotoSummary(t *testing.T) {
 	svc := &InstagramServiceImpl{TelegramClient: tg, PersonalChatID: 7}
 	post := igPost{Shortcode: "IMG", Caption: "hello", Media: []igMedia{{IsVideo: false, URL: "http://img/x"}}}
 
-	svc.notify("foo", []igPost{post})
+	svc.notify(t.Context(), "foo", []igPost{post})
 
 	require.Len(t, tg.photos, 1)
 	require.Len(t, tg.messages, 1)
@@ -212,11 +217,134 @@ func TestNotifySendsPhotoSummary(t *testing.T) {
 	assert.Contains(t, tg.messages[0].text, "IMG")
 }
 
+func carouselPost(n int) igPost {
+	post := igPost{Shortcode: "CAR", Caption: "hello"}
+	for i := 0; i < n; i++ {
+		post.Media = append(post.Media, igMedia{URL: fmt.Sprintf("http://img/%d", i)})
+	}
+	return post
+}
+
+func TestNotifySendsCarouselAsAlbum(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	svc := &InstagramServiceImpl{TelegramClient: tg, PersonalChatID: 7}
+	post := carouselPost(3)
+	post.Media[1] = igMedia{IsVideo: true, URL: "http://vid/1"}
+
+	svc.notify(t.Context(), "foo", []igPost{post})
+
+	require.Len(t, tg.groups, 1)
+	group := tg.groups[0].media
+	require.Len(t, group, 3)
+	assert.Equal(t, external.InputMediaVideo, group[1].Type)
+	assert.Contains(t, group[0].Caption, "*foo*", "summary rides on the first item")
+	assert.Empty(t, group[1].Caption)
+	assert.Empty(t, tg.photos)
+	assert.Empty(t, tg.messages, "no separate summary once the album carries it")
+}
+
+func TestNotifySplitsLargeCarousels(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	svc := &InstagramServiceImpl{TelegramClient: tg, PersonalChatID: 7}
+
+	svc.notify(t.Context(), "foo", []igPost{carouselPost(external.MaxMediaGroupSize + 1)})
+
+	require.Len(t, tg.groups, 1)
+	assert.Len(t, tg.groups[0].media, external.MaxMediaGroupSize)
+	require.Len(t, tg.photos, 1, "a single leftover item cannot form an album")
+	assert.Equal(t, "http://img/10", tg.photos[0].url)
+	assert.Empty(t, tg.messages)
+}
+
+func TestNotifyCarouselUploadsVideosWhenURLGroupFails(t *testing.T) {
+	tg := &fakeTelegramClient{groupURLFails: true}
+	client := &fakeInstagramClient{getFn: func(string) ([]byte, error) { return []byte("video-bytes"), nil }}
+	svc := &InstagramServiceImpl{TelegramClient: tg, InstagramClient: client, PersonalChatID: 7}
+	post := carouselPost(2)
+	post.Media[1] = igMedia{IsVideo: true, URL: "http://vid/1"}
+
+	svc.notify(t.Context(), "foo", []igPost{post})
+
+	require.Len(t, tg.groups, 2)
+	upload := tg.groups[1]
+	assert.True(t, upload.upload)
+	assert.Nil(t, upload.media[0].Data, "photos are still sent by URL")
+	assert.Equal(t, []byte("video-bytes"), upload.media[1].Data)
+	assert.Equal(t, "CAR_1.mp4", upload.media[1].Filename)
+	assert.Empty(t, tg.messages)
+}
+
+func TestNotifyCarouselFallsBackToPerItem(t *testing.T) {
+	tg := &fakeTelegramClient{groupFails: true}
+	svc := &InstagramServiceImpl{TelegramClient: tg, PersonalChatID: 7}
+
+	svc.notify(t.Context(), "foo", []igPost{carouselPost(3)})
+
+	require.Len(t, tg.groups, 1, "photo-only albums are not retried as uploads")
+	assert.Len(t, tg.photos, 3)
+	require.Len(t, tg.messages, 1)
+	assert.Contains(t, tg.messages[0].text, "CAR")
+}
+
+func TestNotifyQueuesThroughOutbox(t *testing.T) {
+	repo := &fakeOutboxRepo{}
+	tg := &fakeTelegramClient{}
+	svc := &InstagramServiceImpl{TelegramClient: tg, Outbox: &OutboxServiceImpl{OutboxRepo: repo}, PersonalChatID: 7}
+	post := igPost{Shortcode: "IMG", Caption: "hello", Media: []igMedia{{URL: "http://img/x"}}}
+
+	require.NoError(t, svc.notify(t.Context(), "foo", []igPost{post}))
+
+	assert.Empty(t, tg.photos, "nothing is sent until the outbox drains")
+	require.Len(t, repo.enqueued, 2, "the photo, then its summary")
+	for _, m := range repo.enqueued {
+		assert.Equal(t, int64(7), m.ChatID)
+		assert.Equal(t, OutboxKindInstagram, m.Kind)
+	}
+
+	for _, m := range repo.enqueued {
+		require.NoError(t, svc.Deliver(t.Context(), m.ChatID, m.Text))
+	}
+	require.Len(t, tg.photos, 1)
+	assert.Equal(t, "http://img/x", tg.photos[0].url)
+	require.Len(t, tg.messages, 1)
+	assert.Contains(t, tg.messages[0].text, "IMG")
+}
+
+func TestNotifyStoriesQueuesThroughOutbox(t *testing.T) {
+	repo := &fakeOutboxRepo{}
+	svc := &InstagramServiceImpl{Outbox: &OutboxServiceImpl{OutboxRepo: repo}, PersonalChatID: 7}
+
+	require.NoError(t, svc.notifyStories(t.Context(), "foo", []igStory{{ID: "111", Media: igMedia{URL: "http://img/s"}}}))
+	assert.Len(t, repo.enqueued, 2)
+}
+
+func TestProcessPostsKeepsShortcodesWhenQueueingFails(t *testing.T) {
+	client := &fakeInstagramClient{getFn: func(string) ([]byte, error) { return []byte(igFeedJSON), nil }}
+	repo := &fakeInstagramRepo{}
+	svc := &InstagramServiceImpl{InstagramAccountRepo: repo, InstagramClient: client, Outbox: &OutboxServiceImpl{OutboxRepo: &fakeOutboxRepo{err: errors.New("db down")}}}
+
+	require.NoError(t, svc.processPosts(t.Context(), repository.InstagramAccount{Username: "foo", LastShortcodes: "BBB"}, "123"))
+	assert.NotContains(t, repo.updatedShortcodes, "foo", "the new post is found again next run")
+}
+
+func TestDeliverFailsOnlyWhenNothingWasSent(t *testing.T) {
+	svc := &InstagramServiceImpl{TelegramClient: &fakeTelegramClient{err: errors.New("boom")}}
+	payload := `{"account":"foo","id":"CAR","media":[{"url":"http://img/0"},{"url":"http://img/1"}],"caption":"hi"}`
+	assert.Error(t, svc.Deliver(t.Context(), 7, payload))
+
+	tg := &fakeTelegramClient{groupFails: true}
+	svc = &InstagramServiceImpl{TelegramClient: tg}
+	require.NoError(t, svc.Deliver(t.Context(), 7, payload), "sent item by item instead")
+	assert.Len(t, tg.photos, 2)
+
+	assert.Error(t, svc.Deliver(t.Context(), 7, "not json"))
+}
+
 func TestSendVideoFallbackThumbnailErrorLogsMessage(t *testing.T) {
 	tg := &fakeTelegramClient{err: errors.New("boom")}
 	svc := &InstagramServiceImpl{TelegramClient: tg, PersonalChatID: 7}
 
-	svc.sendVideoFallback("foo", "VID", "http://link/VID/", igMedia{IsVideo: true, URL: "http://vid/v", ThumbnailURL: "http://img/t"})
+	svc.sendVideoFallback(t.Context(), 7, igDelivery{Account: "foo", ID: "VID", Link: "http://link/VID/"}, igMedia{IsVideo: true, URL: "http://vid/v", ThumbnailURL: "http://img/t"})
 
 	require.Len(t, tg.photos, 1)
 	assert.Equal(t, "http://img/t", tg.photos[0].url)
@@ -236,12 +364,91 @@ func TestInstagramRun(t *testing.T) {
 	tg := &fakeTelegramClient{}
 	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: tg}
 
-	svc.Run()
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
 
 	assert.Empty(t, tg.photos)
 	assert.Equal(t, "AAA,BBB", accountRepo.updatedShortcodes["foo"])
 }
 
+func TestInstagramRunCancelled(t *testing.T) {
+	accountRepo := &fakeInstagramRepo{getAllFn: func() ([]repository.InstagramAccount, error) {
+		return []repository.InstagramAccount{{Username: "foo"}, {Username: "bar"}}, nil
+	}}
+	client := &fakeInstagramClient{getFn: func(string) ([]byte, error) { return []byte(igFeedJSON), nil }}
+	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: &fakeTelegramClient{}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	checked, err := svc.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, checked)
+	assert.Empty(t, accountRepo.updatedShortcodes)
+}
+
+func TestInstagramRunWaitsOutQuietHours(t *testing.T) {
+	defer func() { nowFn = time.Now }()
+	nowFn = func() time.Time { return time.Date(2026, time.March, 10, 23, 0, 0, 0, jakarta) }
+
+	accountRepo := &fakeInstagramRepo{getAllFn: func() ([]repository.InstagramAccount, error) {
+		t.Error("no account is checked during quiet hours")
+		return nil, nil
+	}}
+	tg := &fakeTelegramClient{}
+	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, TelegramClient: tg, QuietHours: util.QuietHours{Start: 22 * 60, End: 7 * 60}}
+
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Zero(t, checked)
+	assert.Empty(t, tg.photos)
+	assert.Empty(t, tg.messages)
+}
+
+func TestInstagramRunCatchesUpAfterQuietHours(t *testing.T) {
+	defer func() { nowFn = time.Now }()
+	nowFn = func() time.Time { return time.Date(2026, time.March, 10, 7, 0, 0, 0, jakarta) }
+
+	accounts := make([]repository.InstagramAccount, 48)
+	for i := range accounts {
+		accounts[i] = repository.InstagramAccount{ID: i, Username: fmt.Sprintf("acct-%d", i), UserID: "123", LastShortcodes: "AAA,BBB"}
+	}
+	accountRepo := &fakeInstagramRepo{getAllFn: func() ([]repository.InstagramAccount, error) { return accounts, nil }}
+	client := &fakeInstagramClient{getFn: func(string) ([]byte, error) { return []byte(igFeedJSON), nil }}
+	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: &fakeTelegramClient{},
+		QuietHours: util.QuietHours{Start: 22 * 60, End: 7 * 60}}
+
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 20, checked, "this hour's bucket and the nine skipped from 22:00 to 06:00, two accounts each")
+}
+
+func TestHoursQuietBefore(t *testing.T) {
+	night := util.QuietHours{Start: 22 * 60, End: 7 * 60}
+	at := func(hour int) time.Time { return time.Date(2026, time.March, 10, hour, 0, 0, 0, jakarta) }
+
+	assert.Equal(t, 9, hoursQuietBefore(night, at(7)))
+	assert.Zero(t, hoursQuietBefore(night, at(12)))
+	assert.Zero(t, hoursQuietBefore(util.QuietHours{}, at(7)))
+}
+
+func TestAccountsDueChecksEachAccountOnce(t *testing.T) {
+	accounts := []repository.InstagramAccount{{ID: 0, Username: "a"}, {ID: 1, Username: "b"}, {ID: 2, Username: "c"}}
+
+	assert.Len(t, accountsDue(accounts, 0, 0), 1)
+	assert.Len(t, accountsDue(accounts, 0, 9), 3, "buckets repeat with fewer than 24 accounts")
+}
+
+func TestSleepContext(t *testing.T) {
+	require.NoError(t, sleepContext(t.Context(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	start := time.Now()
+	assert.ErrorIs(t, sleepContext(ctx, time.Hour), context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
 func TestInstagramRunSendsNewPosts(t *testing.T) {
 	accountRepo := &fakeInstagramRepo{getAllFn: func() ([]repository.InstagramAccount, error) {
 		return []repository.InstagramAccount{{Username: "foo", LastShortcodes: "AAA"}}, nil
@@ -254,18 +461,24 @@ func TestInstagramRunSendsNewPosts(t *testing.T) {
 		return []byte(igFeedJSON), nil
 	}}
 	tg := &fakeTelegramClient{}
-	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: tg, PersonalChatID: 42}
+	notifier := &fakeNotifier{}
+	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: tg, Notifier: notifier, PersonalChatID: 42}
 
-	svc.Run()
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
 
 	require.Len(t, tg.photos, 1)
 	assert.Equal(t, int64(42), tg.photos[0].chatID)
 	assert.Equal(t, "http://img/b", tg.photos[0].url)
 	assert.Empty(t, tg.photos[0].caption) // media carries no caption anymore
-	// the header + link now arrive as a separate summary message
+	// the header + link now arrive as a separate summary message, straight
+	// after the media rather than through the notifier
 	require.Len(t, tg.messages, 1)
+	assert.Equal(t, int64(42), tg.messages[0].chatID)
 	assert.Contains(t, tg.messages[0].text, "foo")
 	assert.Contains(t, tg.messages[0].text, "BBB")
+	assert.Empty(t, notifier.notes)
 	assert.Equal(t, "AAA,BBB", accountRepo.updatedShortcodes["foo"])
 }
 
@@ -283,12 +496,14 @@ func TestInstagramRunAlertsOnceOnExpiredSession(t *testing.T) {
 	tg := &fakeTelegramClient{}
 	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: tg, PersonalChatID: 42}
 
-	svc.Run()
+	checked, err := svc.Run(t.Context())
+	assert.ErrorIs(t, err, external.ErrSessionExpired)
+	assert.Equal(t, 0, checked)
 
 	// Exactly one alert, and the run stops before touching the second account.
 	require.Len(t, tg.messages, 1)
 	assert.Equal(t, int64(42), tg.messages[0].chatID)
-	assert.Contains(t, tg.messages[0].text, "IG_SESSION_ID")
+	assert.Contains(t, tg.messages[0].text, "*IG\\_SESSION\\_ID*")
 	assert.Empty(t, tg.photos)
 	assert.Empty(t, accountRepo.updatedShortcodes)
 }
@@ -307,7 +522,7 @@ func TestParseVideoAndCarousel(t *testing.T) {
 	}}
 	svc := &InstagramServiceImpl{InstagramClient: client, InstagramAccountRepo: &fakeInstagramRepo{}}
 
-	posts, err := svc.fetchLatestPosts("foo", "123")
+	posts, err := svc.fetchLatestPosts(t.Context(), "foo", "123")
 	require.NoError(t, err)
 	require.Len(t, posts, 2)
 
@@ -335,7 +550,7 @@ func TestNotifySendsVideoByURLThenSummary(t *testing.T) {
 		Media:     []igMedia{{IsVideo: true, URL: "http://vid/v", ThumbnailURL: "http://img/t"}},
 	}
 
-	svc.notify("foo", []igPost{post})
+	svc.notify(t.Context(), "foo", []igPost{post})
 
 	require.Len(t, tg.videos, 1)
 	assert.Equal(t, "http://vid/v", tg.videos[0].url)
@@ -353,7 +568,7 @@ func TestNotifyVideoUploadFallbackWhenURLFails(t *testing.T) {
 	svc := &InstagramServiceImpl{TelegramClient: tg, InstagramClient: client, PersonalChatID: 7}
 	post := igPost{Shortcode: "VID", Media: []igMedia{{IsVideo: true, URL: "http://vid/v", ThumbnailURL: "http://img/t"}}}
 
-	svc.notify("foo", []igPost{post})
+	svc.notify(t.Context(), "foo", []igPost{post})
 
 	require.Len(t, tg.videos, 1)  // URL attempt happened
 	require.Len(t, tg.uploads, 1) // fell back to multipart upload
@@ -370,7 +585,7 @@ func TestNotifyVideoThumbnailFallbackWhenTooLarge(t *testing.T) {
 	svc := &InstagramServiceImpl{TelegramClient: tg, InstagramClient: client, PersonalChatID: 7}
 	post := igPost{Shortcode: "VID", Media: []igMedia{{IsVideo: true, URL: "http://vid/v", ThumbnailURL: "http://img/t"}}}
 
-	svc.notify("foo", []igPost{post})
+	svc.notify(t.Context(), "foo", []igPost{post})
 
 	assert.Empty(t, tg.uploads) // too big to upload
 	require.Len(t, tg.photos, 1)
@@ -386,7 +601,7 @@ func TestNotifyVideoDownloadErrorFallsBack(t *testing.T) {
 	svc := &InstagramServiceImpl{TelegramClient: tg, InstagramClient: client, PersonalChatID: 7}
 	post := igPost{Shortcode: "VID", Media: []igMedia{{IsVideo: true, URL: "http://vid/v", ThumbnailURL: "http://img/t"}}}
 
-	svc.notify("foo", []igPost{post})
+	svc.notify(t.Context(), "foo", []igPost{post})
 
 	assert.Empty(t, tg.uploads)
 	require.Len(t, tg.photos, 1)
@@ -402,7 +617,7 @@ func TestNotifyVideoUploadFailureFallsBack(t *testing.T) {
 	svc := &InstagramServiceImpl{TelegramClient: tg, InstagramClient: client, PersonalChatID: 7}
 	post := igPost{Shortcode: "VID", Media: []igMedia{{IsVideo: true, URL: "http://vid/v", ThumbnailURL: "http://img/t"}}}
 
-	svc.notify("foo", []igPost{post})
+	svc.notify(t.Context(), "foo", []igPost{post})
 
 	require.Len(t, tg.uploads, 1) // upload attempted
 	require.Len(t, tg.photos, 1)  // then fell back to thumbnail
@@ -413,7 +628,7 @@ func TestSendVideoFallbackNoThumbnailSendsNote(t *testing.T) {
 	tg := &fakeTelegramClient{}
 	svc := &InstagramServiceImpl{TelegramClient: tg, PersonalChatID: 7}
 
-	svc.sendVideoFallback("foo", "VID", "http://link/VID/", igMedia{IsVideo: true, URL: "http://vid/v"})
+	svc.sendVideoFallback(t.Context(), 7, igDelivery{Account: "foo", ID: "VID", Link: "http://link/VID/"}, igMedia{IsVideo: true, URL: "http://vid/v"})
 
 	assert.Empty(t, tg.photos)
 	require.Len(t, tg.messages, 1)
@@ -425,7 +640,7 @@ func TestSendMediaPhotoErrorIsLogged(t *testing.T) {
 	svc := &InstagramServiceImpl{TelegramClient: tg, PersonalChatID: 7}
 
 	// Should not panic; the error is logged and swallowed.
-	svc.sendMedia("foo", "IMG", "http://link/IMG/", 0, igMedia{IsVideo: false, URL: "http://img/x"})
+	svc.sendMedia(t.Context(), 7, igDelivery{Account: "foo", ID: "IMG", Link: "http://link/IMG/"}, 0, igMedia{IsVideo: false, URL: "http://img/x"})
 
 	require.Len(t, tg.photos, 1)
 	assert.Equal(t, "http://img/x", tg.photos[0].url)
@@ -443,7 +658,7 @@ func TestFetchLatestPostsSkipsMediaWithoutURLs(t *testing.T) {
 	}}
 	svc := &InstagramServiceImpl{InstagramClient: client, InstagramAccountRepo: &fakeInstagramRepo{}}
 
-	posts, err := svc.fetchLatestPosts("foo", "123")
+	posts, err := svc.fetchLatestPosts(t.Context(), "foo", "123")
 	require.NoError(t, err)
 	// every item resolves to zero usable media, so nothing is emitted
 	assert.Empty(t, posts)
@@ -465,7 +680,7 @@ func TestFetchLatestStories(t *testing.T) {
 	}}
 	svc := &InstagramServiceImpl{InstagramClient: client}
 
-	stories, err := svc.fetchLatestStories("foo", "123")
+	stories, err := svc.fetchLatestStories(t.Context(), "foo", "123")
 	require.NoError(t, err)
 	// pk 333 has no usable media -> skipped
 	require.Len(t, stories, 2)
@@ -484,7 +699,7 @@ func TestFetchLatestStoriesAltShape(t *testing.T) {
 	}}
 	svc := &InstagramServiceImpl{InstagramClient: client}
 
-	stories, err := svc.fetchLatestStories("foo", "123")
+	stories, err := svc.fetchLatestStories(t.Context(), "foo", "123")
 	require.NoError(t, err)
 	require.Len(t, stories, 1)
 	assert.Equal(t, "777", stories[0].ID)
@@ -499,7 +714,7 @@ func TestProcessStoriesEmptyCacheSendsEverything(t *testing.T) {
 	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: tg}
 
 	account := repository.InstagramAccount{Username: "foo", UserID: "123", LastStoryIDs: ""}
-	err := svc.processStories(account, "123")
+	err := svc.processStories(t.Context(), account, "123")
 	require.NoError(t, err)
 
 	// empty cache => all current stories are new and delivered
@@ -516,7 +731,7 @@ func TestProcessStoriesNoActiveStoryClearsCache(t *testing.T) {
 	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: tg}
 
 	account := repository.InstagramAccount{Username: "foo", UserID: "123", LastStoryIDs: "111,222"}
-	err := svc.processStories(account, "123")
+	err := svc.processStories(t.Context(), account, "123")
 	require.NoError(t, err)
 
 	// cache is replaced with the (empty) current set, nothing sent
@@ -529,14 +744,14 @@ func TestNotifyStoriesEscapesUnderscoreUsername(t *testing.T) {
 	svc := &InstagramServiceImpl{TelegramClient: tg, PersonalChatID: 7}
 	stories := []igStory{{ID: "999", Media: igMedia{URL: "http://img/s"}}}
 
-	svc.notifyStories("jjuya_o0o", stories)
+	svc.notifyStories(t.Context(), "jjuya_o0o", stories)
 
 	require.Len(t, tg.messages, 1)
 	txt := tg.messages[0].text
-	// username underscores escaped inside bold so Telegram markdown does not choke
+	// username underscores escaped inside bold so Telegram MarkdownV2 does not choke
 	assert.Contains(t, txt, "*jjuya\\_o0o*")
 	// link rendered as inline markdown link with escaped visible text + raw url target
-	assert.Contains(t, txt, "[https://www.instagram.com/stories/jjuya\\_o0o/999/]")
+	assert.Contains(t, txt, "[https://www\\.instagram\\.com/stories/jjuya\\_o0o/999/]")
 	assert.Contains(t, txt, "(https://www.instagram.com/stories/jjuya_o0o/999/)")
 }
 
@@ -546,7 +761,7 @@ func TestFetchLatestStoriesEmptyAndErrors(t *testing.T) {
 			return []byte(`{"reels_media":[]}`), nil
 		}}
 		svc := &InstagramServiceImpl{InstagramClient: client}
-		stories, err := svc.fetchLatestStories("foo", "123")
+		stories, err := svc.fetchLatestStories(t.Context(), "foo", "123")
 		require.NoError(t, err)
 		assert.Empty(t, stories)
 	})
@@ -556,7 +771,7 @@ func TestFetchLatestStoriesEmptyAndErrors(t *testing.T) {
 			return nil, errors.New("net")
 		}}
 		svc := &InstagramServiceImpl{InstagramClient: client}
-		_, err := svc.fetchLatestStories("foo", "123")
+		_, err := svc.fetchLatestStories(t.Context(), "foo", "123")
 		assert.Error(t, err)
 	})
 }
@@ -584,7 +799,7 @@ func TestNotifyStoriesSendsMediaThenSummary(t *testing.T) {
 		{ID: "222", Caption: "hi _there_", Media: igMedia{IsVideo: true, URL: "http://vid/s2", ThumbnailURL: "http://img/t"}},
 	}
 
-	svc.notifyStories("foo", stories)
+	svc.notifyStories(t.Context(), "foo", stories)
 
 	// first story: photo + summary; second story: video + summary
 	require.Len(t, tg.photos, 1)
@@ -610,7 +825,9 @@ func TestInstagramRunSendsNewStory(t *testing.T) {
 	tg := &fakeTelegramClient{}
 	svc := &InstagramServiceImpl{InstagramAccountRepo: accountRepo, InstagramClient: client, TelegramClient: tg, PersonalChatID: 42}
 
-	svc.Run()
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
 
 	// only the new story (222, a video) is delivered
 	require.Len(t, tg.videos, 1)
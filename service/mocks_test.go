@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"seanmcapp/external"
 	"seanmcapp/repository"
+	"time"
 )
 
 // ---- WalletRepo fake ----
@@ -15,11 +18,17 @@ type fakeWalletRepo struct {
 	deleteFn         func(int) (int, error)
 }
 
-func (f *fakeWalletRepo) GetAll() ([]repository.Wallet, error)    { return f.getAllFn() }
-func (f *fakeWalletRepo) GetAllocations() (map[string]int, error) { return f.getAllocationsFn() }
-func (f *fakeWalletRepo) Insert(w repository.Wallet) (int, error) { return f.insertFn(w) }
-func (f *fakeWalletRepo) Update(w repository.Wallet) (int, error) { return f.updateFn(w) }
-func (f *fakeWalletRepo) Delete(id int) (int, error)              { return f.deleteFn(id) }
+func (f *fakeWalletRepo) GetAll(context.Context) ([]repository.Wallet, error) { return f.getAllFn() }
+func (f *fakeWalletRepo) GetAllocations(context.Context) (map[string]int, error) {
+	return f.getAllocationsFn()
+}
+func (f *fakeWalletRepo) Insert(_ context.Context, w repository.Wallet) (int, error) {
+	return f.insertFn(w)
+}
+func (f *fakeWalletRepo) Update(_ context.Context, w repository.Wallet) (int, error) {
+	return f.updateFn(w)
+}
+func (f *fakeWalletRepo) Delete(_ context.Context, id int) (int, error) { return f.deleteFn(id) }
 
 // ---- StockRepo fake ----
 
@@ -32,18 +41,20 @@ type fakeStockRepo struct {
 	updated []repository.Stock // records Update calls
 }
 
-func (f *fakeStockRepo) GetAll() ([]repository.Stock, error) { return f.getAllFn() }
-func (f *fakeStockRepo) Create(s repository.Stock) (string, error) {
+func (f *fakeStockRepo) GetAll(context.Context) ([]repository.Stock, error) { return f.getAllFn() }
+func (f *fakeStockRepo) Create(_ context.Context, s repository.Stock) (string, error) {
 	return f.createFn(s)
 }
-func (f *fakeStockRepo) Update(s repository.Stock) (string, error) {
+func (f *fakeStockRepo) Update(_ context.Context, s repository.Stock) (string, error) {
 	f.updated = append(f.updated, s)
 	if f.updateFn != nil {
 		return f.updateFn(s)
 	}
 	return s.Name, nil
 }
-func (f *fakeStockRepo) Delete(name string) (string, error) { return f.deleteFn(name) }
+func (f *fakeStockRepo) Delete(_ context.Context, name string) (string, error) {
+	return f.deleteFn(name)
+}
 
 // ---- InstagramAccountRepo fake ----
 
@@ -56,8 +67,10 @@ type fakeInstagramRepo struct {
 	updatedStoryIDs   map[string]string
 }
 
-func (f *fakeInstagramRepo) GetAll() ([]repository.InstagramAccount, error) { return f.getAllFn() }
-func (f *fakeInstagramRepo) UpdateLastShortcodes(username, shortcodes string) error {
+func (f *fakeInstagramRepo) GetAll(context.Context) ([]repository.InstagramAccount, error) {
+	return f.getAllFn()
+}
+func (f *fakeInstagramRepo) UpdateLastShortcodes(_ context.Context, username, shortcodes string) error {
 	if f.updatedShortcodes == nil {
 		f.updatedShortcodes = map[string]string{}
 	}
@@ -68,7 +81,7 @@ func (f *fakeInstagramRepo) UpdateLastShortcodes(username, shortcodes string) er
 	return nil
 }
 
-func (f *fakeInstagramRepo) UpdateUserID(username, userID string) error {
+func (f *fakeInstagramRepo) UpdateUserID(_ context.Context, username, userID string) error {
 	if f.updatedUserIDs == nil {
 		f.updatedUserIDs = map[string]string{}
 	}
@@ -76,7 +89,7 @@ func (f *fakeInstagramRepo) UpdateUserID(username, userID string) error {
 	return nil
 }
 
-func (f *fakeInstagramRepo) UpdateLastStoryIDs(username, storyIDs string) error {
+func (f *fakeInstagramRepo) UpdateLastStoryIDs(_ context.Context, username, storyIDs string) error {
 	if f.updatedStoryIDs == nil {
 		f.updatedStoryIDs = map[string]string{}
 	}
@@ -84,6 +97,112 @@ func (f *fakeInstagramRepo) UpdateLastStoryIDs(username, storyIDs string) error
 	return nil
 }
 
+// ---- Notifier fake ----
+
+type fakeNotifier struct {
+	notes []external.Notification
+	ctx   context.Context // of the last notification
+	err   error
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, n external.Notification) error {
+	f.ctx = ctx
+	f.notes = append(f.notes, n)
+	return f.err
+}
+
+// ---- DigestRepo fake ----
+
+type fakeDigestRepo struct {
+	held    []repository.DigestItem
+	due     []repository.DigestItem
+	deleted []int
+	err     error
+}
+
+func (f *fakeDigestRepo) Hold(_ context.Context, item repository.DigestItem) error {
+	f.held = append(f.held, item)
+	return f.err
+}
+
+func (f *fakeDigestRepo) Due(context.Context) ([]repository.DigestItem, error) {
+	return f.due, f.err
+}
+
+func (f *fakeDigestRepo) Delete(_ context.Context, ids ...int) error {
+	f.deleted = append(f.deleted, ids...)
+	return f.err
+}
+
+func (f *fakeDigestRepo) DeleteIn(ctx context.Context, _ *sql.Tx, ids ...int) error {
+	return f.Delete(ctx, ids...)
+}
+
+// ---- OutboxRepo fake ----
+
+type outboxReschedule struct {
+	id        int
+	next      time.Time
+	lastError string
+}
+
+type fakeOutboxRepo struct {
+	enqueued    []repository.OutboxMessage
+	due         []repository.OutboxMessage
+	sent        []int
+	rescheduled []outboxReschedule
+	failed      map[int]string
+	err         error
+}
+
+func (f *fakeOutboxRepo) Enqueue(ctx context.Context, messages ...repository.OutboxMessage) error {
+	return f.EnqueueWith(ctx, nil, messages...)
+}
+
+// EnqueueWith hands write a nil transaction; like the real one, nothing is
+// queued when write fails.
+func (f *fakeOutboxRepo) EnqueueWith(_ context.Context, write func(tx *sql.Tx) error, messages ...repository.OutboxMessage) error {
+	if f.err != nil {
+		return f.err
+	}
+	if write != nil {
+		if err := write(nil); err != nil {
+			return err
+		}
+	}
+	f.enqueued = append(f.enqueued, messages...)
+	return nil
+}
+
+func (f *fakeOutboxRepo) Due(_ context.Context, limit int) ([]repository.OutboxMessage, error) {
+	if len(f.due) > limit {
+		return f.due[:limit], f.err
+	}
+	return f.due, f.err
+}
+
+func (f *fakeOutboxRepo) MarkSent(_ context.Context, id int) error {
+	f.sent = append(f.sent, id)
+	return nil
+}
+
+func (f *fakeOutboxRepo) Reschedule(_ context.Context, id int, next time.Time, lastError string) error {
+	f.rescheduled = append(f.rescheduled, outboxReschedule{id, next, lastError})
+	return nil
+}
+
+func (f *fakeOutboxRepo) MarkFailed(_ context.Context, id int, lastError string) error {
+	if f.failed == nil {
+		f.failed = map[int]string{}
+	}
+	f.failed[id] = lastError
+	return nil
+}
+
+func (f *fakeOutboxRepo) Stats() (repository.OutboxStats, error) {
+	return repository.OutboxStats{Pending: len(f.due), Failed: len(f.failed)}, f.err
+}
+
 // ---- StockClient fake ----
 
 type fakeStockClient struct {
@@ -92,7 +211,7 @@ type fakeStockClient struct {
 	calls  []string
 }
 
-func (f *fakeStockClient) GetPrice(name string) (int64, error) {
+func (f *fakeStockClient) GetPrice(_ context.Context, name string) (int64, error) {
 	f.calls = append(f.calls, name)
 	if f.err != nil {
 		return 0, f.err
@@ -126,41 +245,118 @@ type telegramVideoUpload struct {
 	size     int
 }
 
+type telegramMediaGroup struct {
+	chatID int64
+	media  []external.InputMedia
+	upload bool
+}
+
+type telegramKeyboardMessage struct {
+	chatID   int64
+	text     string
+	keyboard external.InlineKeyboardMarkup
+}
+
+type telegramEdit struct {
+	chatID    int64
+	messageID int
+	text      string // empty for reply-markup-only edits
+	keyboard  *external.InlineKeyboardMarkup
+}
+
 type fakeTelegramClient struct {
 	messages []telegramMessage
+	keyboard []telegramKeyboardMessage
+	answered []string // callback query ids
+	toasts   []string
+	edits    []telegramEdit
 	photos   []telegramPhoto
 	videos   []telegramVideo
 	uploads  []telegramVideoUpload
+	groups   []telegramMediaGroup
 	err      error
+	textErrs map[string]error // SendMessage errors by text, overriding err
 
 	videoURLFails bool // when true, SendVideo responds Ok=false (simulates >20MB)
 	uploadFails   bool // when true, SendVideoUpload responds Ok=false
+	groupURLFails bool // when true, SendMediaGroup responds Ok=false
+	groupFails    bool // when true, SendMediaGroupUpload responds Ok=false too
+
+	ctx context.Context // of the last call
 }
 
-func (f *fakeTelegramClient) SendMessage(chatID int64, text string) (external.TelegramResponse, error) {
+func (f *fakeTelegramClient) SendMessage(ctx context.Context, chatID int64, text string) (external.TelegramResponse, error) {
+	f.ctx = ctx
 	f.messages = append(f.messages, telegramMessage{chatID, text})
+	if err, ok := f.textErrs[text]; ok {
+		return external.TelegramResponse{}, err
+	}
 	return external.TelegramResponse{Ok: true}, f.err
 }
 
-func (f *fakeTelegramClient) SendPhoto(chatID int64, photoURL, caption string) (external.TelegramResponse, error) {
+func (f *fakeTelegramClient) SendPhoto(ctx context.Context, chatID int64, photoURL, caption string) (external.TelegramResponse, error) {
+	f.ctx = ctx
 	f.photos = append(f.photos, telegramPhoto{chatID, photoURL, caption})
 	return external.TelegramResponse{Ok: true}, f.err
 }
 
-func (f *fakeTelegramClient) SendVideo(chatID int64, videoURL, caption string) (external.TelegramResponse, error) {
+func (f *fakeTelegramClient) SendVideo(ctx context.Context, chatID int64, videoURL, caption string) (external.TelegramResponse, error) {
+	f.ctx = ctx
 	f.videos = append(f.videos, telegramVideo{chatID, videoURL, caption})
 	return external.TelegramResponse{Ok: !f.videoURLFails}, f.err
 }
 
-func (f *fakeTelegramClient) SendVideoUpload(chatID int64, data []byte, filename, caption string) (external.TelegramResponse, error) {
+func (f *fakeTelegramClient) SendVideoUpload(ctx context.Context, chatID int64, data []byte, filename, caption string) (external.TelegramResponse, error) {
+	f.ctx = ctx
 	f.uploads = append(f.uploads, telegramVideoUpload{chatID, filename, caption, len(data)})
 	return external.TelegramResponse{Ok: !f.uploadFails}, f.err
 }
 
+func (f *fakeTelegramClient) SendMediaGroup(ctx context.Context, chatID int64, media []external.InputMedia) (external.TelegramResponse, error) {
+	f.ctx = ctx
+	f.groups = append(f.groups, telegramMediaGroup{chatID, media, false})
+	return external.TelegramResponse{Ok: !f.groupURLFails && !f.groupFails}, f.err
+}
+
+func (f *fakeTelegramClient) SendMediaGroupUpload(ctx context.Context, chatID int64, media []external.InputMedia) (external.TelegramResponse, error) {
+	f.ctx = ctx
+	f.groups = append(f.groups, telegramMediaGroup{chatID, media, true})
+	return external.TelegramResponse{Ok: !f.groupFails}, f.err
+}
+
+func (f *fakeTelegramClient) SendMessageWithKeyboard(ctx context.Context, chatID int64, text string, keyboard external.InlineKeyboardMarkup) (external.TelegramResponse, error) {
+	f.ctx = ctx
+	f.keyboard = append(f.keyboard, telegramKeyboardMessage{chatID, text, keyboard})
+	return external.TelegramResponse{Ok: true}, f.err
+}
+
+func (f *fakeTelegramClient) AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error {
+	f.ctx = ctx
+	f.answered = append(f.answered, callbackQueryID)
+	f.toasts = append(f.toasts, text)
+	return f.err
+}
+
+func (f *fakeTelegramClient) EditMessageText(ctx context.Context, chatID int64, messageID int, text string, keyboard *external.InlineKeyboardMarkup) (external.TelegramResponse, error) {
+	f.ctx = ctx
+	f.edits = append(f.edits, telegramEdit{chatID, messageID, text, keyboard})
+	return external.TelegramResponse{Ok: true}, f.err
+}
+
+func (f *fakeTelegramClient) EditMessageReplyMarkup(ctx context.Context, chatID int64, messageID int, keyboard *external.InlineKeyboardMarkup) (external.TelegramResponse, error) {
+	f.ctx = ctx
+	f.edits = append(f.edits, telegramEdit{chatID, messageID, "", keyboard})
+	return external.TelegramResponse{Ok: true}, f.err
+}
+
+func (f *fakeTelegramClient) GetUpdates(context.Context, int64, time.Duration) ([]external.TelegramUpdate, error) {
+	return nil, f.err
+}
+
 // ---- InstagramClient fake ----
 
 type fakeInstagramClient struct {
 	getFn func(url string) ([]byte, error)
 }
 
-func (f *fakeInstagramClient) Get(url string) ([]byte, error) { return f.getFn(url) }
+func (f *fakeInstagramClient) Get(_ context.Context, url string) ([]byte, error) { return f.getFn(url) }
@@ -1,10 +1,11 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"seanmcapp/external"
 	"strings"
@@ -14,11 +15,12 @@ import (
 )
 
 type NewsService interface {
-	Run()
+	Run(ctx context.Context) (int, error)
 }
 
 type NewsServiceImpl struct {
 	TelegramClient external.TelegramClient
+	Notifier       external.Notifier // nil sends straight to GroupChatID
 	GroupChatID    int64
 	httpClient     *http.Client
 	sources        []NewsObject
@@ -41,34 +43,58 @@ func NewNewsService(telegramClient external.TelegramClient, groupChatID int64) *
 	}
 }
 
-func (s *NewsServiceImpl) Run() {
-	s.guard.run("news run", func() {
+// TryStart takes the job's guard for a run started later under the
+// returned context, or reports false while a run is in progress.
+func (s *NewsServiceImpl) TryStart(ctx context.Context) (context.Context, func(), bool) {
+	return s.guard.tryStart(ctx)
+}
+
+// Run sends the day's headlines and returns how many were sent.
+func (s *NewsServiceImpl) Run(ctx context.Context) (int, error) {
+	sent := 0
+	err := s.guard.run(ctx, "news run", func() error {
 		var results []NewsResult
 
 		for _, news := range s.sources {
-			result, err := s.fetchNews(news)
+			result, err := s.fetchNews(ctx, news)
 			if err != nil {
-				log.Printf("[ERROR] %s: %v\n", news.Name(), err)
+				slog.ErrorContext(ctx, "fetching news", "service", SourceNews, "source", news.Name(), "error", err)
 				continue
 			}
 			results = append(results, result)
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return errors.New("no news source could be fetched")
+		}
 
-		message := "Awali harimu dengan berita 📰 dari **Seanmctoday** by @seanmcbot\n\n"
+		message := external.NewMessage().Text("Awali harimu dengan berita 📰 dari ").Bold("Seanmctoday").Text(" by @seanmcbot\n\n")
 		for _, res := range results {
 			flags := ""
 			for _, f := range res.NewsSource.Flag() {
 				flags += string(rune(f))
 			}
-			message += fmt.Sprintf("%s %s - [%s](%s)\n\n", flags, res.NewsSource.Name(), strings.TrimSpace(res.Title), res.URL)
+			message.Textf("%s %s - ", flags, res.NewsSource.Name()).Link(strings.TrimSpace(res.Title), res.URL).Text("\n\n")
 		}
 
-		s.TelegramClient.SendMessage(s.GroupChatID, message)
+		note := external.Notification{Source: SourceNews, Title: "Seanmctoday", Body: message}
+		if err := notify(ctx, s.Notifier, s.TelegramClient, s.GroupChatID, note); err != nil {
+			return fmt.Errorf("sending news: %w", err)
+		}
+		sent = len(results)
+		return nil
 	})
+	return sent, err
 }
 
-func (s *NewsServiceImpl) fetchNews(news NewsObject) (NewsResult, error) {
-	resp, err := s.httpClient.Get(news.URL())
+func (s *NewsServiceImpl) fetchNews(ctx context.Context, news NewsObject) (NewsResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, news.URL(), nil)
+	if err != nil {
+		return NewsResult{}, fmt.Errorf("building request: %w", err)
+	}
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return NewsResult{}, fmt.Errorf("fetching: %w", err)
 	}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -139,10 +140,36 @@ func TestNewsRun(t *testing.T) {
 		},
 	}
 
-	svc.Run()
+	sent, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
 
 	require.Len(t, tg.messages, 1)
 	assert.Equal(t, int64(777), tg.messages[0].chatID)
 	assert.Contains(t, tg.messages[0].text, "Breaking News")
 	assert.Contains(t, tg.messages[0].text, "https://example.com/story")
 }
+
+func TestNewsRunFailsWhenNoSourceCanBeFetched(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<html><body></body></html>`))
+	}))
+	defer srv.Close()
+
+	tg := &fakeTelegramClient{}
+	svc := &NewsServiceImpl{
+		TelegramClient: tg,
+		GroupChatID:    777,
+		httpClient:     srv.Client(),
+		sources: []NewsObject{
+			fakeNewsSource{url: srv.URL, parseFn: func(*goquery.Document) (string, string, error) {
+				return "", "", errors.New("no headline")
+			}},
+		},
+	}
+
+	sent, err := svc.Run(t.Context())
+	assert.EqualError(t, err, "no news source could be fetched")
+	assert.Equal(t, 0, sent)
+	assert.Empty(t, tg.messages)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"seanmcapp/external"
+)
+
+// Notification sources, used as keys when routing notifications to channels.
+const (
+	SourceNews      = "news"
+	SourceStock     = "stock"
+	SourceInstagram = "instagram"
+)
+
+// TelegramNotifier delivers notifications to one Telegram chat, through the
+// outbox when one is configured.
+type TelegramNotifier struct {
+	Outbox         OutboxService
+	TelegramClient external.TelegramClient
+	ChatID         int64
+}
+
+func (n *TelegramNotifier) Notify(ctx context.Context, note external.Notification) error {
+	return notifyChat(ctx, n.Outbox, n.TelegramClient, n.ChatID, note.Body.String())
+}
+
+// NotificationRouter sends each notification to every channel configured for
+// its source. A failing channel does not stop the others.
+type NotificationRouter struct {
+	Routes map[string][]external.Notifier
+}
+
+func (r *NotificationRouter) Notify(ctx context.Context, n external.Notification) error {
+	channels := r.Routes[n.Source]
+	if len(channels) == 0 {
+		slog.WarnContext(ctx, "no notification channel configured, dropping notification", "service", n.Source)
+		return nil
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		if err := channel.Notify(ctx, n); err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", channel, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notify sends n through notifier, or straight to chatID on Telegram when the
+// service has no notifier configured.
+func notify(ctx context.Context, notifier external.Notifier, tg external.TelegramClient, chatID int64, n external.Notification) error {
+	if notifier == nil {
+		notifier = &TelegramNotifier{TelegramClient: tg, ChatID: chatID}
+	}
+	return notifier.Notify(ctx, n)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"seanmcapp/external"
+	"seanmcapp/repository"
+)
+
+func TestNotificationRouterFansOut(t *testing.T) {
+	email, telegram, news := &fakeNotifier{}, &fakeNotifier{}, &fakeNotifier{}
+	router := &NotificationRouter{Routes: map[string][]external.Notifier{
+		SourceStock: {email, telegram},
+		SourceNews:  {news},
+	}}
+
+	note := external.Notification{Source: SourceStock, Body: external.NewMessage().Text("BBCA hitting best price")}
+	require.NoError(t, router.Notify(t.Context(), note))
+
+	assert.Equal(t, []external.Notification{note}, email.notes)
+	assert.Equal(t, []external.Notification{note}, telegram.notes)
+	assert.Empty(t, news.notes)
+}
+
+func TestNotificationRouterKeepsGoingAfterFailure(t *testing.T) {
+	broken := &fakeNotifier{err: errors.New("smtp down")}
+	telegram := &fakeNotifier{}
+	router := &NotificationRouter{Routes: map[string][]external.Notifier{SourceStock: {broken, telegram}}}
+
+	err := router.Notify(t.Context(), external.Notification{Source: SourceStock, Body: external.NewMessage().Text("x")})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "smtp down")
+	assert.Len(t, telegram.notes, 1, "a failing channel must not stop the others")
+}
+
+func TestNotificationRouterUnroutedSource(t *testing.T) {
+	router := &NotificationRouter{}
+	assert.NoError(t, router.Notify(t.Context(), external.Notification{Source: "unknown", Body: external.NewMessage()}))
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	repo := &fakeOutboxRepo{}
+	tg := &fakeTelegramClient{}
+	body := external.NewMessage().Text("v1.0 is out!")
+
+	queued := &TelegramNotifier{Outbox: &OutboxServiceImpl{OutboxRepo: repo}, TelegramClient: tg, ChatID: 42}
+	require.NoError(t, queued.Notify(t.Context(), external.Notification{Body: body}))
+	assert.Equal(t, []repository.OutboxMessage{{ChatID: 42, Text: `v1\.0 is out\!`}}, repo.enqueued)
+	assert.Empty(t, tg.messages)
+
+	direct := &TelegramNotifier{TelegramClient: tg, ChatID: 7}
+	require.NoError(t, direct.Notify(t.Context(), external.Notification{Body: body}))
+	assert.Equal(t, []telegramMessage{{7, `v1\.0 is out\!`}}, tg.messages)
+}
+
+func TestStockRunRoutesAlertsToNotifier(t *testing.T) {
+	stocks := []repository.Stock{
+		{Name: "BBCA", BestPrice: 100, FairPrice: 200, Status: false, CurrentPrice: ptr[int64](90)},
+	}
+	repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) { return stocks, nil }}
+	tg := &fakeTelegramClient{}
+	notifier := &fakeNotifier{}
+	svc := &StockServiceImpl{StockRepo: repo, StockClient: &fakeStockClient{prices: map[string]int64{"BBCA": 90}}, TelegramClient: tg, Notifier: notifier, PersonalChatID: 99}
+
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
+
+	assert.Empty(t, tg.messages)
+	require.Len(t, notifier.notes, 1)
+	assert.Equal(t, SourceStock, notifier.notes[0].Source)
+	assert.Equal(t, "BBCA hitting best price", notifier.notes[0].Body.PlainText())
+}
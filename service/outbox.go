@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"time"
+)
+
+const (
+	outboxBatchSize   = 20
+	outboxMaxAttempts = 10
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = time.Hour
+)
+
+// OutboxService queues outgoing notifications in Postgres and delivers them in
+// the background, so a restart or a Telegram outage does not lose them.
+type OutboxService interface {
+	Enqueue(ctx context.Context, chatID int64, texts ...string) error
+	EnqueueWith(ctx context.Context, chatID int64, write func(tx *sql.Tx) error, texts ...string) error
+	EnqueueKind(ctx context.Context, chatID int64, kind string, payloads ...string) error
+	Drain(ctx context.Context)
+	Stats() (repository.OutboxStats, error)
+}
+
+// OutboxHandler delivers a queued message of a kind other than text from its
+// payload. A failure is retried like a text message's, so it fails only when
+// nothing of the message was delivered.
+type OutboxHandler func(ctx context.Context, chatID int64, payload string) error
+
+// errNoOutboxHandler fails a message whose kind no handler was registered for.
+var errNoOutboxHandler = errors.New("no handler for this kind of message")
+
+type OutboxServiceImpl struct {
+	OutboxRepo     repository.OutboxRepo
+	TelegramClient external.TelegramClient
+	handlers       map[string]OutboxHandler
+	guard          runGuard
+}
+
+// Handle registers how messages of kind are delivered. It is called while
+// wiring, before the outbox is drained.
+func (s *OutboxServiceImpl) Handle(kind string, handler OutboxHandler) {
+	if s.handlers == nil {
+		s.handlers = make(map[string]OutboxHandler)
+	}
+	s.handlers[kind] = handler
+}
+
+// Enqueue stores texts for chatID in one transaction; they are sent in order.
+func (s *OutboxServiceImpl) Enqueue(ctx context.Context, chatID int64, texts ...string) error {
+	return s.OutboxRepo.Enqueue(ctx, outboxMessages(chatID, texts)...)
+}
+
+// EnqueueWith stores texts for chatID in the transaction of write, the change
+// they report, so neither is saved without the other.
+func (s *OutboxServiceImpl) EnqueueWith(ctx context.Context, chatID int64, write func(tx *sql.Tx) error, texts ...string) error {
+	return s.OutboxRepo.EnqueueWith(ctx, write, outboxMessages(chatID, texts)...)
+}
+
+// EnqueueKind stores payloads for chatID in one transaction, each to be
+// delivered in order by the handler registered for kind.
+func (s *OutboxServiceImpl) EnqueueKind(ctx context.Context, chatID int64, kind string, payloads ...string) error {
+	messages := outboxMessages(chatID, payloads)
+	for i := range messages {
+		messages[i].Kind = kind
+	}
+	return s.OutboxRepo.Enqueue(ctx, messages...)
+}
+
+func outboxMessages(chatID int64, texts []string) []repository.OutboxMessage {
+	messages := make([]repository.OutboxMessage, len(texts))
+	for i, text := range texts {
+		messages[i] = repository.OutboxMessage{ChatID: chatID, Text: text}
+	}
+	return messages
+}
+
+// Drain sends one batch of due messages. Failures are retried with backoff
+// until Telegram accepts the message, rejects it for good, or it runs out of
+// attempts. A chat's later messages wait while an earlier one is retried, so
+// they keep their order.
+func (s *OutboxServiceImpl) Drain(ctx context.Context) {
+	_ = s.guard.run(ctx, "outbox drain", func() error {
+		messages, err := s.OutboxRepo.Due(ctx, outboxBatchSize)
+		if err != nil {
+			slog.ErrorContext(ctx, "loading outbox", "service", "outbox", "error", err)
+			return nil
+		}
+
+		held := make(map[int64]bool)
+		for _, m := range messages {
+			if held[m.ChatID] {
+				continue
+			}
+			if err := s.send(ctx, m); err != nil {
+				if !s.recordFailure(ctx, m, err) {
+					held[m.ChatID] = true
+				}
+				continue
+			}
+			if err := s.OutboxRepo.MarkSent(ctx, m.ID); err != nil {
+				slog.ErrorContext(ctx, "marking message as sent", "service", "outbox", "message_id", m.ID, "chat_id", m.ChatID, "error", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *OutboxServiceImpl) send(ctx context.Context, m repository.OutboxMessage) error {
+	if m.Kind == "" || m.Kind == repository.OutboxText {
+		_, err := s.TelegramClient.SendMessage(ctx, m.ChatID, m.Text)
+		return err
+	}
+	handler, ok := s.handlers[m.Kind]
+	if !ok {
+		return fmt.Errorf("%s: %w", m.Kind, errNoOutboxHandler)
+	}
+	return handler(ctx, m.ChatID, m.Text)
+}
+
+func (s *OutboxServiceImpl) Stats() (repository.OutboxStats, error) {
+	return s.OutboxRepo.Stats()
+}
+
+// recordFailure gives up on m or schedules its retry, reporting whether it
+// gave up.
+func (s *OutboxServiceImpl) recordFailure(ctx context.Context, m repository.OutboxMessage, sendErr error) bool {
+	attempts := m.Attempts + 1
+	if permanentSendError(sendErr) || attempts >= outboxMaxAttempts {
+		slog.ErrorContext(ctx, "giving up on message", "service", "outbox", "message_id", m.ID, "chat_id", m.ChatID, "attempts", attempts, "error", sendErr)
+		if err := s.OutboxRepo.MarkFailed(ctx, m.ID, sendErr.Error()); err != nil {
+			slog.ErrorContext(ctx, "marking message as failed", "service", "outbox", "message_id", m.ID, "chat_id", m.ChatID, "error", err)
+		}
+		return true
+	}
+
+	delay := outboxBaseBackoff << m.Attempts
+	if delay > outboxMaxBackoff || delay <= 0 {
+		delay = outboxMaxBackoff
+	}
+	slog.WarnContext(ctx, "message not delivered, retrying", "service", "outbox", "message_id", m.ID, "chat_id", m.ChatID, "retry_in", delay.String(), "error", sendErr)
+	if err := s.OutboxRepo.Reschedule(ctx, m.ID, nowFn().Add(delay), sendErr.Error()); err != nil {
+		slog.ErrorContext(ctx, "rescheduling message", "service", "outbox", "message_id", m.ID, "chat_id", m.ChatID, "error", err)
+	}
+	return false
+}
+
+// permanentSendError reports whether retrying cannot help: the chat is gone,
+// the bot was blocked, or the message itself is invalid or cannot be handled.
+func permanentSendError(err error) bool {
+	if errors.Is(err, external.ErrChatNotFound) || errors.Is(err, external.ErrMessageTooLong) || errors.Is(err, errNoOutboxHandler) {
+		return true
+	}
+	var apiErr *external.TelegramAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusForbidden
+	}
+	return false
+}
+
+// notifyChat queues texts through the outbox, or sends them straight away when
+// no outbox is configured.
+func notifyChat(ctx context.Context, outbox OutboxService, tg external.TelegramClient, chatID int64, texts ...string) error {
+	if outbox != nil {
+		return outbox.Enqueue(ctx, chatID, texts...)
+	}
+
+	var errs []error
+	for _, text := range texts {
+		if _, err := tg.SendMessage(ctx, chatID, text); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxEnqueue(t *testing.T) {
+	repo := &fakeOutboxRepo{}
+	svc := &OutboxServiceImpl{OutboxRepo: repo}
+
+	require.NoError(t, svc.Enqueue(t.Context(), 42, "first", "second"))
+	assert.Equal(t, []repository.OutboxMessage{{ChatID: 42, Text: "first"}, {ChatID: 42, Text: "second"}}, repo.enqueued)
+}
+
+func TestOutboxDrainMarksSent(t *testing.T) {
+	repo := &fakeOutboxRepo{due: []repository.OutboxMessage{{ID: 1, ChatID: 42, Text: "a"}, {ID: 2, ChatID: 7, Text: "b"}}}
+	tg := &fakeTelegramClient{}
+	svc := &OutboxServiceImpl{OutboxRepo: repo, TelegramClient: tg}
+
+	svc.Drain(t.Context())
+
+	assert.Equal(t, []telegramMessage{{42, "a"}, {7, "b"}}, tg.messages)
+	assert.Equal(t, []int{1, 2}, repo.sent)
+}
+
+func TestOutboxDrainKeepsEachChatInOrder(t *testing.T) {
+	repo := &fakeOutboxRepo{due: []repository.OutboxMessage{
+		{ID: 1, ChatID: 42, Text: "first"},
+		{ID: 2, ChatID: 7, Text: "other chat"},
+		{ID: 3, ChatID: 42, Text: "second"},
+	}}
+	tg := &fakeTelegramClient{textErrs: map[string]error{"first": errors.New("timeout")}}
+	svc := &OutboxServiceImpl{OutboxRepo: repo, TelegramClient: tg}
+
+	svc.Drain(t.Context())
+
+	assert.Equal(t, []telegramMessage{{42, "first"}, {7, "other chat"}}, tg.messages, "second waits for first to be retried")
+	assert.Equal(t, []int{2}, repo.sent)
+	require.Len(t, repo.rescheduled, 1)
+	assert.Equal(t, 1, repo.rescheduled[0].id)
+}
+
+func TestOutboxDrainFailures(t *testing.T) {
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	orig := nowFn
+	nowFn = func() time.Time { return now }
+	t.Cleanup(func() { nowFn = orig })
+
+	t.Run("transient errors are retried with backoff", func(t *testing.T) {
+		repo := &fakeOutboxRepo{due: []repository.OutboxMessage{{ID: 1, Attempts: 2}}}
+		svc := &OutboxServiceImpl{OutboxRepo: repo, TelegramClient: &fakeTelegramClient{err: errors.New("connection reset")}}
+
+		svc.Drain(t.Context())
+
+		require.Len(t, repo.rescheduled, 1)
+		assert.Equal(t, outboxReschedule{1, now.Add(2 * time.Minute), "connection reset"}, repo.rescheduled[0])
+		assert.Empty(t, repo.failed)
+	})
+
+	t.Run("backoff is capped", func(t *testing.T) {
+		repo := &fakeOutboxRepo{due: []repository.OutboxMessage{{ID: 1, Attempts: 8}}}
+		svc := &OutboxServiceImpl{OutboxRepo: repo, TelegramClient: &fakeTelegramClient{err: errors.New("timeout")}}
+
+		svc.Drain(t.Context())
+
+		require.Len(t, repo.rescheduled, 1)
+		assert.Equal(t, now.Add(outboxMaxBackoff), repo.rescheduled[0].next)
+	})
+
+	t.Run("permanent errors fail immediately", func(t *testing.T) {
+		apiErr := &external.TelegramAPIError{Method: "sendMessage", Code: 403, Description: "Forbidden: bot was blocked by the user"}
+		repo := &fakeOutboxRepo{due: []repository.OutboxMessage{{ID: 1}}}
+		svc := &OutboxServiceImpl{OutboxRepo: repo, TelegramClient: &fakeTelegramClient{err: apiErr}}
+
+		svc.Drain(t.Context())
+
+		assert.Empty(t, repo.rescheduled)
+		assert.Contains(t, repo.failed[1], "blocked")
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		repo := &fakeOutboxRepo{due: []repository.OutboxMessage{{ID: 1, Attempts: outboxMaxAttempts - 1}}}
+		svc := &OutboxServiceImpl{OutboxRepo: repo, TelegramClient: &fakeTelegramClient{err: errors.New("timeout")}}
+
+		svc.Drain(t.Context())
+
+		assert.Empty(t, repo.rescheduled)
+		assert.Equal(t, "timeout", repo.failed[1])
+	})
+}
+
+func TestOutboxDrainHandlesKinds(t *testing.T) {
+	repo := &fakeOutboxRepo{due: []repository.OutboxMessage{
+		{ID: 1, ChatID: 42, Kind: "album", Text: "payload"},
+		{ID: 2, ChatID: 7, Kind: "unknown", Text: "lost"},
+	}}
+	svc := &OutboxServiceImpl{OutboxRepo: repo, TelegramClient: &fakeTelegramClient{}}
+	var handled []string
+	svc.Handle("album", func(_ context.Context, chatID int64, payload string) error {
+		handled = append(handled, fmt.Sprintf("%d:%s", chatID, payload))
+		return nil
+	})
+
+	svc.Drain(t.Context())
+
+	assert.Equal(t, []string{"42:payload"}, handled)
+	assert.Equal(t, []int{1}, repo.sent)
+	assert.Contains(t, repo.failed[2], "no handler", "a kind nothing handles is not retried")
+}
+
+func TestOutboxEnqueueKind(t *testing.T) {
+	repo := &fakeOutboxRepo{}
+	svc := &OutboxServiceImpl{OutboxRepo: repo}
+
+	require.NoError(t, svc.EnqueueKind(t.Context(), 42, "album", "a", "b"))
+	assert.Equal(t, []repository.OutboxMessage{{ChatID: 42, Kind: "album", Text: "a"}, {ChatID: 42, Kind: "album", Text: "b"}}, repo.enqueued)
+}
+
+func TestOutboxDrainLoadError(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	svc := &OutboxServiceImpl{OutboxRepo: &fakeOutboxRepo{err: errors.New("db down")}, TelegramClient: tg}
+
+	svc.Drain(t.Context())
+	assert.Empty(t, tg.messages)
+}
+
+func TestNotifyChatPrefersOutbox(t *testing.T) {
+	repo := &fakeOutboxRepo{}
+	tg := &fakeTelegramClient{}
+
+	require.NoError(t, notifyChat(t.Context(), &OutboxServiceImpl{OutboxRepo: repo}, tg, 42, "hello"))
+	assert.Len(t, repo.enqueued, 1)
+	assert.Empty(t, tg.messages)
+
+	require.NoError(t, notifyChat(t.Context(), nil, tg, 42, "direct"))
+	assert.Equal(t, []telegramMessage{{42, "direct"}}, tg.messages)
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"seanmcapp/util"
+)
+
+// jakarta is the timezone wall-clock times are read in, such as quiet hours
+// and the month a /spend entry is filed under, the same one the scheduler
+// runs jobs in.
+var jakarta = loadJakarta()
+
+func loadJakarta() *time.Location {
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		// Jakarta has no daylight saving, so a fixed offset is exact.
+		return time.FixedZone("WIB", 7*60*60)
+	}
+	return loc
+}
+
+// quietUntil reports whether now falls within q and, if so, when that quiet
+// period ends.
+func quietUntil(q util.QuietHours, now time.Time) (time.Time, bool) {
+	if q.Start == q.End {
+		return time.Time{}, false
+	}
+
+	local := now.In(jakarta)
+	minute := local.Hour()*60 + local.Minute()
+	var quiet bool
+	if q.Start < q.End {
+		quiet = minute >= q.Start && minute < q.End
+	} else { // wraps past midnight, e.g. 22:00-07:00
+		quiet = minute >= q.Start || minute < q.End
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, jakarta)
+	end := midnight.Add(time.Duration(q.End) * time.Minute)
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, true
+}
+
+// QuietHoursNotifier sits in front of a Telegram chat's notifier. During the
+// chat's quiet hours non-urgent notifications are held in the digest table
+// instead, for DigestService to send as one message once they are over.
+type QuietHoursNotifier struct {
+	Next       external.Notifier
+	ChatID     int64
+	DigestRepo repository.DigestRepo
+	Hours      util.QuietHours            // the chat's quiet hours
+	BySource   map[string]util.QuietHours // overrides Hours for some sources
+}
+
+func (n *QuietHoursNotifier) Notify(ctx context.Context, note external.Notification) error {
+	hours, ok := n.BySource[note.Source]
+	if !ok {
+		hours = n.Hours
+	}
+
+	releaseAt, quiet := quietUntil(hours, nowFn())
+	if note.Urgent || !quiet {
+		return n.Next.Notify(ctx, note)
+	}
+
+	return n.DigestRepo.Hold(ctx, repository.DigestItem{
+		ChatID:    n.ChatID,
+		Source:    note.Source,
+		Text:      note.Body.String(),
+		ReleaseAt: releaseAt,
+	})
+}
+
+// DigestService sends the notifications held during quiet hours, one digest
+// per chat, once those hours are over. It runs every minute.
+type DigestService interface {
+	Run(ctx context.Context) (int, error)
+}
+
+type DigestServiceImpl struct {
+	DigestRepo     repository.DigestRepo
+	TelegramClient external.TelegramClient
+	Outbox         OutboxService
+	guard          runGuard
+}
+
+// TryStart takes the job's guard for a run started later under the
+// returned context, or reports false while a run is in progress.
+func (s *DigestServiceImpl) TryStart(ctx context.Context) (context.Context, func(), bool) {
+	return s.guard.tryStart(ctx)
+}
+
+// Run sends the digests that are due and returns how many held items they
+// delivered.
+func (s *DigestServiceImpl) Run(ctx context.Context) (int, error) {
+	delivered := 0
+	err := s.guard.run(ctx, "digest", func() error {
+		items, err := s.DigestRepo.Due(ctx)
+		if err != nil {
+			return fmt.Errorf("loading digest items: %w", err)
+		}
+
+		// Due returns items grouped by chat.
+		for start := 0; start < len(items); {
+			if err := ctx.Err(); err != nil {
+				return err // the rest stay held for the next run
+			}
+			end := start
+			for end < len(items) && items[end].ChatID == items[start].ChatID {
+				end++
+			}
+			if s.send(ctx, items[start:end]) {
+				delivered += end - start
+			}
+			start = end
+		}
+		return nil
+	})
+	return delivered, err
+}
+
+// send delivers one chat's digest and forgets its items. Items of a digest
+// that could not be sent stay held and are retried on the next run. Through
+// the outbox, the digest is queued and its items deleted in one transaction,
+// so a failure cannot send it twice.
+func (s *DigestServiceImpl) send(ctx context.Context, items []repository.DigestItem) bool {
+	chatID := items[0].ChatID
+	ids := make([]int, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+
+	if s.Outbox != nil {
+		err := s.Outbox.EnqueueWith(ctx, chatID, func(tx *sql.Tx) error { return s.DigestRepo.DeleteIn(ctx, tx, ids...) }, digestText(items))
+		if err != nil {
+			slog.ErrorContext(ctx, "queuing digest", "service", "digest", "chat_id", chatID, "error", err)
+			return false
+		}
+		return true
+	}
+
+	if _, err := s.TelegramClient.SendMessage(ctx, chatID, digestText(items)); err != nil {
+		slog.ErrorContext(ctx, "sending digest", "service", "digest", "chat_id", chatID, "error", err)
+		return false
+	}
+	// The digest went out, so its items go even when the run is cancelled.
+	if err := s.DigestRepo.Delete(context.WithoutCancel(ctx), ids...); err != nil {
+		slog.ErrorContext(ctx, "clearing digest items", "service", "digest", "chat_id", chatID, "error", err)
+	}
+	return true
+}
+
+var digestHeadings = map[string]string{
+	SourceNews:      "📰 News",
+	SourceStock:     "📈 Stock",
+	SourceInstagram: "📸 Instagram",
+}
+
+// digestText puts the held notifications together, grouped by source in the
+// order each source first came up. Item texts are already rendered, so they
+// are joined as they are.
+func digestText(items []repository.DigestItem) string {
+	var sources []string
+	bySource := make(map[string][]string)
+	for _, item := range items {
+		if _, seen := bySource[item.Source]; !seen {
+			sources = append(sources, item.Source)
+		}
+		bySource[item.Source] = append(bySource[item.Source], item.Text)
+	}
+
+	var b strings.Builder
+	b.WriteString(external.NewMessage().Textf("🌙 While you were away (%d)", len(items)).String())
+	for _, source := range sources {
+		heading, ok := digestHeadings[source]
+		if !ok {
+			heading = source
+		}
+		b.WriteString("\n\n" + external.NewMessage().Bold(heading).String())
+		for _, text := range bySource[source] {
+			b.WriteString("\n\n" + text)
+		}
+	}
+	return b.String()
+}
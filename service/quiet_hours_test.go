@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"seanmcapp/util"
+)
+
+func jakartaTime(day, hour, minute int) time.Time {
+	return time.Date(2026, time.March, day, hour, minute, 0, 0, jakarta)
+}
+
+func TestQuietUntil(t *testing.T) {
+	overnight := util.QuietHours{Start: 22 * 60, End: 7 * 60}
+	afternoon := util.QuietHours{Start: 13 * 60, End: 15 * 60}
+
+	tests := []struct {
+		name  string
+		hours util.QuietHours
+		now   time.Time
+		quiet bool
+		until time.Time
+	}{
+		{"before overnight window", overnight, jakartaTime(10, 21, 59), false, time.Time{}},
+		{"late evening", overnight, jakartaTime(10, 23, 30), true, jakartaTime(11, 7, 0)},
+		{"early morning", overnight, jakartaTime(11, 3, 0), true, jakartaTime(11, 7, 0)},
+		{"window just ended", overnight, jakartaTime(11, 7, 0), false, time.Time{}},
+		{"within same-day window", afternoon, jakartaTime(10, 14, 0), true, jakartaTime(10, 15, 0)},
+		{"after same-day window", afternoon, jakartaTime(10, 15, 1), false, time.Time{}},
+		{"off", util.QuietHours{}, jakartaTime(10, 0, 0), false, time.Time{}},
+		{"other timezone", overnight, jakartaTime(10, 23, 0).UTC(), true, jakartaTime(11, 7, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := quietUntil(tt.hours, tt.now)
+			assert.Equal(t, tt.quiet, quiet)
+			assert.True(t, tt.until.Equal(until), "until = %v, want %v", until, tt.until)
+		})
+	}
+}
+
+func TestQuietHoursNotifier(t *testing.T) {
+	defer func() { nowFn = time.Now }()
+	nowFn = func() time.Time { return jakartaTime(10, 23, 0) }
+
+	newNotifier := func() (*QuietHoursNotifier, *fakeNotifier, *fakeDigestRepo) {
+		next, repo := &fakeNotifier{}, &fakeDigestRepo{}
+		return &QuietHoursNotifier{
+			Next:       next,
+			ChatID:     42,
+			DigestRepo: repo,
+			Hours:      util.QuietHours{Start: 22 * 60, End: 7 * 60},
+			BySource:   map[string]util.QuietHours{SourceStock: {}},
+		}, next, repo
+	}
+
+	t.Run("held during quiet hours", func(t *testing.T) {
+		n, next, repo := newNotifier()
+		require.NoError(t, n.Notify(t.Context(), external.Notification{Source: SourceInstagram, Body: external.NewMessage().Text("new post!")}))
+
+		assert.Empty(t, next.notes)
+		require.Len(t, repo.held, 1)
+		assert.Equal(t, repository.DigestItem{ChatID: 42, Source: SourceInstagram, Text: `new post\!`, ReleaseAt: repo.held[0].ReleaseAt}, repo.held[0])
+		assert.True(t, jakartaTime(11, 7, 0).Equal(repo.held[0].ReleaseAt))
+	})
+
+	t.Run("urgent bypasses quiet hours", func(t *testing.T) {
+		n, next, repo := newNotifier()
+		require.NoError(t, n.Notify(t.Context(), external.Notification{Source: SourceInstagram, Body: external.NewMessage().Text("session expired"), Urgent: true}))
+
+		assert.Len(t, next.notes, 1)
+		assert.Empty(t, repo.held)
+	})
+
+	t.Run("source override", func(t *testing.T) {
+		n, next, repo := newNotifier()
+		require.NoError(t, n.Notify(t.Context(), external.Notification{Source: SourceStock, Body: external.NewMessage().Text("BBCA")}))
+
+		assert.Len(t, next.notes, 1, "stock has quiet hours turned off")
+		assert.Empty(t, repo.held)
+	})
+
+	t.Run("outside quiet hours", func(t *testing.T) {
+		nowFn = func() time.Time { return jakartaTime(10, 12, 0) }
+		n, next, repo := newNotifier()
+		require.NoError(t, n.Notify(t.Context(), external.Notification{Source: SourceNews, Body: external.NewMessage().Text("news")}))
+
+		assert.Len(t, next.notes, 1)
+		assert.Empty(t, repo.held)
+	})
+}
+
+func TestDigestRunSendsOneDigestPerChat(t *testing.T) {
+	repo := &fakeDigestRepo{due: []repository.DigestItem{
+		{ID: 1, ChatID: 7, Source: SourceInstagram, Text: "post a"},
+		{ID: 2, ChatID: 7, Source: SourceNews, Text: "headline"},
+		{ID: 3, ChatID: 7, Source: SourceInstagram, Text: "post b"},
+		{ID: 4, ChatID: 9, Source: SourceStock, Text: "BBCA"},
+	}}
+	tg := &fakeTelegramClient{}
+	svc := &DigestServiceImpl{DigestRepo: repo, TelegramClient: tg}
+
+	delivered, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 4, delivered)
+
+	require.Len(t, tg.messages, 2)
+	assert.Equal(t, int64(7), tg.messages[0].chatID)
+	assert.Equal(t, "🌙 While you were away \\(3\\)\n\n*📸 Instagram*\n\npost a\n\npost b\n\n*📰 News*\n\nheadline", tg.messages[0].text)
+	assert.Equal(t, int64(9), tg.messages[1].chatID)
+	assert.Equal(t, "🌙 While you were away \\(1\\)\n\n*📈 Stock*\n\nBBCA", tg.messages[1].text)
+	assert.Equal(t, []int{1, 2, 3, 4}, repo.deleted)
+}
+
+func TestDigestRunKeepsItemsWhenSendFails(t *testing.T) {
+	repo := &fakeDigestRepo{due: []repository.DigestItem{{ID: 1, ChatID: 7, Source: SourceNews, Text: "headline"}}}
+	svc := &DigestServiceImpl{DigestRepo: repo, TelegramClient: &fakeTelegramClient{err: errors.New("timeout")}}
+
+	delivered, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+
+	assert.Empty(t, repo.deleted)
+}
+
+func TestDigestRunQueuesThroughOutbox(t *testing.T) {
+	repo := &fakeDigestRepo{due: []repository.DigestItem{{ID: 5, ChatID: 7, Source: SourceNews, Text: "headline"}}}
+	outbox := &fakeOutboxRepo{}
+	tg := &fakeTelegramClient{}
+	svc := &DigestServiceImpl{DigestRepo: repo, TelegramClient: tg, Outbox: &OutboxServiceImpl{OutboxRepo: outbox}}
+
+	delivered, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	assert.Empty(t, tg.messages)
+	require.Len(t, outbox.enqueued, 1)
+	assert.Equal(t, int64(7), outbox.enqueued[0].ChatID)
+	assert.Equal(t, []int{5}, repo.deleted)
+
+	t.Run("items are kept when the digest cannot be queued", func(t *testing.T) {
+		repo := &fakeDigestRepo{due: []repository.DigestItem{{ID: 5, ChatID: 7, Source: SourceNews, Text: "headline"}}}
+		svc := &DigestServiceImpl{DigestRepo: repo, TelegramClient: tg, Outbox: &OutboxServiceImpl{OutboxRepo: &fakeOutboxRepo{err: errors.New("db down")}}}
+
+		delivered, err := svc.Run(t.Context())
+		require.NoError(t, err)
+		assert.Zero(t, delivered)
+		assert.Empty(t, repo.deleted)
+	})
+}
@@ -1,44 +1,54 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"seanmcapp/external"
 	"seanmcapp/repository"
 	"strings"
 )
 
 type StockService interface {
-	Run()
-	RefreshPrices() ([]DashboardStock, error)
+	Run(ctx context.Context) (int, error)
+	RefreshPrices(ctx context.Context) ([]DashboardStock, error)
 
-	GetAll() ([]DashboardStock, error)
-	Create(stock DashboardStock) (string, error)
-	Update(stock DashboardStock) (string, error)
-	Delete(name string) (string, error)
+	GetAll(ctx context.Context) ([]DashboardStock, error)
+	Create(ctx context.Context, stock DashboardStock) (string, error)
+	Update(ctx context.Context, stock DashboardStock) (string, error)
+	Delete(ctx context.Context, name string) (string, error)
 }
 
 type StockServiceImpl struct {
 	StockRepo      repository.StockRepo
 	StockClient    external.StockClient
 	TelegramClient external.TelegramClient
+	Notifier       external.Notifier // nil sends straight to PersonalChatID
 	PersonalChatID int64
 	guard          runGuard
 }
 
-func (s *StockServiceImpl) Run() {
-	stocks, err := s.GetAll()
+// TryStart takes the job's guard for a run started later under the
+// returned context, or reports false while a run is in progress.
+func (s *StockServiceImpl) TryStart(ctx context.Context) (context.Context, func(), bool) {
+	return s.guard.tryStart(ctx)
+}
+
+// Run refreshes every price, alerts on the stocks that hit their price and
+// returns how many stocks were checked.
+func (s *StockServiceImpl) Run(ctx context.Context) (int, error) {
+	stocks, err := s.GetAll(ctx)
 	if err != nil {
-		log.Printf("[ERROR] cannot retrieve data from DB: %v\n", err)
-		return
+		return 0, fmt.Errorf("cannot retrieve data from DB: %w", err)
 	}
 
-	s.fetchAndUpdatePrices(stocks)
-	stocks, err = s.GetAll()
+	if err := s.fetchAndUpdatePrices(ctx, stocks); err != nil {
+		return 0, fmt.Errorf("refreshing prices: %w", err)
+	}
+	stocks, err = s.GetAll(ctx)
 	if err != nil {
-		log.Printf("[ERROR] cannot retrieve refreshed data from DB: %v\n", err)
-		return
+		return 0, fmt.Errorf("cannot retrieve refreshed data from DB: %w", err)
 	}
 
 	var result []string
@@ -59,21 +69,27 @@ func (s *StockServiceImpl) Run() {
 	}
 
 	if len(result) > 0 {
-		log.Println("[INFO] stocks hit/reach")
-		finalResult := strings.Join(result, "\n")
-		_, err := s.TelegramClient.SendMessage(s.PersonalChatID, finalResult)
-		if err != nil {
-			log.Printf("[ERROR] cannot send message for the final result: %v\n", err)
+		slog.InfoContext(ctx, "stocks hit their price", "service", SourceStock, "alerts", len(result))
+		note := external.Notification{Source: SourceStock, Title: "Stock alert", Body: external.NewMessage().Text(strings.Join(result, "\n"))}
+		if err := notify(ctx, s.Notifier, s.TelegramClient, s.PersonalChatID, note); err != nil {
+			return len(stocks), fmt.Errorf("cannot send message for the final result: %w", err)
 		}
 	}
+	return len(stocks), nil
 }
 
-func (s *StockServiceImpl) fetchAndUpdatePrices(stocks []DashboardStock) {
-	s.guard.run("stock refresh", func() {
+// fetchAndUpdatePrices refreshes what it can; prices that cannot be fetched or
+// saved are logged and left as they were. It stops early once ctx is done,
+// and returns ErrAlreadyRunning without fetching while another refresh is going.
+func (s *StockServiceImpl) fetchAndUpdatePrices(ctx context.Context, stocks []DashboardStock) error {
+	return s.guard.run(ctx, "stock refresh", func() error {
 		for _, stock := range stocks {
-			currentPrice, err := s.StockClient.GetPrice(stock.Name)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			currentPrice, err := s.StockClient.GetPrice(ctx, stock.Name)
 			if err != nil {
-				log.Printf("[ERROR] %v\n", err)
+				slog.ErrorContext(ctx, "cannot fetch price", "service", SourceStock, "ticker", stock.Name, "error", err)
 				continue
 			}
 
@@ -86,30 +102,35 @@ func (s *StockServiceImpl) fetchAndUpdatePrices(stocks []DashboardStock) {
 				BuyPrice:     stock.BuyPrice,
 				Lot:          stock.Lot,
 			}
-			if _, err := s.StockRepo.Update(updatedStock); err != nil {
-				log.Printf("[ERROR] cannot update stock: %v\n", err)
+			if _, err := s.StockRepo.Update(ctx, updatedStock); err != nil {
+				slog.ErrorContext(ctx, "cannot update stock", "service", SourceStock, "ticker", stock.Name, "error", err)
 				continue
 			}
 		}
+		return nil
 	})
 }
 
-func (s *StockServiceImpl) RefreshPrices() ([]DashboardStock, error) {
-	stocks, err := s.GetAll()
+func (s *StockServiceImpl) RefreshPrices(ctx context.Context) ([]DashboardStock, error) {
+	stocks, err := s.GetAll(ctx)
 	if err != nil {
-		log.Printf("[ERROR] cannot retrieve data from DB: %v\n", err)
+		slog.ErrorContext(ctx, "cannot retrieve stocks", "service", SourceStock, "error", err)
 		return nil, err
 	}
 
-	s.fetchAndUpdatePrices(stocks)
+	// A refresh already going is not repeated; what it has saved so far is
+	// returned.
+	if err := s.fetchAndUpdatePrices(ctx, stocks); err != nil && !errors.Is(err, ErrAlreadyRunning) {
+		return nil, err
+	}
 
-	return s.GetAll()
+	return s.GetAll(ctx)
 }
 
-func (s *StockServiceImpl) GetAll() ([]DashboardStock, error) {
-	stocks, err := s.StockRepo.GetAll()
+func (s *StockServiceImpl) GetAll(ctx context.Context) ([]DashboardStock, error) {
+	stocks, err := s.StockRepo.GetAll(ctx)
 	if err != nil {
-		log.Printf("[ERROR] cannot retrieve stocks: %v\n", err)
+		slog.ErrorContext(ctx, "cannot retrieve stocks", "service", SourceStock, "error", err)
 		return nil, err
 	}
 	var dashboardStocks []DashboardStock
@@ -119,34 +140,34 @@ func (s *StockServiceImpl) GetAll() ([]DashboardStock, error) {
 	return dashboardStocks, nil
 }
 
-func (s *StockServiceImpl) Create(stock DashboardStock) (string, error) {
+func (s *StockServiceImpl) Create(ctx context.Context, stock DashboardStock) (string, error) {
 	if stock.BestPrice <= 0 || stock.FairPrice <= 0 {
 		return "", ValidationError{Message: "best_price and fair_price are required and must be > 0"}
 	}
 	st := repository.Stock(stock)
-	name, err := s.StockRepo.Create(st)
+	name, err := s.StockRepo.Create(ctx, st)
 	if err != nil {
-		log.Printf("[ERROR] cannot create stock: %v\n", err)
+		slog.ErrorContext(ctx, "cannot create stock", "service", SourceStock, "ticker", stock.Name, "error", err)
 	}
 	return name, err
 }
 
-func (s *StockServiceImpl) Update(stock DashboardStock) (string, error) {
+func (s *StockServiceImpl) Update(ctx context.Context, stock DashboardStock) (string, error) {
 	if stock.BestPrice <= 0 || stock.FairPrice <= 0 {
 		return "", ValidationError{Message: "best_price and fair_price are required and must be > 0"}
 	}
 	st := repository.Stock(stock)
-	name, err := s.StockRepo.Update(st)
+	name, err := s.StockRepo.Update(ctx, st)
 	if err != nil && !errors.Is(err, repository.ErrNotFound) {
-		log.Printf("[ERROR] cannot update stock: %v\n", err)
+		slog.ErrorContext(ctx, "cannot update stock", "service", SourceStock, "ticker", stock.Name, "error", err)
 	}
 	return name, err
 }
 
-func (s *StockServiceImpl) Delete(name string) (string, error) {
-	deletedName, err := s.StockRepo.Delete(name)
+func (s *StockServiceImpl) Delete(ctx context.Context, name string) (string, error) {
+	deletedName, err := s.StockRepo.Delete(ctx, name)
 	if err != nil && !errors.Is(err, repository.ErrNotFound) {
-		log.Printf("[ERROR] cannot delete stock: %v\n", err)
+		slog.ErrorContext(ctx, "cannot delete stock", "service", SourceStock, "ticker", name, "error", err)
 	}
 	return deletedName, err
 }
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"seanmcapp/external"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RegisterStockCommands exposes the watchlist through the bot so prices can be
+// checked without logging into the web UI.
+func RegisterStockCommands(bot BotService, stocks StockService) {
+	bot.Register("stock", "show the watchlist and portfolio, or one ticker with /stock BBCA", stockCommand(stocks))
+	bot.Register("refresh", "fetch the latest prices and show what changed", refreshCommand(stocks))
+}
+
+func stockCommand(stocks StockService) BotHandler {
+	return func(ctx context.Context, cmd BotCommand) (BotReply, error) {
+		all, err := stocks.GetAll(ctx)
+		if err != nil {
+			return BotReply{}, err
+		}
+
+		if len(cmd.Args) == 0 {
+			return BotReply{Text: formatStockTable(all)}, nil
+		}
+
+		name := strings.ToUpper(cmd.Args[0])
+		for _, st := range all {
+			if strings.EqualFold(st.Name, name) {
+				return BotReply{Text: formatStockDetail(st)}, nil
+			}
+		}
+		return BotReply{}, ValidationError{Message: fmt.Sprintf("%s is not in the watchlist", name)}
+	}
+}
+
+func refreshCommand(stocks StockService) BotHandler {
+	return func(ctx context.Context, _ BotCommand) (BotReply, error) {
+		before, err := stocks.GetAll(ctx)
+		if err != nil {
+			return BotReply{}, err
+		}
+		after, err := stocks.RefreshPrices(ctx)
+		if err != nil {
+			return BotReply{}, err
+		}
+		return BotReply{Text: formatPriceChanges(before, after)}, nil
+	}
+}
+
+// formatStockTable renders the watchlist as a fixed-width table inside a code
+// block, so Telegram keeps the alignment.
+// Wishlist rows show the distance to the best price, portfolio rows the
+// distance to the fair price.
+func formatStockTable(stocks []DashboardStock) string {
+	if len(stocks) == 0 {
+		return external.NewMessage().Text("The watchlist is empty.").String()
+	}
+
+	var wishlist, portfolio strings.Builder
+	for _, st := range sortedStocks(stocks) {
+		section, target := &wishlist, st.BestPrice
+		if st.Status {
+			section, target = &portfolio, st.FairPrice
+		}
+		section.WriteString(stockRow(st.Name, formatPrice(st.CurrentPrice), strconv.FormatInt(st.BestPrice, 10), strconv.FormatInt(st.FairPrice, 10), formatDistance(st.CurrentPrice, target)))
+	}
+
+	var sections []string
+	if wishlist.Len() > 0 {
+		sections = append(sections, "Wishlist (Δ to best)\n"+stockRow("Name", "Now", "Best", "Fair", "Δ%")+wishlist.String())
+	}
+	if portfolio.Len() > 0 {
+		sections = append(sections, "Portfolio (Δ to fair)\n"+stockRow("Name", "Now", "Best", "Fair", "Δ%")+portfolio.String())
+	}
+	return external.NewMessage().Pre(strings.Join(sections, "\n")).String()
+}
+
+func formatStockDetail(st DashboardStock) string {
+	status := "wishlist"
+	if st.Status {
+		status = "portfolio"
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s (%s)", st.Name, status),
+		fmt.Sprintf("Now  %8s", formatPrice(st.CurrentPrice)),
+		fmt.Sprintf("Best %8d %7s", st.BestPrice, formatDistance(st.CurrentPrice, st.BestPrice)),
+		fmt.Sprintf("Fair %8d %7s", st.FairPrice, formatDistance(st.CurrentPrice, st.FairPrice)),
+	}
+	if st.BuyPrice != nil {
+		line := fmt.Sprintf("Buy  %8d %7s", *st.BuyPrice, formatDistance(st.CurrentPrice, *st.BuyPrice))
+		if st.Lot != nil {
+			line += fmt.Sprintf(" x%d lot", *st.Lot)
+		}
+		lines = append(lines, line)
+	}
+	return external.NewMessage().Pre(strings.Join(lines, "\n")).String()
+}
+
+func formatPriceChanges(before, after []DashboardStock) string {
+	previous := make(map[string]*int64, len(before))
+	for _, st := range before {
+		previous[st.Name] = st.CurrentPrice
+	}
+
+	var b strings.Builder
+	for _, st := range sortedStocks(after) {
+		old := previous[st.Name]
+		if st.CurrentPrice == nil || (old != nil && *old == *st.CurrentPrice) {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString(changeRow("Name", "Was", "Now", "Δ%"))
+		}
+		b.WriteString(changeRow(st.Name, formatPrice(old), formatPrice(st.CurrentPrice), formatChange(old, *st.CurrentPrice)))
+	}
+
+	if b.Len() == 0 {
+		return external.NewMessage().Text("Prices refreshed, nothing changed.").String()
+	}
+	return external.NewMessage().Text("Prices refreshed:\n").Pre(b.String()).String()
+}
+
+func stockRow(name, now, best, fair, distance string) string {
+	return fmt.Sprintf("%-5s %6s %6s %6s %6s\n", name, now, best, fair, distance)
+}
+
+func changeRow(name, was, now, change string) string {
+	return fmt.Sprintf("%-5s %6s %6s %6s\n", name, was, now, change)
+}
+
+func sortedStocks(stocks []DashboardStock) []DashboardStock {
+	sorted := append([]DashboardStock(nil), stocks...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+func formatPrice(price *int64) string {
+	if price == nil {
+		return "-"
+	}
+	return strconv.FormatInt(*price, 10)
+}
+
+// formatDistance is how far the current price sits above (+) or below (-) target.
+func formatDistance(current *int64, target int64) string {
+	if current == nil || target == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f", float64(*current-target)/float64(target)*100)
+}
+
+func formatChange(old *int64, current int64) string {
+	if old == nil {
+		return "new"
+	}
+	return formatDistance(&current, *old)
+}
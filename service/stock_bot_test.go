@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"seanmcapp/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stockBotFixture() []repository.Stock {
+	return []repository.Stock{
+		{Name: "TLKM", BestPrice: 3000, FairPrice: 4000, Status: true, CurrentPrice: ptr[int64](4200), BuyPrice: ptr[int64](3100), Lot: ptr[int64](10)},
+		{Name: "BBCA", BestPrice: 8000, FairPrice: 10000, Status: false, CurrentPrice: ptr[int64](9200)},
+		{Name: "GOTO", BestPrice: 50, FairPrice: 80, Status: false},
+	}
+}
+
+func TestStockCommandTable(t *testing.T) {
+	repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) { return stockBotFixture(), nil }}
+	reply, err := stockCommand(&StockServiceImpl{StockRepo: repo})(t.Context(), BotCommand{Name: "stock"})
+	require.NoError(t, err)
+
+	want := "```\n" +
+		"Wishlist (Δ to best)\n" +
+		"Name     Now   Best   Fair     Δ%\n" +
+		"BBCA    9200   8000  10000  +15.0\n" +
+		"GOTO       -     50     80      -\n" +
+		"\n" +
+		"Portfolio (Δ to fair)\n" +
+		"Name     Now   Best   Fair     Δ%\n" +
+		"TLKM    4200   3000   4000   +5.0\n" +
+		"```"
+	assert.Equal(t, want, reply.Text)
+}
+
+func TestStockCommandSingleTicker(t *testing.T) {
+	repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) { return stockBotFixture(), nil }}
+	handler := stockCommand(&StockServiceImpl{StockRepo: repo})
+
+	reply, err := handler(t.Context(), BotCommand{Name: "stock", Args: []string{"tlkm"}})
+	require.NoError(t, err)
+	assert.Equal(t, "```\n"+
+		"TLKM (portfolio)\n"+
+		"Now      4200\n"+
+		"Best     3000   +40.0\n"+
+		"Fair     4000    +5.0\n"+
+		"Buy      3100   +35.5 x10 lot\n"+
+		"```", reply.Text)
+
+	_, err = handler(t.Context(), BotCommand{Name: "stock", Args: []string{"XXXX"}})
+	assert.ErrorAs(t, err, &ValidationError{})
+}
+
+func TestStockCommandEmptyAndError(t *testing.T) {
+	repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) { return nil, nil }}
+	reply, err := stockCommand(&StockServiceImpl{StockRepo: repo})(t.Context(), BotCommand{})
+	require.NoError(t, err)
+	assert.Equal(t, "The watchlist is empty\\.", reply.Text)
+
+	repo.getAllFn = func() ([]repository.Stock, error) { return nil, errors.New("db down") }
+	_, err = stockCommand(&StockServiceImpl{StockRepo: repo})(t.Context(), BotCommand{})
+	assert.Error(t, err)
+}
+
+func TestRefreshCommand(t *testing.T) {
+	current := stockBotFixture()
+	repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) {
+		return append([]repository.Stock(nil), current...), nil
+	}}
+	repo.updateFn = func(s repository.Stock) (string, error) {
+		for i := range current {
+			if current[i].Name == s.Name {
+				current[i] = s
+			}
+		}
+		return s.Name, nil
+	}
+	client := &fakeStockClient{prices: map[string]int64{"TLKM": 4200, "BBCA": 9000, "GOTO": 60}}
+	svc := &StockServiceImpl{StockRepo: repo, StockClient: client}
+
+	reply, err := refreshCommand(svc)(t.Context(), BotCommand{Name: "refresh"})
+	require.NoError(t, err)
+	assert.Equal(t, "Prices refreshed:\n```\n"+
+		"Name     Was    Now     Δ%\n"+
+		"BBCA    9200   9000   -2.2\n"+
+		"GOTO       -     60    new\n"+
+		"```", reply.Text)
+
+	reply, err = refreshCommand(svc)(t.Context(), BotCommand{Name: "refresh"})
+	require.NoError(t, err)
+	assert.Equal(t, "Prices refreshed, nothing changed\\.", reply.Text)
+}
+
+func TestRegisterStockCommands(t *testing.T) {
+	tg := &fakeTelegramClient{}
+	bot := NewBotService(tg, "seanmcbot")
+	RegisterStockCommands(bot, &StockServiceImpl{})
+
+	assert.Contains(t, bot.commands, "stock")
+	assert.Contains(t, bot.commands, "refresh")
+}
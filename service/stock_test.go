@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"seanmcapp/repository"
 	"testing"
@@ -17,7 +18,7 @@ func TestStockGetAll(t *testing.T) {
 	}}
 	svc := &StockServiceImpl{StockRepo: repo}
 
-	got, err := svc.GetAll()
+	got, err := svc.GetAll(t.Context())
 	require.NoError(t, err)
 	require.Len(t, got, 1)
 	assert.Equal(t, "BBCA", got[0].Name)
@@ -25,7 +26,7 @@ func TestStockGetAll(t *testing.T) {
 
 	// error passthrough
 	repo.getAllFn = func() ([]repository.Stock, error) { return nil, errors.New("db down") }
-	_, err = svc.GetAll()
+	_, err = svc.GetAll(t.Context())
 	assert.Error(t, err)
 }
 
@@ -34,13 +35,13 @@ func TestStockCreateValidation(t *testing.T) {
 		createFn: func(s repository.Stock) (string, error) { return s.Name, nil },
 	}}
 
-	_, err := svc.Create(DashboardStock{Name: "X", BestPrice: 0, FairPrice: 10})
+	_, err := svc.Create(t.Context(), DashboardStock{Name: "X", BestPrice: 0, FairPrice: 10})
 	assert.ErrorAs(t, err, &ValidationError{})
 
-	_, err = svc.Create(DashboardStock{Name: "X", BestPrice: 10, FairPrice: 0})
+	_, err = svc.Create(t.Context(), DashboardStock{Name: "X", BestPrice: 10, FairPrice: 0})
 	assert.ErrorAs(t, err, &ValidationError{})
 
-	name, err := svc.Create(DashboardStock{Name: "BBCA", BestPrice: 100, FairPrice: 200})
+	name, err := svc.Create(t.Context(), DashboardStock{Name: "BBCA", BestPrice: 100, FairPrice: 200})
 	require.NoError(t, err)
 	assert.Equal(t, "BBCA", name)
 }
@@ -48,7 +49,7 @@ func TestStockCreateValidation(t *testing.T) {
 func TestStockUpdateAndDelete(t *testing.T) {
 	t.Run("update validation", func(t *testing.T) {
 		svc := &StockServiceImpl{StockRepo: &fakeStockRepo{}}
-		_, err := svc.Update(DashboardStock{Name: "X", BestPrice: -1, FairPrice: 10})
+		_, err := svc.Update(t.Context(), DashboardStock{Name: "X", BestPrice: -1, FairPrice: 10})
 		assert.ErrorAs(t, err, &ValidationError{})
 	})
 
@@ -56,7 +57,7 @@ func TestStockUpdateAndDelete(t *testing.T) {
 		svc := &StockServiceImpl{StockRepo: &fakeStockRepo{
 			updateFn: func(repository.Stock) (string, error) { return "", repository.ErrNotFound },
 		}}
-		_, err := svc.Update(DashboardStock{Name: "X", BestPrice: 1, FairPrice: 1})
+		_, err := svc.Update(t.Context(), DashboardStock{Name: "X", BestPrice: 1, FairPrice: 1})
 		assert.ErrorIs(t, err, repository.ErrNotFound)
 	})
 
@@ -64,7 +65,7 @@ func TestStockUpdateAndDelete(t *testing.T) {
 		svc := &StockServiceImpl{StockRepo: &fakeStockRepo{
 			deleteFn: func(name string) (string, error) { return name, nil },
 		}}
-		name, err := svc.Delete("BBCA")
+		name, err := svc.Delete(t.Context(), "BBCA")
 		require.NoError(t, err)
 		assert.Equal(t, "BBCA", name)
 	})
@@ -79,7 +80,7 @@ func TestStockRefreshPrices(t *testing.T) {
 	client := &fakeStockClient{prices: map[string]int64{"BBCA": 155, "TLKM": 320}}
 	svc := &StockServiceImpl{StockRepo: repo, StockClient: client}
 
-	got, err := svc.RefreshPrices()
+	got, err := svc.RefreshPrices(t.Context())
 	require.NoError(t, err)
 	assert.Len(t, got, 2)
 
@@ -103,13 +104,34 @@ func TestStockRunAlerts(t *testing.T) {
 	tg := &fakeTelegramClient{}
 	svc := &StockServiceImpl{StockRepo: repo, StockClient: client, TelegramClient: tg, PersonalChatID: 99}
 
-	svc.Run()
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 3, checked)
 
 	require.Len(t, tg.messages, 1)
 	assert.Equal(t, int64(99), tg.messages[0].chatID)
 	assert.Equal(t, "BBCA hitting best price\nTLKM reaching fair price", tg.messages[0].text)
 }
 
+func TestStockRunQueuesAlertsInOutbox(t *testing.T) {
+	stocks := []repository.Stock{
+		{Name: "BBCA", BestPrice: 100, FairPrice: 200, Status: false, CurrentPrice: ptr[int64](90)},
+	}
+	repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) { return stocks, nil }}
+	client := &fakeStockClient{prices: map[string]int64{"BBCA": 90}}
+	tg := &fakeTelegramClient{}
+	outbox := &fakeOutboxRepo{}
+	svc := &StockServiceImpl{StockRepo: repo, StockClient: client, TelegramClient: tg, PersonalChatID: 99}
+	svc.Notifier = &TelegramNotifier{Outbox: &OutboxServiceImpl{OutboxRepo: outbox}, TelegramClient: tg, ChatID: 99}
+
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
+
+	assert.Empty(t, tg.messages, "alerts go through the outbox, not straight to Telegram")
+	assert.Equal(t, []repository.OutboxMessage{{ChatID: 99, Text: "BBCA hitting best price"}}, outbox.enqueued)
+}
+
 func TestStockRunNoAlerts(t *testing.T) {
 	stocks := []repository.Stock{
 		{Name: "BBCA", BestPrice: 100, FairPrice: 200, Status: false, CurrentPrice: ptr[int64](150)},
@@ -119,7 +141,9 @@ func TestStockRunNoAlerts(t *testing.T) {
 	tg := &fakeTelegramClient{}
 	svc := &StockServiceImpl{StockRepo: repo, StockClient: client, TelegramClient: tg}
 
-	svc.Run()
+	checked, err := svc.Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, checked)
 	assert.Empty(t, tg.messages)
 }
 
@@ -127,7 +151,7 @@ func TestStockRefreshPricesErrors(t *testing.T) {
 	t.Run("GetAll error propagates", func(t *testing.T) {
 		repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) { return nil, errors.New("db") }}
 		svc := &StockServiceImpl{StockRepo: repo, StockClient: &fakeStockClient{}}
-		_, err := svc.RefreshPrices()
+		_, err := svc.RefreshPrices(t.Context())
 		assert.Error(t, err)
 	})
 
@@ -137,7 +161,7 @@ func TestStockRefreshPricesErrors(t *testing.T) {
 		client := &fakeStockClient{err: errors.New("fetch failed")}
 		svc := &StockServiceImpl{StockRepo: repo, StockClient: client}
 
-		got, err := svc.RefreshPrices()
+		got, err := svc.RefreshPrices(t.Context())
 		require.NoError(t, err)
 		assert.Len(t, got, 1)
 		assert.Empty(t, repo.updated) // update skipped because price fetch failed
@@ -149,7 +173,44 @@ func TestStockRunGetAllError(t *testing.T) {
 	tg := &fakeTelegramClient{}
 	svc := &StockServiceImpl{StockRepo: repo, StockClient: &fakeStockClient{}, TelegramClient: tg}
 
-	svc.Run() // should return early without panicking
+	checked, err := svc.Run(t.Context())
+	assert.Error(t, err)
+	assert.Equal(t, 0, checked)
+	assert.Empty(t, tg.messages)
+}
+
+
+func TestStockRunCancelled(t *testing.T) {
+	repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) {
+		return []repository.Stock{{Name: "BBCA", BestPrice: 1000, FairPrice: 2000}}, nil
+	}}
+	client := &fakeStockClient{prices: map[string]int64{"BBCA": 500}}
+	tg := &fakeTelegramClient{}
+	svc := &StockServiceImpl{StockRepo: repo, StockClient: client, TelegramClient: tg}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err := svc.Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, client.calls, "no prices are fetched once the job is cancelled")
 	assert.Empty(t, tg.messages)
 }
 
+func TestStockRunSkipsWhileRefreshIsGoing(t *testing.T) {
+	repo := &fakeStockRepo{getAllFn: func() ([]repository.Stock, error) {
+		return []repository.Stock{{Name: "BBCA", BestPrice: 1000, FairPrice: 2000, CurrentPrice: ptr[int64](500)}}, nil
+	}}
+	client := &fakeStockClient{prices: map[string]int64{"BBCA": 500}}
+	tg := &fakeTelegramClient{}
+	svc := &StockServiceImpl{StockRepo: repo, StockClient: client, TelegramClient: tg}
+	svc.guard.running.Store(true) // a refresh from the API or the bot
+
+	_, err := svc.Run(t.Context())
+	assert.ErrorIs(t, err, ErrAlreadyRunning)
+	assert.Empty(t, tg.messages, "no alerts on prices the other refresh is still updating")
+
+	got, err := svc.RefreshPrices(t.Context())
+	require.NoError(t, err, "a refresh on demand returns the prices saved so far")
+	assert.Len(t, got, 1)
+	assert.Empty(t, client.calls)
+}
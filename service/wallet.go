@@ -1,17 +1,19 @@
 package service
 
 import (
+	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"seanmcapp/repository"
 	"sort"
 )
 
 type WalletService interface {
-	Dashboard(date int) (*DashboardView, error)
-	Create(wallet DashboardWallet) (int, error)
-	Update(wallet DashboardWallet) (int, error)
-	Delete(id int) (int, error)
+	Dashboard(ctx context.Context, date int) (*DashboardView, error)
+	Create(ctx context.Context, wallet DashboardWallet) (int, error)
+	Update(ctx context.Context, wallet DashboardWallet) (int, error)
+	Delete(ctx context.Context, id int) (int, error)
+	Export(ctx context.Context) ([]DashboardWallet, error)
 }
 
 type WalletServiceImpl struct {
@@ -28,10 +30,10 @@ var expenseSet = func() map[string]struct{} {
 	return set
 }()
 
-func (s *WalletServiceImpl) Dashboard(date int) (*DashboardView, error) {
-	wallets, err := s.WalletRepo.GetAll()
+func (s *WalletServiceImpl) Dashboard(ctx context.Context, date int) (*DashboardView, error) {
+	wallets, err := s.WalletRepo.GetAll(ctx)
 	if err != nil {
-		log.Println("Failed to fetch wallet", err)
+		slog.ErrorContext(ctx, "failed to fetch wallets", "service", "wallet", "error", err)
 		return nil, err
 	}
 
@@ -53,9 +55,9 @@ func (s *WalletServiceImpl) Dashboard(date int) (*DashboardView, error) {
 		}
 	}
 
-	ytdAlloc, err := s.WalletRepo.GetAllocations()
+	ytdAlloc, err := s.WalletRepo.GetAllocations(ctx)
 	if err != nil {
-		log.Println("Failed to fetch allocations", err)
+		slog.ErrorContext(ctx, "failed to fetch allocations", "service", "wallet", "error", err)
 		return nil, err
 	}
 
@@ -134,32 +136,48 @@ func calculateTotalAmount(wallets []repository.Wallet, account string, date *int
 	return total
 }
 
-func (s *WalletServiceImpl) Create(wallet DashboardWallet) (int, error) {
+func (s *WalletServiceImpl) Create(ctx context.Context, wallet DashboardWallet) (int, error) {
 	w := repository.Wallet(wallet)
-	id, err := s.WalletRepo.Insert(w)
+	id, err := s.WalletRepo.Insert(ctx, w)
 	if err != nil {
-		log.Println("Failed to create wallet", err)
+		slog.ErrorContext(ctx, "failed to create wallet", "service", "wallet", "error", err)
 	}
 	return id, err
 }
 
-func (s *WalletServiceImpl) Update(wallet DashboardWallet) (int, error) {
+func (s *WalletServiceImpl) Update(ctx context.Context, wallet DashboardWallet) (int, error) {
 	w := repository.Wallet(wallet)
-	id, err := s.WalletRepo.Update(w)
+	id, err := s.WalletRepo.Update(ctx, w)
 	if err != nil && !errors.Is(err, repository.ErrNotFound) {
-		log.Println("Failed to update wallet", err)
+		slog.ErrorContext(ctx, "failed to update wallet", "service", "wallet", "wallet_id", wallet.ID, "error", err)
 	}
 	return id, err
 }
 
-func (s *WalletServiceImpl) Delete(id int) (int, error) {
-	deletedID, err := s.WalletRepo.Delete(id)
+func (s *WalletServiceImpl) Delete(ctx context.Context, id int) (int, error) {
+	deletedID, err := s.WalletRepo.Delete(ctx, id)
 	if err != nil && !errors.Is(err, repository.ErrNotFound) {
-		log.Println("Failed to delete wallet", err)
+		slog.ErrorContext(ctx, "failed to delete wallet", "service", "wallet", "wallet_id", id, "error", err)
 	}
 	return deletedID, err
 }
 
+// Export returns every wallet entry, oldest month first.
+func (s *WalletServiceImpl) Export(ctx context.Context) ([]DashboardWallet, error) {
+	wallets, err := s.WalletRepo.GetAll(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to fetch wallets", "service", "wallet", "error", err)
+		return nil, err
+	}
+
+	exported := make([]DashboardWallet, len(wallets))
+	for i, w := range wallets {
+		exported[i] = DashboardWallet(w)
+	}
+	sort.SliceStable(exported, func(i, j int) bool { return exported[i].Date < exported[j].Date })
+	return exported, nil
+}
+
 type DashboardView struct {
 	Chart       DashboardChart         `json:"chart"`
 	Allocations []DashboardAllocations `json:"allocations"`
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seanmcapp/external"
+	"seanmcapp/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const walletCallbackNamespace = "wallet"
+
+var nowFn = time.Now
+
+// accountCurrencies maps each wallet account to the currency it is kept in.
+var accountCurrencies = map[string]string{
+	"DBS": "SGD",
+	"BCA": "IDR",
+}
+
+const defaultWalletAccount = "DBS"
+
+// categoryAliases maps shorthand typed in the chat onto expenseCategories.
+var categoryAliases = map[string]string{
+	"food":      "Daily",
+	"lunch":     "Daily",
+	"dinner":    "Daily",
+	"breakfast": "Daily",
+	"grocery":   "Daily",
+	"transport": "Daily",
+	"it":        "IT Stuff",
+	"tech":      "IT Stuff",
+	"gadget":    "IT Stuff",
+	"clothes":   "Fashion",
+	"trip":      "Travel",
+	"flight":    "Travel",
+	"hotel":     "Travel",
+	"health":    "Wellness",
+	"gym":       "Wellness",
+	"invest":    "Funding",
+}
+
+// RegisterWalletCommands lets expenses be logged from the chat, with an undo
+// button on the confirmation.
+func RegisterWalletCommands(bot BotService, wallets WalletService) {
+	bot.Register("spend", "log an expense: /spend 45 Daily lunch [DBS|BCA] [SGD|IDR]", spendCommand(wallets))
+	bot.RegisterCallback(walletCallbackNamespace, walletCallback(wallets))
+}
+
+func spendCommand(wallets WalletService) BotHandler {
+	return func(ctx context.Context, cmd BotCommand) (BotReply, error) {
+		wallet, err := parseSpend(cmd.Args, nowFn().In(jakarta))
+		if err != nil {
+			return BotReply{}, err
+		}
+
+		id, err := wallets.Create(ctx, wallet)
+		if err != nil {
+			return BotReply{}, err
+		}
+
+		text := external.NewMessage().Textf("✅ Saved #%d %s - %s: %d %s (%s, %d)", id, wallet.Category, wallet.Name, wallet.Amount, wallet.Currency, wallet.Account, wallet.Date).String()
+		return BotReply{Text: text, Keyboard: undoKeyboard(id)}, nil
+	}
+}
+
+// undoKeyboard is the button under a /spend confirmation.
+func undoKeyboard(id int) *external.InlineKeyboardMarkup {
+	return &external.InlineKeyboardMarkup{InlineKeyboard: [][]external.InlineKeyboardButton{{
+		{Text: "↩️ Undo", CallbackData: fmt.Sprintf("%s:undo:%d", walletCallbackNamespace, id)},
+	}}}
+}
+
+// walletCallback handles the buttons under a /spend confirmation. Undo first
+// swaps in a confirm/cancel pair so a stray tap cannot delete the entry.
+func walletCallback(wallets WalletService) BotCallbackHandler {
+	return func(ctx context.Context, cb BotCallback) (BotReply, error) {
+		action, rawID, _ := strings.Cut(cb.Data, ":")
+		id, err := strconv.Atoi(rawID)
+		if err != nil {
+			return BotReply{}, fmt.Errorf("unknown wallet callback %q", cb.Data)
+		}
+
+		switch action {
+		case "undo":
+			keyboard := confirmKeyboard(walletCallbackNamespace, fmt.Sprintf("delete:%d", id), fmt.Sprintf("keep:%d", id))
+			return BotReply{Edit: true, Keyboard: keyboard, Toast: fmt.Sprintf("Remove #%d?", id)}, nil
+		case "keep":
+			return BotReply{Edit: true, Keyboard: undoKeyboard(id), Toast: "Kept"}, nil
+		case "delete":
+			if _, err := wallets.Delete(ctx, id); err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					return BotReply{Edit: true, Text: external.NewMessage().Textf("#%d was already removed.", id).String()}, nil
+				}
+				return BotReply{}, err
+			}
+			return BotReply{Edit: true, Text: external.NewMessage().Textf("↩️ Removed #%d", id).String(), Toast: "Removed"}, nil
+		}
+		return BotReply{}, fmt.Errorf("unknown wallet callback %q", cb.Data)
+	}
+}
+
+// parseSpend turns "45 Daily lunch at hawker DBS" into an expense dated in the
+// current month. Trailing account/currency tokens are optional: the account
+// defaults to DBS (or to the account kept in the given currency) and the
+// currency to the account's own.
+func parseSpend(args []string, now time.Time) (DashboardWallet, error) {
+	usage := ValidationError{Message: fmt.Sprintf("usage: /spend <amount> <category> [name] [DBS|BCA] [SGD|IDR]\ncategories: %s", strings.Join(expenseCategories, ", "))}
+	if len(args) < 2 {
+		return DashboardWallet{}, usage
+	}
+
+	amount, err := strconv.Atoi(args[0])
+	if err != nil || amount <= 0 {
+		return DashboardWallet{}, usage
+	}
+
+	category, ok := resolveCategory(args[1])
+	if !ok {
+		return DashboardWallet{}, ValidationError{Message: fmt.Sprintf("unknown category %q\ncategories: %s", args[1], strings.Join(expenseCategories, ", "))}
+	}
+
+	rest := args[2:]
+	var account, currency string
+	for len(rest) > 0 {
+		last := strings.ToUpper(rest[len(rest)-1])
+		if _, isAccount := accountCurrencies[last]; isAccount && account == "" {
+			account = last
+		} else if isCurrency(last) && currency == "" {
+			currency = last
+		} else {
+			break
+		}
+		rest = rest[:len(rest)-1]
+	}
+
+	switch {
+	case account == "" && currency == "":
+		account = defaultWalletAccount
+	case account == "":
+		account = accountForCurrency(currency)
+	}
+	if currency == "" {
+		currency = accountCurrencies[account]
+	}
+
+	name := strings.Join(rest, " ")
+	if name == "" {
+		name = category
+	}
+
+	return DashboardWallet{
+		Date:     now.Year()*100 + int(now.Month()),
+		Name:     name,
+		Category: category,
+		Currency: currency,
+		Amount:   -amount, // expenses are stored as negative amounts
+		Done:     true,
+		Account:  account,
+	}, nil
+}
+
+func resolveCategory(raw string) (string, bool) {
+	for _, c := range expenseCategories {
+		if strings.EqualFold(c, raw) {
+			return c, true
+		}
+	}
+	category, ok := categoryAliases[strings.ToLower(raw)]
+	return category, ok
+}
+
+func isCurrency(token string) bool {
+	for _, c := range accountCurrencies {
+		if c == token {
+			return true
+		}
+	}
+	return false
+}
+
+func accountForCurrency(currency string) string {
+	for account, c := range accountCurrencies {
+		if c == currency {
+			return account
+		}
+	}
+	return defaultWalletAccount
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"errors"
+	"seanmcapp/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpend(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		args []string
+		want DashboardWallet
+	}{
+		{
+			name: "defaults to DBS in SGD",
+			args: []string{"45", "Daily", "lunch"},
+			want: DashboardWallet{Date: 202603, Name: "lunch", Category: "Daily", Currency: "SGD", Amount: -45, Done: true, Account: "DBS"},
+		},
+		{
+			name: "explicit account picks its currency",
+			args: []string{"50000", "daily", "nasi", "padang", "bca"},
+			want: DashboardWallet{Date: 202603, Name: "nasi padang", Category: "Daily", Currency: "IDR", Amount: -50000, Done: true, Account: "BCA"},
+		},
+		{
+			name: "currency alone picks the account",
+			args: []string{"120", "it", "keyboard", "IDR"},
+			want: DashboardWallet{Date: 202603, Name: "keyboard", Category: "IT Stuff", Currency: "IDR", Amount: -120, Done: true, Account: "BCA"},
+		},
+		{
+			name: "alias and no name",
+			args: []string{"30", "gym", "DBS", "SGD"},
+			want: DashboardWallet{Date: 202603, Name: "Wellness", Category: "Wellness", Currency: "SGD", Amount: -30, Done: true, Account: "DBS"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSpend(tc.args, now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseSpendInvalid(t *testing.T) {
+	now := time.Now()
+	for _, args := range [][]string{
+		nil,
+		{"45"},
+		{"abc", "Daily"},
+		{"-5", "Daily"},
+		{"45", "Groceries?"},
+	} {
+		_, err := parseSpend(args, now)
+		assert.ErrorAs(t, err, &ValidationError{}, "args %v", args)
+	}
+}
+
+func TestSpendCommand(t *testing.T) {
+	defer func() { nowFn = time.Now }()
+	// 03:00 on 1 October in Jakarta, still September in UTC.
+	nowFn = func() time.Time { return time.Date(2026, time.September, 30, 20, 0, 0, 0, time.UTC) }
+
+	var inserted repository.Wallet
+	repo := &fakeWalletRepo{insertFn: func(w repository.Wallet) (int, error) {
+		inserted = w
+		return 123, nil
+	}}
+	reply, err := spendCommand(&WalletServiceImpl{WalletRepo: repo})(t.Context(), BotCommand{Name: "spend", Args: []string{"45", "Daily", "chicken_rice"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, 202610, inserted.Date)
+	assert.Equal(t, -45, inserted.Amount)
+	assert.Equal(t, "✅ Saved \\#123 Daily \\- chicken\\_rice: \\-45 SGD \\(DBS, 202610\\)", reply.Text)
+	require.NotNil(t, reply.Keyboard)
+	assert.Equal(t, "wallet:undo:123", reply.Keyboard.InlineKeyboard[0][0].CallbackData)
+
+	repo.insertFn = func(repository.Wallet) (int, error) { return -1, errors.New("db down") }
+	_, err = spendCommand(&WalletServiceImpl{WalletRepo: repo})(t.Context(), BotCommand{Name: "spend", Args: []string{"45", "Daily"}})
+	assert.Error(t, err)
+}
+
+func TestWalletUndoCallback(t *testing.T) {
+	var deleted []int
+	repo := &fakeWalletRepo{deleteFn: func(id int) (int, error) {
+		if id == 404 {
+			return -1, repository.ErrNotFound
+		}
+		deleted = append(deleted, id)
+		return id, nil
+	}}
+	handler := walletCallback(&WalletServiceImpl{WalletRepo: repo})
+
+	t.Run("undo asks for confirmation", func(t *testing.T) {
+		reply, err := handler(t.Context(), BotCallback{Namespace: "wallet", Data: "undo:123"})
+		require.NoError(t, err)
+		assert.True(t, reply.Edit)
+		assert.Empty(t, reply.Text, "only the buttons are swapped")
+		require.NotNil(t, reply.Keyboard)
+		row := reply.Keyboard.InlineKeyboard[0]
+		assert.Equal(t, "wallet:delete:123", row[0].CallbackData)
+		assert.Equal(t, "wallet:keep:123", row[1].CallbackData)
+		assert.Empty(t, deleted)
+	})
+
+	t.Run("keep brings the undo button back", func(t *testing.T) {
+		reply, err := handler(t.Context(), BotCallback{Namespace: "wallet", Data: "keep:123"})
+		require.NoError(t, err)
+		assert.True(t, reply.Edit)
+		assert.Equal(t, "Kept", reply.Toast)
+		assert.Empty(t, reply.Text, "only the buttons are swapped")
+		require.NotNil(t, reply.Keyboard)
+		assert.Equal(t, "wallet:undo:123", reply.Keyboard.InlineKeyboard[0][0].CallbackData)
+		assert.Empty(t, deleted)
+	})
+
+	t.Run("confirmed delete", func(t *testing.T) {
+		reply, err := handler(t.Context(), BotCallback{Namespace: "wallet", Data: "delete:123"})
+		require.NoError(t, err)
+		assert.Equal(t, BotReply{Edit: true, Text: "↩️ Removed \\#123", Toast: "Removed"}, reply)
+		assert.Equal(t, []int{123}, deleted)
+	})
+
+	t.Run("already removed", func(t *testing.T) {
+		reply, err := handler(t.Context(), BotCallback{Namespace: "wallet", Data: "delete:404"})
+		require.NoError(t, err)
+		assert.Equal(t, "\\#404 was already removed\\.", reply.Text)
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		_, err := handler(t.Context(), BotCallback{Namespace: "wallet", Data: "redo:1"})
+		assert.Error(t, err)
+		_, err = handler(t.Context(), BotCallback{Namespace: "wallet", Data: "undo:abc"})
+		assert.Error(t, err)
+	})
+}
@@ -26,7 +26,7 @@ func TestWalletDashboard(t *testing.T) {
 	}
 	svc := &WalletServiceImpl{WalletRepo: repo}
 
-	view, err := svc.Dashboard(202406)
+	view, err := svc.Dashboard(t.Context(), 202406)
 	require.NoError(t, err)
 
 	// Savings = sum of Done entries per account.
@@ -71,7 +71,7 @@ func TestWalletDashboardErrors(t *testing.T) {
 		svc := &WalletServiceImpl{WalletRepo: &fakeWalletRepo{
 			getAllFn: func() ([]repository.Wallet, error) { return nil, boom },
 		}}
-		_, err := svc.Dashboard(202406)
+		_, err := svc.Dashboard(t.Context(), 202406)
 		assert.ErrorIs(t, err, boom)
 	})
 
@@ -80,7 +80,7 @@ func TestWalletDashboardErrors(t *testing.T) {
 			getAllFn:         func() ([]repository.Wallet, error) { return nil, nil },
 			getAllocationsFn: func() (map[string]int, error) { return nil, boom },
 		}}
-		_, err := svc.Dashboard(202406)
+		_, err := svc.Dashboard(t.Context(), 202406)
 		assert.ErrorIs(t, err, boom)
 	})
 }
@@ -92,7 +92,7 @@ func TestWalletCreateUpdateDelete(t *testing.T) {
 			return 42, nil
 		}}
 		svc := &WalletServiceImpl{WalletRepo: repo}
-		id, err := svc.Create(DashboardWallet{Name: "x"})
+		id, err := svc.Create(t.Context(), DashboardWallet{Name: "x"})
 		require.NoError(t, err)
 		assert.Equal(t, 42, id)
 	})
@@ -102,15 +102,34 @@ func TestWalletCreateUpdateDelete(t *testing.T) {
 			return -1, repository.ErrNotFound
 		}}
 		svc := &WalletServiceImpl{WalletRepo: repo}
-		_, err := svc.Update(DashboardWallet{ID: ptr(1)})
+		_, err := svc.Update(t.Context(), DashboardWallet{ID: ptr(1)})
 		assert.ErrorIs(t, err, repository.ErrNotFound)
 	})
 
 	t.Run("delete success", func(t *testing.T) {
 		repo := &fakeWalletRepo{deleteFn: func(id int) (int, error) { return id, nil }}
 		svc := &WalletServiceImpl{WalletRepo: repo}
-		id, err := svc.Delete(7)
+		id, err := svc.Delete(t.Context(), 7)
 		require.NoError(t, err)
 		assert.Equal(t, 7, id)
 	})
 }
+
+func TestWalletExport(t *testing.T) {
+	wallets := []repository.Wallet{
+		{ID: ptr(1), Date: 202406, Name: "b", Category: "Rent", Currency: "SGD", Amount: -50, Account: "DBS"},
+		{ID: ptr(2), Date: 202405, Name: "a", Category: "Daily", Currency: "SGD", Amount: -100, Done: true, Account: "DBS"},
+		{ID: ptr(3), Date: 202406, Name: "c", Category: "Travel", Currency: "IDR", Amount: -25400, Account: "BCA"},
+	}
+	svc := &WalletServiceImpl{WalletRepo: &fakeWalletRepo{getAllFn: func() ([]repository.Wallet, error) { return wallets, nil }}}
+
+	got, err := svc.Export(t.Context())
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, []int{2, 1, 3}, []int{*got[0].ID, *got[1].ID, *got[2].ID}, "by month, keeping order within a month")
+
+	boom := errors.New("boom")
+	svc.WalletRepo = &fakeWalletRepo{getAllFn: func() ([]repository.Wallet, error) { return nil, boom }}
+	_, err = svc.Export(t.Context())
+	assert.ErrorIs(t, err, boom)
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// logLevel is the level of every logger made by NewLogger. It starts at info,
+// is set from LOG_LEVEL at startup and can be changed while running.
+var logLevel = new(slog.LevelVar)
+
+// LogLevel is the current log level.
+func LogLevel() slog.Level { return logLevel.Level() }
+
+// SetLogLevel changes the log level of every logger made by NewLogger.
+func SetLogLevel(level slog.Level) { logLevel.Set(level) }
+
+// ParseLogLevel parses debug, info, warn or error, in any case.
+func ParseLogLevel(raw string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(raw))
+	return level, err
+}
+
+// NewLogger logs JSON lines to w at the runtime log level, adding the request
+// or job run id carried by the context of each record.
+func NewLogger(w io.Writer) *slog.Logger {
+	return slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: logLevel})})
+}
+
+// SetupLogging makes a JSON logger on stderr the default, for both slog and
+// the log package.
+func SetupLogging() {
+	slog.SetDefault(NewLogger(os.Stderr))
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	runIDKey
+)
+
+// WithRequestID returns ctx carrying the id of the HTTP request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID is the request id carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithRunID returns ctx carrying the id of the job run being executed.
+func WithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey, id)
+}
+
+// RunID is the job run id carried by ctx, or "".
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey).(string)
+	return id
+}
+
+// NewID returns a random id for a request or a job run.
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// contextHandler adds request_id and run_id to records logged with a context
+// that carries them.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id := RunID(ctx); id != "" {
+		r.AddAttrs(slog.String("run_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLoggerAddsContextIDs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf).With("service", "stock")
+
+	ctx := WithRunID(WithRequestID(context.Background(), "req-1"), "run-1")
+	logger.InfoContext(ctx, "refreshed", "ticker", "BBCA")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "refreshed", record["msg"])
+	assert.Equal(t, "stock", record["service"])
+	assert.Equal(t, "BBCA", record["ticker"])
+	assert.Equal(t, "req-1", record["request_id"])
+	assert.Equal(t, "run-1", record["run_id"])
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer SetLogLevel(LogLevel())
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf)
+
+	SetLogLevel(slog.LevelInfo)
+	logger.Debug("hidden")
+	assert.Empty(t, buf.String())
+
+	SetLogLevel(slog.LevelDebug)
+	logger.Debug("shown")
+	assert.Contains(t, buf.String(), `"msg":"shown"`)
+	assert.NotContains(t, buf.String(), "hidden")
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for raw, want := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "Warn": slog.LevelWarn, "error": slog.LevelError} {
+		level, err := ParseLogLevel(raw)
+		require.NoError(t, err, raw)
+		assert.Equal(t, want, level, raw)
+	}
+	_, err := ParseLogLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestNewID(t *testing.T) {
+	a, b := NewID(), NewID()
+	assert.Len(t, a, 16)
+	assert.NotEqual(t, a, b)
+	assert.Empty(t, strings.Trim(a, "0123456789abcdef"))
+	assert.Empty(t, RequestID(context.Background()))
+}
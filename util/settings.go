@@ -1,18 +1,57 @@
 package util
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type AppsSettings struct {
 	DBSettings       DatabaseSettings
 	WalletSettings   WalletSettings
-	TelegramSettings TelegramSettings
-	IGSettings       IGSettings
+	TelegramSettings TelegramSettings // zero unless Features.Telegram
+	IGSettings       IGSettings       // zero unless Features.Instagram
+	NotifySettings   NotifySettings
+	Features         FeatureSettings
+	MetricsToken     string     // bearer token /metrics requires; open when empty
+	LogLevel         slog.Level // LOG_LEVEL, info by default; changeable at runtime
+	JobTimeouts      JobTimeouts
+}
+
+// defaultJobTimeout bounds a job run unless JOB_TIMEOUT says otherwise. It
+// leaves room for an Instagram run, which waits up to 90s between accounts.
+const defaultJobTimeout = 30 * time.Minute
+
+// JobTimeouts is how long a scheduled job may run before it is cancelled.
+type JobTimeouts struct {
+	Default time.Duration            // JOB_TIMEOUT
+	ByJob   map[string]time.Duration // JOB_TIMEOUTS, e.g. "instagram=1h,news=2m"
+}
+
+// For is the timeout of job.
+func (t JobTimeouts) For(job string) time.Duration {
+	if d, ok := t.ByJob[job]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// FeatureSettings says which parts of the app are wired. Each can be forced
+// with a FEATURE_* variable; left unset, a feature is on when its secrets are
+// present (Telegram, Instagram), when it has somewhere to notify (news), or
+// always (stock).
+type FeatureSettings struct {
+	Telegram  bool // bot, webhook or poller, Telegram notifications and the outbox
+	Instagram bool // Instagram fetcher, needs Telegram
+	News      bool // daily news
+	Stock     bool // stock dashboard API and daily stock alerts
 }
 
 type IGSettings struct {
@@ -20,11 +59,26 @@ type IGSettings struct {
 	CSRFToken string
 }
 
+// Database backends, chosen with DATABASE_BACKEND.
+const (
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory" // wallets, stocks and Instagram accounts only
+)
+
+// DatabaseSettings come from DATABASE_URL or, without it, from DATABASE_HOST,
+// DATABASE_PORT, DATABASE_NAME, DATABASE_USER and DATABASE_PASS. None of them
+// are needed with the memory backend.
 type DatabaseSettings struct {
-	Host string
-	Name string
-	Pass string
-	User string
+	Backend     string
+	File        string // JSON file the memory backend is kept in; memory only when empty
+	URL         string // DATABASE_URL as given, if set
+	Host        string
+	Port        int
+	Name        string
+	Pass        string
+	User        string
+	SSLMode     string // overrides the sslmode of DSN when set
+	AutoMigrate bool   // apply pending migrations on boot
 }
 
 type WalletSettings struct {
@@ -37,106 +91,396 @@ type TelegramSettings struct {
 	Botname        string
 	PersonalChatID int64
 	GroupChatID    int64
+	WebhookSecret  string
+	PollUpdates    bool    // use getUpdates long polling instead of the webhook
+	AllowedChatIDs []int64 // chats the bot accepts updates from; defaults to the personal and group chats
+	ReadyCheck     bool    // /readyz also requires getMe to answer
+}
+
+// Notification channels a service can be routed to.
+const (
+	NotifyTelegramPersonal = "telegram:personal"
+	NotifyTelegramGroup    = "telegram:group"
+	NotifyWebhook          = "webhook"
+	NotifyDiscord          = "discord"
+	NotifyEmail            = "email"
+)
+
+type NotifySettings struct {
+	// Routes maps a service ("news", "stock", "instagram") to the channels its
+	// notifications go to, e.g. NOTIFY_STOCK=email,telegram:personal.
+	Routes            map[string][]string
+	WebhookURL        string
+	DiscordWebhookURL string
+	SMTP              SMTPSettings
+	// QuietHours holds the quiet hours of the Telegram chats, keyed by chat
+	// ("personal", "group") or by chat and source ("personal.stock"), the
+	// latter taking precedence, e.g.
+	// NOTIFY_QUIET_HOURS=personal=22:00-07:00,personal.stock=off.
+	QuietHours map[string]QuietHours
+}
+
+// QuietHours is a daily window, in Asia/Jakarta time, during which non-urgent
+// notifications are held back. Start and End are minutes after midnight and
+// the window may wrap past midnight; Start == End is never quiet.
+type QuietHours struct {
+	Start int
+	End   int
+}
+
+// ParseQuietHours parses "22:00-07:00", or "off" for no quiet hours.
+func ParseQuietHours(raw string) (QuietHours, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "off" {
+		return QuietHours{}, nil
+	}
+
+	startRaw, endRaw, ok := strings.Cut(raw, "-")
+	if !ok {
+		return QuietHours{}, fmt.Errorf("quiet hours %q are not in the form HH:MM-HH:MM", raw)
+	}
+	start, err := parseClock(startRaw)
+	if err != nil {
+		return QuietHours{}, err
+	}
+	end, err := parseClock(endRaw)
+	if err != nil {
+		return QuietHours{}, err
+	}
+	return QuietHours{Start: start, End: end}, nil
+}
+
+func parseClock(raw string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", raw)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+type SMTPSettings struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
 }
 
 var (
 	once    sync.Once
 	config  AppsSettings
-	fatalFn = log.Fatal
+	fatalFn = func(v ...any) {
+		slog.Error(fmt.Sprint(v...))
+		os.Exit(1)
+	}
 )
 
+// GetAppSettings loads the settings once and exits listing every problem when
+// they are invalid.
 func GetAppSettings() AppsSettings {
 	once.Do(func() {
-		config = getAppSettings()
+		var err error
+		config, err = LoadAppSettings()
+		if err != nil {
+			fatalFn(err)
+		}
 	})
 	return config
 }
 
-func getAppSettings() AppsSettings {
-	dbHost := os.Getenv("DATABASE_HOST")
-	if dbHost == "" {
-		fatalFn("DATABASE_HOST is not set")
+// LoadAppSettings reads the settings from the environment and CONFIG_FILE. The
+// error, if any, is a *ConfigError listing every problem found.
+func LoadAppSettings() (AppsSettings, error) {
+	c := newConfigSource()
+
+	settings := AppsSettings{
+		DBSettings: loadDatabaseSettings(c),
+		WalletSettings: WalletSettings{
+			SecretKey: c.require("APPS_SECRET_KEY"),
+			Password:  c.require("APPS_PASSWORD"),
+		},
+		MetricsToken: c.get("METRICS_TOKEN"),
+	}
+	if raw := c.get("LOG_LEVEL"); raw != "" {
+		level, err := ParseLogLevel(raw)
+		if err != nil {
+			c.problemf("LOG_LEVEL %q is not debug, info, warn or error", raw)
+		}
+		settings.LogLevel = level
+	}
+
+	settings.JobTimeouts = loadJobTimeouts(c)
+
+	features := &settings.Features
+	features.Telegram = c.feature("FEATURE_TELEGRAM", c.isSet("TELEGRAM_BOT_ENDPOINT", "TELEGRAM_BOT_NAME", "TELEGRAM_PERSONAL_CHAT_ID", "TELEGRAM_GROUP_CHAT_ID"))
+	if features.Telegram {
+		settings.TelegramSettings = loadTelegramSettings(c)
+		// The outbox, digest and polling offsets are kept in Postgres only.
+		if settings.DBSettings.Backend == BackendMemory {
+			c.problemf("FEATURE_TELEGRAM needs the postgres DATABASE_BACKEND")
+		}
 	}
 
-	dbName := os.Getenv("DATABASE_NAME")
-	if dbName == "" {
-		fatalFn("DATABASE_NAME is not set")
+	features.Instagram = c.feature("FEATURE_INSTAGRAM", c.isSet("IG_SESSION_ID", "IG_CSRF_TOKEN"))
+	if features.Instagram {
+		settings.IGSettings = IGSettings{
+			SessionID: c.require("IG_SESSION_ID"),
+			CSRFToken: c.require("IG_CSRF_TOKEN"),
+		}
+		if !features.Telegram {
+			c.problemf("FEATURE_INSTAGRAM needs Telegram, which is not configured")
+		}
 	}
 
-	dbPass := os.Getenv("DATABASE_PASS")
-	if dbPass == "" {
-		fatalFn("DATABASE_PASS is not set")
+	settings.NotifySettings = loadNotifySettings(c, features.Telegram)
+
+	features.News = c.feature("FEATURE_NEWS", len(settings.NotifySettings.Routes["news"]) > 0)
+	if features.News && len(settings.NotifySettings.Routes["news"]) == 0 {
+		c.problemf("FEATURE_NEWS is on but news has no notification channel")
 	}
+	features.Stock = c.feature("FEATURE_STOCK", true)
 
-	dbUser := os.Getenv("DATABASE_USER")
-	if dbUser == "" {
-		fatalFn("DATABASE_USER is not set")
+	return settings, c.err()
+}
+
+func loadJobTimeouts(c *configSource) JobTimeouts {
+	timeouts := JobTimeouts{Default: defaultJobTimeout, ByJob: make(map[string]time.Duration)}
+	if raw := c.get("JOB_TIMEOUT"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			c.problemf("JOB_TIMEOUT %q is not a positive duration such as 30m", raw)
+		} else {
+			timeouts.Default = d
+		}
 	}
 
-	walletSecret := os.Getenv("APPS_SECRET_KEY")
-	if walletSecret == "" {
-		fatalFn("APPS_SECRET_KEY is not set")
+	for _, rule := range parseList(c.get("JOB_TIMEOUTS")) {
+		job, raw, _ := strings.Cut(rule, "=")
+		d, err := time.ParseDuration(raw)
+		switch {
+		case job != "news" && job != "stock" && job != "instagram" && job != "digest":
+			c.problemf("JOB_TIMEOUTS is invalid: %q is not a job", job)
+		case err != nil || d <= 0:
+			c.problemf("JOB_TIMEOUTS is invalid: %q is not job=duration, e.g. instagram=1h", rule)
+		default:
+			timeouts.ByJob[job] = d
+		}
 	}
+	return timeouts
+}
 
-	walletPassword := os.Getenv("APPS_PASSWORD")
-	if walletPassword == "" {
-		fatalFn("APPS_PASSWORD is not set")
+func loadDatabaseSettings(c *configSource) DatabaseSettings {
+	settings := DatabaseSettings{
+		Backend:     c.get("DATABASE_BACKEND"),
+		AutoMigrate: c.bool("DATABASE_AUTO_MIGRATE", true),
+		SSLMode:     c.get("DATABASE_SSLMODE"),
+	}
+	switch settings.Backend {
+	case "":
+		settings.Backend = BackendPostgres
+	case BackendPostgres:
+	case BackendMemory:
+		settings.File = c.get("DATABASE_FILE")
+		return settings
+	default:
+		c.problemf("DATABASE_BACKEND %q is neither %s nor %s", settings.Backend, BackendPostgres, BackendMemory)
 	}
 
-	telegramEndpoint := os.Getenv("TELEGRAM_BOT_ENDPOINT")
-	if telegramEndpoint == "" {
-		fatalFn("TELEGRAM_BOT_ENDPOINT is not set")
+	switch settings.SSLMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		c.problemf("DATABASE_SSLMODE %q is not a Postgres sslmode", settings.SSLMode)
 	}
 
-	telegramBotname := os.Getenv("TELEGRAM_BOT_NAME")
-	if telegramBotname == "" {
-		fatalFn("TELEGRAM_BOT_NAME is not set")
+	if raw := c.get("DATABASE_URL"); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") || u.Host == "" {
+			c.problemf("DATABASE_URL is not a postgres:// URL")
+			return settings
+		}
+		settings.URL = raw
+		settings.Host = u.Hostname()
+		settings.Port = 5432
+		if port := u.Port(); port != "" {
+			settings.Port, _ = strconv.Atoi(port)
+		}
+		settings.Name = strings.TrimPrefix(u.Path, "/")
+		settings.User = u.User.Username()
+		settings.Pass, _ = u.User.Password()
+		return settings
 	}
 
-	telegramPersonalChatIdStr := os.Getenv("TELEGRAM_PERSONAL_CHAT_ID")
-	telegramPersonalChatId, err := strconv.ParseInt(telegramPersonalChatIdStr, 10, 64)
-	if err != nil {
-		fatalFn("TELEGRAM_PERSONAL_CHAT_ID is not set")
+	settings.Host = c.require("DATABASE_HOST")
+	settings.Port = c.int("DATABASE_PORT", 5432)
+	settings.Name = c.require("DATABASE_NAME")
+	settings.User = c.require("DATABASE_USER")
+	settings.Pass = c.require("DATABASE_PASS")
+	return settings
+}
+
+// DSN is the connection string for lib/pq. sslmode defaults to require, as
+// Heroku Postgres needs, unless DATABASE_SSLMODE or DATABASE_URL says otherwise.
+func (d DatabaseSettings) DSN() string {
+	u := &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(d.User, d.Pass),
+		Host:   net.JoinHostPort(d.Host, strconv.Itoa(d.Port)),
+		Path:   d.Name,
+	}
+	if d.URL != "" {
+		u, _ = url.Parse(d.URL)
 	}
 
-	telegramGroupChatIdStr := os.Getenv("TELEGRAM_GROUP_CHAT_ID")
-	telegramGroupChatId, err := strconv.ParseInt(telegramGroupChatIdStr, 10, 64)
-	if err != nil {
-		fatalFn("TELEGRAM_GROUP_CHAT_ID is not set")
+	query := u.Query()
+	switch {
+	case d.SSLMode != "":
+		query.Set("sslmode", d.SSLMode)
+	case query.Get("sslmode") == "":
+		query.Set("sslmode", "require")
 	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
 
-	igSessionID := os.Getenv("IG_SESSION_ID")
-	if igSessionID == "" {
-		fatalFn("IG_SESSION_ID is not set")
+func loadTelegramSettings(c *configSource) TelegramSettings {
+	settings := TelegramSettings{
+		Endpoint:       c.require("TELEGRAM_BOT_ENDPOINT"),
+		Botname:        c.require("TELEGRAM_BOT_NAME"),
+		PersonalChatID: c.requireInt64("TELEGRAM_PERSONAL_CHAT_ID"),
+		GroupChatID:    c.requireInt64("TELEGRAM_GROUP_CHAT_ID"),
+		PollUpdates:    c.bool("TELEGRAM_POLL_UPDATES", false),
+		ReadyCheck:     c.bool("TELEGRAM_READY_CHECK", false),
 	}
 
-	igCSRFToken := os.Getenv("IG_CSRF_TOKEN")
-	if igCSRFToken == "" {
-		fatalFn("IG_CSRF_TOKEN is not set")
+	// The secret only guards the webhook, which is not used in polling mode.
+	if settings.PollUpdates {
+		settings.WebhookSecret = c.get("TELEGRAM_WEBHOOK_SECRET")
+	} else {
+		settings.WebhookSecret = c.require("TELEGRAM_WEBHOOK_SECRET")
 	}
 
-	return AppsSettings{
-		DBSettings: DatabaseSettings{
-			Host: dbHost,
-			Name: dbName,
-			Pass: dbPass,
-			User: dbUser,
-		},
-		WalletSettings: WalletSettings{
-			SecretKey: walletSecret,
-			Password:  walletPassword,
-		},
-		TelegramSettings: TelegramSettings{
-			Endpoint:       telegramEndpoint,
-			Botname:        telegramBotname,
-			PersonalChatID: telegramPersonalChatId,
-			GroupChatID:    telegramGroupChatId,
-		},
-		IGSettings: IGSettings{
-			SessionID: igSessionID,
-			CSRFToken: igCSRFToken,
+	settings.AllowedChatIDs = []int64{settings.PersonalChatID, settings.GroupChatID}
+	if raw := c.get("TELEGRAM_ALLOWED_CHAT_IDS"); raw != "" {
+		ids, err := parseInt64List(raw)
+		if err != nil {
+			c.problemf("TELEGRAM_ALLOWED_CHAT_IDS is invalid: %v", err)
+		}
+		settings.AllowedChatIDs = ids
+	}
+	return settings
+}
+
+// loadNotifySettings reads where each service sends its notifications. Without
+// any NOTIFY_* variables news goes to the group chat and everything else to
+// the personal chat, and no chat has quiet hours. Default Telegram routes are
+// dropped when Telegram is not configured; explicit ones are a problem.
+func loadNotifySettings(c *configSource, telegram bool) NotifySettings {
+	settings := NotifySettings{
+		Routes:            make(map[string][]string),
+		WebhookURL:        c.get("NOTIFY_WEBHOOK_URL"),
+		DiscordWebhookURL: c.get("NOTIFY_DISCORD_WEBHOOK_URL"),
+		SMTP: SMTPSettings{
+			Host:     c.get("SMTP_HOST"),
+			Port:     c.int("SMTP_PORT", 587),
+			Username: c.get("SMTP_USERNAME"),
+			Password: c.get("SMTP_PASSWORD"),
+			From:     c.get("SMTP_FROM"),
+			To:       parseList(c.get("SMTP_TO")),
 		},
 	}
+
+	defaults := map[string]string{
+		"news":      NotifyTelegramGroup,
+		"stock":     NotifyTelegramPersonal,
+		"instagram": NotifyTelegramPersonal,
+	}
+	for source, fallback := range defaults {
+		key := "NOTIFY_" + strings.ToUpper(source)
+		raw := c.get(key)
+		explicit := raw != ""
+		if !explicit {
+			raw = fallback
+		}
+
+		channels := []string{}
+		for _, channel := range parseList(raw) {
+			isTelegram := channel == NotifyTelegramPersonal || channel == NotifyTelegramGroup
+			switch problem := settings.checkChannel(channel); {
+			case problem != "":
+				c.problemf("%s is invalid: %s", key, problem)
+			case isTelegram && !telegram && explicit:
+				c.problemf("%s routes to %s but Telegram is not configured", key, channel)
+			case isTelegram && !telegram:
+			default:
+				channels = append(channels, channel)
+			}
+		}
+		settings.Routes[source] = channels
+	}
+
+	settings.QuietHours = make(map[string]QuietHours)
+	for _, rule := range parseList(c.get("NOTIFY_QUIET_HOURS")) {
+		key, value, ok := strings.Cut(rule, "=")
+		chat, source, _ := strings.Cut(key, ".")
+		if _, known := defaults[source]; !ok || (chat != "personal" && chat != "group") || (source != "" && !known) {
+			c.problemf("NOTIFY_QUIET_HOURS is invalid: %q is not chat[.source]=HH:MM-HH:MM", rule)
+			continue
+		}
+		hours, err := ParseQuietHours(value)
+		if err != nil {
+			c.problemf("NOTIFY_QUIET_HOURS is invalid: %v", err)
+			continue
+		}
+		settings.QuietHours[key] = hours
+	}
+	return settings
+}
+
+// checkChannel reports why channel cannot be used, or "" when it can.
+func (s NotifySettings) checkChannel(channel string) string {
+	switch channel {
+	case NotifyTelegramPersonal, NotifyTelegramGroup:
+	case NotifyWebhook:
+		if s.WebhookURL == "" {
+			return "webhook needs NOTIFY_WEBHOOK_URL"
+		}
+	case NotifyDiscord:
+		if s.DiscordWebhookURL == "" {
+			return "discord needs NOTIFY_DISCORD_WEBHOOK_URL"
+		}
+	case NotifyEmail:
+		if s.SMTP.Host == "" || s.SMTP.From == "" || len(s.SMTP.To) == 0 {
+			return "email needs SMTP_HOST, SMTP_FROM and SMTP_TO"
+		}
+	default:
+		return "unknown channel " + strconv.Quote(channel)
+	}
+	return ""
+}
+
+// parseList splits a comma-separated list, dropping blanks.
+func parseList(raw string) []string {
+	var items []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// parseInt64List parses a comma-separated list such as "123,-100456".
+func parseInt64List(raw string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(raw, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
 }
 
 func GetFrontendPath() string {
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,6 +25,7 @@ func TestGetAppSettings(t *testing.T) {
 		"TELEGRAM_BOT_NAME":         "botname",
 		"TELEGRAM_PERSONAL_CHAT_ID": "123",
 		"TELEGRAM_GROUP_CHAT_ID":    "456",
+		"TELEGRAM_WEBHOOK_SECRET":   "hook-secret",
 		"IG_SESSION_ID":             "sess",
 		"IG_CSRF_TOKEN":             "csrf",
 	}
@@ -46,18 +48,21 @@ func TestGetAppSettings(t *testing.T) {
 	assert.Equal(t, "db-name", settings.DBSettings.Name)
 	assert.Equal(t, "db-pass", settings.DBSettings.Pass)
 	assert.Equal(t, "db-user", settings.DBSettings.User)
+	assert.True(t, settings.DBSettings.AutoMigrate, "migrations run on boot by default")
 	assert.Equal(t, "secret-key", settings.WalletSettings.SecretKey)
 	assert.Equal(t, "password", settings.WalletSettings.Password)
 	assert.Equal(t, "https://api.telegram.org/bot", settings.TelegramSettings.Endpoint)
 	assert.Equal(t, "botname", settings.TelegramSettings.Botname)
 	assert.Equal(t, int64(123), settings.TelegramSettings.PersonalChatID)
 	assert.Equal(t, int64(456), settings.TelegramSettings.GroupChatID)
+	assert.Equal(t, "hook-secret", settings.TelegramSettings.WebhookSecret)
+	assert.Equal(t, []int64{123, 456}, settings.TelegramSettings.AllowedChatIDs)
 	assert.Equal(t, "sess", settings.IGSettings.SessionID)
 	assert.Equal(t, "csrf", settings.IGSettings.CSRFToken)
 }
 
 func TestGetAppSettingsMissingEnvPanics(t *testing.T) {
-	for _, key := range []string{"DATABASE_HOST", "DATABASE_NAME", "DATABASE_PASS", "DATABASE_USER", "APPS_SECRET_KEY", "APPS_PASSWORD", "TELEGRAM_BOT_ENDPOINT", "TELEGRAM_BOT_NAME", "TELEGRAM_PERSONAL_CHAT_ID", "TELEGRAM_GROUP_CHAT_ID", "IG_SESSION_ID", "IG_CSRF_TOKEN"} {
+	for _, key := range []string{"DATABASE_HOST", "DATABASE_NAME", "DATABASE_PASS", "DATABASE_USER", "APPS_SECRET_KEY", "APPS_PASSWORD", "TELEGRAM_BOT_ENDPOINT", "TELEGRAM_BOT_NAME", "TELEGRAM_PERSONAL_CHAT_ID", "TELEGRAM_GROUP_CHAT_ID", "TELEGRAM_WEBHOOK_SECRET", "IG_SESSION_ID", "IG_CSRF_TOKEN"} {
 		_ = os.Unsetenv(key)
 	}
 	defer func() {
@@ -71,6 +76,44 @@ func TestGetAppSettingsMissingEnvPanics(t *testing.T) {
 	assert.Panics(t, func() { GetAppSettings() })
 }
 
+func TestGetAppSettingsPollingModeSkipsWebhookSecret(t *testing.T) {
+	env := map[string]string{
+		"DATABASE_HOST":             "db-host",
+		"DATABASE_NAME":             "db-name",
+		"DATABASE_PASS":             "db-pass",
+		"DATABASE_USER":             "db-user",
+		"APPS_SECRET_KEY":           "secret-key",
+		"APPS_PASSWORD":             "password",
+		"TELEGRAM_BOT_ENDPOINT":     "https://api.telegram.org/bot",
+		"TELEGRAM_BOT_NAME":         "botname",
+		"TELEGRAM_PERSONAL_CHAT_ID": "123",
+		"TELEGRAM_GROUP_CHAT_ID":    "456",
+		"TELEGRAM_POLL_UPDATES":     "true",
+		"TELEGRAM_ALLOWED_CHAT_IDS": "123,789",
+		"IG_SESSION_ID":             "sess",
+		"IG_CSRF_TOKEN":             "csrf",
+	}
+	_ = os.Unsetenv("TELEGRAM_WEBHOOK_SECRET")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	settings, err := LoadAppSettings()
+	require.NoError(t, err)
+	assert.True(t, settings.TelegramSettings.PollUpdates)
+	assert.Empty(t, settings.TelegramSettings.WebhookSecret)
+	assert.Equal(t, []int64{123, 789}, settings.TelegramSettings.AllowedChatIDs)
+}
+
+func TestParseInt64List(t *testing.T) {
+	ids, err := parseInt64List("123, -100456")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{123, -100456}, ids)
+
+	_, err = parseInt64List("123,abc")
+	assert.Error(t, err)
+}
+
 func TestGetFrontendPath(t *testing.T) {
 	wd, err := os.Getwd()
 	require.NoError(t, err)
@@ -78,3 +121,136 @@ func TestGetFrontendPath(t *testing.T) {
 	got := GetFrontendPath()
 	assert.Equal(t, filepath.Join(wd, "ui", ".build"), got)
 }
+
+// notifySettings loads the notification settings alone, with Telegram on.
+func notifySettings() (NotifySettings, error) {
+	c := newConfigSource()
+	settings := loadNotifySettings(c, true)
+	return settings, c.err()
+}
+
+func TestGetNotifySettingsDefaults(t *testing.T) {
+	settings, err := notifySettings()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]string{
+		"news":      {NotifyTelegramGroup},
+		"stock":     {NotifyTelegramPersonal},
+		"instagram": {NotifyTelegramPersonal},
+	}, settings.Routes)
+	assert.Equal(t, 587, settings.SMTP.Port)
+}
+
+func TestGetNotifySettingsRoutes(t *testing.T) {
+	t.Setenv("NOTIFY_STOCK", "email, telegram:personal")
+	t.Setenv("NOTIFY_NEWS", "telegram:group,discord,webhook")
+	t.Setenv("NOTIFY_WEBHOOK_URL", "https://hooks.example.com/seanmc")
+	t.Setenv("NOTIFY_DISCORD_WEBHOOK_URL", "https://discord.com/api/webhooks/1/x")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", "2525")
+	t.Setenv("SMTP_FROM", "bot@example.com")
+	t.Setenv("SMTP_TO", "me@example.com, you@example.com")
+
+	settings, err := notifySettings()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{NotifyEmail, NotifyTelegramPersonal}, settings.Routes["stock"])
+	assert.Equal(t, []string{NotifyTelegramGroup, NotifyDiscord, NotifyWebhook}, settings.Routes["news"])
+	assert.Equal(t, []string{NotifyTelegramPersonal}, settings.Routes["instagram"])
+	assert.Equal(t, "https://hooks.example.com/seanmc", settings.WebhookURL)
+	assert.Equal(t, SMTPSettings{Host: "smtp.example.com", Port: 2525, From: "bot@example.com", To: []string{"me@example.com", "you@example.com"}}, settings.SMTP)
+}
+
+func TestGetNotifySettingsInvalid(t *testing.T) {
+	tests := map[string]map[string]string{
+		"unknown channel":     {"NOTIFY_NEWS": "carrier-pigeon"},
+		"webhook without url": {"NOTIFY_STOCK": "webhook"},
+		"discord without url": {"NOTIFY_STOCK": "discord"},
+		"email without smtp":  {"NOTIFY_INSTAGRAM": "email", "SMTP_HOST": "smtp.example.com"},
+		"bad smtp port":       {"SMTP_PORT": "smtp"},
+	}
+
+	for name, env := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			_, err := notifySettings()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	tests := map[string]QuietHours{
+		"22:00-07:00":   {Start: 22 * 60, End: 7 * 60},
+		" 13:30-15:00 ": {Start: 13*60 + 30, End: 15 * 60},
+		"off":           {},
+	}
+	for raw, want := range tests {
+		got, err := ParseQuietHours(raw)
+		require.NoError(t, err, raw)
+		assert.Equal(t, want, got, raw)
+	}
+
+	for _, raw := range []string{"", "22:00", "22-07", "25:00-07:00", "late-early"} {
+		_, err := ParseQuietHours(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestGetNotifySettingsQuietHours(t *testing.T) {
+	t.Setenv("NOTIFY_QUIET_HOURS", "personal=22:00-07:00, personal.stock=off, group.instagram=23:00-06:00")
+
+	settings, err := notifySettings()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]QuietHours{
+		"personal":        {Start: 22 * 60, End: 7 * 60},
+		"personal.stock":  {},
+		"group.instagram": {Start: 23 * 60, End: 6 * 60},
+	}, settings.QuietHours)
+}
+
+func TestGetNotifySettingsInvalidQuietHours(t *testing.T) {
+	for _, raw := range []string{"personal", "family=22:00-07:00", "personal.weather=22:00-07:00", "group=22:00"} {
+		t.Run(raw, func(t *testing.T) {
+			t.Setenv("NOTIFY_QUIET_HOURS", raw)
+			_, err := notifySettings()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadJobTimeouts(t *testing.T) {
+	t.Setenv("JOB_TIMEOUT", "10m")
+	t.Setenv("JOB_TIMEOUTS", "instagram=1h, news=90s")
+
+	c := newConfigSource()
+	timeouts := loadJobTimeouts(c)
+	require.NoError(t, c.err())
+	assert.Equal(t, time.Hour, timeouts.For("instagram"))
+	assert.Equal(t, 90*time.Second, timeouts.For("news"))
+	assert.Equal(t, 10*time.Minute, timeouts.For("stock"))
+}
+
+func TestLoadJobTimeoutsInvalid(t *testing.T) {
+	tests := map[string]map[string]string{
+		"default":       {"JOB_TIMEOUT": "half an hour"},
+		"zero default":  {"JOB_TIMEOUT": "0s"},
+		"unknown job":   {"JOB_TIMEOUTS": "weather=1m"},
+		"bad duration":  {"JOB_TIMEOUTS": "news=soon"},
+		"missing value": {"JOB_TIMEOUTS": "news"},
+	}
+	for name, env := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			c := newConfigSource()
+			timeouts := loadJobTimeouts(c)
+			assert.Error(t, c.err())
+			assert.Equal(t, 30*time.Minute, timeouts.For("news"), "a bad value keeps the default")
+		})
+	}
+}